@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 
@@ -11,10 +12,41 @@ import (
 
 type DB struct {
 	*sql.DB
+
+	// Dialect selects the SQL flavour used by queries and migrations
+	Dialect Dialect
+
+	// FullTextSearch reports whether the todos_fts index is available.
+	// It requires SQLite built with FTS5 (the sqlite_fts5 build tag).
+	FullTextSearch bool
 }
 
-// Initialize creates and returns a new database connection
+// Initialize creates and returns a new database connection with all
+// migrations applied
 func Initialize(dbPath string) (*DB, error) {
+	db, err := Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Run migrations
+	if _, err := db.MigrateUp(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	// The search index depends on how SQLite was built, so it is set up
+	// here rather than in a versioned migration
+	if err := db.setupFullTextSearch(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to set up full-text search: %w", err)
+	}
+
+	return db, nil
+}
+
+// Open creates and returns a new database connection without running migrations
+func Open(dbPath string) (*DB, error) {
 	// Create data directory if it doesn't exist
 	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
 		return nil, fmt.Errorf("failed to create data directory: %w", err)
@@ -32,131 +64,79 @@ func Initialize(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	db := &DB{sqlDB}
-
-	// Run migrations
-	if err := db.migrate(); err != nil {
-		sqlDB.Close()
-		return nil, fmt.Errorf("failed to run migrations: %w", err)
-	}
-
-	return db, nil
+	return &DB{DB: sqlDB, Dialect: SQLite}, nil
 }
 
-// migrate runs the database migrations
-func (db *DB) migrate() error {
-	// Create categories table
-	categoriesSchema := `
-	CREATE TABLE IF NOT EXISTS categories (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name VARCHAR(50) NOT NULL UNIQUE,
-		color VARCHAR(7) DEFAULT '#007bff',
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_categories_name ON categories(name);
-
-	-- Insert default categories
-	INSERT OR IGNORE INTO categories (name, color) VALUES 
-		('仕事', '#ff6b6b'),
-		('プライベート', '#4dabf7'),
-		('勉強', '#51cf66'),
-		('その他', '#868e96');
-	`
-
-	if _, err := db.Exec(categoriesSchema); err != nil {
-		return fmt.Errorf("failed to create categories table: %w", err)
-	}
-
-	// Check if category_id column exists in todos table
-	var columnExists bool
+// setupFullTextSearch creates the todos_fts index and the triggers that keep
+// it in sync with the todos table. The trigram tokenizer is used so that
+// Japanese text, which has no word separators, can be searched as well.
+func (db *DB) setupFullTextSearch() error {
+	// Triggers are missing on first run, or when a previous run could not
+	// maintain the index; either way the index must be rebuilt afterwards
+	var triggerCount int
 	err := db.QueryRow(`
-		SELECT COUNT(*) FROM pragma_table_info('todos') 
-		WHERE name='category_id'
-	`).Scan(&columnExists)
+		SELECT COUNT(*) FROM sqlite_master 
+		WHERE type = 'trigger' AND name = 'todos_fts_insert'
+	`).Scan(&triggerCount)
 	if err != nil {
-		return fmt.Errorf("failed to check column existence: %w", err)
+		return fmt.Errorf("failed to check search triggers: %w", err)
 	}
 
-	// Add category_id to todos table if it doesn't exist
-	if !columnExists {
-		alterTableSQL := `
-		ALTER TABLE todos ADD COLUMN category_id INTEGER REFERENCES categories(id);
-		CREATE INDEX IF NOT EXISTS idx_todos_category_id ON todos(category_id);
-		`
-		if _, err := db.Exec(alterTableSQL); err != nil {
-			return fmt.Errorf("failed to add category_id column: %w", err)
-		}
+	var fts5 bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts5); err != nil {
+		return fmt.Errorf("failed to check for FTS5 support: %w", err)
 	}
 
-	// Check if priority column exists in todos table
-	var priorityColumnExists bool
-	err = db.QueryRow(`
-		SELECT COUNT(*) FROM pragma_table_info('todos') 
-		WHERE name='priority'
-	`).Scan(&priorityColumnExists)
-	if err != nil {
-		return fmt.Errorf("failed to check priority column existence: %w", err)
+	if !fts5 {
+		// Without FTS5 the triggers would make every write fail, so drop them
+		// and let searches fall back to LIKE
+		log.Printf("Full-text search unavailable; build with -tags sqlite_fts5 to enable it")
+		_, err := db.Exec(`
+			DROP TRIGGER IF EXISTS todos_fts_insert;
+			DROP TRIGGER IF EXISTS todos_fts_delete;
+			DROP TRIGGER IF EXISTS todos_fts_update;
+		`)
+		return err
 	}
 
-	// Add priority to todos table if it doesn't exist
-	if !priorityColumnExists {
-		alterPrioritySQL := `
-		ALTER TABLE todos ADD COLUMN priority INTEGER DEFAULT 1;
-		CREATE INDEX IF NOT EXISTS idx_todos_priority ON todos(priority);
-		`
-		if _, err := db.Exec(alterPrioritySQL); err != nil {
-			return fmt.Errorf("failed to add priority column: %w", err)
-		}
-	}
+	ftsSchema := `
+	CREATE VIRTUAL TABLE IF NOT EXISTS todos_fts USING fts5(
+		title, description,
+		content='todos', content_rowid='id',
+		tokenize='trigram'
+	);
+	`
 
-	// Check if due_date column exists in todos table
-	var dueDateColumnExists bool
-	err = db.QueryRow(`
-		SELECT COUNT(*) FROM pragma_table_info('todos') 
-		WHERE name='due_date'
-	`).Scan(&dueDateColumnExists)
-	if err != nil {
-		return fmt.Errorf("failed to check due_date column existence: %w", err)
+	if _, err := db.Exec(ftsSchema); err != nil {
+		return fmt.Errorf("failed to create search index: %w", err)
 	}
 
-	// Add due_date to todos table if it doesn't exist
-	if !dueDateColumnExists {
-		alterDueDateSQL := `
-		ALTER TABLE todos ADD COLUMN due_date DATETIME;
-		CREATE INDEX IF NOT EXISTS idx_todos_due_date ON todos(due_date);
-		`
-		if _, err := db.Exec(alterDueDateSQL); err != nil {
-			return fmt.Errorf("failed to add due_date column: %w", err)
-		}
-	}
+	triggersSchema := `
+	CREATE TRIGGER IF NOT EXISTS todos_fts_insert AFTER INSERT ON todos BEGIN
+		INSERT INTO todos_fts(rowid, title, description) VALUES (new.id, new.title, new.description);
+	END;
 
-	// Original todos table schema for new installations
-	todosSchema := `
-	CREATE TABLE IF NOT EXISTS todos (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		title VARCHAR(255) NOT NULL,
-		description TEXT DEFAULT '',
-		category_id INTEGER REFERENCES categories(id),
-		priority INTEGER DEFAULT 1,
-		due_date DATETIME,
-		completed BOOLEAN DEFAULT FALSE,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
+	CREATE TRIGGER IF NOT EXISTS todos_fts_delete AFTER DELETE ON todos BEGIN
+		INSERT INTO todos_fts(todos_fts, rowid, title, description) VALUES ('delete', old.id, old.title, old.description);
+	END;
 
-	CREATE INDEX IF NOT EXISTS idx_todos_completed ON todos(completed);
-	CREATE INDEX IF NOT EXISTS idx_todos_created_at ON todos(created_at);
-	CREATE INDEX IF NOT EXISTS idx_todos_category_id ON todos(category_id);
-	CREATE INDEX IF NOT EXISTS idx_todos_priority ON todos(priority);
-	CREATE INDEX IF NOT EXISTS idx_todos_due_date ON todos(due_date);
+	CREATE TRIGGER IF NOT EXISTS todos_fts_update AFTER UPDATE OF title, description ON todos BEGIN
+		INSERT INTO todos_fts(todos_fts, rowid, title, description) VALUES ('delete', old.id, old.title, old.description);
+		INSERT INTO todos_fts(rowid, title, description) VALUES (new.id, new.title, new.description);
+	END;
 	`
 
-	if _, err := db.Exec(todosSchema); err != nil {
-		return fmt.Errorf("failed to execute todos schema: %w", err)
+	if _, err := db.Exec(triggersSchema); err != nil {
+		return fmt.Errorf("failed to create search triggers: %w", err)
+	}
+
+	if triggerCount == 0 {
+		if _, err := db.Exec(`INSERT INTO todos_fts(todos_fts) VALUES ('rebuild')`); err != nil {
+			return fmt.Errorf("failed to build search index: %w", err)
+		}
 	}
 
+	db.FullTextSearch = true
 	return nil
 }
 
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Dialect identifies the SQL database behind a DB
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// Rebind rewrites the ? placeholders used throughout the stores into the
+// dialect's own style. Question marks inside quoted strings are left alone.
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	inString := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inString = !inString
+		case r == '?' && !inString:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Like returns the case-insensitive LIKE operator of the dialect
+func (d Dialect) Like() string {
+	if d == Postgres {
+		return "ILIKE"
+	}
+	return "LIKE"
+}
+
+// Timestamp returns an expression for the timestamp expr that compares by
+// its value. SQLite stores timestamps as text, which only compares
+// correctly once datetime() has brought it to UTC in one format.
+func (d Dialect) Timestamp(expr string) string {
+	if d == Postgres {
+		return expr
+	}
+	return "datetime(" + expr + ")"
+}
+
+// MinutesBefore returns an expression for the timestamp expr moved back by
+// the non-negative number of minutes in the integer expression minutes,
+// comparable like the expressions of Timestamp
+func (d Dialect) MinutesBefore(expr, minutes string) string {
+	if d == Postgres {
+		return expr + " - " + minutes + " * INTERVAL '1 minute'"
+	}
+	return "datetime(" + expr + ", '-' || " + minutes + " || ' minutes')"
+}
+
+// Exec executes a query with ? placeholders
+func (db *DB) Exec(query string, args ...any) (sql.Result, error) {
+	return db.DB.Exec(db.Dialect.Rebind(query), args...)
+}
+
+// Query runs a query with ? placeholders
+func (db *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	return db.DB.Query(db.Dialect.Rebind(query), args...)
+}
+
+// QueryRow runs a query with ? placeholders that returns at most one row
+func (db *DB) QueryRow(query string, args ...any) *sql.Row {
+	return db.DB.QueryRow(db.Dialect.Rebind(query), args...)
+}
+
+// Tx is a transaction that accepts ? placeholders like DB
+type Tx struct {
+	*sql.Tx
+	dialect Dialect
+}
+
+// Begin starts a transaction
+func (db *DB) Begin() (*Tx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, dialect: db.Dialect}, nil
+}
+
+// Exec executes a query with ? placeholders
+func (tx *Tx) Exec(query string, args ...any) (sql.Result, error) {
+	return tx.Tx.Exec(tx.dialect.Rebind(query), args...)
+}
+
+// Query runs a query with ? placeholders
+func (tx *Tx) Query(query string, args ...any) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.dialect.Rebind(query), args...)
+}
+
+// QueryRow runs a query with ? placeholders that returns at most one row
+func (tx *Tx) QueryRow(query string, args ...any) *sql.Row {
+	return tx.Tx.QueryRow(tx.dialect.Rebind(query), args...)
+}
+
+// IsUniqueViolation reports whether err was caused by a UNIQUE constraint
+func IsUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	return false
+}
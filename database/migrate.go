@@ -0,0 +1,402 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+// Migration is a numbered schema change read from
+// migrations/<dialect>/NNNN_name.{up,down}.sql
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // SHA-256 of the up script
+}
+
+// MigrationStatus describes a migration and whether it has been applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	Modified  bool // the up script changed after it was applied
+}
+
+// loadMigrations reads the embedded migrations, ordered by version
+func loadMigrations(files fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		versionPart, migrationName, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", name)
+		}
+		version, err := strconv.Atoi(versionPart)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", name, err)
+		}
+
+		content, err := fs.ReadFile(files, path.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", name, err)
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: migrationName}
+			byVersion[version] = m
+		} else if m.Name != migrationName {
+			return nil, fmt.Errorf("migration %04d has conflicting names %q and %q", version, m.Name, migrationName)
+		}
+
+		if direction == "up" {
+			m.Up = string(content)
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// appliedMigration is a row of schema_migrations
+type appliedMigration struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// ensureMigrationsTable creates schema_migrations, baselining databases that
+// were created before versioned migrations existed
+func (db *DB) ensureMigrationsTable(migrations []Migration) error {
+	existsQuery := `
+		SELECT COUNT(*) FROM sqlite_master
+		WHERE type = 'table' AND name = 'schema_migrations'
+	`
+	timestampType := "DATETIME"
+	if db.Dialect == Postgres {
+		existsQuery = `
+			SELECT COUNT(*) FROM information_schema.tables
+			WHERE table_schema = current_schema() AND table_name = 'schema_migrations'
+		`
+		timestampType = "TIMESTAMPTZ"
+	}
+
+	var exists int
+	if err := db.QueryRow(existsQuery).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check migrations table: %w", err)
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	if _, err := db.Exec(`
+		CREATE TABLE schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at ` + timestampType + ` DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	// Only SQLite databases predate versioned migrations
+	if db.Dialect != SQLite {
+		return nil
+	}
+	return db.baselineLegacySchema(migrations)
+}
+
+// legacyMarkers identify, for databases created by the old ad-hoc migration
+// code, which versioned migrations their schema already contains
+var legacyMarkers = map[int]struct{ table, column string }{
+	1: {"todos", "id"},
+	2: {"todos", "category_id"},
+	3: {"todos", "priority"},
+	4: {"todos", "due_date"},
+}
+
+// baselineLegacySchema records the migrations whose changes a pre-existing
+// database already has, so they are not applied a second time
+func (db *DB) baselineLegacySchema(migrations []Migration) error {
+	for _, m := range migrations {
+		marker, ok := legacyMarkers[m.Version]
+		if !ok {
+			break
+		}
+
+		var count int
+		err := db.QueryRow(`
+			SELECT COUNT(*) FROM pragma_table_info(?)
+			WHERE name = ?
+		`, marker.table, marker.column).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("failed to inspect existing schema: %w", err)
+		}
+		if count == 0 {
+			break
+		}
+
+		if _, err := db.Exec(
+			`INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)`,
+			m.Version, m.Name, m.Checksum,
+		); err != nil {
+			return fmt.Errorf("failed to record baseline migration: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// appliedMigrations returns the rows of schema_migrations by version
+func (db *DB) appliedMigrations() (map[int]appliedMigration, error) {
+	rows, err := db.Query(`SELECT version, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.checksum, &a.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		applied[version] = a
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return applied, nil
+}
+
+// MigrationStatus reports every known migration and whether it has been applied
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(migrationFiles, path.Join("migrations", string(db.Dialect)))
+	if err != nil {
+		return nil, err
+	}
+	if err := db.ensureMigrationsTable(migrations); err != nil {
+		return nil, err
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		statuses[i] = MigrationStatus{Migration: m}
+		if a, ok := applied[m.Version]; ok {
+			statuses[i].Applied = true
+			statuses[i].AppliedAt = a.appliedAt
+			statuses[i].Modified = a.checksum != m.Checksum
+		}
+	}
+
+	return statuses, nil
+}
+
+// MigrateUp applies all pending migrations in order, each in its own transaction.
+// It refuses to run if an applied migration has been edited since.
+func (db *DB) MigrateUp() (int, error) {
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, s := range statuses {
+		if s.Modified {
+			return 0, fmt.Errorf("migration %04d_%s has been modified since it was applied", s.Version, s.Name)
+		}
+	}
+
+	count := 0
+	for _, s := range statuses {
+		if s.Applied {
+			continue
+		}
+		if err := db.applyMigration(s.Migration); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// MigrateDown rolls back the given number of most recently applied migrations
+func (db *DB) MigrateDown(steps int) (int, error) {
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(statuses) - 1; i >= 0 && count < steps; i-- {
+		s := statuses[i]
+		if !s.Applied {
+			continue
+		}
+		if s.Down == "" {
+			return count, fmt.Errorf("migration %04d_%s cannot be rolled back: no down script", s.Version, s.Name)
+		}
+		if err := db.revertMigration(s.Migration); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// applyMigration runs a migration's up script and records it
+func (db *DB) applyMigration(m Migration) error {
+	tx, done, err := db.beginMigration()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer done()
+
+	if _, err := tx.Exec(m.Up); err != nil {
+		return fmt.Errorf("failed to apply migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+	if err := db.checkForeignKeys(tx); err != nil {
+		return fmt.Errorf("failed to apply migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)`,
+		m.Version, m.Name, m.Checksum,
+	); err != nil {
+		return fmt.Errorf("failed to record migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+
+	return tx.Commit()
+}
+
+// revertMigration runs a migration's down script and forgets it
+func (db *DB) revertMigration(m Migration) error {
+	tx, done, err := db.beginMigration()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer done()
+
+	if _, err := tx.Exec(m.Down); err != nil {
+		return fmt.Errorf("failed to roll back migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+	if err := db.checkForeignKeys(tx); err != nil {
+		return fmt.Errorf("failed to roll back migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.Version); err != nil {
+		return fmt.Errorf("failed to unrecord migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+
+	return tx.Commit()
+}
+
+// beginMigration starts the transaction of a migration script. On SQLite it
+// runs on a connection with foreign keys turned off. Rebuilding a table that
+// others refer to, as the down scripts do, would otherwise fail or cascade
+// into the rows referring to it; checkForeignKeys verifies them before the
+// transaction commits. done rolls back the transaction if it
+// has not been committed and releases the connection.
+func (db *DB) beginMigration() (tx *Tx, done func(), err error) {
+	if db.Dialect != SQLite {
+		tx, err := db.Begin()
+		if err != nil {
+			return nil, nil, err
+		}
+		return tx, func() { tx.Rollback() }, nil
+	}
+
+	ctx := context.Background()
+	conn, err := db.DB.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	sqlTx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+		conn.Close()
+		return nil, nil, err
+	}
+
+	done = func() {
+		sqlTx.Rollback()
+		conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+		conn.Close()
+	}
+	return &Tx{Tx: sqlTx, dialect: db.Dialect}, done, nil
+}
+
+// checkForeignKeys reports the first row a migration script left referring
+// to a missing row. Only SQLite needs it, see beginMigration.
+func (db *DB) checkForeignKeys(tx *Tx) error {
+	if db.Dialect != SQLite {
+		return nil
+	}
+
+	var table, parent string
+	var rowID sql.NullInt64
+	var fkID int
+	err := tx.QueryRow("PRAGMA foreign_key_check").Scan(&table, &rowID, &parent, &fkID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check foreign keys: %w", err)
+	}
+	return fmt.Errorf("row %d of %s refers to a missing row of %s", rowID.Int64, table, parent)
+}
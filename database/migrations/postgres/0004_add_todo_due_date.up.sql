@@ -0,0 +1,2 @@
+ALTER TABLE todos ADD COLUMN due_date TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_todos_due_date ON todos(due_date);
@@ -0,0 +1,3 @@
+-- Subtasks: a todo may belong to a parent todo; deleting the parent deletes the subtree
+ALTER TABLE todos ADD COLUMN parent_id INTEGER REFERENCES todos(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_todos_parent_id ON todos(parent_id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_todos_series_id;
+ALTER TABLE todos DROP COLUMN IF EXISTS occurrence;
+ALTER TABLE todos DROP COLUMN IF EXISTS series_id;
+ALTER TABLE todos DROP COLUMN IF EXISTS recurrence;
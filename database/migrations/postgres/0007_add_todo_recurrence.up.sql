@@ -0,0 +1,6 @@
+-- Recurring todos: the RRULE of the series, the ID of its first todo and
+-- the position of this todo in the series
+ALTER TABLE todos ADD COLUMN recurrence TEXT;
+ALTER TABLE todos ADD COLUMN series_id INTEGER;
+ALTER TABLE todos ADD COLUMN occurrence INTEGER;
+CREATE INDEX IF NOT EXISTS idx_todos_series_id ON todos(series_id);
@@ -0,0 +1,17 @@
+-- This fails when several users have a category or tag of the same name
+ALTER TABLE tags DROP CONSTRAINT IF EXISTS tags_owner_id_name_key;
+ALTER TABLE tags ADD CONSTRAINT tags_name_key UNIQUE (name);
+ALTER TABLE tags DROP COLUMN IF EXISTS owner_id;
+
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_owner_id_name_key;
+ALTER TABLE categories ADD CONSTRAINT categories_name_key UNIQUE (name);
+ALTER TABLE categories DROP COLUMN IF EXISTS owner_id;
+
+DROP INDEX IF EXISTS idx_webhooks_owner_id;
+ALTER TABLE webhooks DROP COLUMN IF EXISTS owner_id;
+
+DROP INDEX IF EXISTS idx_todos_owner_id;
+ALTER TABLE todos DROP COLUMN IF EXISTS owner_id;
+
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,35 @@
+-- User accounts; passwords are stored as bcrypt hashes
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(50) NOT NULL UNIQUE,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Login sessions; id is the SHA-256 of the token kept in the session cookie
+CREATE TABLE IF NOT EXISTS sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+
+-- Todos, categories, tags and webhooks belong to a user. Rows created before
+-- there were accounts have no owner until the first user registers.
+ALTER TABLE todos ADD COLUMN owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_todos_owner_id ON todos(owner_id);
+
+ALTER TABLE webhooks ADD COLUMN owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_webhooks_owner_id ON webhooks(owner_id);
+
+-- Category and tag names become unique per user
+ALTER TABLE categories ADD COLUMN owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_name_key;
+ALTER TABLE categories ADD CONSTRAINT categories_owner_id_name_key UNIQUE (owner_id, name);
+
+ALTER TABLE tags ADD COLUMN owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE tags DROP CONSTRAINT IF EXISTS tags_name_key;
+ALTER TABLE tags ADD CONSTRAINT tags_owner_id_name_key UNIQUE (owner_id, name);
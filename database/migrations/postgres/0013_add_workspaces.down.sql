@@ -0,0 +1,17 @@
+-- Dropping the columns deletes nothing, so delete the todos, categories and
+-- tags of workspaces first; their tags and reminders cascade
+DELETE FROM todos WHERE workspace_id IS NOT NULL;
+DELETE FROM categories WHERE workspace_id IS NOT NULL;
+DELETE FROM tags WHERE workspace_id IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_todos_workspace_id;
+DROP INDEX IF EXISTS idx_categories_workspace_id_name;
+DROP INDEX IF EXISTS idx_tags_workspace_id_name;
+
+ALTER TABLE todos DROP COLUMN IF EXISTS workspace_id;
+ALTER TABLE categories DROP COLUMN IF EXISTS workspace_id;
+ALTER TABLE tags DROP COLUMN IF EXISTS workspace_id;
+
+DROP TABLE IF EXISTS workspace_invitations;
+DROP TABLE IF EXISTS workspace_members;
+DROP TABLE IF EXISTS workspaces;
@@ -0,0 +1,5 @@
+-- The todos in the trash are deleted, with their tags and reminders
+DELETE FROM todos WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_todos_deleted_at;
+ALTER TABLE todos DROP COLUMN IF EXISTS deleted_at;
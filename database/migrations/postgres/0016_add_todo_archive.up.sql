@@ -0,0 +1,4 @@
+-- Archive: completed todos can be moved out of the active list, keeping the
+-- time they were archived
+ALTER TABLE todos ADD COLUMN archived_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_todos_archived_at ON todos(archived_at);
@@ -1,6 +1,3 @@
--- Initial schema for GoTODO application
--- This file contains the base table definitions
-
 -- TODOs table
 CREATE TABLE IF NOT EXISTS todos (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -11,6 +8,5 @@ CREATE TABLE IF NOT EXISTS todos (
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
--- Create index for better query performance
 CREATE INDEX IF NOT EXISTS idx_todos_completed ON todos(completed);
-CREATE INDEX IF NOT EXISTS idx_todos_created_at ON todos(created_at);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_todos_created_at ON todos(created_at);
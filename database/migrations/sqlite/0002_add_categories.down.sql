@@ -0,0 +1,23 @@
+-- SQLite cannot drop a column used by a foreign key, so rebuild the table
+-- with the columns it had before this migration
+DROP INDEX IF EXISTS idx_todos_category_id;
+
+CREATE TABLE todos_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title VARCHAR(255) NOT NULL,
+    description TEXT DEFAULT '',
+    completed BOOLEAN DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO todos_new (id, title, description, completed, created_at, updated_at)
+SELECT id, title, description, completed, created_at, updated_at FROM todos;
+
+DROP TABLE todos;
+ALTER TABLE todos_new RENAME TO todos;
+
+CREATE INDEX IF NOT EXISTS idx_todos_completed ON todos(completed);
+CREATE INDEX IF NOT EXISTS idx_todos_created_at ON todos(created_at);
+
+DROP TABLE IF EXISTS categories;
@@ -0,0 +1,20 @@
+-- Categories table
+CREATE TABLE IF NOT EXISTS categories (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(50) NOT NULL UNIQUE,
+    color VARCHAR(7) DEFAULT '#007bff',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_categories_name ON categories(name);
+
+-- Default categories
+INSERT OR IGNORE INTO categories (name, color) VALUES 
+    ('仕事', '#ff6b6b'),
+    ('プライベート', '#4dabf7'),
+    ('勉強', '#51cf66'),
+    ('その他', '#868e96');
+
+ALTER TABLE todos ADD COLUMN category_id INTEGER REFERENCES categories(id);
+CREATE INDEX IF NOT EXISTS idx_todos_category_id ON todos(category_id);
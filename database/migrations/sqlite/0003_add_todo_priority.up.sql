@@ -0,0 +1,2 @@
+ALTER TABLE todos ADD COLUMN priority INTEGER DEFAULT 1;
+CREATE INDEX IF NOT EXISTS idx_todos_priority ON todos(priority);
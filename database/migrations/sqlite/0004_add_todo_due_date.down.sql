@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_todos_due_date;
+ALTER TABLE todos DROP COLUMN due_date;
@@ -0,0 +1,27 @@
+-- SQLite cannot drop a column used by a foreign key, so rebuild the table
+-- with the columns it had before this migration
+DROP INDEX IF EXISTS idx_todos_parent_id;
+
+CREATE TABLE todos_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title VARCHAR(255) NOT NULL,
+    description TEXT DEFAULT '',
+    completed BOOLEAN DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    category_id INTEGER REFERENCES categories(id),
+    priority INTEGER DEFAULT 1,
+    due_date DATETIME
+);
+
+INSERT INTO todos_new (id, title, description, completed, created_at, updated_at, category_id, priority, due_date)
+SELECT id, title, description, completed, created_at, updated_at, category_id, priority, due_date FROM todos;
+
+DROP TABLE todos;
+ALTER TABLE todos_new RENAME TO todos;
+
+CREATE INDEX IF NOT EXISTS idx_todos_completed ON todos(completed);
+CREATE INDEX IF NOT EXISTS idx_todos_created_at ON todos(created_at);
+CREATE INDEX IF NOT EXISTS idx_todos_category_id ON todos(category_id);
+CREATE INDEX IF NOT EXISTS idx_todos_priority ON todos(priority);
+CREATE INDEX IF NOT EXISTS idx_todos_due_date ON todos(due_date);
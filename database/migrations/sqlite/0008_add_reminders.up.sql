@@ -0,0 +1,16 @@
+-- Reminders fire at a fixed time or a number of minutes before the todo's
+-- due date. sent_at is set when the scheduler claims a reminder, so it fires
+-- once even across restarts or with several servers on one database.
+CREATE TABLE IF NOT EXISTS reminders (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    remind_at DATETIME,
+    minutes_before INTEGER,
+    sent_at DATETIME,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_reminders_todo_id ON reminders(todo_id);
+CREATE INDEX IF NOT EXISTS idx_reminders_pending ON reminders(sent_at);
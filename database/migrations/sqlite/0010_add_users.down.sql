@@ -0,0 +1,84 @@
+-- SQLite cannot drop a column used by a foreign key, so rebuild the tables
+-- with the columns they had before this migration. This fails when several
+-- users have a category or tag of the same name.
+DROP INDEX IF EXISTS idx_todos_owner_id;
+DROP INDEX IF EXISTS idx_webhooks_owner_id;
+
+CREATE TABLE todos_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title VARCHAR(255) NOT NULL,
+    description TEXT DEFAULT '',
+    completed BOOLEAN DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    category_id INTEGER REFERENCES categories(id),
+    priority INTEGER DEFAULT 1,
+    due_date DATETIME,
+    parent_id INTEGER REFERENCES todos(id) ON DELETE CASCADE,
+    recurrence TEXT,
+    series_id INTEGER,
+    occurrence INTEGER
+);
+
+INSERT INTO todos_new (id, title, description, completed, created_at, updated_at, category_id, priority, due_date, parent_id, recurrence, series_id, occurrence)
+SELECT id, title, description, completed, created_at, updated_at, category_id, priority, due_date, parent_id, recurrence, series_id, occurrence FROM todos;
+
+DROP TABLE todos;
+ALTER TABLE todos_new RENAME TO todos;
+
+CREATE INDEX IF NOT EXISTS idx_todos_completed ON todos(completed);
+CREATE INDEX IF NOT EXISTS idx_todos_created_at ON todos(created_at);
+CREATE INDEX IF NOT EXISTS idx_todos_category_id ON todos(category_id);
+CREATE INDEX IF NOT EXISTS idx_todos_priority ON todos(priority);
+CREATE INDEX IF NOT EXISTS idx_todos_due_date ON todos(due_date);
+CREATE INDEX IF NOT EXISTS idx_todos_parent_id ON todos(parent_id);
+CREATE INDEX IF NOT EXISTS idx_todos_series_id ON todos(series_id);
+
+CREATE TABLE categories_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(50) NOT NULL UNIQUE,
+    color VARCHAR(7) DEFAULT '#007bff',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO categories_new (id, name, color, created_at, updated_at)
+SELECT id, name, color, created_at, updated_at FROM categories;
+
+DROP TABLE categories;
+ALTER TABLE categories_new RENAME TO categories;
+
+CREATE INDEX IF NOT EXISTS idx_categories_name ON categories(name);
+
+CREATE TABLE tags_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(50) NOT NULL UNIQUE,
+    color VARCHAR(7) DEFAULT '#6c757d',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO tags_new (id, name, color, created_at, updated_at)
+SELECT id, name, color, created_at, updated_at FROM tags;
+
+DROP TABLE tags;
+ALTER TABLE tags_new RENAME TO tags;
+
+CREATE TABLE webhooks_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url TEXT NOT NULL,
+    events TEXT NOT NULL DEFAULT '',
+    secret TEXT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO webhooks_new (id, url, events, secret, active, created_at, updated_at)
+SELECT id, url, events, secret, active, created_at, updated_at FROM webhooks;
+
+DROP TABLE webhooks;
+ALTER TABLE webhooks_new RENAME TO webhooks;
+
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
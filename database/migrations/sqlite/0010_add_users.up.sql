@@ -0,0 +1,62 @@
+-- User accounts; passwords are stored as bcrypt hashes
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username VARCHAR(50) NOT NULL UNIQUE,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Login sessions; id is the SHA-256 of the token kept in the session cookie
+CREATE TABLE IF NOT EXISTS sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+
+-- Todos, categories, tags and webhooks belong to a user. Rows created before
+-- there were accounts have no owner until the first user registers.
+ALTER TABLE todos ADD COLUMN owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_todos_owner_id ON todos(owner_id);
+
+ALTER TABLE webhooks ADD COLUMN owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_webhooks_owner_id ON webhooks(owner_id);
+
+-- Category and tag names become unique per user, which SQLite can only do
+-- by rebuilding the tables
+DROP INDEX IF EXISTS idx_categories_name;
+
+CREATE TABLE categories_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(50) NOT NULL,
+    color VARCHAR(7) DEFAULT '#007bff',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE (owner_id, name)
+);
+
+INSERT INTO categories_new (id, name, color, created_at, updated_at)
+SELECT id, name, color, created_at, updated_at FROM categories;
+
+DROP TABLE categories;
+ALTER TABLE categories_new RENAME TO categories;
+
+CREATE TABLE tags_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(50) NOT NULL,
+    color VARCHAR(7) DEFAULT '#6c757d',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE (owner_id, name)
+);
+
+INSERT INTO tags_new (id, name, color, created_at, updated_at)
+SELECT id, name, color, created_at, updated_at FROM tags;
+
+DROP TABLE tags;
+ALTER TABLE tags_new RENAME TO tags;
@@ -0,0 +1,82 @@
+-- The todos, categories and tags of workspaces are deleted. Foreign keys are
+-- off while migrating, so their tags and reminders are deleted explicitly.
+DELETE FROM todo_tags WHERE todo_id IN (SELECT id FROM todos WHERE workspace_id IS NOT NULL)
+    OR tag_id IN (SELECT id FROM tags WHERE workspace_id IS NOT NULL);
+DELETE FROM reminders WHERE todo_id IN (SELECT id FROM todos WHERE workspace_id IS NOT NULL);
+DELETE FROM todos WHERE workspace_id IS NOT NULL;
+DELETE FROM categories WHERE workspace_id IS NOT NULL;
+DELETE FROM tags WHERE workspace_id IS NOT NULL;
+
+-- SQLite cannot drop a column used by a foreign key, so rebuild the tables
+-- with the columns they had before this migration
+DROP INDEX IF EXISTS idx_todos_workspace_id;
+DROP INDEX IF EXISTS idx_categories_workspace_id_name;
+DROP INDEX IF EXISTS idx_tags_workspace_id_name;
+
+CREATE TABLE todos_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title VARCHAR(255) NOT NULL,
+    description TEXT DEFAULT '',
+    completed BOOLEAN DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    category_id INTEGER REFERENCES categories(id),
+    priority INTEGER DEFAULT 1,
+    due_date DATETIME,
+    parent_id INTEGER REFERENCES todos(id) ON DELETE CASCADE,
+    recurrence TEXT,
+    series_id INTEGER,
+    occurrence INTEGER,
+    owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO todos_new (id, title, description, completed, created_at, updated_at, category_id, priority, due_date, parent_id, recurrence, series_id, occurrence, owner_id)
+SELECT id, title, description, completed, created_at, updated_at, category_id, priority, due_date, parent_id, recurrence, series_id, occurrence, owner_id FROM todos;
+
+DROP TABLE todos;
+ALTER TABLE todos_new RENAME TO todos;
+
+CREATE INDEX IF NOT EXISTS idx_todos_completed ON todos(completed);
+CREATE INDEX IF NOT EXISTS idx_todos_created_at ON todos(created_at);
+CREATE INDEX IF NOT EXISTS idx_todos_category_id ON todos(category_id);
+CREATE INDEX IF NOT EXISTS idx_todos_priority ON todos(priority);
+CREATE INDEX IF NOT EXISTS idx_todos_due_date ON todos(due_date);
+CREATE INDEX IF NOT EXISTS idx_todos_parent_id ON todos(parent_id);
+CREATE INDEX IF NOT EXISTS idx_todos_series_id ON todos(series_id);
+CREATE INDEX IF NOT EXISTS idx_todos_owner_id ON todos(owner_id);
+
+CREATE TABLE categories_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(50) NOT NULL,
+    color VARCHAR(7) DEFAULT '#007bff',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE (owner_id, name)
+);
+
+INSERT INTO categories_new (id, name, color, created_at, updated_at, owner_id)
+SELECT id, name, color, created_at, updated_at, owner_id FROM categories;
+
+DROP TABLE categories;
+ALTER TABLE categories_new RENAME TO categories;
+
+CREATE TABLE tags_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(50) NOT NULL,
+    color VARCHAR(7) DEFAULT '#6c757d',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE (owner_id, name)
+);
+
+INSERT INTO tags_new (id, name, color, created_at, updated_at, owner_id)
+SELECT id, name, color, created_at, updated_at, owner_id FROM tags;
+
+DROP TABLE tags;
+ALTER TABLE tags_new RENAME TO tags;
+
+DROP TABLE IF EXISTS workspace_invitations;
+DROP TABLE IF EXISTS workspace_members;
+DROP TABLE IF EXISTS workspaces;
@@ -0,0 +1,42 @@
+-- Workspaces share their todos, categories and tags among their members
+CREATE TABLE IF NOT EXISTS workspaces (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(100) NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Owners manage the workspace and its members, editors change its todos and
+-- categories, viewers only see them
+CREATE TABLE IF NOT EXISTS workspace_members (
+    workspace_id INTEGER NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (workspace_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_workspace_members_user_id ON workspace_members(user_id);
+
+-- Invitation links; token_hash is the SHA-256 of the token in the link
+CREATE TABLE IF NOT EXISTS workspace_invitations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    workspace_id INTEGER NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('editor', 'viewer')),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_workspace_invitations_workspace_id ON workspace_invitations(workspace_id);
+
+-- The todos, categories and tags of a workspace have a workspace_id and no
+-- owner_id; names are unique within a workspace
+ALTER TABLE todos ADD COLUMN workspace_id INTEGER REFERENCES workspaces(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_todos_workspace_id ON todos(workspace_id);
+
+ALTER TABLE categories ADD COLUMN workspace_id INTEGER REFERENCES workspaces(id) ON DELETE CASCADE;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_workspace_id_name ON categories(workspace_id, name);
+
+ALTER TABLE tags ADD COLUMN workspace_id INTEGER REFERENCES workspaces(id) ON DELETE CASCADE;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_workspace_id_name ON tags(workspace_id, name);
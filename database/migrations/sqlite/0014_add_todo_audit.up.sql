@@ -0,0 +1,19 @@
+-- Audit log of changes to todos. todo_id has no foreign key, so the history
+-- of a deleted todo is kept; user_id is who made the change. changes holds
+-- the changed fields as {"field": {"old": ..., "new": ...}} and revision the
+-- todo afterwards (before a deletion), both as JSON.
+CREATE TABLE IF NOT EXISTS todo_audit (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    todo_id INTEGER NOT NULL,
+    action VARCHAR(10) NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    workspace_id INTEGER REFERENCES workspaces(id) ON DELETE CASCADE,
+    changes TEXT NOT NULL,
+    revision TEXT NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_todo_audit_todo_id ON todo_audit(todo_id);
+CREATE INDEX IF NOT EXISTS idx_todo_audit_owner_id ON todo_audit(owner_id);
+CREATE INDEX IF NOT EXISTS idx_todo_audit_workspace_id ON todo_audit(workspace_id);
@@ -0,0 +1,8 @@
+-- The todos in the trash are deleted. Foreign keys are off while migrating,
+-- so their tags and reminders are deleted explicitly.
+DELETE FROM todo_tags WHERE todo_id IN (SELECT id FROM todos WHERE deleted_at IS NOT NULL);
+DELETE FROM reminders WHERE todo_id IN (SELECT id FROM todos WHERE deleted_at IS NOT NULL);
+DELETE FROM todos WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_todos_deleted_at;
+ALTER TABLE todos DROP COLUMN deleted_at;
@@ -0,0 +1,4 @@
+-- Trash: deleted todos keep their row with the time they were deleted until
+-- they are restored or purged
+ALTER TABLE todos ADD COLUMN deleted_at DATETIME;
+CREATE INDEX IF NOT EXISTS idx_todos_deleted_at ON todos(deleted_at);
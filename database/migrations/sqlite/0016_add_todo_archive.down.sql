@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_todos_archived_at;
+ALTER TABLE todos DROP COLUMN archived_at;
@@ -0,0 +1,4 @@
+-- Row versions: every change to a todo or a category increments its version,
+-- which the API returns as an ETag for optimistic concurrency
+ALTER TABLE todos ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE categories ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
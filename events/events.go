@@ -0,0 +1,178 @@
+// Package events lets the API announce changes to todos and categories.
+//
+// Handlers publish an Event after every successful mutation; webhooks and
+// the live event stream subscribe to the Bus.
+package events
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	TodoCreated     = "todo.created"
+	TodoUpdated     = "todo.updated"
+	TodoToggled     = "todo.toggled"
+	TodoDeleted     = "todo.deleted"
+	TodoRestored    = "todo.restored"
+	CategoryCreated = "category.created"
+	CategoryUpdated = "category.updated"
+	CategoryDeleted = "category.deleted"
+)
+
+// Types lists every event type
+var Types = []string{
+	TodoCreated, TodoUpdated, TodoToggled, TodoDeleted, TodoRestored,
+	CategoryCreated, CategoryUpdated, CategoryDeleted,
+}
+
+// Event is a change made through the API. Data is the todo or category after
+// the change; for deletions it only holds the ID.
+type Event struct {
+	ID   int64     `json:"id"` // increasing, also across restarts
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+
+	// UserID is the owner of the changed todo or category, or for one of a
+	// workspace the user who changed it, 0 if the server did. WorkspaceID is
+	// that workspace, or 0.
+	// Only the subscribers of that user or workspace receive the event.
+	UserID      int `json:"-"`
+	WorkspaceID int `json:"workspace_id,omitempty"`
+}
+
+// Deleted is the data of a deletion event
+type Deleted struct {
+	ID int `json:"id"`
+}
+
+// ValidPattern reports whether pattern names an event type or a group of
+// them: "todo.*", "category.*" or "*"
+func ValidPattern(pattern string) bool {
+	if pattern == "*" {
+		return true
+	}
+	for _, t := range Types {
+		if pattern == t || pattern == prefix(t)+".*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether eventType is selected by any of the patterns.
+// No patterns select every event.
+func Matches(patterns []string, eventType string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == eventType || pattern == prefix(eventType)+".*" {
+			return true
+		}
+	}
+	return false
+}
+
+// prefix returns the resource part of an event type, "todo" for "todo.created"
+func prefix(eventType string) string {
+	resource, _, _ := strings.Cut(eventType, ".")
+	return resource
+}
+
+// HistorySize is how many of the latest events a Bus keeps for clients
+// resuming with SubscribeAfter
+const HistorySize = 1000
+
+// Bus delivers published events to its subscribers. A nil *Bus discards
+// events, so handlers work without one.
+type Bus struct {
+	mu          sync.Mutex
+	nextID      int64
+	history     []Event // the latest events, oldest first
+	subscribers map[int]func(Event)
+	nextSubID   int
+}
+
+// NewBus creates a Bus without subscribers. Event IDs start from the
+// current time in microseconds, so they keep increasing after a restart.
+func NewBus() *Bus {
+	return &Bus{
+		nextID:      time.Now().UnixMicro(),
+		subscribers: make(map[int]func(Event)),
+	}
+}
+
+// Publish assigns the next ID to an event about a change userID made to their
+// data, or to that of workspaceID when it is not 0, and passes it to every
+// subscriber
+func (b *Bus) Publish(userID, workspaceID int, eventType string, data any) Event {
+	event := Event{Type: eventType, Time: time.Now().UTC(), Data: data, UserID: userID, WorkspaceID: workspaceID}
+	if b == nil {
+		return event
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	event.ID = b.nextID
+	b.nextID++
+
+	b.history = append(b.history, event)
+	if len(b.history) > HistorySize {
+		b.history = append([]Event(nil), b.history[len(b.history)-HistorySize:]...)
+	}
+
+	for _, fn := range b.subscribers {
+		fn(event)
+	}
+	return event
+}
+
+// Subscribe calls fn with every event published from now on, in order, until
+// the returned function is called. fn runs while the bus is locked, so it
+// must return quickly and must not publish.
+func (b *Bus) Subscribe(fn func(Event)) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.subscribe(fn)
+}
+
+// SubscribeAfter is Subscribe for a client that has seen the events up to
+// lastID. It also returns the events published since then, which come before
+// any passed to fn. complete is false when some of them are no longer kept,
+// for instance after a restart, and the client has to reload instead.
+func (b *Bus) SubscribeAfter(lastID int64, fn func(Event)) (missed []Event, complete bool, unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	oldest := b.nextID
+	if len(b.history) > 0 {
+		oldest = b.history[0].ID
+	}
+	complete = lastID >= oldest-1
+
+	for _, event := range b.history {
+		if event.ID > lastID {
+			missed = append(missed, event)
+		}
+	}
+	return missed, complete, b.subscribe(fn)
+}
+
+// subscribe registers fn. The caller must hold b.mu.
+func (b *Bus) subscribe(fn func(Event)) (unsubscribe func()) {
+	id := b.nextSubID
+	b.nextSubID++
+	b.subscribers[id] = fn
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, id)
+	}
+}
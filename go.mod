@@ -2,4 +2,12 @@ module gotodo
 
 go 1.23.4
 
-require github.com/mattn/go-sqlite3 v1.14.30
+require (
+	github.com/coreos/go-oidc/v3 v3.14.1
+	github.com/lib/pq v1.12.3
+	github.com/mattn/go-sqlite3 v1.14.30
+	golang.org/x/crypto v0.41.0
+	golang.org/x/oauth2 v0.28.0
+)
+
+require github.com/go-jose/go-jose/v4 v4.0.5 // indirect
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gotodo/events"
+	"gotodo/models"
+)
+
+// ArchiveHandler serves POST /api/todos/archive, which archives completed
+// todos, and POST /api/todos/{id}/unarchive. Archived todos are listed with
+// GET /api/todos?archived=true.
+type ArchiveHandler struct {
+	store models.TodoRepository
+	audit models.AuditRepository
+	bus   *events.Bus
+}
+
+func NewArchiveHandler(store models.TodoRepository, audit models.AuditRepository, bus *events.Bus) *ArchiveHandler {
+	return &ArchiveHandler{store: store, audit: audit, bus: bus}
+}
+
+// scoped limits the handler to the todos a request works on
+func (h *ArchiveHandler) scoped(r *http.Request) *ArchiveHandler {
+	return &ArchiveHandler{store: requestStore(r, h.store), audit: requestStore(r, h.audit), bus: h.bus}
+}
+
+func (h *ArchiveHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	h = h.scoped(r)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.PathValue("id") == "" {
+		h.archive(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	h.unarchive(w, r, id)
+}
+
+// archive archives the completed todos, optionally only those of a category
+// or those that have not changed for older_than_days, and returns them
+func (h *ArchiveHandler) archive(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		CategoryID    *int `json:"category_id"`
+		OlderThanDays int  `json:"older_than_days"`
+	}
+	// The body is optional; without it every completed todo is archived
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.OlderThanDays < 0 {
+		http.Error(w, "older_than_days must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+
+	filter := models.ArchiveFilter{CategoryID: req.CategoryID}
+	if req.OlderThanDays > 0 {
+		before := time.Now().AddDate(0, 0, -req.OlderThanDays)
+		filter.UpdatedBefore = &before
+	}
+
+	todos, err := h.store.Archive(filter)
+	if err != nil {
+		log.Printf("Error archiving todos: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	for _, todo := range todos {
+		recordChange(h.audit, r, models.AuditArchived, beforeArchive(todo), &todo)
+		h.bus.Publish(CurrentUser(r).ID, currentWorkspaceID(r), events.TodoUpdated, todo)
+	}
+	json.NewEncoder(w).Encode(todos)
+}
+
+// PublishArchived records the todos the server archived on its own, such as
+// with ARCHIVE_AFTER, in the audit log of their owners and sends their events
+func PublishArchived(audit models.AuditRepository, bus *events.Bus, todos []models.Todo) {
+	for _, todo := range todos {
+		userID, workspaceID := todo.Owner()
+		if workspaceID != 0 {
+			recordEntry(audit.ForWorkspace(workspaceID), nil, models.AuditArchived, beforeArchive(todo), &todo)
+		} else {
+			recordEntry(audit.ForUser(userID), nil, models.AuditArchived, beforeArchive(todo), &todo)
+		}
+		bus.Publish(userID, workspaceID, events.TodoUpdated, todo)
+	}
+}
+
+// beforeArchive returns an archived todo as it was before; archiving does
+// not change anything else about it
+func beforeArchive(todo models.Todo) *models.Todo {
+	todo.ArchivedAt = nil
+	return &todo
+}
+
+// unarchive brings an archived todo and its subtasks back to the active list
+func (h *ArchiveHandler) unarchive(w http.ResponseWriter, r *http.Request, id int) {
+	before, err := h.store.GetByID(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error getting todo: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	todo, err := h.store.Unarchive(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "archived with its parent") {
+			http.Error(w, "This todo is archived with its parent; unarchive the parent instead", http.StatusConflict)
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error unarchiving todo: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if before.ArchivedAt != nil {
+		recordChange(h.audit, r, models.AuditUnarchived, before, todo)
+	}
+	h.bus.Publish(CurrentUser(r).ID, currentWorkspaceID(r), events.TodoUpdated, todo)
+	json.NewEncoder(w).Encode(todo)
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gotodo/events"
+	"gotodo/models"
+)
+
+// recordChange adds a change a request made to a todo to the audit log;
+// before is nil for a creation and after for a deletion. The change has
+// been made by then, so a failure to record it is only logged.
+func recordChange(audit models.AuditRepository, r *http.Request, action string, before, after *models.Todo) {
+	userID := CurrentUser(r).ID
+	recordEntry(audit, &userID, action, before, after)
+}
+
+// recordEntry is recordChange for a change by userID, or by the server
+// itself when it is nil
+func recordEntry(audit models.AuditRepository, userID *int, action string, before, after *models.Todo) {
+	entry := &models.AuditEntry{Action: action, UserID: userID}
+
+	var from, to *models.TodoRevision
+	if before != nil {
+		entry.TodoID = before.ID
+		from = models.RevisionOf(before)
+		entry.Revision = from
+	}
+	if after != nil {
+		entry.TodoID = after.ID
+		to = models.RevisionOf(after)
+		entry.Revision = to
+	}
+	entry.Changes = models.DiffRevisions(from, to)
+
+	if err := audit.Record(entry); err != nil {
+		log.Printf("Error recording %s of todo %d: %v", action, entry.TodoID, err)
+	}
+}
+
+// AuditHandler serves the audit log: /api/audit, the history of a todo at
+// /api/todos/{id}/history and restoring a todo to one of its revisions with
+// POST /api/todos/{id}/history/{entryID}/restore
+type AuditHandler struct {
+	audit models.AuditRepository
+	todos models.TodoRepository
+	bus   *events.Bus
+}
+
+func NewAuditHandler(audit models.AuditRepository, todos models.TodoRepository, bus *events.Bus) *AuditHandler {
+	return &AuditHandler{audit: audit, todos: todos, bus: bus}
+}
+
+// scoped limits the handler to the log and todos a request works on
+func (h *AuditHandler) scoped(r *http.Request) *AuditHandler {
+	return &AuditHandler{audit: requestStore(r, h.audit), todos: requestStore(r, h.todos), bus: h.bus}
+}
+
+func (h *AuditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	h = h.scoped(r)
+
+	if r.PathValue("id") == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.getAudit(w, r)
+		return
+	}
+
+	todoID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if v := r.PathValue("entryID"); v != "" {
+		entryID, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid revision ID", http.StatusBadRequest)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.restore(w, r, todoID, entryID)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.getHistory(w, todoID)
+}
+
+// getHistory lists the changes to a todo, oldest first. The history of a
+// deleted todo stays available.
+func (h *AuditHandler) getHistory(w http.ResponseWriter, todoID int) {
+	entries, err := h.audit.History(todoID)
+	if err != nil {
+		log.Printf("Error getting todo history: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if len(entries) == 0 {
+		if _, err := h.todos.GetByID(todoID); err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				http.Error(w, "Todo not found", http.StatusNotFound)
+				return
+			}
+			log.Printf("Error getting todo: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(entries)
+}
+
+// getAudit lists the changes to every todo, newest first, filtered by
+// todo_id, action, user_id, since and until and paginated with limit and offset
+func (h *AuditHandler) getAudit(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, total, err := h.audit.List(filter)
+	if err != nil {
+		log.Printf("Error getting audit log: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	json.NewEncoder(w).Encode(entries)
+}
+
+// parseAuditFilter reads the filters and pagination of the audit log from the query string
+func parseAuditFilter(r *http.Request) (models.AuditFilter, error) {
+	q := r.URL.Query()
+	var filter models.AuditFilter
+
+	for _, param := range []struct {
+		name string
+		dest *int
+	}{
+		{"todo_id", &filter.TodoID},
+		{"user_id", &filter.UserID},
+	} {
+		if v := q.Get(param.name); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				return filter, fmt.Errorf("Invalid %s", param.name)
+			}
+			*param.dest = id
+		}
+	}
+
+	if v := q.Get("action"); v != "" {
+		if !slices.Contains(models.AuditActions, v) {
+			return filter, fmt.Errorf("Unknown action %q (use %s)", v, strings.Join(models.AuditActions, ", "))
+		}
+		filter.Action = v
+	}
+
+	for _, param := range []struct {
+		name string
+		dest **time.Time
+	}{
+		{"since", &filter.Since},
+		{"until", &filter.Until},
+	} {
+		if v := q.Get(param.name); v != "" {
+			parsed, err := parseFilterTime(v)
+			if err != nil {
+				return filter, fmt.Errorf("Invalid %s. Use YYYY-MM-DD, YYYY-MM-DDTHH:MM or RFC 3339", param.name)
+			}
+			*param.dest = &parsed
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > models.MaxAuditLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", models.MaxAuditLimit)
+		}
+		filter.Limit = limit
+	}
+
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return filter, fmt.Errorf("offset must be a non-negative integer")
+		}
+		filter.Offset = offset
+	}
+
+	return filter, nil
+}
+
+// restore puts a todo back to the revision of one of its audit entries: its
+// title, description, category, tags, priority, due date, completion and
+// recurrence. Its place among the other todos is kept.
+func (h *AuditHandler) restore(w http.ResponseWriter, r *http.Request, todoID, entryID int) {
+	entry, err := h.audit.Get(entryID)
+	if err != nil || entry.TodoID != todoID {
+		if err == nil || strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Revision not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error getting audit entry: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	revision := entry.Revision
+
+	before, err := h.todos.GetByID(todoID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error getting todo: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	rule, err := parseRecurrence(revision.Recurrence)
+	if err != nil {
+		log.Printf("Error parsing recurrence of audit entry %d: %v", entry.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	priority := revision.Priority
+	todo, err := h.todos.Update(todoID, revision.Title, revision.Description, revision.CategoryID, &priority, revision.DueDate, append([]int{}, revision.TagIDs...))
+	if err != nil {
+		if strings.Contains(err.Error(), "category not found") {
+			http.Error(w, "The category of this revision no longer exists", http.StatusConflict)
+			return
+		}
+		if strings.Contains(err.Error(), "tag not found") {
+			http.Error(w, "A tag of this revision no longer exists", http.StatusConflict)
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error restoring todo: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var completion *models.Completion
+	if todo.Completed != revision.Completed {
+		if todo, completion, err = h.todos.Toggle(todoID); err != nil {
+			log.Printf("Error restoring completion: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// SetRecurrence starts a new series, so leave an unchanged rule alone
+	if !reflect.DeepEqual(todo.Recurrence, revision.Recurrence) {
+		if todo, err = h.todos.SetRecurrence(todoID, rule); err != nil {
+			log.Printf("Error restoring recurrence: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	recordChange(h.audit, r, models.AuditRestored, before, todo)
+	h.bus.Publish(CurrentUser(r).ID, currentWorkspaceID(r), events.TodoUpdated, todo)
+	publishCompletion(h.audit, h.bus, r, completion)
+	json.NewEncoder(w).Encode(todo)
+}
@@ -0,0 +1,448 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"gotodo/models"
+)
+
+// SessionCookie is the cookie holding the session token of a signed-in user
+const SessionCookie = "gotodo_session"
+
+// sessionLifetime is how long a login lasts
+const sessionLifetime = 30 * 24 * time.Hour
+
+// Password length limits; bcrypt ignores everything after 72 bytes, so
+// longer passwords are refused rather than silently truncated
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,50}$`)
+
+// apiTokenPrefix starts every API token, which makes them easy to spot, for
+// instance by secret scanners
+const apiTokenPrefix = "gotodo_"
+
+// tokenResources are the parts of the API that API token scopes grant
+// access to, as resource:read or resource:write
+var tokenResources = []string{"todos", "categories", "tags", "webhooks", "workspaces"}
+
+// dummyPasswordHash is checked against when a username does not exist, so
+// that failed logins take as long whether or not it does
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+	return hash
+})
+
+type contextKey int
+
+const (
+	userKey contextKey = iota
+	tokenKey
+	workspaceKey
+)
+
+// CurrentUser returns the signed-in user of a request passed through
+// AuthHandler.Require
+func CurrentUser(r *http.Request) *models.User {
+	user, _ := r.Context().Value(userKey).(*models.User)
+	return user
+}
+
+// CurrentWorkspace returns the workspace a request passed through
+// AuthHandler.Require works on, with the role of the signed-in user, or nil
+// for their personal todos
+func CurrentWorkspace(r *http.Request) *models.Workspace {
+	workspace, _ := r.Context().Value(workspaceKey).(*models.Workspace)
+	return workspace
+}
+
+// AuthHandler serves /api/auth/register, /api/auth/login, /api/auth/logout,
+// /api/auth/me and /api/auth/methods, and /api/auth/oidc/login and
+// /api/auth/oidc/callback once EnableOIDC is called. It guards the rest of
+// the API; besides the session cookie, it accepts personal API tokens as
+// "Authorization: Bearer".
+type AuthHandler struct {
+	users      models.UserRepository
+	workspaces models.WorkspaceRepository
+	oidc       *oidcLogin // nil without single sign-on
+}
+
+func NewAuthHandler(users models.UserRepository, workspaces models.WorkspaceRepository) *AuthHandler {
+	return &AuthHandler{users: users, workspaces: workspaces}
+}
+
+func (h *AuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	method := http.MethodPost
+	action := strings.TrimPrefix(r.URL.Path, "/api/auth/")
+	if action == "me" || action == "methods" || strings.HasPrefix(action, "oidc/") {
+		method = http.MethodGet
+	}
+	if r.Method != method {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch action {
+	case "register":
+		h.register(w, r)
+	case "login":
+		h.login(w, r)
+	case "logout":
+		h.logout(w, r)
+	case "me":
+		h.me(w, r)
+	case "methods":
+		json.NewEncoder(w).Encode(map[string]bool{"password": true, "oidc": h.oidc != nil})
+	case "oidc/login", "oidc/callback":
+		if h.oidc == nil {
+			http.Error(w, "Single sign-on is not configured", http.StatusNotFound)
+			return
+		}
+		if action == "oidc/login" {
+			h.oidcLoginStart(w, r)
+		} else {
+			h.oidcCallback(w, r)
+		}
+	default:
+		http.Error(w, "Invalid endpoint", http.StatusBadRequest)
+	}
+}
+
+// Require wraps an API handler so that it only serves signed-in users,
+// whom it gets from CurrentUser. Requests with an API token also need the
+// token to have the read scope (for GET) or the write scope of each of
+// resources. Requests with ?workspace={id} work on that workspace, which
+// the handler gets from CurrentWorkspace; the user must be a member, and
+// viewers may only read.
+func (h *AuthHandler) Require(next http.Handler, resources ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, token, err := h.authenticate(r)
+		if err != nil {
+			log.Printf("Error authenticating request: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			if _, ok := bearerToken(r); ok {
+				http.Error(w, "Invalid API token", http.StatusUnauthorized)
+				return
+			}
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userKey, user)
+		if token != nil {
+			access := "write"
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				access = "read"
+			}
+			for _, resource := range resources {
+				if !hasScope(token.Scopes, resource, access) {
+					http.Error(w, fmt.Sprintf("API token lacks the %s:%s scope", resource, access), http.StatusForbidden)
+					return
+				}
+			}
+			ctx = context.WithValue(ctx, tokenKey, token)
+		}
+
+		if param := r.URL.Query().Get("workspace"); param != "" {
+			id, err := strconv.Atoi(param)
+			if err != nil {
+				http.Error(w, "Invalid workspace", http.StatusBadRequest)
+				return
+			}
+			workspace, err := h.workspaces.Get(id, user.ID)
+			if err != nil {
+				if strings.Contains(err.Error(), "not found") {
+					http.Error(w, "Workspace not found", http.StatusNotFound)
+					return
+				}
+				log.Printf("Error getting workspace: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if workspace.Role == models.RoleViewer && r.Method != http.MethodGet && r.Method != http.MethodHead {
+				http.Error(w, "Viewers cannot make changes in this workspace", http.StatusForbidden)
+				return
+			}
+			ctx = context.WithValue(ctx, workspaceKey, workspace)
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireSession is Require for the parts of the API that need the user to
+// have signed in with their password, such as managing API tokens
+func (h *AuthHandler) RequireSession(next http.Handler) http.Handler {
+	return h.Require(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Value(tokenKey) != nil {
+			http.Error(w, "API tokens cannot be used here", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// RequireFeed is Require for feeds that calendar apps subscribe to. As they
+// cannot send an Authorization header, the API token may also be given as
+// the token query parameter or as the password of HTTP basic auth.
+func (h *AuthHandler) RequireFeed(next http.Handler, resources ...string) http.Handler {
+	require := h.Require(next, resources...)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := bearerToken(r); !ok {
+			token := r.URL.Query().Get("token")
+			if _, password, ok := r.BasicAuth(); ok && token == "" {
+				token = password
+			}
+			if token != "" {
+				r = r.Clone(r.Context())
+				r.Header.Set("Authorization", "Bearer "+token)
+			} else if _, err := r.Cookie(SessionCookie); err != nil {
+				// Lets calendar apps ask for the token
+				w.Header().Set("WWW-Authenticate", `Basic realm="gotodo"`)
+			}
+		}
+		require.ServeHTTP(w, r)
+	})
+}
+
+// hasScope reports whether scopes grant access to resource; a write scope
+// also grants read access
+func hasScope(scopes []string, resource, access string) bool {
+	for _, scope := range scopes {
+		if scope == resource+":"+access || scope == resource+":write" {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate returns the user of the request's API token or, without
+// one, of its session cookie; user is nil when they are not valid. token is
+// the API token used, if any.
+func (h *AuthHandler) authenticate(r *http.Request) (user *models.User, token *models.APIToken, err error) {
+	bearer, ok := bearerToken(r)
+	if !ok {
+		user, err := h.sessionUser(r)
+		return user, nil, err
+	}
+
+	user, token, err = h.users.APITokenUser(hashToken(bearer), time.Now())
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	return user, token, nil
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// sessionUser returns the user of the request's session cookie, or nil
+// without a valid one
+func (h *AuthHandler) sessionUser(r *http.Request) (*models.User, error) {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil || cookie.Value == "" {
+		return nil, nil
+	}
+
+	user, err := h.users.SessionUser(hashToken(cookie.Value), time.Now())
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// credentials is the body of register and login requests
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (h *AuthHandler) register(w http.ResponseWriter, r *http.Request) {
+	var req credentials
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	if !usernamePattern.MatchString(req.Username) {
+		http.Error(w, "Username must be 3-50 letters, digits, dots, dashes or underscores", http.StatusBadRequest)
+		return
+	}
+	if len(req.Password) < minPasswordLength || len(req.Password) > maxPasswordLength {
+		http.Error(w, "Password must be between 8 and 72 bytes long", http.StatusBadRequest)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.users.Create(req.Username, string(hash))
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			http.Error(w, "Username is already taken", http.StatusConflict)
+			return
+		}
+		log.Printf("Error creating user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Registering also signs the user in
+	if err := h.startSession(w, r, user); err != nil {
+		log.Printf("Error creating session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *AuthHandler) login(w http.ResponseWriter, r *http.Request) {
+	var req credentials
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.users.GetByUsername(strings.TrimSpace(req.Username))
+	if err != nil && !strings.Contains(err.Error(), "not found") {
+		log.Printf("Error getting user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	hash := dummyPasswordHash()
+	if user != nil {
+		hash = []byte(user.PasswordHash)
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(req.Password)); err != nil || user == nil {
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.users.DeleteExpiredSessions(time.Now()); err != nil {
+		log.Printf("Error deleting expired sessions: %v", err)
+	}
+	if err := h.startSession(w, r, user); err != nil {
+		log.Printf("Error creating session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *AuthHandler) logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(SessionCookie); err == nil && cookie.Value != "" {
+		if err := h.users.DeleteSession(hashToken(cookie.Value)); err != nil {
+			log.Printf("Error deleting session: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	setSessionCookie(w, r, "", time.Unix(0, 0))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) me(w http.ResponseWriter, r *http.Request) {
+	user, _, err := h.authenticate(r)
+	if err != nil {
+		log.Printf("Error authenticating request: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	json.NewEncoder(w).Encode(user)
+}
+
+// startSession stores a new session for user and sends its token in the
+// session cookie. Only a hash of the token is stored.
+func (h *AuthHandler) startSession(w http.ResponseWriter, r *http.Request, user *models.User) error {
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(sessionLifetime)
+
+	if err := h.users.CreateSession(user.ID, hashToken(token), expiresAt); err != nil {
+		return err
+	}
+
+	setSessionCookie(w, r, token, expiresAt)
+	return nil
+}
+
+// setSessionCookie sets the session cookie, or clears it when expiresAt is
+// in the past. SameSite=Lax keeps other sites from making changes with it.
+func setSessionCookie(w http.ResponseWriter, r *http.Request, token string, expiresAt time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// newToken returns a random session or API token
+func newToken() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(key), nil
+}
+
+// hashToken returns the stored form of a session or API token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gotodo/events"
+	"gotodo/models"
+)
+
+// BulkHandler serves POST /api/todos/bulk, which applies one action to many
+// todos at once
+type BulkHandler struct {
+	store models.TodoRepository
+	audit models.AuditRepository
+	bus   *events.Bus
+}
+
+func NewBulkHandler(store models.TodoRepository, audit models.AuditRepository, bus *events.Bus) *BulkHandler {
+	return &BulkHandler{store: store, audit: audit, bus: bus}
+}
+
+// scoped limits the handler to the todos a request works on
+func (h *BulkHandler) scoped(r *http.Request) *BulkHandler {
+	return &BulkHandler{store: requestStore(r, h.store), audit: requestStore(r, h.audit), bus: h.bus}
+}
+
+func (h *BulkHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	h = h.scoped(r)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Action string `json:"action"`
+		// IDs lists the todos to change; Filter selects them instead, with
+		// the query parameters of GET /api/todos such as "completed=true"
+		IDs    []int  `json:"ids"`
+		Filter string `json:"filter"`
+		// CategoryID is the category of set_category; null removes it
+		CategoryID optional[int] `json:"category_id"`
+		Priority   int           `json:"priority"`
+		Days       int           `json:"days"` // shift_due
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	change, err := parseBulkChange(req.Action, req.CategoryID, req.Priority, req.Days)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ids := req.IDs
+	switch {
+	case ids != nil && req.Filter != "":
+		http.Error(w, "Give either ids or a filter, not both", http.StatusBadRequest)
+		return
+	case ids == nil && req.Filter == "":
+		http.Error(w, "ids or a filter is required", http.StatusBadRequest)
+		return
+	case len(ids) > models.MaxBulkTodos:
+		http.Error(w, fmt.Sprintf("At most %d todos can be changed at once", models.MaxBulkTodos), http.StatusBadRequest)
+		return
+	case req.Filter != "":
+		var status int
+		if ids, status, err = h.selectTodos(req.Filter); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+
+	// Subtasks go to the trash with their parent, so log their deletion too
+	var subtasks []models.Todo
+	if change.Action == models.BulkDelete && len(ids) > 0 {
+		if subtasks, err = h.store.Descendants(ids...); err != nil {
+			log.Printf("Error getting subtasks: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	results, err := h.store.Bulk(ids, change)
+	if err != nil {
+		if strings.Contains(err.Error(), "category not found") {
+			http.Error(w, "Category not found", http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error applying bulk %s: %v", change.Action, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	listed := make(map[int]bool, len(results))
+	for _, result := range results {
+		listed[result.ID] = true
+		if result.Status == models.BulkOK {
+			h.publish(r, change.Action, result.Before, result.Todo)
+			publishCompletion(h.audit, h.bus, r, result.Completion)
+		}
+	}
+	for _, subtask := range subtasks {
+		if !listed[subtask.ID] {
+			h.publish(r, change.Action, &subtask, nil)
+		}
+	}
+
+	json.NewEncoder(w).Encode(results)
+}
+
+// parseBulkChange validates the action of a bulk request and the value it needs
+func parseBulkChange(action string, categoryID optional[int], priority, days int) (models.BulkChange, error) {
+	change := models.BulkChange{Action: action}
+	switch action {
+	case models.BulkSetCategory:
+		if !categoryID.Set {
+			return change, fmt.Errorf("category_id is required for set_category (null removes the category)")
+		}
+		change.CategoryID = categoryID.Value
+	case models.BulkSetPriority:
+		if priority < 1 || priority > 3 {
+			return change, fmt.Errorf("Priority must be between 1 (low) and 3 (high)")
+		}
+		change.Priority = priority
+	case models.BulkShiftDue:
+		if days == 0 {
+			return change, fmt.Errorf("days is required for shift_due")
+		}
+		change.Days = days
+	case models.BulkComplete, models.BulkReopen, models.BulkDelete:
+	default:
+		return change, fmt.Errorf("Unknown action %q (use %s)", action, strings.Join(models.BulkActions, ", "))
+	}
+	return change, nil
+}
+
+// selectTodos returns the ids of the todos matching a filter of GET
+// /api/todos, refusing filters that match too many of them
+func (h *BulkHandler) selectTodos(filterQuery string) ([]int, int, error) {
+	values, err := url.ParseQuery(filterQuery)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("Invalid filter")
+	}
+	filter, err := parseTodoFilter(values)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	explicitLimit := filter.Limit != 0
+	if !explicitLimit {
+		filter.Limit = models.MaxBulkTodos
+	}
+	todos, total, err := h.store.List(filter)
+	if err != nil {
+		log.Printf("Error getting todos: %v", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("Internal server error")
+	}
+	if !explicitLimit && total > models.MaxBulkTodos {
+		return nil, http.StatusBadRequest, fmt.Errorf("The filter matches %d todos; at most %d can be changed at once", total, models.MaxBulkTodos)
+	}
+
+	ids := make([]int, len(todos))
+	for i, todo := range todos {
+		ids[i] = todo.ID
+	}
+	return ids, 0, nil
+}
+
+// publish records a change a bulk request made to a todo and sends the
+// event a single request making it would
+func (h *BulkHandler) publish(r *http.Request, action string, before, after *models.Todo) {
+	userID, workspaceID := CurrentUser(r).ID, currentWorkspaceID(r)
+	switch action {
+	case models.BulkComplete, models.BulkReopen:
+		recordChange(h.audit, r, models.AuditToggled, before, after)
+		h.bus.Publish(userID, workspaceID, events.TodoToggled, after)
+	case models.BulkDelete:
+		recordChange(h.audit, r, models.AuditDeleted, before, nil)
+		h.bus.Publish(userID, workspaceID, events.TodoDeleted, events.Deleted{ID: before.ID})
+	default:
+		recordChange(h.audit, r, models.AuditUpdated, before, after)
+		h.bus.Publish(userID, workspaceID, events.TodoUpdated, after)
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gotodo/models"
+)
+
+// icalTime is the UTC date-time format of iCalendar
+const icalTime = "20060102T150405Z"
+
+// icalPriorities maps our priorities to those of iCalendar, where 1 is the
+// highest and 9 the lowest
+var icalPriorities = map[int]int{1: 9, 2: 5, 3: 1}
+
+// icalEscaper escapes iCalendar text values
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// CalendarHandler serves GET /calendar.ics, an iCalendar feed of the todos
+// with due dates that calendar apps can subscribe to
+type CalendarHandler struct {
+	store models.TodoRepository
+}
+
+func NewCalendarHandler(store models.TodoRepository) *CalendarHandler {
+	return &CalendarHandler{store: store}
+}
+
+// scoped limits the handler to the todos a request works on
+func (h *CalendarHandler) scoped(r *http.Request) *CalendarHandler {
+	return &CalendarHandler{store: requestStore(r, h.store)}
+}
+
+func (h *CalendarHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h = h.scoped(r)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The feed takes the filters of GET /api/todos, such as category_id
+	filter, err := parseTodoFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	withEvents := false
+	if v := r.URL.Query().Get("events"); v != "" {
+		if withEvents, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "events must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="gotodo.ics"`)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	calendar := &icalWriter{w: w}
+	calendar.line("BEGIN", "VCALENDAR")
+	calendar.line("VERSION", "2.0")
+	calendar.line("PRODID", "-//gotodo//gotodo//EN")
+	calendar.line("CALSCALE", "GREGORIAN")
+	calendar.line("METHOD", "PUBLISH")
+	calendar.text("X-WR-CALNAME", "gotodo")
+
+	// The response has started, so errors can only be logged from here on
+	stamp := time.Now().UTC().Format(icalTime)
+	err = eachTodoBatch(h.store, filter, func(todos []models.Todo) error {
+		for _, todo := range todos {
+			if todo.DueDate == nil {
+				continue
+			}
+			calendar.todo(todo, stamp)
+			if withEvents {
+				calendar.event(todo, stamp)
+			}
+		}
+		flushResponse(w)
+		return calendar.err
+	})
+	calendar.line("END", "VCALENDAR")
+	if err == nil {
+		err = calendar.err
+	}
+	if err != nil {
+		log.Printf("Error writing calendar: %v", err)
+	}
+}
+
+// icalWriter writes the lines of an iCalendar stream, keeping the first
+// error
+type icalWriter struct {
+	w   io.Writer
+	err error
+}
+
+// todo writes a todo as a VTODO component
+func (c *icalWriter) todo(todo models.Todo, stamp string) {
+	c.line("BEGIN", "VTODO")
+	c.line("UID", fmt.Sprintf("todo-%d@gotodo", todo.ID))
+	c.common(todo, stamp)
+	c.line("DUE", todo.DueDate.UTC().Format(icalTime))
+	if todo.Completed {
+		c.line("STATUS", "COMPLETED")
+		c.line("COMPLETED", todo.UpdatedAt.UTC().Format(icalTime))
+	} else {
+		c.line("STATUS", "NEEDS-ACTION")
+	}
+	if todo.ParentID != nil {
+		c.line("RELATED-TO", fmt.Sprintf("todo-%d@gotodo", *todo.ParentID))
+	}
+	c.line("END", "VTODO")
+}
+
+// event writes a todo as a VEVENT at its due date, for calendar apps that
+// do not show VTODOs
+func (c *icalWriter) event(todo models.Todo, stamp string) {
+	c.line("BEGIN", "VEVENT")
+	c.line("UID", fmt.Sprintf("todo-%d-due@gotodo", todo.ID))
+	c.common(todo, stamp)
+	c.line("DTSTART", todo.DueDate.UTC().Format(icalTime))
+	c.line("TRANSP", "TRANSPARENT")
+	c.line("STATUS", "CONFIRMED")
+	c.line("END", "VEVENT")
+}
+
+// common writes the properties VTODOs and VEVENTs share
+func (c *icalWriter) common(todo models.Todo, stamp string) {
+	c.line("DTSTAMP", stamp)
+	c.line("CREATED", todo.CreatedAt.UTC().Format(icalTime))
+	c.line("LAST-MODIFIED", todo.UpdatedAt.UTC().Format(icalTime))
+	c.line("SEQUENCE", strconv.Itoa(max(todo.Version-1, 0)))
+	c.text("SUMMARY", todo.Title)
+	if todo.Description != "" {
+		c.text("DESCRIPTION", todo.Description)
+	}
+	c.line("PRIORITY", strconv.Itoa(icalPriorities[todo.Priority]))
+	if todo.Category != nil {
+		c.text("CATEGORIES", todo.Category.Name)
+	}
+}
+
+// text writes a property with a text value
+func (c *icalWriter) text(name, value string) {
+	c.line(name, icalEscaper.Replace(value))
+}
+
+// line writes a property, folding it into lines of at most 75 octets
+func (c *icalWriter) line(name, value string) {
+	if c.err != nil {
+		return
+	}
+	var b strings.Builder
+	line := name + ":" + value
+	width := 75
+	for len(line) > width {
+		cut := width
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		width = 74 // continuation lines start with a space
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	_, c.err = io.WriteString(c.w, b.String())
+}
@@ -2,32 +2,48 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"gotodo/events"
 	"gotodo/models"
 )
 
 type CategoryHandler struct {
-	store *models.CategoryStore
+	store models.CategoryRepository
+	bus   *events.Bus
 }
 
-func NewCategoryHandler(store *models.CategoryStore) *CategoryHandler {
-	return &CategoryHandler{store: store}
+func NewCategoryHandler(store models.CategoryRepository, bus *events.Bus) *CategoryHandler {
+	return &CategoryHandler{store: store, bus: bus}
+}
+
+// scoped limits the handler to the categories a request works on
+func (h *CategoryHandler) scoped(r *http.Request) *CategoryHandler {
+	return &CategoryHandler{store: requestStore(r, h.store), bus: h.bus}
 }
 
 func (h *CategoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	
+	h = h.scoped(r)
+	
 	switch r.Method {
 	case http.MethodGet:
+		if path := strings.TrimPrefix(r.URL.Path, "/api/categories/"); path != r.URL.Path && path != "" {
+			h.getCategory(w, r, path)
+			return
+		}
 		h.getCategories(w, r)
 	case http.MethodPost:
 		h.createCategory(w, r)
 	case http.MethodPut:
 		h.updateCategory(w, r)
+	case http.MethodPatch:
+		h.patchCategory(w, r)
 	case http.MethodDelete:
 		h.deleteCategory(w, r)
 	default:
@@ -46,6 +62,68 @@ func (h *CategoryHandler) getCategories(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(categories)
 }
 
+// getCategory returns a single category with its version in the ETag header
+func (h *CategoryHandler) getCategory(w http.ResponseWriter, r *http.Request, path string) {
+	id, err := strconv.Atoi(path)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	
+	category, err := h.store.GetByID(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error getting category: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	
+	if notModified(w, r, category.Version) {
+		return
+	}
+	json.NewEncoder(w).Encode(category)
+}
+
+// checkVersion honours the If-Match header of a change to a category,
+// see checkIfMatch. It returns the version the change expects, see
+// ifMatchVersion.
+func (h *CategoryHandler) checkVersion(w http.ResponseWriter, r *http.Request, id int) (int, bool) {
+	if r.Header.Get("If-Match") == "" {
+		return 0, true
+	}
+	
+	category, err := h.store.GetByID(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return 0, false
+		}
+		log.Printf("Error getting category: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return 0, false
+	}
+	return category.Version, checkIfMatch(w, r, category.Version, category)
+}
+
+// versionConflict answers 412 Precondition Failed with the category as it
+// is now, for a change that another one overtook after checkIfMatch
+func (h *CategoryHandler) versionConflict(w http.ResponseWriter, id int) {
+	category, err := h.store.GetByID(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error getting category: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	preconditionFailed(w, category.Version, category)
+}
+
 func (h *CategoryHandler) createCategory(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Name  string `json:"name"`
@@ -77,6 +155,8 @@ func (h *CategoryHandler) createCategory(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	
+	h.bus.Publish(CurrentUser(r).ID, currentWorkspaceID(r), events.CategoryCreated, category)
+	w.Header().Set("ETag", etag(category.Version))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(category)
 }
@@ -108,8 +188,86 @@ func (h *CategoryHandler) updateCategory(w http.ResponseWriter, r *http.Request)
 		req.Color = "#007bff"
 	}
 	
-	category, err := h.store.Update(id, req.Name, req.Color)
+	version, ok := h.checkVersion(w, r, id)
+	if !ok {
+		return
+	}
+	
+	category, err := h.store.IfVersion(version).Update(id, req.Name, req.Color)
+	if err != nil {
+		if errors.Is(err, models.ErrVersionConflict) {
+			h.versionConflict(w, id)
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return
+		}
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			http.Error(w, "Category name already exists", http.StatusConflict)
+			return
+		}
+		log.Printf("Error updating category: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	
+	h.bus.Publish(CurrentUser(r).ID, currentWorkspaceID(r), events.CategoryUpdated, category)
+	w.Header().Set("ETag", etag(category.Version))
+	json.NewEncoder(w).Encode(category)
+}
+
+// categoryFields are the fields of a category that PATCH /api/categories/{id} changes
+type categoryFields struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// patchCategory changes the fields of a category named by a merge patch or
+// a JSON Patch, see applyPatch
+func (h *CategoryHandler) patchCategory(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/categories/")
+	id, err := strconv.Atoi(path)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	
+	category, err := h.store.GetByID(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error getting category: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	
+	if !checkIfMatch(w, r, category.Version, category) {
+		return
+	}
+	
+	var patched categoryFields
+	if !applyPatch(w, r, categoryFields{Name: category.Name, Color: category.Color}, &patched) {
+		return
+	}
+	
+	if strings.TrimSpace(patched.Name) == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	
+	if patched.Color == "" {
+		patched.Color = "#007bff"
+	}
+	
+	category, err = h.store.IfVersion(ifMatchVersion(r, category.Version)).Update(id, patched.Name, patched.Color)
 	if err != nil {
+		if errors.Is(err, models.ErrVersionConflict) {
+			h.versionConflict(w, id)
+			return
+		}
 		if strings.Contains(err.Error(), "not found") {
 			http.Error(w, "Category not found", http.StatusNotFound)
 			return
@@ -123,6 +281,8 @@ func (h *CategoryHandler) updateCategory(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	
+	h.bus.Publish(CurrentUser(r).ID, currentWorkspaceID(r), events.CategoryUpdated, category)
+	w.Header().Set("ETag", etag(category.Version))
 	json.NewEncoder(w).Encode(category)
 }
 
@@ -134,8 +294,17 @@ func (h *CategoryHandler) deleteCategory(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	
-	err = h.store.Delete(id)
+	version, ok := h.checkVersion(w, r, id)
+	if !ok {
+		return
+	}
+	
+	err = h.store.IfVersion(version).Delete(id)
 	if err != nil {
+		if errors.Is(err, models.ErrVersionConflict) {
+			h.versionConflict(w, id)
+			return
+		}
 		if strings.Contains(err.Error(), "not found") {
 			http.Error(w, "Category not found", http.StatusNotFound)
 			return
@@ -149,5 +318,6 @@ func (h *CategoryHandler) deleteCategory(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	
+	h.bus.Publish(CurrentUser(r).ID, currentWorkspaceID(r), events.CategoryDeleted, events.Deleted{ID: id})
 	w.WriteHeader(http.StatusNoContent)
 }
\ No newline at end of file
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// etag returns the ETag of a todo or category, which is its row version
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// checkIfMatch honours the If-Match header of a change to a todo or
+// category. When it names neither the current version nor "*", it answers
+// 412 Precondition Failed with current, the resource as it is now, and
+// returns false. Requests without If-Match always pass.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, version int, current any) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" || matchesETag(header, etag(version), false) {
+		return true
+	}
+
+	preconditionFailed(w, version, current)
+	return false
+}
+
+// preconditionFailed answers 412 Precondition Failed with current, the
+// resource as it is now
+func preconditionFailed(w http.ResponseWriter, version int, current any) {
+	w.Header().Set("ETag", etag(version))
+	w.WriteHeader(http.StatusPreconditionFailed)
+	json.NewEncoder(w).Encode(current)
+}
+
+// ifMatchVersion returns the version a change that passed checkIfMatch
+// expects the store to still hold, or 0 for a request without If-Match.
+// Stores made by IfVersion with it fail with models.ErrVersionConflict
+// when another change got in between the check and the write.
+func ifMatchVersion(r *http.Request, version int) int {
+	if r.Header.Get("If-Match") == "" {
+		return 0
+	}
+	return version
+}
+
+// notModified answers 304 Not Modified to a GET whose If-None-Match names
+// the current version
+func notModified(w http.ResponseWriter, r *http.Request, version int) bool {
+	w.Header().Set("ETag", etag(version))
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !matchesETag(header, etag(version), true) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// matchesETag reports whether a list of ETags from If-Match or
+// If-None-Match names tag; weak comparison ignores the W/ prefix
+func matchesETag(header, tag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gotodo/events"
+)
+
+// eventStreamBuffer is how many events may queue for a slow client before
+// it is disconnected; it resumes from its last event on reconnecting
+const eventStreamBuffer = 256
+
+// eventStreamHeartbeat keeps idle connections open through proxies
+const eventStreamHeartbeat = 30 * time.Second
+
+// EventHandler streams the events of a bus as Server-Sent Events
+type EventHandler struct {
+	bus *events.Bus
+}
+
+func NewEventHandler(bus *events.Bus) *EventHandler {
+	return &EventHandler{bus: bus}
+}
+
+// ServeHTTP streams the events of the changes to the signed-in user's todos
+// and categories, or to those of the workspace of the request, until the
+// client disconnects. A client sending Last-Event-ID (or ?last_event_id=)
+// first receives the events it missed, or a "reset" event when they are no
+// longer available.
+func (h *EventHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	userID, workspaceID := CurrentUser(r).ID, currentWorkspaceID(r)
+	visible := func(event events.Event) bool {
+		if workspaceID != 0 {
+			return event.WorkspaceID == workspaceID
+		}
+		return event.WorkspaceID == 0 && event.UserID == userID
+	}
+	stream := make(chan events.Event, eventStreamBuffer)
+	overflow := make(chan struct{})
+	send := func(event events.Event) {
+		if !visible(event) {
+			return
+		}
+		select {
+		case stream <- event:
+		default:
+			// Too far behind; drop the client rather than block the bus
+			select {
+			case <-overflow:
+			default:
+				close(overflow)
+			}
+		}
+	}
+
+	var missed []events.Event
+	complete := true
+	var unsubscribe func()
+	if lastEventID != "" {
+		lastID, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		missed, complete, unsubscribe = h.bus.SubscribeAfter(lastID, send)
+	} else {
+		unsubscribe = h.bus.Subscribe(send)
+	}
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, event := range missed {
+		if !visible(event) {
+			continue
+		}
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-overflow:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case event := <-stream:
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes an event in the text/event-stream format, with the same
+// JSON as webhook payloads
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", event.Type, err)
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gotodo/models"
+)
+
+// exportBatchSize is how many todos an export reads from the store at a
+// time, so that large exports are streamed instead of held in memory
+const exportBatchSize = 500
+
+// priorityLabels names the priorities in exports and imports
+var priorityLabels = map[int]string{1: "low", 2: "medium", 3: "high"}
+
+// exportColumns is the column order of CSV exports
+var exportColumns = []string{
+	"id", "title", "description", "category", "tags", "priority",
+	"due_date", "completed", "parent_id", "recurrence", "created_at", "updated_at",
+}
+
+// exportedTodo is a todo in the JSON export format, which POST /api/import
+// reads back. Categories and tags are given by name.
+type exportedTodo struct {
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Category    string     `json:"category,omitempty"`
+	Tags        []string   `json:"tags"`
+	Priority    string     `json:"priority"`
+	DueDate     *time.Time `json:"due_date"`
+	Completed   bool       `json:"completed"`
+	ParentID    *int       `json:"parent_id"`
+	Recurrence  string     `json:"recurrence,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// exportTodo converts a todo to the export format
+func exportTodo(todo models.Todo) exportedTodo {
+	exported := exportedTodo{
+		ID:          todo.ID,
+		Title:       todo.Title,
+		Description: todo.Description,
+		Tags:        []string{},
+		Priority:    priorityLabels[todo.Priority],
+		DueDate:     todo.DueDate,
+		Completed:   todo.Completed,
+		ParentID:    todo.ParentID,
+		CreatedAt:   todo.CreatedAt,
+		UpdatedAt:   todo.UpdatedAt,
+	}
+	if todo.Category != nil {
+		exported.Category = todo.Category.Name
+	}
+	for _, tag := range todo.Tags {
+		exported.Tags = append(exported.Tags, tag.Name)
+	}
+	if todo.Recurrence != nil {
+		exported.Recurrence = *todo.Recurrence
+	}
+	return exported
+}
+
+// exportWriter writes todos in one export format
+type exportWriter interface {
+	writeTodo(todo exportedTodo) error
+	// flush sends what has been written so far
+	flush() error
+	close() error
+}
+
+// ExportHandler serves GET /api/export, which downloads the todos matching
+// the filters of GET /api/todos as CSV, JSON or Markdown
+type ExportHandler struct {
+	store models.TodoRepository
+}
+
+func NewExportHandler(store models.TodoRepository) *ExportHandler {
+	return &ExportHandler{store: store}
+}
+
+// scoped limits the handler to the todos a request works on
+func (h *ExportHandler) scoped(r *http.Request) *ExportHandler {
+	return &ExportHandler{store: requestStore(r, h.store)}
+}
+
+func (h *ExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h = h.scoped(r)
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := parseTodoFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var contentType, extension string
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		contentType, extension = "application/json", "json"
+	case "csv":
+		contentType, extension = "text/csv; charset=utf-8", "csv"
+	case "markdown", "md":
+		contentType, extension = "text/markdown; charset=utf-8", "md"
+	default:
+		http.Error(w, "Invalid format. Use csv, json or markdown", http.StatusBadRequest)
+		return
+	}
+	filename := fmt.Sprintf("todos-%s.%s", time.Now().Format("2006-01-02"), extension)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	var export exportWriter
+	switch extension {
+	case "json":
+		export, err = newJSONExport(w)
+	case "csv":
+		export, err = newCSVExport(w)
+	case "md":
+		export, err = newMarkdownExport(w)
+	}
+
+	// The response has started, so errors can only be logged from here on
+	if err == nil {
+		err = eachTodoBatch(h.store, filter, func(todos []models.Todo) error {
+			for _, todo := range todos {
+				if err := export.writeTodo(exportTodo(todo)); err != nil {
+					return err
+				}
+			}
+			return export.flush()
+		})
+	}
+	if err == nil {
+		err = export.close()
+	}
+	if err != nil {
+		log.Printf("Error exporting todos: %v", err)
+	}
+}
+
+// eachTodoBatch lists the todos matching filter a batch at a time in the
+// order they were created, keeping to its limit and offset. Each batch
+// starts after the last todo of the one before, so todos added or deleted
+// meanwhile do not make it skip or repeat any.
+func eachTodoBatch(store models.TodoRepository, filter models.TodoFilter, fn func([]models.Todo) error) error {
+	filter.Sort = "id"
+	remaining := filter.Limit
+	for {
+		filter.Limit = exportBatchSize
+		if remaining > 0 && remaining < exportBatchSize {
+			filter.Limit = remaining
+		}
+		todos, _, err := store.List(filter)
+		if err != nil {
+			return err
+		}
+		if err := fn(todos); err != nil {
+			return err
+		}
+		if len(todos) < filter.Limit {
+			return nil
+		}
+
+		filter.AfterID = todos[len(todos)-1].ID
+		filter.Offset = 0
+		if remaining > 0 {
+			if remaining -= len(todos); remaining == 0 {
+				return nil
+			}
+		}
+	}
+}
+
+// flushResponse sends the buffered part of a streamed response
+func flushResponse(w io.Writer) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// jsonExport writes {"exported_at": ..., "todos": [...]} one todo at a time
+type jsonExport struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONExport(w io.Writer) (*jsonExport, error) {
+	_, err := fmt.Fprintf(w, "{\"exported_at\":%q,\"todos\":[", time.Now().UTC().Format(time.RFC3339))
+	return &jsonExport{w: w}, err
+}
+
+func (e *jsonExport) writeTodo(todo exportedTodo) error {
+	data, err := json.Marshal(todo)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		data = append([]byte(",\n"), data...)
+	} else {
+		data = append([]byte("\n"), data...)
+	}
+	e.count++
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonExport) flush() error {
+	flushResponse(e.w)
+	return nil
+}
+
+func (e *jsonExport) close() error {
+	_, err := io.WriteString(e.w, "\n]}\n")
+	return err
+}
+
+// csvExport writes a header row with exportColumns and a row per todo
+type csvExport struct {
+	w   io.Writer
+	csv *csv.Writer
+}
+
+func newCSVExport(w io.Writer) (*csvExport, error) {
+	e := &csvExport{w: w, csv: csv.NewWriter(w)}
+	return e, e.csv.Write(exportColumns)
+}
+
+// csvFormulaStarts are the first characters that make spreadsheets read a
+// cell as a formula
+const csvFormulaStarts = "=+-@\t\r"
+
+// csvText keeps spreadsheets from running a cell as a formula by putting a
+// ' before it; the CSV import takes it off again
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune(csvFormulaStarts, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func (e *csvExport) writeTodo(todo exportedTodo) error {
+	var dueDate, parentID string
+	if todo.DueDate != nil {
+		dueDate = todo.DueDate.UTC().Format(time.RFC3339)
+	}
+	if todo.ParentID != nil {
+		parentID = strconv.Itoa(*todo.ParentID)
+	}
+	return e.csv.Write([]string{
+		strconv.Itoa(todo.ID),
+		csvText(todo.Title),
+		csvText(todo.Description),
+		csvText(todo.Category),
+		csvText(strings.Join(todo.Tags, ", ")),
+		todo.Priority,
+		dueDate,
+		strconv.FormatBool(todo.Completed),
+		parentID,
+		csvText(todo.Recurrence),
+		todo.CreatedAt.UTC().Format(time.RFC3339),
+		todo.UpdatedAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func (e *csvExport) flush() error {
+	e.csv.Flush()
+	flushResponse(e.w)
+	return e.csv.Error()
+}
+
+func (e *csvExport) close() error {
+	return e.flush()
+}
+
+// markdownExport writes a task list, with the details of each todo after
+// its title and the description indented below it
+type markdownExport struct {
+	w io.Writer
+}
+
+func newMarkdownExport(w io.Writer) (*markdownExport, error) {
+	_, err := io.WriteString(w, "# Todos\n\n")
+	return &markdownExport{w: w}, err
+}
+
+func (e *markdownExport) writeTodo(todo exportedTodo) error {
+	check := " "
+	if todo.Completed {
+		check = "x"
+	}
+	details := []string{}
+	if todo.Category != "" {
+		details = append(details, markdownEscape(todo.Category))
+	}
+	details = append(details, todo.Priority)
+	if todo.DueDate != nil {
+		details = append(details, "due "+todo.DueDate.UTC().Format("2006-01-02 15:04"))
+	}
+	for _, tag := range todo.Tags {
+		details = append(details, "#"+markdownEscape(tag))
+	}
+
+	line := fmt.Sprintf("- [%s] %s · %s\n", check, markdownEscape(todo.Title), strings.Join(details, " · "))
+	if description := strings.TrimSpace(todo.Description); description != "" {
+		for _, descriptionLine := range strings.Split(description, "\n") {
+			line += "  " + markdownEscape(strings.TrimRight(descriptionLine, "\r")) + "\n"
+		}
+	}
+	_, err := io.WriteString(e.w, line)
+	return err
+}
+
+func (e *markdownExport) flush() error {
+	flushResponse(e.w)
+	return nil
+}
+
+func (e *markdownExport) close() error {
+	return nil
+}
+
+// markdownEscaper escapes the characters that would format text in Markdown
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`,
+	"<", `\<`, ">", `\>`, "#", `\#`, "|", `\|`,
+)
+
+// markdownEscape escapes text for a line of Markdown
+func markdownEscape(text string) string {
+	return markdownEscaper.Replace(text)
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"gotodo/models"
+)
+
+func TestCSVText(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"Buy milk", "Buy milk"},
+		{"=HYPERLINK(\"http://example.com\")", "'=HYPERLINK(\"http://example.com\")"},
+		{"+1 call", "'+1 call"},
+		{"-20% sale", "'-20% sale"},
+		{"@home", "'@home"},
+		{"\tindented", "'\tindented"},
+		{"\rreturn", "'\rreturn"},
+		{"a=b", "a=b"},
+		{"'quoted", "'quoted"},
+	}
+
+	for _, tt := range tests {
+		if got := csvText(tt.value); got != tt.want {
+			t.Errorf("csvText(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestEachTodoBatch(t *testing.T) {
+	store := models.NewMemoryTodoStore(models.NewMemoryDB())
+	count := exportBatchSize*2 + 10
+	for i := 1; i <= count; i++ {
+		if _, err := store.CreateFull(fmt.Sprintf("Todo %d", i), "", nil, 1, nil, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		limit, offset int
+		first, last   int
+	}{
+		{"everything", 0, 0, 1, count},
+		{"limit across batches", exportBatchSize + 5, 0, 1, exportBatchSize + 5},
+		{"offset", 0, 7, 8, count},
+		{"limit and offset", 540, 450, 451, 990},
+	}
+
+	for _, tt := range tests {
+		var ids []int
+		err := eachTodoBatch(store, models.TodoFilter{Limit: tt.limit, Offset: tt.offset}, func(todos []models.Todo) error {
+			for _, todo := range todos {
+				ids = append(ids, todo.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(ids) != tt.last-tt.first+1 || ids[0] != tt.first || ids[len(ids)-1] != tt.last {
+			t.Errorf("%s: got %d todos from %d to %d, want %d to %d", tt.name, len(ids), ids[0], ids[len(ids)-1], tt.first, tt.last)
+		}
+	}
+
+	// Deleting todos that were already read does not make later ones skipped
+	var ids []int
+	err := eachTodoBatch(store, models.TodoFilter{}, func(todos []models.Todo) error {
+		for _, todo := range todos {
+			ids = append(ids, todo.ID)
+		}
+		if len(ids) == exportBatchSize {
+			for id := 1; id <= 10; id++ {
+				if err := store.Delete(id); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != count || ids[len(ids)-1] != count {
+		t.Errorf("read %d todos ending at %d while deleting, want %d", len(ids), ids[len(ids)-1], count)
+	}
+}
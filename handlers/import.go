@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gotodo/events"
+	"gotodo/importer"
+	"gotodo/models"
+	"gotodo/recurrence"
+)
+
+// Limits of a single import
+const (
+	maxImportSize  = 10 << 20
+	maxImportTodos = 5000
+)
+
+// Outcomes of an import for a single todo
+const (
+	importCreated   = "created"
+	importDuplicate = "duplicate"
+	importFailed    = "failed"
+)
+
+// importResult reports what an import did, or would do, with one todo of
+// the file
+type importResult struct {
+	Title  string `json:"title"`
+	Status string `json:"status"`
+	// ID is the created todo, or the existing one a duplicate matches; it
+	// is not set in dry runs
+	ID       int      `json:"id,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// importReport is the response of POST /api/import
+type importReport struct {
+	Format            string         `json:"format"`
+	DryRun            bool           `json:"dry_run"`
+	Created           int            `json:"created"`
+	Duplicates        int            `json:"duplicates"`
+	Failed            int            `json:"failed"`
+	CategoriesCreated []string       `json:"categories_created"`
+	TagsCreated       []string       `json:"tags_created"`
+	Todos             []importResult `json:"todos"`
+}
+
+// ImportHandler serves POST /api/import, which creates todos from a file
+// exported by gotodo or another todo app, see package importer
+type ImportHandler struct {
+	store      models.TodoRepository
+	categories models.CategoryRepository
+	tags       models.TagRepository
+	audit      models.AuditRepository
+	bus        *events.Bus
+}
+
+func NewImportHandler(store models.TodoRepository, categories models.CategoryRepository, tags models.TagRepository, audit models.AuditRepository, bus *events.Bus) *ImportHandler {
+	return &ImportHandler{store: store, categories: categories, tags: tags, audit: audit, bus: bus}
+}
+
+// scoped limits the handler to the todos, categories and tags a request works on
+func (h *ImportHandler) scoped(r *http.Request) *ImportHandler {
+	return &ImportHandler{
+		store:      requestStore(r, h.store),
+		categories: requestStore(r, h.categories),
+		tags:       requestStore(r, h.tags),
+		audit:      requestStore(r, h.audit),
+		bus:        h.bus,
+	}
+}
+
+func (h *ImportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	h = h.scoped(r)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "dry_run must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	data, ok := readImportFile(w, r)
+	if !ok {
+		return
+	}
+	format, todos, err := importer.Parse(data, r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, "Invalid import: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(todos) > maxImportTodos {
+		http.Error(w, fmt.Sprintf("An import can create at most %d todos", maxImportTodos), http.StatusBadRequest)
+		return
+	}
+
+	report := &importReport{Format: format, DryRun: dryRun, CategoriesCreated: []string{}, TagsCreated: []string{}, Todos: []importResult{}}
+	if err := h.importTodos(r, report, todos); err != nil {
+		log.Printf("Error importing todos: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !dryRun {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// readImportFile returns the uploaded file, which is either the request body
+// or the "file" field of a multipart form
+func readImportFile(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	var data []byte
+	var err error
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		file, _, formErr := r.FormFile("file")
+		if formErr == nil {
+			defer file.Close()
+			data, err = io.ReadAll(file)
+		} else if errors.Is(formErr, http.ErrMissingFile) {
+			http.Error(w, "The form needs a file field", http.StatusBadRequest)
+			return nil, false
+		} else {
+			err = formErr
+		}
+	} else {
+		data, err = io.ReadAll(r.Body)
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("The file is larger than %d MB", maxImportSize>>20), http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Invalid upload", http.StatusBadRequest)
+		return nil, false
+	}
+	return data, true
+}
+
+// importTodos creates the todos of an import, or only works out what would
+// be created in a dry run. Todos matching an existing todo, or one earlier in
+// the file, are skipped as duplicates; categories and tags are created when
+// no existing one has their name. Failures of single todos are reported in
+// their result and the import goes on.
+func (h *ImportHandler) importTodos(r *http.Request, report *importReport, todos []importer.Todo) error {
+	categories, err := h.categories.GetAll()
+	if err != nil {
+		return err
+	}
+	categoryNames := &importNames{ids: make(map[string]int)}
+	for _, category := range categories {
+		categoryNames.ids[strings.ToLower(category.Name)] = category.ID
+	}
+	tags, err := h.tags.GetAll()
+	if err != nil {
+		return err
+	}
+	tagNames := &importNames{ids: make(map[string]int)}
+	for _, tag := range tags {
+		tagNames.ids[strings.ToLower(tag.Name)] = tag.ID
+	}
+	if !report.DryRun {
+		categoryNames.create = func(name string) (int, error) {
+			category, err := h.categories.Create(name, "#007bff")
+			if err != nil {
+				return 0, err
+			}
+			h.bus.Publish(CurrentUser(r).ID, currentWorkspaceID(r), events.CategoryCreated, category)
+			return category.ID, nil
+		}
+		tagNames.create = func(name string) (int, error) {
+			tag, err := h.tags.Create(name, "#6c757d")
+			if err != nil {
+				return 0, err
+			}
+			return tag.ID, nil
+		}
+	}
+
+	seen := make(map[string]int)
+	for _, filter := range []models.TodoFilter{{}, {Archived: true}} {
+		existing, _, err := h.store.List(filter)
+		if err != nil {
+			return err
+		}
+		for _, todo := range existing {
+			seen[duplicateKey(todo.ParentID, todo.Title, todo.DueDate)] = todo.ID
+		}
+	}
+
+	// ids holds the todo each entry became or matched, so that subtasks can
+	// find their parent; entries a dry run would create get negative ids
+	ids := make([]int, len(todos))
+	for i, entry := range todos {
+		result := importResult{Title: entry.Title, Warnings: entry.Warnings}
+
+		var parentID *int
+		if entry.Parent >= 0 {
+			if ids[entry.Parent] == 0 {
+				report.add(result, importFailed, "its parent was not imported")
+				continue
+			}
+			id := ids[entry.Parent]
+			parentID = &id
+		}
+
+		key := duplicateKey(parentID, entry.Title, entry.DueDate)
+		if id, ok := seen[key]; ok {
+			ids[i] = id
+			result.ID = max(id, 0)
+			report.add(result, importDuplicate, "")
+			continue
+		}
+
+		var rule *recurrence.Rule
+		if entry.Recurrence != "" {
+			if rule, err = recurrence.Parse(entry.Recurrence); err != nil {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("recurrence %q ignored: %v", entry.Recurrence, err))
+			}
+		}
+
+		categoryID, tagIDs, err := h.resolveNames(entry, categoryNames, tagNames)
+		if err != nil {
+			log.Printf("Error creating categories and tags for %q: %v", entry.Title, err)
+			report.add(result, importFailed, "its category or tags could not be created")
+			continue
+		}
+
+		if report.DryRun {
+			ids[i] = -(i + 1)
+			seen[key] = ids[i]
+			report.add(result, importCreated, "")
+			continue
+		}
+
+		todo, err := h.createTodo(entry, parentID, categoryID, tagIDs, rule)
+		if err != nil {
+			log.Printf("Error importing todo %q: %v", entry.Title, err)
+			report.add(result, importFailed, "it could not be created")
+			continue
+		}
+		ids[i] = todo.ID
+		seen[key] = todo.ID
+		result.ID = todo.ID
+		report.add(result, importCreated, "")
+
+		recordChange(h.audit, r, models.AuditCreated, nil, todo)
+		h.bus.Publish(CurrentUser(r).ID, currentWorkspaceID(r), events.TodoCreated, todo)
+	}
+
+	report.CategoriesCreated = append(report.CategoriesCreated, categoryNames.created...)
+	report.TagsCreated = append(report.TagsCreated, tagNames.created...)
+	return nil
+}
+
+// resolveNames returns the ids of the category and tags of an entry,
+// creating the ones that do not exist yet
+func (h *ImportHandler) resolveNames(entry importer.Todo, categories, tags *importNames) (*int, []int, error) {
+	var categoryID *int
+	if strings.TrimSpace(entry.Category) != "" {
+		id, err := categories.id(entry.Category)
+		if err != nil {
+			return nil, nil, err
+		}
+		categoryID = &id
+	}
+	var tagIDs []int
+	for _, name := range entry.Tags {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		id, err := tags.id(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !slices.Contains(tagIDs, id) {
+			tagIDs = append(tagIDs, id)
+		}
+	}
+	return categoryID, tagIDs, nil
+}
+
+// createTodo creates an imported todo in a single write, with the times the
+// file gives. The completion time stands in for the last change, which is
+// also what ARCHIVE_AFTER counts from.
+func (h *ImportHandler) createTodo(entry importer.Todo, parentID, categoryID *int, tagIDs []int, rule *recurrence.Rule) (*models.Todo, error) {
+	todo := models.TodoImport{
+		Title:       entry.Title,
+		Description: entry.Description,
+		CategoryID:  categoryID,
+		Priority:    entry.Priority,
+		DueDate:     entry.DueDate,
+		TagIDs:      tagIDs,
+		ParentID:    parentID,
+		Completed:   entry.Completed,
+		Rule:        rule,
+		CreatedAt:   entry.CreatedAt,
+	}
+	if entry.Completed && entry.CompletedAt != nil {
+		todo.UpdatedAt = entry.CompletedAt
+		// It cannot have been created after it was completed
+		if todo.CreatedAt == nil || todo.CreatedAt.After(*todo.UpdatedAt) {
+			todo.CreatedAt = todo.UpdatedAt
+		}
+	}
+	return h.store.Import(todo)
+}
+
+// add records the outcome of one todo of an import
+func (report *importReport) add(result importResult, status, message string) {
+	result.Status = status
+	result.Error = message
+	switch status {
+	case importCreated:
+		report.Created++
+	case importDuplicate:
+		report.Duplicates++
+	case importFailed:
+		report.Failed++
+	}
+	report.Todos = append(report.Todos, result)
+}
+
+// duplicateKey identifies todos that count as duplicates of each other: the
+// same title, ignoring case, and due date under the same parent
+func duplicateKey(parentID *int, title string, dueDate *time.Time) string {
+	parent := 0
+	if parentID != nil {
+		parent = *parentID
+	}
+	key := strconv.Itoa(parent) + "/" + strings.ToLower(strings.TrimSpace(title))
+	if dueDate != nil {
+		key += "@" + dueDate.UTC().Format("2006-01-02T15:04")
+	}
+	return key
+}
+
+// importNames finds categories or tags by name, ignoring case, and creates
+// the missing ones; without create, as in dry runs, they get negative ids
+type importNames struct {
+	ids     map[string]int
+	created []string
+	create  func(name string) (int, error)
+}
+
+func (n *importNames) id(name string) (int, error) {
+	name = strings.TrimSpace(name)
+	if id, ok := n.ids[strings.ToLower(name)]; ok {
+		return id, nil
+	}
+	id := -(len(n.created) + 1)
+	if n.create != nil {
+		var err error
+		if id, err = n.create(name); err != nil {
+			return 0, err
+		}
+	}
+	n.ids[strings.ToLower(name)] = id
+	n.created = append(n.created, name)
+	return id, nil
+}
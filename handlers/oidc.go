@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"gotodo/models"
+)
+
+// oidcCookie holds the state, nonce and PKCE verifier of a login in progress
+const oidcCookie = "gotodo_oidc"
+
+// oidcLoginTimeout is how long users have to sign in at the provider
+const oidcLoginTimeout = 10 * time.Minute
+
+// oidcClient talks to the provider; without a timeout a stuck provider
+// would hold up every login
+var oidcClient = &http.Client{Timeout: 10 * time.Second}
+
+// invalidUsernameChars are removed from the names a provider suggests
+var invalidUsernameChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// OIDCConfig configures sign-in through an OpenID Connect provider
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty for public clients, which rely on PKCE alone
+	RedirectURL  string // where the provider sends users back: .../api/auth/oidc/callback
+}
+
+// oidcLogin signs users in with the authorization code flow and PKCE
+type oidcLogin struct {
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// EnableOIDC lets users sign in through the provider of config, which it
+// discovers from the issuer. Users signing in for the first time get an
+// account, which is tied to the subject of their ID tokens.
+func (h *AuthHandler) EnableOIDC(ctx context.Context, config OIDCConfig) error {
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, oidcClient), config.Issuer)
+	if err != nil {
+		return fmt.Errorf("failed to discover OpenID Connect provider: %w", err)
+	}
+
+	h.oidc = &oidcLogin{
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+	}
+	return nil
+}
+
+// oidcLoginStart sends the user to the provider
+func (h *AuthHandler) oidcLoginStart(w http.ResponseWriter, r *http.Request) {
+	state, err := newToken()
+	if err != nil {
+		log.Printf("Error generating login state: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := newToken()
+	if err != nil {
+		log.Printf("Error generating login nonce: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	// The callback checks the state and nonce against this cookie; SameSite=Lax
+	// still sends it on the provider's redirect back
+	setOIDCCookie(w, r, strings.Join([]string{state, nonce, verifier}, "."), int(oidcLoginTimeout.Seconds()))
+
+	url := h.oidc.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// oidcCallback finishes a login when the provider sends the user back, and
+// signs them in
+func (h *AuthHandler) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if message := query.Get("error"); message != "" {
+		if description := query.Get("error_description"); description != "" {
+			message += ": " + description
+		}
+		http.Error(w, "Sign-in failed: "+message, http.StatusUnauthorized)
+		return
+	}
+
+	var state, nonce, verifier string
+	if cookie, err := r.Cookie(oidcCookie); err == nil {
+		parts := strings.Split(cookie.Value, ".")
+		if len(parts) == 3 {
+			state, nonce, verifier = parts[0], parts[1], parts[2]
+		}
+	}
+	setOIDCCookie(w, r, "", -1)
+	if state == "" || query.Get("state") != state {
+		http.Error(w, "Invalid or expired sign-in, please try again", http.StatusBadRequest)
+		return
+	}
+
+	ctx := oidc.ClientContext(r.Context(), oidcClient)
+	token, err := h.oidc.oauth2.Exchange(ctx, query.Get("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		log.Printf("Error exchanging authorization code: %v", err)
+		http.Error(w, "Sign-in failed", http.StatusBadGateway)
+		return
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		log.Printf("Error signing in: the provider returned no ID token")
+		http.Error(w, "Sign-in failed", http.StatusBadGateway)
+		return
+	}
+
+	// Verify checks the signature against the provider's keys, the issuer,
+	// the audience and the expiry
+	idToken, err := h.oidc.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		log.Printf("Error verifying ID token: %v", err)
+		http.Error(w, "Sign-in failed", http.StatusUnauthorized)
+		return
+	}
+	if idToken.Nonce != nonce {
+		log.Printf("Error verifying ID token: nonce mismatch")
+		http.Error(w, "Sign-in failed", http.StatusUnauthorized)
+		return
+	}
+
+	var claims struct {
+		PreferredUsername string `json:"preferred_username"`
+		Email             string `json:"email"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		log.Printf("Error reading ID token claims: %v", err)
+		http.Error(w, "Sign-in failed", http.StatusBadGateway)
+		return
+	}
+
+	user, err := h.identityUser(idToken.Issuer, idToken.Subject, claims.PreferredUsername, claims.Email)
+	if err != nil {
+		log.Printf("Error getting user of %s at %s: %v", idToken.Subject, idToken.Issuer, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.startSession(w, r, user); err != nil {
+		log.Printf("Error creating session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// identityUser returns the user of an OpenID Connect identity, creating one
+// named after the suggested username or email on the first sign-in
+func (h *AuthHandler) identityUser(issuer, subject, preferredUsername, email string) (*models.User, error) {
+	user, err := h.users.GetByIdentity(issuer, subject)
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		return user, err
+	}
+
+	base := oidcUsername(preferredUsername, email)
+	for i := 1; i <= 100; i++ {
+		username := base
+		if i > 1 {
+			username = fmt.Sprintf("%s%d", base, i)
+		}
+
+		user, err := h.users.CreateWithIdentity(username, issuer, subject)
+		if err == nil || !strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return user, err
+		}
+		// A concurrent first sign-in of the same identity may have created
+		// the user; only a taken username calls for another number
+		if user, lookupErr := h.users.GetByIdentity(issuer, subject); lookupErr == nil || !strings.Contains(lookupErr.Error(), "not found") {
+			return user, lookupErr
+		}
+		if !strings.Contains(err.Error(), "users.username") {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("no free username based on %q", base)
+}
+
+// oidcUsername makes a valid username out of the preferred_username claim,
+// or the part of the email before the @
+func oidcUsername(preferredUsername, email string) string {
+	local, _, _ := strings.Cut(email, "@")
+	for _, name := range []string{preferredUsername, local} {
+		name = invalidUsernameChars.ReplaceAllString(name, "")
+		if len(name) > 40 {
+			name = name[:40] // leaves room for a number when the name is taken
+		}
+		if len(name) >= 3 {
+			return name
+		}
+	}
+	return "user"
+}
+
+// setOIDCCookie sets the cookie of a login in progress, or clears it when
+// maxAge is negative
+func setOIDCCookie(w http.ResponseWriter, r *http.Request, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    value,
+		Path:     "/api/auth/oidc/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gotodo/models"
+)
+
+// fakeProvider is an OpenID Connect provider serving discovery, its keys
+// and a token endpoint that checks PKCE. Tests hand out authorization codes
+// with issueCode instead of going through a login page.
+type fakeProvider struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	mu    sync.Mutex
+	codes map[string]fakeCode
+}
+
+// fakeCode is an authorization code and the ID token it is exchanged for
+type fakeCode struct {
+	challenge string
+	claims    map[string]any
+	key       *rsa.PrivateKey // signs the ID token; the provider's key unless a test swaps it
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{key: key, clientID: "gotodo", codes: make(map[string]fakeCode)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/authorize",
+			"token_endpoint":                        p.server.URL + "/token",
+			"jwks_uri":                              p.server.URL + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", p.token)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// token exchanges an authorization code for an ID token, refusing code
+// verifiers that do not match the challenge of the login
+func (p *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	p.mu.Lock()
+	code, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signJWT(code.key, code.claims),
+	})
+}
+
+// issueCode returns a code for a login with the given PKCE challenge whose
+// ID token has the claims of a valid token for nonce, changed by change
+func (p *fakeProvider) issueCode(challenge, nonce string, change func(claims map[string]any, code *fakeCode)) string {
+	code := fakeCode{
+		challenge: challenge,
+		key:       p.key,
+		claims: map[string]any{
+			"iss":                p.server.URL,
+			"sub":                "subject-1",
+			"aud":                p.clientID,
+			"exp":                time.Now().Add(time.Hour).Unix(),
+			"iat":                time.Now().Unix(),
+			"nonce":              nonce,
+			"preferred_username": "alice",
+			"email":              "alice@example.com",
+		},
+	}
+	if change != nil {
+		change(code.claims, &code)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	name := fmt.Sprintf("code-%d", len(p.codes)+1)
+	p.codes[name] = code
+	return name
+}
+
+// signJWT signs claims with RS256
+func signJWT(key *rsa.PrivateKey, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		panic(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// oidcTest is an AuthHandler signing in through a fake provider
+type oidcTest struct {
+	provider *fakeProvider
+	users    models.UserRepository
+	auth     *AuthHandler
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+	provider := newFakeProvider(t)
+	db := models.NewMemoryDB()
+	users := models.NewMemoryUserStore(db)
+	auth := NewAuthHandler(users, models.NewMemoryWorkspaceStore(db))
+	err := auth.EnableOIDC(context.Background(), OIDCConfig{
+		Issuer:      provider.server.URL,
+		ClientID:    provider.clientID,
+		RedirectURL: "http://gotodo.test/api/auth/oidc/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &oidcTest{provider: provider, users: users, auth: auth}
+}
+
+// login starts a sign-in and returns the callback request the provider
+// would send the user back with. change edits the ID token, and tamper the
+// callback request.
+func (o *oidcTest) login(t *testing.T, change func(map[string]any, *fakeCode), tamper func(*http.Request)) *httptest.ResponseRecorder {
+	t.Helper()
+	start := httptest.NewRecorder()
+	o.auth.ServeHTTP(start, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil))
+	if start.Code != http.StatusFound {
+		t.Fatalf("login start: got %d, want 302", start.Code)
+	}
+	location, err := url.Parse(start.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := location.Query()
+	if params.Get("code_challenge_method") != "S256" {
+		t.Fatalf("login start: code_challenge_method = %q, want S256", params.Get("code_challenge_method"))
+	}
+
+	code := o.provider.issueCode(params.Get("code_challenge"), params.Get("nonce"), change)
+	callback := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?"+url.Values{
+		"code":  {code},
+		"state": {params.Get("state")},
+	}.Encode(), nil)
+	for _, cookie := range start.Result().Cookies() {
+		callback.AddCookie(cookie)
+	}
+	if tamper != nil {
+		tamper(callback)
+	}
+
+	rec := httptest.NewRecorder()
+	o.auth.ServeHTTP(rec, callback)
+	return rec
+}
+
+// sessionCookie returns the session a response started, if any
+func sessionCookie(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == SessionCookie && cookie.Value != "" {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// setLoginCookie replaces the cookie of the login in progress
+func setLoginCookie(r *http.Request, value func(old string) string) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name == oidcCookie {
+			cookie.Value = value(cookie.Value)
+		}
+		r.AddCookie(cookie)
+	}
+}
+
+func TestOIDCCallbackRejectsInvalidLogins(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(map[string]any, *fakeCode)
+		tamper func(*http.Request)
+		want   int
+	}{
+		{
+			name: "PKCE verifier mismatch",
+			tamper: func(r *http.Request) {
+				setLoginCookie(r, func(old string) string {
+					parts := strings.Split(old, ".")
+					return parts[0] + "." + parts[1] + ".not-the-verifier-of-this-login-at-all-0123456789"
+				})
+			},
+			want: http.StatusBadGateway,
+		},
+		{
+			name: "bad state",
+			tamper: func(r *http.Request) {
+				query := r.URL.Query()
+				query.Set("state", "forged")
+				r.URL.RawQuery = query.Encode()
+			},
+			want: http.StatusBadRequest,
+		},
+		{
+			name:   "missing login cookie",
+			tamper: func(r *http.Request) { r.Header.Del("Cookie") },
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:   "bad nonce",
+			change: func(claims map[string]any, _ *fakeCode) { claims["nonce"] = "replayed" },
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "wrong audience",
+			change: func(claims map[string]any, _ *fakeCode) { claims["aud"] = "another-client" },
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "wrong issuer",
+			change: func(claims map[string]any, _ *fakeCode) { claims["iss"] = "https://evil.example.com" },
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "expired token",
+			change: func(claims map[string]any, _ *fakeCode) { claims["exp"] = time.Now().Add(-time.Hour).Unix() },
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "bad signature",
+			change: func(_ map[string]any, code *fakeCode) { code.key = otherKey },
+			want:   http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOIDCTest(t)
+			rec := o.login(t, tt.change, tt.tamper)
+			if rec.Code != tt.want {
+				t.Fatalf("got %d (%s), want %d", rec.Code, strings.TrimSpace(rec.Body.String()), tt.want)
+			}
+			if sessionCookie(rec) != nil {
+				t.Fatal("a session was started")
+			}
+			if _, err := o.users.GetByIdentity(o.provider.server.URL, "subject-1"); err == nil {
+				t.Fatal("a user was created")
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackProvisionsAndFindsUsers(t *testing.T) {
+	o := newOIDCTest(t)
+
+	rec := o.login(t, nil, nil)
+	if rec.Code != http.StatusSeeOther || sessionCookie(rec) == nil {
+		t.Fatalf("first login: got %d (%s) without a session", rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+	user, err := o.users.GetByIdentity(o.provider.server.URL, "subject-1")
+	if err != nil {
+		t.Fatalf("first login did not create a user: %v", err)
+	}
+	if user.Username != "alice" {
+		t.Fatalf("username = %q, want alice", user.Username)
+	}
+	if _, err := o.users.SessionUser(hashToken(sessionCookie(rec).Value), time.Now()); err != nil {
+		t.Fatalf("session of the first login: %v", err)
+	}
+
+	rec = o.login(t, nil, nil)
+	if rec.Code != http.StatusSeeOther || sessionCookie(rec) == nil {
+		t.Fatalf("repeat login: got %d (%s) without a session", rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+	again, err := o.users.SessionUser(hashToken(sessionCookie(rec).Value), time.Now())
+	if err != nil {
+		t.Fatalf("session of the repeat login: %v", err)
+	}
+	if again.ID != user.ID {
+		t.Fatalf("repeat login signed in user %d, want %d", again.ID, user.ID)
+	}
+	if _, err := o.users.GetByUsername("alice2"); err == nil {
+		t.Fatal("repeat login created another user")
+	}
+
+	// Another subject with the same suggested name gets a numbered username
+	rec = o.login(t, func(claims map[string]any, _ *fakeCode) { claims["sub"] = "subject-2" }, nil)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("login of another subject: got %d", rec.Code)
+	}
+	other, err := o.users.GetByIdentity(o.provider.server.URL, "subject-2")
+	if err != nil || other.Username != "alice2" {
+		t.Fatalf("other subject: got %v, %v; want alice2", other, err)
+	}
+}
+
+// racingUsers misses the identity on its first lookup, as if a concurrent
+// first sign-in created the user just after it
+type racingUsers struct {
+	models.UserRepository
+	missed bool
+}
+
+func (u *racingUsers) GetByIdentity(issuer, subject string) (*models.User, error) {
+	if !u.missed {
+		u.missed = true
+		return nil, fmt.Errorf("user not found")
+	}
+	return u.UserRepository.GetByIdentity(issuer, subject)
+}
+
+func TestIdentityUserRace(t *testing.T) {
+	users := models.NewMemoryUserStore(models.NewMemoryDB())
+	existing, err := users.CreateWithIdentity("alice", "https://issuer", "subject-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewAuthHandler(&racingUsers{UserRepository: users}, nil)
+	user, err := h.identityUser("https://issuer", "subject-1", "alice", "")
+	if err != nil {
+		t.Fatalf("identityUser: %v", err)
+	}
+	if user.ID != existing.ID {
+		t.Fatalf("got user %d, want the existing user %d", user.ID, existing.ID)
+	}
+	if _, err := users.GetByUsername("alice2"); err == nil {
+		t.Fatal("the race created a second user")
+	}
+}
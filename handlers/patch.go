@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// jsonPatchType is the media type of JSON Patches; PATCH requests with any
+// other body are taken as merge patches
+const jsonPatchType = "application/json-patch+json"
+
+// errPatchTest reports a failed "test" operation of a JSON Patch
+var errPatchTest = errors.New("patch test failed")
+
+// applyPatch applies the patch in the request body to fields, the fields of
+// a resource that a client may change, and decodes the result into dest.
+// Merge patches (RFC 7396) replace the fields they name and remove those set
+// to null; JSON Patches (RFC 6902) are lists of operations on the fields.
+// It writes an error response and returns false when the patch is invalid.
+func applyPatch(w http.ResponseWriter, r *http.Request, fields, dest any) bool {
+	// Patches work on plain JSON values
+	var doc any
+	data, err := json.Marshal(fields)
+	if err == nil {
+		err = json.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == jsonPatchType {
+		var ops []patchOperation
+		if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+			http.Error(w, "Invalid JSON Patch; expected an array of operations", http.StatusBadRequest)
+			return false
+		}
+		doc, err = applyJSONPatch(doc, ops)
+	} else {
+		var patch any
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return false
+		}
+		doc = mergePatch(doc, patch)
+	}
+	if err != nil {
+		if errors.Is(err, errPatchTest) {
+			http.Error(w, "Patch test failed", http.StatusConflict)
+			return false
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	// Fields that cannot be changed are unknown here, so patching them fails
+	data, err = json.Marshal(doc)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dest); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			http.Error(w, fmt.Sprintf("Invalid patch: %s has the wrong type", typeErr.Field), http.StatusBadRequest)
+			return false
+		}
+		http.Error(w, "Invalid patch: "+strings.TrimPrefix(err.Error(), "json: "), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// mergePatch applies a JSON Merge Patch to target
+func mergePatch(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = make(map[string]any)
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergePatch(targetObject[key], value)
+		}
+	}
+	return targetObject
+}
+
+// patchOperation is a single operation of a JSON Patch
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch applies the operations of a JSON Patch to doc in order;
+// the first one that fails stops the patch
+func applyJSONPatch(doc any, ops []patchOperation) (any, error) {
+	for i, op := range ops {
+		var err error
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("Operation %d (%s) needs a value", i, op.Op)
+			}
+			var value any
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return nil, fmt.Errorf("Operation %d (%s) has an invalid value", i, op.Op)
+			}
+			switch op.Op {
+			case "add":
+				doc, err = addPointer(doc, op.Path, value)
+			case "replace":
+				if doc, _, err = removePointer(doc, op.Path); err == nil {
+					doc, err = addPointer(doc, op.Path, value)
+				}
+			case "test":
+				var current any
+				if current, err = getPointer(doc, op.Path); err == nil && !reflect.DeepEqual(current, value) {
+					err = errPatchTest
+				}
+			}
+		case "remove":
+			doc, _, err = removePointer(doc, op.Path)
+		case "move":
+			if op.Path != op.From && strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, fmt.Errorf("Operation %d (move) cannot move %q into itself", i, op.From)
+			}
+			var value any
+			if doc, value, err = removePointer(doc, op.From); err == nil {
+				doc, err = addPointer(doc, op.Path, value)
+			}
+		case "copy":
+			var value any
+			if value, err = getPointer(doc, op.From); err == nil {
+				doc, err = addPointer(doc, op.Path, copyJSON(value))
+			}
+		default:
+			return nil, fmt.Errorf("Operation %d has an unknown op %q (use add, remove, replace, move, copy or test)", i, op.Op)
+		}
+		if err != nil {
+			if errors.Is(err, errPatchTest) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("Operation %d (%s) failed: %v", i, op.Op, err)
+		}
+	}
+	return doc, nil
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// getPointer returns the value at a JSON Pointer
+func getPointer(doc any, pointer string) (any, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		if doc, err = child(doc, token); err != nil {
+			return nil, fmt.Errorf("path %q not found", pointer)
+		}
+	}
+	return doc, nil
+}
+
+// addPointer adds value at a JSON Pointer, replacing a member of an object
+// or inserting into an array ("-" appends)
+func addPointer(doc any, pointer string, value any) (any, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return updateParent(doc, tokens, func(container any, token string) (any, error) {
+		switch container := container.(type) {
+		case map[string]any:
+			container[token] = value
+			return container, nil
+		case []any:
+			i := len(container)
+			if token != "-" {
+				if i, err = arrayIndex(token, len(container)+1); err != nil {
+					return nil, err
+				}
+			}
+			return append(container[:i], append([]any{value}, container[i:]...)...), nil
+		}
+		return nil, fmt.Errorf("path %q not found", pointer)
+	})
+}
+
+// removePointer removes the value at a JSON Pointer and returns it
+func removePointer(doc any, pointer string) (any, any, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil, fmt.Errorf("the whole document cannot be removed")
+	}
+	var removed any
+	doc, err = updateParent(doc, tokens, func(container any, token string) (any, error) {
+		value, err := child(container, token)
+		if err != nil {
+			return nil, fmt.Errorf("path %q not found", pointer)
+		}
+		removed = value
+		switch container := container.(type) {
+		case map[string]any:
+			delete(container, token)
+			return container, nil
+		case []any:
+			i, _ := arrayIndex(token, len(container))
+			return append(container[:i], container[i+1:]...), nil
+		}
+		return container, nil
+	})
+	return doc, removed, err
+}
+
+// updateParent walks doc to the container of the last token and replaces it
+// with what update returns
+func updateParent(doc any, tokens []string, update func(container any, token string) (any, error)) (any, error) {
+	if len(tokens) == 1 {
+		return update(doc, tokens[0])
+	}
+	value, err := child(doc, tokens[0])
+	if err != nil {
+		return nil, err
+	}
+	if value, err = updateParent(value, tokens[1:], update); err != nil {
+		return nil, err
+	}
+	switch doc := doc.(type) {
+	case map[string]any:
+		doc[tokens[0]] = value
+	case []any:
+		i, _ := arrayIndex(tokens[0], len(doc))
+		doc[i] = value
+	}
+	return doc, nil
+}
+
+// child returns a member of an object or an element of an array
+func child(container any, token string) (any, error) {
+	switch container := container.(type) {
+	case map[string]any:
+		if value, ok := container[token]; ok {
+			return value, nil
+		}
+	case []any:
+		if i, err := arrayIndex(token, len(container)); err == nil {
+			return container[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%q not found", token)
+}
+
+// arrayIndex parses an array index of a JSON Pointer, which must be below n
+func arrayIndex(token string, n int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i >= n || (len(token) > 1 && token[0] == '0') || token[0] == '+' {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return i, nil
+}
+
+// copyJSON returns a deep copy of a plain JSON value
+func copyJSON(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(value))
+		for key, v := range value {
+			copied[key] = copyJSON(v)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(value))
+		for i, v := range value {
+			copied[i] = copyJSON(v)
+		}
+		return copied
+	}
+	return value
+}
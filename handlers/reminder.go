@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gotodo/models"
+)
+
+// ReminderHandler serves /api/todos/{id}/reminders and
+// /api/todos/{id}/reminders/{reminderID}
+type ReminderHandler struct {
+	store models.ReminderRepository
+}
+
+func NewReminderHandler(store models.ReminderRepository) *ReminderHandler {
+	return &ReminderHandler{store: store}
+}
+
+// scoped limits the handler to the reminders a request works on
+func (h *ReminderHandler) scoped(r *http.Request) *ReminderHandler {
+	return &ReminderHandler{store: requestStore(r, h.store)}
+}
+
+func (h *ReminderHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	h = h.scoped(r)
+
+	todoID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if v := r.PathValue("reminderID"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid reminder ID", http.StatusBadRequest)
+			return
+		}
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.deleteReminder(w, todoID, id)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.getReminders(w, todoID)
+	case http.MethodPost:
+		h.createReminder(w, r, todoID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *ReminderHandler) getReminders(w http.ResponseWriter, todoID int) {
+	reminders, err := h.store.List(todoID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error getting reminders: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(reminders)
+}
+
+func (h *ReminderHandler) createReminder(w http.ResponseWriter, r *http.Request, todoID int) {
+	var req struct {
+		RemindAt      *string `json:"remind_at"`      // fixed time
+		MinutesBefore *int    `json:"minutes_before"` // relative to the due date
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if (req.RemindAt == nil) == (req.MinutesBefore == nil) {
+		http.Error(w, "Either remind_at or minutes_before is required", http.StatusBadRequest)
+		return
+	}
+
+	var remindAt *time.Time
+	if req.RemindAt != nil {
+		parsed, err := parseFilterTime(*req.RemindAt)
+		if err != nil {
+			http.Error(w, "Invalid remind_at format. Use YYYY-MM-DDTHH:MM or RFC 3339", http.StatusBadRequest)
+			return
+		}
+		parsed = parsed.UTC()
+		remindAt = &parsed
+	}
+
+	if req.MinutesBefore != nil && *req.MinutesBefore < 0 {
+		http.Error(w, "minutes_before must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	reminder, err := h.store.Create(todoID, remindAt, req.MinutesBefore)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error creating reminder: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(reminder)
+}
+
+func (h *ReminderHandler) deleteReminder(w http.ResponseWriter, todoID, id int) {
+	if err := h.store.Delete(todoID, id); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Reminder not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error deleting reminder: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gotodo/models"
+)
+
+type TagHandler struct {
+	store models.TagRepository
+}
+
+func NewTagHandler(store models.TagRepository) *TagHandler {
+	return &TagHandler{store: store}
+}
+
+// scoped limits the handler to the tags a request works on
+func (h *TagHandler) scoped(r *http.Request) *TagHandler {
+	return &TagHandler{store: requestStore(r, h.store)}
+}
+
+func (h *TagHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	
+	h = h.scoped(r)
+	
+	switch r.Method {
+	case http.MethodGet:
+		h.getTags(w, r)
+	case http.MethodPost:
+		h.createTag(w, r)
+	case http.MethodPut:
+		h.updateTag(w, r)
+	case http.MethodDelete:
+		h.deleteTag(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *TagHandler) getTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.store.GetAll()
+	if err != nil {
+		log.Printf("Error getting tags: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	
+	if tags == nil {
+		tags = []models.Tag{}
+	}
+	
+	json.NewEncoder(w).Encode(tags)
+}
+
+func (h *TagHandler) createTag(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	}
+	
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	
+	if strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	
+	if req.Color == "" {
+		req.Color = "#6c757d" // Default color
+	}
+	
+	tag, err := h.store.Create(req.Name, req.Color)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			http.Error(w, "Tag already exists", http.StatusConflict)
+			return
+		}
+		log.Printf("Error creating tag: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tag)
+}
+
+func (h *TagHandler) updateTag(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/tags/")
+	id, err := strconv.Atoi(path)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	
+	var req struct {
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	}
+	
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	
+	if strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	
+	if req.Color == "" {
+		req.Color = "#6c757d"
+	}
+	
+	tag, err := h.store.Update(id, req.Name, req.Color)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Tag not found", http.StatusNotFound)
+			return
+		}
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			http.Error(w, "Tag name already exists", http.StatusConflict)
+			return
+		}
+		log.Printf("Error updating tag: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	
+	json.NewEncoder(w).Encode(tag)
+}
+
+func (h *TagHandler) deleteTag(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/tags/")
+	id, err := strconv.Atoi(path)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	
+	err = h.store.Delete(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Tag not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error deleting tag: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	
+	w.WriteHeader(http.StatusNoContent)
+}
\ No newline at end of file
@@ -2,33 +2,88 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
+	"gotodo/events"
 	"gotodo/models"
+	"gotodo/query"
+	"gotodo/recurrence"
 )
 
 type TodoHandler struct {
-	store *models.TodoStore
+	store models.TodoRepository
+	audit models.AuditRepository
+	bus   *events.Bus
 }
 
-func NewTodoHandler(store *models.TodoStore) *TodoHandler {
-	return &TodoHandler{store: store}
+func NewTodoHandler(store models.TodoRepository, audit models.AuditRepository, bus *events.Bus) *TodoHandler {
+	return &TodoHandler{store: store, audit: audit, bus: bus}
+}
+
+// scoped limits the handler to the todos a request works on
+func (h *TodoHandler) scoped(r *http.Request) *TodoHandler {
+	return &TodoHandler{store: requestStore(r, h.store), audit: requestStore(r, h.audit), bus: h.bus}
 }
 
 func (h *TodoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	
+	h = h.scoped(r)
+	
+	// /api/todos/{id}/subtasks lists and creates the subtasks of a todo,
+	// /api/todos/{id}/occurrences previews the next occurrences of a recurring one
+	id, subresource, err := todoSubresource(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	
 	switch r.Method {
 	case http.MethodGet:
-		h.getTodos(w, r)
+		switch subresource {
+		case "subtasks":
+			h.getSubtasks(w, r, id)
+		case "occurrences":
+			h.getOccurrences(w, r, id)
+		default:
+			if path := strings.TrimPrefix(r.URL.Path, "/api/todos/"); path != r.URL.Path && path != "" {
+				id, err := strconv.Atoi(path)
+				if err != nil {
+					http.Error(w, "Invalid ID", http.StatusBadRequest)
+					return
+				}
+				h.getTodo(w, r, id)
+				return
+			}
+			h.getTodos(w, r)
+		}
 	case http.MethodPost:
-		h.createTodo(w, r)
+		if subresource == "subtasks" {
+			h.createTodo(w, r, &id)
+		} else {
+			h.createTodo(w, r, nil)
+		}
 	case http.MethodPut:
 		h.updateTodo(w, r)
+	case http.MethodPatch:
+		if subresource != "" {
+			http.Error(w, "Invalid endpoint", http.StatusBadRequest)
+			return
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/todos/"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+		h.patchTodo(w, r, id)
 	case http.MethodDelete:
 		h.deleteTodo(w, r)
 	default:
@@ -36,37 +91,351 @@ func (h *TodoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// todoSubresource splits a path of the form /api/todos/{id}/{subresource}.
+// Other paths return an empty subresource.
+func todoSubresource(path string) (int, string, error) {
+	parts := strings.Split(strings.TrimPrefix(path, "/api/todos/"), "/")
+	if len(parts) != 2 {
+		return 0, "", nil
+	}
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", err
+	}
+	return id, parts[1], nil
+}
+
 func (h *TodoHandler) getTodos(w http.ResponseWriter, r *http.Request) {
-	// Get query parameters
-	searchQuery := r.URL.Query().Get("search")
+	h.listTodos(w, r, nil)
+}
+
+// getTodo returns a single todo with its version in the ETag header
+func (h *TodoHandler) getTodo(w http.ResponseWriter, r *http.Request, id int) {
+	todo, err := h.store.GetByID(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error getting todo: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	
+	if notModified(w, r, todo.Version) {
+		return
+	}
+	json.NewEncoder(w).Encode(todo)
+}
+
+// getSubtasks lists the direct subtasks of a todo, accepting the same parameters as getTodos
+func (h *TodoHandler) getSubtasks(w http.ResponseWriter, r *http.Request, parentID int) {
+	parent, err := h.store.GetByID(parentID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error getting todo: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 	
-	var todos []models.Todo
-	var err error
+	h.listTodos(w, r, parent)
+}
+
+// getOccurrences previews the next due dates of a recurring todo
+func (h *TodoHandler) getOccurrences(w http.ResponseWriter, r *http.Request, id int) {
+	count := 5
+	if v := r.URL.Query().Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > models.MaxOccurrencePreview {
+			http.Error(w, fmt.Sprintf("Count must be between 1 and %d", models.MaxOccurrencePreview), http.StatusBadRequest)
+			return
+		}
+		count = n
+	}
 	
-	if searchQuery != "" {
-		// Use search functionality
-		todos, err = h.store.Search(searchQuery)
-	} else {
-		// Get all todos
-		todos, err = h.store.GetAll()
+	todo, err := h.store.GetByID(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error getting todo: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	
+	occurrences, err := models.NextOccurrences(todo, count, time.Now())
+	if err != nil {
+		if strings.Contains(err.Error(), "does not recur") {
+			http.Error(w, "Todo does not recur", http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error computing occurrences: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	
+	if occurrences == nil {
+		occurrences = []time.Time{}
+	}
+	json.NewEncoder(w).Encode(occurrences)
+}
+
+// listTodos writes the todos matching the request's filters. With nested=true
+// only top-level todos (or the direct subtasks of parent) are listed, each
+// carrying its whole subtree in "subtasks".
+func (h *TodoHandler) listTodos(w http.ResponseWriter, r *http.Request, parent *models.Todo) {
+	filter, err := parseTodoFilter(r.URL.Query())
+	if err != nil {
+		var queryErr *query.Error
+		if errors.As(err, &queryErr) {
+			// Report the position so the UI can point at the bad token
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(queryErr)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 	
+	nested := false
+	if v := r.URL.Query().Get("nested"); v != "" {
+		nested, err = strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "Invalid nested value", http.StatusBadRequest)
+			return
+		}
+	}
+	
+	if parent != nil {
+		filter.ParentID = &parent.ID
+		filter.NoParent = false
+		// Subtasks are archived along with their parent
+		filter.Archived = parent.ArchivedAt != nil
+	} else if nested && filter.ParentID == nil {
+		filter.NoParent = true
+	}
+	
+	todos, total, err := h.store.List(filter)
 	if err != nil {
 		log.Printf("Error getting todos: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 	
+	if nested && len(todos) > 0 {
+		ids := make([]int, len(todos))
+		for i, todo := range todos {
+			ids[i] = todo.ID
+		}
+		descendants, err := h.store.Descendants(ids...)
+		if err != nil {
+			log.Printf("Error getting subtasks: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		todos = models.NestSubtasks(todos, descendants)
+	}
+	
+	if todos == nil {
+		todos = []models.Todo{}
+	}
+	
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
 	json.NewEncoder(w).Encode(todos)
 }
 
-func (h *TodoHandler) createTodo(w http.ResponseWriter, r *http.Request) {
+// parseTodoFilter reads the list filters, sort order and pagination from a query string
+func parseTodoFilter(q url.Values) (models.TodoFilter, error) {
+	filter := models.TodoFilter{
+		Sort: q.Get("sort"),
+	}
+
+	// The search box accepts the structured query language, e.g.
+	// category:仕事 priority:>=2 due:<2026-11-01 is:open "design review"
+	if v := strings.TrimSpace(q.Get("search")); v != "" {
+		parsed, queryErr := query.Parse(v, time.Now())
+		if queryErr != nil {
+			return filter, queryErr
+		}
+		filter.Query = parsed
+	}
+
+	if v := q.Get("category_id"); v != "" {
+		if v == "null" || v == "none" {
+			filter.NoCategory = true
+		} else {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				return filter, fmt.Errorf("Invalid category_id")
+			}
+			filter.CategoryID = &id
+		}
+	}
+
+	if v := q.Get("parent_id"); v != "" {
+		if v == "null" || v == "none" {
+			filter.NoParent = true
+		} else {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				return filter, fmt.Errorf("Invalid parent_id")
+			}
+			filter.ParentID = &id
+		}
+	}
+
+	if v := q.Get("series_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid series_id")
+		}
+		filter.SeriesID = &id
+	}
+
+	// tag_id=1,2 matches todos having all of the given tags
+	if v := q.Get("tag_id"); v != "" {
+		if v == "null" || v == "none" {
+			filter.NoTags = true
+		} else {
+			for _, part := range strings.Split(v, ",") {
+				id, err := strconv.Atoi(strings.TrimSpace(part))
+				if err != nil {
+					return filter, fmt.Errorf("Invalid tag_id")
+				}
+				filter.TagIDs = append(filter.TagIDs, id)
+			}
+		}
+	}
+
+	if v := q.Get("priority"); v != "" {
+		priority, err := strconv.Atoi(v)
+		if err != nil || priority < 1 || priority > 3 {
+			return filter, fmt.Errorf("Priority must be between 1 (low) and 3 (high)")
+		}
+		filter.Priority = &priority
+	}
+
+	if v := q.Get("completed"); v != "" {
+		completed, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid completed value")
+		}
+		filter.Completed = &completed
+	}
+
+	if v := q.Get("has_due_date"); v != "" {
+		hasDueDate, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid has_due_date value")
+		}
+		filter.HasDueDate = &hasDueDate
+	}
+
+	if v := q.Get("overdue"); v != "" {
+		overdue, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid overdue value")
+		}
+		filter.Overdue = overdue
+	}
+
+	if v := q.Get("archived"); v != "" {
+		archived, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid archived value")
+		}
+		filter.Archived = archived
+	}
+
+	for _, param := range []struct {
+		name string
+		dest **time.Time
+	}{
+		{"due_before", &filter.DueBefore},
+		{"due_after", &filter.DueAfter},
+	} {
+		if v := q.Get(param.name); v != "" {
+			parsed, err := parseFilterTime(v)
+			if err != nil {
+				return filter, fmt.Errorf("Invalid %s. Use YYYY-MM-DD, YYYY-MM-DDTHH:MM or RFC 3339", param.name)
+			}
+			*param.dest = &parsed
+		}
+	}
+
+	if _, err := models.ParseTodoSort(filter.Sort); err != nil {
+		return filter, fmt.Errorf("Invalid sort: %v", err)
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > models.MaxTodoLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", models.MaxTodoLimit)
+		}
+		filter.Limit = limit
+	}
+
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return filter, fmt.Errorf("offset must be a non-negative integer")
+		}
+		if filter.Limit == 0 {
+			filter.Limit = models.DefaultTodoLimit
+		}
+		filter.Offset = offset
+	}
+
+	return filter, nil
+}
+
+// parseFilterTime accepts the date formats used by the list filters
+func parseFilterTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %q", value)
+}
+
+// optional is a JSON field that tells an explicit null from a missing field
+type optional[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (o *optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+// parseRecurrence validates a recurrence rule from a request; an empty rule means none
+func parseRecurrence(value *string) (*recurrence.Rule, error) {
+	if value == nil || strings.TrimSpace(*value) == "" {
+		return nil, nil
+	}
+	rule, err := recurrence.Parse(*value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid recurrence: %v", err)
+	}
+	return rule, nil
+}
+
+// createTodo creates a top-level todo, or a subtask when parentID is set
+func (h *TodoHandler) createTodo(w http.ResponseWriter, r *http.Request, parentID *int) {
 	var req struct {
 		Title       string  `json:"title"`
 		Description string  `json:"description"`
 		CategoryID  *int    `json:"category_id"`
 		Priority    *int    `json:"priority"`
 		DueDate     *string `json:"due_date"` // ISO format string
+		TagIDs      []int   `json:"tag_ids"`
+		Recurrence  *string `json:"recurrence"` // RRULE such as FREQ=WEEKLY;BYDAY=MO
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -79,6 +448,12 @@ func (h *TodoHandler) createTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	rule, err := parseRecurrence(req.Recurrence)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
 	// Validate priority if provided
 	if req.Priority != nil && (*req.Priority < 1 || *req.Priority > 3) {
 		http.Error(w, "Priority must be between 1 (low) and 3 (high)", http.StatusBadRequest)
@@ -103,13 +478,33 @@ func (h *TodoHandler) createTodo(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Use CreateFull method to handle all fields
-	todo, err := h.store.CreateFull(req.Title, req.Description, req.CategoryID, priority, dueDate)
+	var todo *models.Todo
+	if parentID != nil {
+		todo, err = h.store.CreateSubtask(*parentID, req.Title, req.Description, req.CategoryID, priority, dueDate, req.TagIDs, rule)
+	} else {
+		todo, err = h.store.CreateFull(req.Title, req.Description, req.CategoryID, priority, dueDate, req.TagIDs, rule)
+	}
 	if err != nil {
+		if strings.Contains(err.Error(), "parent todo not found") {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		if strings.Contains(err.Error(), "category not found") {
+			http.Error(w, "Category not found", http.StatusBadRequest)
+			return
+		}
+		if strings.Contains(err.Error(), "tag not found") {
+			http.Error(w, "Tag not found", http.StatusBadRequest)
+			return
+		}
 		log.Printf("Error creating todo: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 	
+	recordChange(h.audit, r, models.AuditCreated, nil, todo)
+	h.bus.Publish(CurrentUser(r).ID, currentWorkspaceID(r), events.TodoCreated, todo)
+	w.Header().Set("ETag", etag(todo.Version))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(todo)
 }
@@ -143,8 +538,27 @@ func (h *TodoHandler) updateTodo(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *TodoHandler) toggleTodo(w http.ResponseWriter, r *http.Request, id int) {
-	todo, err := h.store.Toggle(id)
+	before, err := h.store.GetByID(id)
 	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error getting todo: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	
+	if !checkIfMatch(w, r, before.Version, before) {
+		return
+	}
+	
+	todo, completion, err := h.store.IfVersion(ifMatchVersion(r, before.Version)).Toggle(id)
+	if err != nil {
+		if errors.Is(err, models.ErrVersionConflict) {
+			h.versionConflict(w, id)
+			return
+		}
 		if strings.Contains(err.Error(), "not found") {
 			http.Error(w, "Todo not found", http.StatusNotFound)
 			return
@@ -154,32 +568,213 @@ func (h *TodoHandler) toggleTodo(w http.ResponseWriter, r *http.Request, id int)
 		return
 	}
 	
+	recordChange(h.audit, r, models.AuditToggled, before, todo)
+	h.bus.Publish(CurrentUser(r).ID, currentWorkspaceID(r), events.TodoToggled, todo)
+	publishCompletion(h.audit, h.bus, r, completion)
+	w.Header().Set("ETag", etag(todo.Version))
 	json.NewEncoder(w).Encode(todo)
 }
 
-func (h *TodoHandler) editTodo(w http.ResponseWriter, r *http.Request, id int) {
-	var req struct {
-		Title       string  `json:"title"`
-		Description string  `json:"description"`
-		CategoryID  *int    `json:"category_id"`
-		Priority    *int    `json:"priority"`
-		DueDate     *string `json:"due_date"` // ISO format string
+// publishCompletion records and announces the subtasks completed along with
+// a todo and the next occurrence its completion created, as the requests
+// making those changes would
+func publishCompletion(audit models.AuditRepository, bus *events.Bus, r *http.Request, completion *models.Completion) {
+	if completion == nil {
+		return
 	}
-	
+	userID, workspaceID := CurrentUser(r).ID, currentWorkspaceID(r)
+	for _, subtask := range completion.Subtasks {
+		recordChange(audit, r, models.AuditToggled, subtask.Before, subtask.After)
+		bus.Publish(userID, workspaceID, events.TodoToggled, subtask.After)
+	}
+	if completion.Next != nil {
+		recordChange(audit, r, models.AuditCreated, nil, completion.Next)
+		bus.Publish(userID, workspaceID, events.TodoCreated, completion.Next)
+	}
+}
+
+// versionConflict answers 412 Precondition Failed with the todo as it is
+// now, for a change that another one overtook after checkIfMatch
+func (h *TodoHandler) versionConflict(w http.ResponseWriter, id int) {
+	todo, err := h.store.GetByID(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error getting todo: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	preconditionFailed(w, todo.Version, todo)
+}
+
+// todoEdit is the body of PUT /api/todos/{id}
+type todoEdit struct {
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	CategoryID  *int    `json:"category_id"`
+	Priority    *int    `json:"priority"`
+	DueDate     *string `json:"due_date"` // ISO format string
+	// ParentID re-parents the todo; leaving it out keeps the current parent
+	ParentID optional[int] `json:"parent_id"`
+	// TagIDs replaces the tags; leaving it out keeps the current ones
+	TagIDs *[]int `json:"tag_ids"`
+	// Recurrence replaces the rule; null or "" stops the recurrence and
+	// leaving it out keeps the current rule
+	Recurrence optional[string] `json:"recurrence"`
+}
+
+func (h *TodoHandler) editTodo(w http.ResponseWriter, r *http.Request, id int) {
+	var req todoEdit
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 	
+	// The audit log records the changes against the todo as it was
+	before, err := h.store.GetByID(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error getting todo: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	
+	// A stale If-Match means someone else changed the todo in the meantime
+	if !checkIfMatch(w, r, before.Version, before) {
+		return
+	}
+	
+	todo, ok := h.saveTodo(w, id, ifMatchVersion(r, before.Version), req)
+	if !ok {
+		return
+	}
+	
+	recordChange(h.audit, r, models.AuditUpdated, before, todo)
+	h.bus.Publish(CurrentUser(r).ID, currentWorkspaceID(r), events.TodoUpdated, todo)
+	w.Header().Set("ETag", etag(todo.Version))
+	json.NewEncoder(w).Encode(todo)
+}
+
+// todoFields are the fields of a todo that PATCH /api/todos/{id} changes,
+// in the format of PUT /api/todos/{id}
+type todoFields struct {
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	CategoryID  *int    `json:"category_id"`
+	Priority    int     `json:"priority"`
+	DueDate     *string `json:"due_date"`
+	ParentID    *int    `json:"parent_id"`
+	TagIDs      []int   `json:"tag_ids"`
+	Recurrence  *string `json:"recurrence"`
+	Completed   bool    `json:"completed"`
+}
+
+// fieldsOfTodo returns the fields of a todo that a patch applies to
+func fieldsOfTodo(todo *models.Todo) todoFields {
+	fields := todoFields{
+		Title:       todo.Title,
+		Description: todo.Description,
+		CategoryID:  todo.CategoryID,
+		Priority:    todo.Priority,
+		ParentID:    todo.ParentID,
+		TagIDs:      []int{},
+		Recurrence:  todo.Recurrence,
+		Completed:   todo.Completed,
+	}
+	if todo.DueDate != nil {
+		dueDate := todo.DueDate.UTC().Format("2006-01-02T15:04")
+		fields.DueDate = &dueDate
+	}
+	for _, tag := range todo.Tags {
+		fields.TagIDs = append(fields.TagIDs, tag.ID)
+	}
+	return fields
+}
+
+// patchTodo changes the fields of a todo named by a merge patch or a JSON
+// Patch and leaves the others as they are, see applyPatch
+func (h *TodoHandler) patchTodo(w http.ResponseWriter, r *http.Request, id int) {
+	before, err := h.store.GetByID(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error getting todo: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	
+	if !checkIfMatch(w, r, before.Version, before) {
+		return
+	}
+	
+	var patched todoFields
+	if !applyPatch(w, r, fieldsOfTodo(before), &patched) {
+		return
+	}
+	
+	tagIDs := append([]int{}, patched.TagIDs...)
+	req := todoEdit{
+		Title:       patched.Title,
+		Description: patched.Description,
+		CategoryID:  patched.CategoryID,
+		Priority:    &patched.Priority,
+		DueDate:     patched.DueDate,
+		TagIDs:      &tagIDs,
+	}
+	// Moving a todo and setting its rule have side effects, so only do so on a change
+	if !reflect.DeepEqual(patched.ParentID, before.ParentID) {
+		req.ParentID = optional[int]{Set: true, Value: patched.ParentID}
+	}
+	if !reflect.DeepEqual(patched.Recurrence, before.Recurrence) {
+		req.Recurrence = optional[string]{Set: true, Value: patched.Recurrence}
+	}
+	
+	todo, ok := h.saveTodo(w, id, ifMatchVersion(r, before.Version), req)
+	if !ok {
+		return
+	}
+	
+	var completion *models.Completion
+	if todo.Completed != patched.Completed {
+		if todo, completion, err = h.store.IfVersion(ifMatchVersion(r, todo.Version)).Toggle(id); err != nil {
+			if errors.Is(err, models.ErrVersionConflict) {
+				h.versionConflict(w, id)
+				return
+			}
+			log.Printf("Error toggling todo: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	
+	recordChange(h.audit, r, models.AuditUpdated, before, todo)
+	h.bus.Publish(CurrentUser(r).ID, currentWorkspaceID(r), events.TodoUpdated, todo)
+	publishCompletion(h.audit, h.bus, r, completion)
+	w.Header().Set("ETag", etag(todo.Version))
+	json.NewEncoder(w).Encode(todo)
+}
+
+// saveTodo validates and stores the changes of a PUT or PATCH request in a
+// single write, writing an error response and returning false when they
+// fail. A version other than 0 makes a todo changed by someone else since
+// fail with 412.
+func (h *TodoHandler) saveTodo(w http.ResponseWriter, id int, version int, req todoEdit) (*models.Todo, bool) {
 	if strings.TrimSpace(req.Title) == "" {
 		http.Error(w, "Title is required", http.StatusBadRequest)
-		return
+		return nil, false
 	}
 	
 	// Validate priority if provided
 	if req.Priority != nil && (*req.Priority < 1 || *req.Priority > 3) {
 		http.Error(w, "Priority must be between 1 (low) and 3 (high)", http.StatusBadRequest)
-		return
+		return nil, false
 	}
 	
 	// Parse due date if provided
@@ -188,23 +783,55 @@ func (h *TodoHandler) editTodo(w http.ResponseWriter, r *http.Request, id int) {
 		parsed, err := time.Parse("2006-01-02T15:04", *req.DueDate)
 		if err != nil {
 			http.Error(w, "Invalid due date format. Use YYYY-MM-DDTHH:MM", http.StatusBadRequest)
-			return
+			return nil, false
 		}
 		dueDate = &parsed
 	}
 	
-	todo, err := h.store.Update(id, req.Title, req.Description, req.CategoryID, req.Priority, dueDate)
+	rule, err := parseRecurrence(req.Recurrence.Value)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	
+	edit := models.TodoEdit{
+		Title:         req.Title,
+		Description:   req.Description,
+		CategoryID:    req.CategoryID,
+		Priority:      req.Priority,
+		DueDate:       dueDate,
+		Move:          req.ParentID.Set,
+		ParentID:      req.ParentID.Value,
+		SetRecurrence: req.Recurrence.Set,
+		Rule:          rule,
+	}
+	if req.TagIDs != nil {
+		edit.TagIDs = append([]int{}, *req.TagIDs...)
+	}
+	
+	todo, err := h.store.IfVersion(version).Edit(id, edit)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrVersionConflict):
+			h.versionConflict(w, id)
+		case strings.Contains(err.Error(), "parent todo not found"):
+			http.Error(w, "Parent todo not found", http.StatusBadRequest)
+		case strings.Contains(err.Error(), "cycle"):
+			http.Error(w, "A todo cannot be moved under itself or one of its subtasks", http.StatusBadRequest)
+		case strings.Contains(err.Error(), "category not found"):
+			http.Error(w, "Category not found", http.StatusBadRequest)
+		case strings.Contains(err.Error(), "tag not found"):
+			http.Error(w, "Tag not found", http.StatusBadRequest)
+		case strings.Contains(err.Error(), "not found"):
 			http.Error(w, "Todo not found", http.StatusNotFound)
-			return
+		default:
+			log.Printf("Error updating todo: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
 		}
-		log.Printf("Error updating todo: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return nil, false
 	}
 	
-	json.NewEncoder(w).Encode(todo)
+	return todo, true
 }
 
 func (h *TodoHandler) deleteTodo(w http.ResponseWriter, r *http.Request) {
@@ -215,16 +842,56 @@ func (h *TodoHandler) deleteTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	err = h.store.Delete(id)
+	todo, err := h.store.GetByID(id)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			http.Error(w, "Todo not found", http.StatusNotFound)
 			return
 		}
+		log.Printf("Error getting todo: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	
+	if !checkIfMatch(w, r, todo.Version, todo) {
+		return
+	}
+	
+	// A todo with subtasks is only deleted together with them, on request
+	store := h.store.IfVersion(ifMatchVersion(r, todo.Version))
+	var deleted []models.Todo
+	if r.URL.Query().Get("cascade") == "true" {
+		deleted, err = h.store.Descendants(id)
+		if err != nil {
+			log.Printf("Error getting subtasks: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		err = store.DeleteTree(id)
+	} else {
+		err = store.Delete(id)
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrVersionConflict) {
+			h.versionConflict(w, id)
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		if strings.Contains(err.Error(), "has subtasks") {
+			http.Error(w, "Todo has subtasks; delete with ?cascade=true to remove them as well", http.StatusConflict)
+			return
+		}
 		log.Printf("Error deleting todo: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 	
+	for _, deletedTodo := range append(deleted, *todo) {
+		recordChange(h.audit, r, models.AuditDeleted, &deletedTodo, nil)
+		h.bus.Publish(CurrentUser(r).ID, currentWorkspaceID(r), events.TodoDeleted, events.Deleted{ID: deletedTodo.ID})
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
\ No newline at end of file
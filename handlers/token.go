@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gotodo/models"
+)
+
+// maxTokenNameLength matches the name column of api_tokens
+const maxTokenNameLength = 100
+
+// TokenHandler serves /api/tokens, where users manage their personal API
+// tokens
+type TokenHandler struct {
+	users models.UserRepository
+}
+
+func NewTokenHandler(users models.UserRepository) *TokenHandler {
+	return &TokenHandler{users: users}
+}
+
+func (h *TokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID := CurrentUser(r).ID
+
+	// /api/tokens and /api/tokens/{id}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/tokens"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.getTokens(w, userID)
+		case http.MethodPost:
+			h.createToken(w, r, userID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	id, err := strconv.Atoi(path)
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.deleteToken(w, userID, id)
+}
+
+// tokenRequest is the body of POST requests
+type tokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// validate checks the name and scopes of a request and removes duplicate scopes
+func (req *tokenRequest) validate() error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("Name is required")
+	}
+	if len(req.Name) > maxTokenNameLength {
+		return fmt.Errorf("Name must be at most %d characters", maxTokenNameLength)
+	}
+
+	if len(req.Scopes) == 0 {
+		return fmt.Errorf("At least one scope is required")
+	}
+	var scopes []string
+	for _, scope := range req.Scopes {
+		resource, access, _ := strings.Cut(scope, ":")
+		if !slices.Contains(tokenResources, resource) || (access != "read" && access != "write") {
+			return fmt.Errorf("Unknown scope %q (use %s followed by :read or :write)", scope, strings.Join(tokenResources, ", "))
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	req.Scopes = scopes
+	return nil
+}
+
+func (h *TokenHandler) getTokens(w http.ResponseWriter, userID int) {
+	tokens, err := h.users.APITokens(userID)
+	if err != nil {
+		log.Printf("Error getting API tokens: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func (h *TokenHandler) createToken(w http.ResponseWriter, r *http.Request, userID int) {
+	var req tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	secret, err := newToken()
+	if err != nil {
+		log.Printf("Error generating API token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	secret = apiTokenPrefix + secret
+
+	token, err := h.users.CreateAPIToken(userID, req.Name, hashToken(secret), req.Scopes)
+	if err != nil {
+		log.Printf("Error creating API token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// The token is only shown now
+	token.Token = secret
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(token)
+}
+
+func (h *TokenHandler) deleteToken(w http.ResponseWriter, userID, id int) {
+	if err := h.users.DeleteAPIToken(userID, id); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Token not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error deleting API token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gotodo/events"
+	"gotodo/models"
+)
+
+// TrashHandler serves the deleted todos: /api/trash lists them,
+// POST /api/trash/{id}/restore undoes a deletion and DELETE /api/trash/{id}
+// removes a todo for good
+type TrashHandler struct {
+	store models.TodoRepository
+	audit models.AuditRepository
+	bus   *events.Bus
+}
+
+func NewTrashHandler(store models.TodoRepository, audit models.AuditRepository, bus *events.Bus) *TrashHandler {
+	return &TrashHandler{store: store, audit: audit, bus: bus}
+}
+
+// scoped limits the handler to the trash a request works on
+func (h *TrashHandler) scoped(r *http.Request) *TrashHandler {
+	return &TrashHandler{store: requestStore(r, h.store), audit: requestStore(r, h.audit), bus: h.bus}
+}
+
+func (h *TrashHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	h = h.scoped(r)
+
+	if r.PathValue("id") == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.getTrash(w)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/restore") && r.Method == http.MethodPost:
+		h.restore(w, r, id)
+	case !strings.HasSuffix(r.URL.Path, "/restore") && r.Method == http.MethodDelete:
+		h.purge(w, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// getTrash lists the deleted todos, most recently deleted first. Subtasks
+// deleted along with their parent are restored and purged with it, so only
+// the parent is listed.
+func (h *TrashHandler) getTrash(w http.ResponseWriter) {
+	todos, err := h.store.Trash()
+	if err != nil {
+		log.Printf("Error getting trash: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(todos)
+}
+
+// restore takes a todo out of the trash with the subtasks deleted along with it
+func (h *TrashHandler) restore(w http.ResponseWriter, r *http.Request, id int) {
+	restored, err := h.store.Restore(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "parent todo is in the trash") {
+			http.Error(w, "The parent of this todo is in the trash; restore it first", http.StatusConflict)
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Todo not found in the trash", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error restoring todo: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	for _, todo := range restored {
+		recordChange(h.audit, r, models.AuditUndeleted, nil, &todo)
+		h.bus.Publish(CurrentUser(r).ID, currentWorkspaceID(r), events.TodoRestored, todo)
+	}
+	json.NewEncoder(w).Encode(restored[0])
+}
+
+// purge permanently removes a todo in the trash and its subtasks. Their
+// change history is kept.
+func (h *TrashHandler) purge(w http.ResponseWriter, id int) {
+	if err := h.store.Purge(id); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Todo not found in the trash", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error purging todo: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
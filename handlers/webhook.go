@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gotodo/events"
+	"gotodo/models"
+)
+
+type WebhookHandler struct {
+	store models.WebhookRepository
+}
+
+func NewWebhookHandler(store models.WebhookRepository) *WebhookHandler {
+	return &WebhookHandler{store: store}
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Requests only see the webhooks of the signed-in user; workspaces have none
+	if CurrentWorkspace(r) != nil {
+		http.Error(w, "Webhooks belong to users, not workspaces", http.StatusBadRequest)
+		return
+	}
+	h = &WebhookHandler{store: h.store.ForUser(CurrentUser(r).ID)}
+
+	// /api/webhooks, /api/webhooks/{id} and /api/webhooks/{id}/deliveries
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/webhooks"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.getWebhooks(w)
+		case http.MethodPost:
+			h.createWebhook(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) > 2 || (len(parts) == 2 && parts[1] != "deliveries") {
+		http.Error(w, "Invalid endpoint", http.StatusBadRequest)
+		return
+	}
+
+	if len(parts) == 2 {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.getDeliveries(w, r, id)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.getWebhook(w, id)
+	case http.MethodPut:
+		h.updateWebhook(w, r, id)
+	case http.MethodDelete:
+		h.deleteWebhook(w, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// webhookRequest is the body of POST and PUT requests
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Secret signs the payloads; POST generates one when it is left out,
+	// PUT keeps the current one
+	Secret *string `json:"secret"`
+	Active *bool   `json:"active"` // PUT only; left out keeps the current state
+}
+
+// validate checks the URL and event patterns of a request
+func (req *webhookRequest) validate() error {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("A valid http or https URL is required")
+	}
+	if req.Events == nil {
+		req.Events = []string{}
+	}
+	for _, pattern := range req.Events {
+		if !events.ValidPattern(pattern) {
+			return fmt.Errorf("Unknown event %q (use %s, todo.*, category.* or *)", pattern, strings.Join(events.Types, ", "))
+		}
+	}
+	if req.Secret != nil && *req.Secret == "" {
+		return fmt.Errorf("Secret must not be empty")
+	}
+	return nil
+}
+
+// withoutSecret hides the secret, which is only shown when it is set
+func withoutSecret(webhook models.Webhook) models.Webhook {
+	webhook.Secret = ""
+	return webhook
+}
+
+func (h *WebhookHandler) getWebhooks(w http.ResponseWriter) {
+	webhooks, err := h.store.GetAll()
+	if err != nil {
+		log.Printf("Error getting webhooks: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range webhooks {
+		webhooks[i] = withoutSecret(webhooks[i])
+	}
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+func (h *WebhookHandler) getWebhook(w http.ResponseWriter, id int) {
+	webhook, err := h.store.GetByID(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error getting webhook: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(withoutSecret(*webhook))
+}
+
+func (h *WebhookHandler) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	secret := ""
+	if req.Secret != nil {
+		secret = *req.Secret
+	} else {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Printf("Error generating webhook secret: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		secret = hex.EncodeToString(key)
+	}
+
+	webhook, err := h.store.Create(req.URL, req.Events, secret)
+	if err != nil {
+		log.Printf("Error creating webhook: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// The secret is returned this once so the receiver can verify signatures
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func (h *WebhookHandler) updateWebhook(w http.ResponseWriter, r *http.Request, id int) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	active := true
+	if req.Active != nil {
+		active = *req.Active
+	} else {
+		current, err := h.store.GetByID(id)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				http.Error(w, "Webhook not found", http.StatusNotFound)
+				return
+			}
+			log.Printf("Error getting webhook: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		active = current.Active
+	}
+
+	webhook, err := h.store.Update(id, req.URL, req.Events, req.Secret, active)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error updating webhook: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(withoutSecret(*webhook))
+}
+
+func (h *WebhookHandler) deleteWebhook(w http.ResponseWriter, id int) {
+	if err := h.store.Delete(id); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error deleting webhook: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getDeliveries returns the delivery log of a webhook, newest first
+func (h *WebhookHandler) getDeliveries(w http.ResponseWriter, r *http.Request, id int) {
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 1000 {
+			http.Error(w, "Limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := h.store.Deliveries(id, limit)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error getting webhook deliveries: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(deliveries)
+}
@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gotodo/models"
+)
+
+// maxWorkspaceNameLength matches the name column of workspaces
+const maxWorkspaceNameLength = 100
+
+// invitationLifetime is how long an invitation link can be used
+const invitationLifetime = 7 * 24 * time.Hour
+
+// requestStore returns the part of store a request works on: the workspace
+// it asks for, or else the signed-in user's personal data
+func requestStore[R any](r *http.Request, store interface {
+	ForUser(userID int) R
+	ForWorkspace(workspaceID int) R
+}) R {
+	if workspace := CurrentWorkspace(r); workspace != nil {
+		return store.ForWorkspace(workspace.ID)
+	}
+	return store.ForUser(CurrentUser(r).ID)
+}
+
+// currentWorkspaceID returns the ID of the workspace of a request, or 0
+func currentWorkspaceID(r *http.Request) int {
+	if workspace := CurrentWorkspace(r); workspace != nil {
+		return workspace.ID
+	}
+	return 0
+}
+
+// WorkspaceHandler serves /api/workspaces, where users create workspaces,
+// and their owners manage members and invitation links
+type WorkspaceHandler struct {
+	workspaces models.WorkspaceRepository
+}
+
+func NewWorkspaceHandler(workspaces models.WorkspaceRepository) *WorkspaceHandler {
+	return &WorkspaceHandler{workspaces: workspaces}
+}
+
+func (h *WorkspaceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID := CurrentUser(r).ID
+
+	// /api/workspaces, /api/workspaces/join, /api/workspaces/{id},
+	// /api/workspaces/{id}/members[/{userID}] and
+	// /api/workspaces/{id}/invitations[/{invitationID}]
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/workspaces"), "/")
+	switch path {
+	case "":
+		switch r.Method {
+		case http.MethodGet:
+			h.getWorkspaces(w, userID)
+		case http.MethodPost:
+			h.createWorkspace(w, r, userID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	case "join":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.join(w, r, userID)
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.Error(w, "Invalid workspace ID", http.StatusBadRequest)
+		return
+	}
+	workspace, err := h.workspaces.Get(id, userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Workspace not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error getting workspace: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Every member may look; only owners make changes, except that members
+	// may leave
+	var subID int
+	if len(parts) == 3 {
+		if subID, err = strconv.Atoi(parts[2]); err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+	}
+	leaving := len(parts) == 3 && parts[1] == "members" && subID == userID && r.Method == http.MethodDelete
+	if r.Method != http.MethodGet && workspace.Role != models.RoleOwner && !leaving {
+		http.Error(w, "Only owners can manage this workspace", http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(workspace)
+		case http.MethodPut:
+			h.renameWorkspace(w, r, workspace)
+		case http.MethodDelete:
+			h.deleteWorkspace(w, workspace)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	case len(parts) == 2 && parts[1] == "members":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.getMembers(w, workspace)
+	case len(parts) == 3 && parts[1] == "members":
+		switch r.Method {
+		case http.MethodPut:
+			h.setRole(w, r, workspace, subID)
+		case http.MethodDelete:
+			h.removeMember(w, workspace, subID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	case len(parts) == 2 && parts[1] == "invitations":
+		switch r.Method {
+		case http.MethodGet:
+			h.getInvitations(w, workspace)
+		case http.MethodPost:
+			h.createInvitation(w, r, workspace)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	case len(parts) == 3 && parts[1] == "invitations":
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.deleteInvitation(w, workspace, subID)
+	default:
+		http.Error(w, "Invalid endpoint", http.StatusNotFound)
+	}
+}
+
+// workspaceName reads and checks the name in the body of a request
+func workspaceName(r *http.Request) (string, error) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return "", fmt.Errorf("Invalid JSON")
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return "", fmt.Errorf("Name is required")
+	}
+	if len(name) > maxWorkspaceNameLength {
+		return "", fmt.Errorf("Name must be at most %d characters", maxWorkspaceNameLength)
+	}
+	return name, nil
+}
+
+func (h *WorkspaceHandler) getWorkspaces(w http.ResponseWriter, userID int) {
+	workspaces, err := h.workspaces.List(userID)
+	if err != nil {
+		log.Printf("Error getting workspaces: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(workspaces)
+}
+
+func (h *WorkspaceHandler) createWorkspace(w http.ResponseWriter, r *http.Request, userID int) {
+	name, err := workspaceName(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	workspace, err := h.workspaces.Create(userID, name)
+	if err != nil {
+		log.Printf("Error creating workspace: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(workspace)
+}
+
+func (h *WorkspaceHandler) renameWorkspace(w http.ResponseWriter, r *http.Request, workspace *models.Workspace) {
+	name, err := workspaceName(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.workspaces.Rename(workspace.ID, name); err != nil {
+		log.Printf("Error renaming workspace: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	workspace.Name = name
+	json.NewEncoder(w).Encode(workspace)
+}
+
+func (h *WorkspaceHandler) deleteWorkspace(w http.ResponseWriter, workspace *models.Workspace) {
+	if err := h.workspaces.Delete(workspace.ID); err != nil {
+		log.Printf("Error deleting workspace: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WorkspaceHandler) getMembers(w http.ResponseWriter, workspace *models.Workspace) {
+	members, err := h.workspaces.Members(workspace.ID)
+	if err != nil {
+		log.Printf("Error getting workspace members: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(members)
+}
+
+func (h *WorkspaceHandler) setRole(w http.ResponseWriter, r *http.Request, workspace *models.Workspace, userID int) {
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Role != models.RoleOwner && req.Role != models.RoleEditor && req.Role != models.RoleViewer {
+		http.Error(w, "Role must be owner, editor or viewer", http.StatusBadRequest)
+		return
+	}
+
+	h.changeMember(w, h.workspaces.SetRole(workspace.ID, userID, req.Role))
+}
+
+func (h *WorkspaceHandler) removeMember(w http.ResponseWriter, workspace *models.Workspace, userID int) {
+	h.changeMember(w, h.workspaces.RemoveMember(workspace.ID, userID))
+}
+
+// changeMember answers a request that changed a member with err
+func (h *WorkspaceHandler) changeMember(w http.ResponseWriter, err error) {
+	if err != nil {
+		if strings.Contains(err.Error(), "member not found") {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		}
+		if strings.Contains(err.Error(), "last owner") {
+			http.Error(w, "A workspace needs at least one owner", http.StatusConflict)
+			return
+		}
+		log.Printf("Error changing workspace member: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WorkspaceHandler) getInvitations(w http.ResponseWriter, workspace *models.Workspace) {
+	invitations, err := h.workspaces.Invitations(workspace.ID, time.Now())
+	if err != nil {
+		log.Printf("Error getting invitations: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(invitations)
+}
+
+func (h *WorkspaceHandler) createInvitation(w http.ResponseWriter, r *http.Request, workspace *models.Workspace) {
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Role != models.RoleEditor && req.Role != models.RoleViewer {
+		http.Error(w, "Role must be editor or viewer", http.StatusBadRequest)
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		log.Printf("Error generating invitation token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	invitation, err := h.workspaces.CreateInvitation(workspace.ID, hashToken(token), req.Role, time.Now().Add(invitationLifetime))
+	if err != nil {
+		log.Printf("Error creating invitation: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// The link is only shown now; the app joins the workspace when it is
+	// opened by a signed-in user
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	invitation.Token = token
+	invitation.URL = scheme + "://" + r.Host + "/?invite=" + token
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invitation)
+}
+
+func (h *WorkspaceHandler) deleteInvitation(w http.ResponseWriter, workspace *models.Workspace, id int) {
+	if err := h.workspaces.DeleteInvitation(workspace.ID, id); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Invitation not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error deleting invitation: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// join adds the user to the workspace of the invitation token in the body
+func (h *WorkspaceHandler) join(w http.ResponseWriter, r *http.Request, userID int) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	workspace, err := h.workspaces.Join(hashToken(strings.TrimSpace(req.Token)), userID, time.Now())
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Invalid or expired invitation", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error joining workspace: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(workspace)
+}
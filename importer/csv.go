@@ -0,0 +1,228 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// csvColumns lists the header names accepted for each field of a CSV import,
+// after columnIndex has normalised them
+var csvColumns = map[string][]string{
+	"id":           {"id"},
+	"title":        {"title", "name", "task", "content", "subject"},
+	"description":  {"description", "notes", "note", "desc", "body"},
+	"category":     {"category", "list", "project"},
+	"tags":         {"tags", "labels"},
+	"priority":     {"priority", "importance"},
+	"due_date":     {"due_date", "due", "deadline", "date"},
+	"completed":    {"completed", "done", "status"},
+	"parent_id":    {"parent_id", "parent"},
+	"recurrence":   {"recurrence", "rrule"},
+	"created_at":   {"created_at", "created", "date_created", "creation_date"},
+	"completed_at": {"completed_at", "date_completed", "completion_date"},
+	"updated_at":   {"updated_at", "modified", "last_modified"},
+}
+
+// csvFile reads the rows of a CSV file by column name
+type csvFile struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVFile(data []byte) (*csvFile, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	return &csvFile{reader: reader, columns: columnIndex(header)}, nil
+}
+
+// columnIndex maps the lower-case names of a header row, with spaces
+// replaced by underscores, to their positions
+func columnIndex(header []string) map[string]int {
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
+		if _, ok := columns[name]; !ok {
+			columns[name] = i
+		}
+	}
+	return columns
+}
+
+// has reports whether the file has a column for field
+func (f *csvFile) has(field string) bool {
+	for _, name := range csvColumns[field] {
+		if _, ok := f.columns[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// each calls fn with every row of the file; get returns the value of a
+// field of csvColumns in the row, or of the column named field
+func (f *csvFile) each(fn func(get func(field string) string)) error {
+	for {
+		record, err := f.reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid CSV: %v", err)
+		}
+		fn(func(field string) string {
+			names, ok := csvColumns[field]
+			if !ok {
+				names = []string{field}
+			}
+			for _, name := range names {
+				if i, ok := f.columns[name]; ok && i < len(record) {
+					return strings.TrimSpace(record[i])
+				}
+			}
+			return ""
+		})
+	}
+}
+
+// csvText takes off the ' that the CSV export puts before cells starting
+// with =, +, -, @, a tab or a carriage return, so that spreadsheets do not
+// run them as formulas
+func csvText(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune("=+-@\t\r", rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
+
+// parseCSV reads a CSV file with a header row naming the fields of
+// csvColumns, of which only the title is required
+func parseCSV(data []byte) ([]Todo, error) {
+	file, err := newCSVFile(data)
+	if err != nil {
+		return nil, err
+	}
+	if !file.has("title") {
+		return nil, fmt.Errorf("the CSV file needs a title column")
+	}
+
+	var todos []Todo
+	err = file.each(func(get func(string) string) {
+		if get("title") == "" {
+			return
+		}
+		todo := newTodo(csvText(get("title")))
+		todo.key = get("id")
+		todo.parentKey = get("parent_id")
+		todo.Description = csvText(get("description"))
+		todo.Category = csvText(get("category"))
+		todo.Tags = splitList(csvText(get("tags")))
+		todo.Completed = parseBool(get("completed"))
+		todo.Recurrence = csvText(get("recurrence"))
+		if value := get("priority"); value != "" {
+			if priority, ok := parsePriority(value); ok {
+				todo.Priority = priority
+			} else {
+				todo.warn("priority %q not understood", value)
+			}
+		}
+		if value := get("due_date"); value != "" {
+			if due, ok := parseDate(value); ok {
+				todo.DueDate = due
+			} else {
+				todo.warn("due date %q not understood", value)
+			}
+		}
+		todo.CreatedAt = parseTime(&todo, "creation time", get("created_at"))
+		if todo.Completed {
+			// gotodo's CSV export has no completion time; its last change
+			// is the closest to one
+			todo.CompletedAt = parseTime(&todo, "completion time", get("completed_at"))
+			if todo.CompletedAt == nil {
+				todo.CompletedAt = parseTime(&todo, "update time", get("updated_at"))
+			}
+		}
+		todos = append(todos, todo)
+	})
+	return todos, err
+}
+
+// parseTodoist reads a Todoist project template. Sections become
+// categories, @labels in the task content become tags and INDENT nests
+// subtasks; notes are added to the description of the task before them.
+// Todoist priorities run from 1 (p1, the highest) to 4.
+func parseTodoist(data []byte) ([]Todo, error) {
+	file, err := newCSVFile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var todos []Todo
+	var section string
+	var parents []string // keys of the last task at each indent level
+	err = file.each(func(get func(string) string) {
+		content := get("content")
+		switch strings.ToLower(get("type")) {
+		case "section":
+			section = content
+			parents = nil
+		case "note":
+			if len(todos) > 0 && content != "" {
+				last := &todos[len(todos)-1]
+				last.Description = strings.TrimSpace(last.Description + "\n\n" + content)
+			}
+		case "task":
+			var words, labels []string
+			for _, word := range strings.Fields(content) {
+				if len(word) > 1 && word[0] == '@' {
+					labels = append(labels, word[1:])
+				} else {
+					words = append(words, word)
+				}
+			}
+			if len(words) == 0 {
+				return
+			}
+			todo := newTodo(strings.Join(words, " "))
+			todo.Tags = labels
+			todo.Description = get("description")
+			todo.Category = section
+
+			switch value := get("priority"); value {
+			case "1":
+				todo.Priority = 3
+			case "2":
+				todo.Priority = 2
+			case "", "3", "4":
+			default:
+				todo.warn("priority %q not understood", value)
+			}
+			if value := get("date"); value != "" {
+				if due, ok := parseDate(value); ok {
+					todo.DueDate = due
+				} else {
+					todo.warn("due date %q not understood", value)
+				}
+			}
+
+			indent, _ := strconv.Atoi(get("indent"))
+			indent = max(1, min(indent, len(parents)+1))
+			parents = parents[:indent-1]
+			if len(parents) > 0 {
+				todo.parentKey = parents[len(parents)-1]
+			}
+			todo.key = strconv.Itoa(len(todos))
+			parents = append(parents, todo.key)
+			todos = append(todos, todo)
+		}
+	})
+	return todos, err
+}
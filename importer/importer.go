@@ -0,0 +1,280 @@
+// Package importer reads todos from files exported by gotodo and other todo
+// apps:
+//
+//	csv             CSV with a header row, such as gotodo's CSV export
+//	json            gotodo's JSON export
+//	todoist         Todoist project templates (CSV)
+//	microsoft_todo  Microsoft To Do tasks as returned by Microsoft Graph (JSON)
+//	trello          Trello board exports (JSON)
+//
+// Categories and tags are read by name. Subtasks come from parent ids,
+// Todoist indentation, To Do checklist items and Trello checklists.
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Import formats
+const (
+	CSV           = "csv"
+	JSON          = "json"
+	Todoist       = "todoist"
+	MicrosoftToDo = "microsoft_todo"
+	Trello        = "trello"
+)
+
+// Formats lists every import format
+var Formats = []string{CSV, JSON, Todoist, MicrosoftToDo, Trello}
+
+// Todo is a todo read from an import file
+type Todo struct {
+	Title       string
+	Description string
+	Category    string // category name; empty for none
+	Tags        []string
+	Priority    int // 1-3
+	DueDate     *time.Time
+	Completed   bool
+	Recurrence  string // RRULE, see package recurrence
+	// CreatedAt is when the todo was created and CompletedAt when it was
+	// completed, when the file tells; both are in UTC
+	CreatedAt   *time.Time
+	CompletedAt *time.Time
+	// Parent is the index of the todo's parent among the parsed todos, or
+	// -1 for top-level todos. Parents always come before their subtasks.
+	Parent int
+	// Warnings describe the parts of the entry that could not be read
+	Warnings []string
+
+	key       string // id of the todo in the file, if any
+	parentKey string
+}
+
+// Parse reads the todos in data, detecting the format when format is empty,
+// and returns the format used
+func Parse(data []byte, format string) (string, []Todo, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if format == "" {
+		var err error
+		if format, err = Detect(data); err != nil {
+			return "", nil, err
+		}
+	}
+
+	var todos []Todo
+	var err error
+	switch format {
+	case CSV:
+		todos, err = parseCSV(data)
+	case Todoist:
+		todos, err = parseTodoist(data)
+	case JSON:
+		todos, err = parseJSON(data)
+	case MicrosoftToDo:
+		todos, err = parseMicrosoftToDo(data)
+	case Trello:
+		todos, err = parseTrello(data)
+	default:
+		return "", nil, fmt.Errorf("unknown format %q (use %s)", format, strings.Join(Formats, ", "))
+	}
+	if err != nil {
+		return format, nil, err
+	}
+	return format, linkParents(todos), nil
+}
+
+// Detect guesses the format of an import file from its content
+func Detect(data []byte) (string, error) {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if len(data) == 0 {
+		return "", fmt.Errorf("the file is empty")
+	}
+
+	switch data[0] {
+	case '{':
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return "", fmt.Errorf("invalid JSON: %v", err)
+		}
+		switch {
+		case doc["todos"] != nil:
+			return JSON, nil
+		case doc["cards"] != nil:
+			return Trello, nil
+		case doc["value"] != nil, doc["lists"] != nil:
+			return MicrosoftToDo, nil
+		}
+		return "", fmt.Errorf("unrecognised JSON file")
+	case '[':
+		var items []map[string]json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return "", fmt.Errorf("invalid JSON: %v", err)
+		}
+		// To Do tasks have a status and an importance where ours have
+		// completed and priority
+		if len(items) > 0 && (items[0]["importance"] != nil || items[0]["status"] != nil) {
+			return MicrosoftToDo, nil
+		}
+		return JSON, nil
+	}
+
+	header, err := csv.NewReader(bytes.NewReader(data)).Read()
+	if err != nil {
+		return "", fmt.Errorf("unrecognised file: %v", err)
+	}
+	columns := columnIndex(header)
+	if _, ok := columns["type"]; ok {
+		if _, ok := columns["content"]; ok {
+			return Todoist, nil
+		}
+	}
+	return CSV, nil
+}
+
+// linkParents sets Parent from the keys of the todos and orders them so that
+// parents come first. Todos whose parent is missing, or who are part of a
+// cycle, become top-level todos.
+func linkParents(todos []Todo) []Todo {
+	byKey := make(map[string]int)
+	for i, todo := range todos {
+		if todo.key != "" {
+			byKey[todo.key] = i
+		}
+	}
+	children := make(map[int][]int)
+	var roots []int
+	for i := range todos {
+		parent, ok := byKey[todos[i].parentKey]
+		if todos[i].parentKey == "" || !ok || parent == i {
+			if todos[i].parentKey != "" {
+				todos[i].Warnings = append(todos[i].Warnings, fmt.Sprintf("parent %s not found; imported as a top-level todo", todos[i].parentKey))
+			}
+			roots = append(roots, i)
+			continue
+		}
+		children[parent] = append(children[parent], i)
+	}
+
+	ordered := make([]Todo, 0, len(todos))
+	placed := make([]bool, len(todos))
+	var place func(i, parent int)
+	place = func(i, parent int) {
+		placed[i] = true
+		todo := todos[i]
+		todo.Parent = parent
+		ordered = append(ordered, todo)
+		index := len(ordered) - 1
+		for _, child := range children[i] {
+			if !placed[child] {
+				place(child, index)
+			}
+		}
+	}
+	for _, i := range roots {
+		place(i, -1)
+	}
+	// What is left only has parents among itself
+	for i := range todos {
+		if !placed[i] {
+			todos[i].Warnings = append(todos[i].Warnings, "subtasks form a cycle; imported as a top-level todo")
+			place(i, -1)
+		}
+	}
+	return ordered
+}
+
+// newTodo returns a todo with the defaults of the importer
+func newTodo(title string) Todo {
+	return Todo{Title: strings.TrimSpace(title), Priority: 1, Parent: -1}
+}
+
+// warn records a part of an entry that could not be read
+func (t *Todo) warn(format string, args ...any) {
+	t.Warnings = append(t.Warnings, fmt.Sprintf(format, args...))
+}
+
+// priorityNames maps priority words to their values
+var priorityNames = map[string]int{
+	"low": 1, "medium": 2, "normal": 2, "high": 3,
+	"低": 1, "中": 2, "高": 3,
+}
+
+// parsePriority reads a priority given as 1-3 or by name
+func parsePriority(value string) (int, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if priority, ok := priorityNames[value]; ok {
+		return priority, true
+	}
+	priority, err := strconv.Atoi(value)
+	if err != nil || priority < 1 || priority > 3 {
+		return 0, false
+	}
+	return priority, true
+}
+
+// dateLayouts are the due date formats the importer understands
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999", // Microsoft Graph, without a zone
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02",
+	"Jan 2 2006",
+	"Jan 2, 2006",
+	"2 Jan 2006",
+}
+
+// parseDate reads a due date. Dates with a zone are converted to UTC; the
+// others are taken as UTC, as due dates entered in the app are.
+func parseDate(value string) (*time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			t = t.UTC()
+			return &t, true
+		}
+	}
+	return nil, false
+}
+
+// parseTime reads a creation or completion time of an entry, warning
+// about one that cannot be read; an empty value is no time
+func parseTime(todo *Todo, what, value string) *time.Time {
+	if value == "" {
+		return nil
+	}
+	t, ok := parseDate(value)
+	if !ok {
+		todo.warn("%s %q not understood", what, value)
+	}
+	return t
+}
+
+// parseBool reads the completed column of a CSV file
+func parseBool(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "yes", "y", "1", "x", "done", "completed":
+		return true
+	}
+	return false
+}
+
+// splitList splits a comma separated list of names
+func splitList(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,95 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// at returns the time of an RFC 3339 timestamp
+func at(t *testing.T, value string) *time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed = parsed.UTC()
+	return &parsed
+}
+
+// unix returns a Unix time, as Trello ids hold them
+func unix(seconds int64) *time.Time {
+	t := time.Unix(seconds, 0).UTC()
+	return &t
+}
+
+func TestParseFixtures(t *testing.T) {
+	tests := []struct {
+		file   string
+		format string
+		want   []Todo
+	}{
+		// The update time of a completed todo stands in for its completion
+		{"gotodo.json", JSON, []Todo{
+			{Title: "Pay rent", Category: "Home", Tags: []string{}, Priority: 3, DueDate: at(t, "2026-11-01T00:00:00Z"),
+				Completed: true, Parent: -1, CreatedAt: at(t, "2026-10-01T10:00:00Z"), CompletedAt: at(t, "2026-10-02T11:30:00Z")},
+			{Title: "Get receipt", Tags: []string{"paper"}, Priority: 1, Parent: 0, CreatedAt: at(t, "2026-10-01T10:05:00Z")},
+		}},
+		{"todoist.csv", Todoist, []Todo{
+			{Title: "Plan the trip", Tags: []string{"travel"}, Priority: 1, Parent: -1},
+			{Title: "Buy milk", Description: "Two litres\n\nOat milk if there is no other", Category: "Errands",
+				Tags: []string{"shop", "urgent"}, Priority: 3, DueDate: at(t, "2026-10-20T00:00:00Z"), Parent: -1},
+			{Title: "Check the price", Category: "Errands", Priority: 2, Parent: 1},
+			{Title: "Compare brands", Category: "Errands", Priority: 1, Parent: 2},
+			{Title: "Water plants", Category: "Errands", Priority: 1, Parent: -1,
+				Warnings: []string{`priority "5" not understood`, `due date "every day" not understood`}},
+		}},
+		{"microsoft_todo.json", MicrosoftToDo, []Todo{
+			{Title: "Send the report", Description: "Numbers & charts", Category: "Work", Tags: []string{"Reports"},
+				Priority: 3, DueDate: at(t, "2026-09-02T00:00:00Z"), Completed: true, Parent: -1,
+				CreatedAt: at(t, "2026-09-01T08:30:00.1234567Z"), CompletedAt: at(t, "2026-09-03T00:00:00Z")},
+			{Title: "Charts", Category: "Work", Priority: 1, Completed: true, Parent: 0,
+				CreatedAt: at(t, "2026-09-01T08:31:00Z"), CompletedAt: at(t, "2026-09-02T17:00:00Z")},
+			{Title: "Stand-up", Category: "Work", Priority: 2, Recurrence: "FREQ=WEEKLY;BYDAY=MO,TH", Parent: -1,
+				CreatedAt: at(t, "2026-09-05T09:00:00Z")},
+			{Title: "Renew passport", Description: "Photos first", Priority: 1, Parent: -1,
+				Warnings: []string{`importance "urgent" not understood`, `recurrence "relativeMonthly" is not supported`}},
+		}},
+		{"trello.json", Trello, []Todo{
+			{Title: "Fix the tap", Category: "To do", Tags: []string{"Plumbing"}, Priority: 1, Parent: -1,
+				CreatedAt: unix(0x6520a200), Warnings: []string{`due date "next week" not understood`}},
+			{Title: "Paint the fence", Description: "White", Category: "Doing", Tags: []string{"green"}, Priority: 3,
+				DueDate: at(t, "2026-10-25T09:00:00Z"), Completed: true, Parent: -1, CreatedAt: unix(0x6520a100)},
+			{Title: "Buy paint", Category: "Doing", Priority: 1, Parent: 1, CreatedAt: unix(0x6520a500)},
+			{Title: "Sand", Category: "Doing", Priority: 1, Completed: true, Parent: 1, CreatedAt: unix(0x6520a500)},
+		}},
+	}
+
+	for _, tt := range tests {
+		data, err := os.ReadFile(filepath.Join("testdata", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		format, todos, err := Parse(data, "")
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		if format != tt.format {
+			t.Errorf("%s: detected %s, want %s", tt.file, format, tt.format)
+		}
+		if len(todos) != len(tt.want) {
+			t.Errorf("%s: got %d todos, want %d: %+v", tt.file, len(todos), len(tt.want), todos)
+			continue
+		}
+		for i := range todos {
+			// Keys only link parents, which Parent already shows
+			todos[i].key, todos[i].parentKey = "", ""
+			if !reflect.DeepEqual(todos[i], tt.want[i]) {
+				t.Errorf("%s: todo %d = %+v, want %+v", tt.file, i, todos[i], tt.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportedTodo is a todo in gotodo's JSON export
+type exportedTodo struct {
+	ID          json.RawMessage `json:"id"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	Category    string          `json:"category"`
+	Tags        []string        `json:"tags"`
+	Priority    json.RawMessage `json:"priority"` // a name, or 1-3
+	DueDate     *string         `json:"due_date"`
+	Completed   bool            `json:"completed"`
+	ParentID    json.RawMessage `json:"parent_id"`
+	Recurrence  string          `json:"recurrence"`
+	CreatedAt   string          `json:"created_at"`
+	UpdatedAt   string          `json:"updated_at"`
+}
+
+// parseJSON reads gotodo's JSON export, or just its list of todos
+func parseJSON(data []byte) ([]Todo, error) {
+	var exported []exportedTodo
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &exported); err != nil {
+			return nil, fmt.Errorf("invalid JSON export: %v", err)
+		}
+	} else {
+		var doc struct {
+			Todos []exportedTodo `json:"todos"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("invalid JSON export: %v", err)
+		}
+		exported = doc.Todos
+	}
+
+	var todos []Todo
+	for _, entry := range exported {
+		if strings.TrimSpace(entry.Title) == "" {
+			continue
+		}
+		todo := newTodo(entry.Title)
+		todo.key = rawText(entry.ID)
+		todo.parentKey = rawText(entry.ParentID)
+		todo.Description = entry.Description
+		todo.Category = strings.TrimSpace(entry.Category)
+		todo.Tags = entry.Tags
+		todo.Completed = entry.Completed
+		todo.Recurrence = entry.Recurrence
+		if value := rawText(entry.Priority); value != "" {
+			if priority, ok := parsePriority(value); ok {
+				todo.Priority = priority
+			} else {
+				todo.warn("priority %q not understood", value)
+			}
+		}
+		if entry.DueDate != nil && *entry.DueDate != "" {
+			if due, ok := parseDate(*entry.DueDate); ok {
+				todo.DueDate = due
+			} else {
+				todo.warn("due date %q not understood", *entry.DueDate)
+			}
+		}
+		todo.CreatedAt = parseTime(&todo, "creation time", entry.CreatedAt)
+		if todo.Completed {
+			// The export has no completion time; its last change is the
+			// closest to one
+			todo.CompletedAt = parseTime(&todo, "update time", entry.UpdatedAt)
+		}
+		todos = append(todos, todo)
+	}
+	return todos, nil
+}
+
+// rawText returns a JSON string or number as text, and null as ""
+func rawText(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return strings.TrimSpace(text)
+	}
+	if value := strings.TrimSpace(string(raw)); value != "null" {
+		return value
+	}
+	return ""
+}
+
+// microsoftTask is a todoTask of Microsoft Graph
+type microsoftTask struct {
+	Title string `json:"title"`
+	Body  *struct {
+		Content     string `json:"content"`
+		ContentType string `json:"contentType"`
+	} `json:"body"`
+	Importance  string `json:"importance"`
+	Status      string `json:"status"`
+	DueDateTime *struct {
+		DateTime string `json:"dateTime"`
+	} `json:"dueDateTime"`
+	Categories        []string `json:"categories"`
+	CreatedDateTime   string   `json:"createdDateTime"`
+	CompletedDateTime *struct {
+		DateTime string `json:"dateTime"`
+	} `json:"completedDateTime"`
+	ChecklistItems []struct {
+		DisplayName     string `json:"displayName"`
+		IsChecked       bool   `json:"isChecked"`
+		CreatedDateTime string `json:"createdDateTime"`
+		CheckedDateTime string `json:"checkedDateTime"`
+	} `json:"checklistItems"`
+	Recurrence *struct {
+		Pattern struct {
+			Type       string   `json:"type"`
+			Interval   int      `json:"interval"`
+			DaysOfWeek []string `json:"daysOfWeek"`
+			DayOfMonth int      `json:"dayOfMonth"`
+		} `json:"pattern"`
+	} `json:"recurrence"`
+}
+
+// microsoftList is a todoTaskList of Microsoft Graph with its tasks
+type microsoftList struct {
+	DisplayName string          `json:"displayName"`
+	Tasks       []microsoftTask `json:"tasks"`
+}
+
+// htmlTags matches the tags of HTML task bodies
+var htmlTags = regexp.MustCompile(`<[^>]*>`)
+
+// parseMicrosoftToDo reads Microsoft To Do tasks: a list of tasks, a Graph
+// response with the tasks in "value", or {"lists": [...]} with lists that
+// have a displayName and tasks. The name of the list becomes the category
+// and To Do categories become tags; checklist items become subtasks.
+// Importance low, normal and high become priorities 1-3.
+func parseMicrosoftToDo(data []byte) ([]Todo, error) {
+	var lists []microsoftList
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		var tasks []microsoftTask
+		if err := json.Unmarshal(data, &tasks); err != nil {
+			return nil, fmt.Errorf("invalid Microsoft To Do file: %v", err)
+		}
+		lists = []microsoftList{{Tasks: tasks}}
+	} else {
+		var doc struct {
+			Value []microsoftTask `json:"value"`
+			Lists []microsoftList `json:"lists"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("invalid Microsoft To Do file: %v", err)
+		}
+		lists = append(doc.Lists, microsoftList{Tasks: doc.Value})
+	}
+
+	var todos []Todo
+	for _, list := range lists {
+		for _, task := range list.Tasks {
+			if strings.TrimSpace(task.Title) == "" {
+				continue
+			}
+			todo := newTodo(task.Title)
+			todo.key = strconv.Itoa(len(todos))
+			todo.Category = strings.TrimSpace(list.DisplayName)
+			todo.Tags = task.Categories
+			todo.Completed = task.Status == "completed"
+			if task.Body != nil {
+				todo.Description = strings.TrimSpace(task.Body.Content)
+				if strings.EqualFold(task.Body.ContentType, "html") {
+					todo.Description = strings.TrimSpace(html.UnescapeString(htmlTags.ReplaceAllString(todo.Description, "")))
+				}
+			}
+			if task.Importance != "" {
+				if priority, ok := parsePriority(task.Importance); ok {
+					todo.Priority = priority
+				} else {
+					todo.warn("importance %q not understood", task.Importance)
+				}
+			}
+			if task.DueDateTime != nil && task.DueDateTime.DateTime != "" {
+				if due, ok := parseDate(task.DueDateTime.DateTime); ok {
+					todo.DueDate = due
+				} else {
+					todo.warn("due date %q not understood", task.DueDateTime.DateTime)
+				}
+			}
+			if task.Recurrence != nil {
+				todo.Recurrence = microsoftRecurrence(&todo, task.Recurrence.Pattern.Type, task.Recurrence.Pattern.Interval,
+					task.Recurrence.Pattern.DaysOfWeek, task.Recurrence.Pattern.DayOfMonth)
+			}
+			todo.CreatedAt = parseTime(&todo, "creation time", task.CreatedDateTime)
+			if todo.Completed && task.CompletedDateTime != nil {
+				todo.CompletedAt = parseTime(&todo, "completion time", task.CompletedDateTime.DateTime)
+			}
+			todos = append(todos, todo)
+
+			for _, item := range task.ChecklistItems {
+				if strings.TrimSpace(item.DisplayName) == "" {
+					continue
+				}
+				subtask := newTodo(item.DisplayName)
+				subtask.parentKey = todo.key
+				subtask.Category = todo.Category
+				subtask.Completed = item.IsChecked
+				subtask.CreatedAt = parseTime(&subtask, "creation time", item.CreatedDateTime)
+				if subtask.Completed {
+					subtask.CompletedAt = parseTime(&subtask, "completion time", item.CheckedDateTime)
+				}
+				todos = append(todos, subtask)
+			}
+		}
+	}
+	return todos, nil
+}
+
+// microsoftRecurrence converts the recurrence pattern of a To Do task to an
+// RRULE, warning about the patterns that have none
+func microsoftRecurrence(todo *Todo, kind string, interval int, daysOfWeek []string, dayOfMonth int) string {
+	var rule string
+	switch kind {
+	case "daily":
+		rule = "FREQ=DAILY"
+	case "weekly":
+		rule = "FREQ=WEEKLY"
+		var days []string
+		for _, day := range daysOfWeek {
+			if len(day) >= 2 {
+				days = append(days, strings.ToUpper(day[:2]))
+			}
+		}
+		if len(days) > 0 {
+			rule += ";BYDAY=" + strings.Join(days, ",")
+		}
+	case "absoluteMonthly":
+		rule = "FREQ=MONTHLY"
+		if dayOfMonth > 0 {
+			rule += ";BYMONTHDAY=" + strconv.Itoa(dayOfMonth)
+		}
+	case "absoluteYearly":
+		rule = "FREQ=YEARLY"
+	default:
+		todo.warn("recurrence %q is not supported", kind)
+		return ""
+	}
+	if interval > 1 {
+		rule += ";INTERVAL=" + strconv.Itoa(interval)
+	}
+	return rule
+}
+
+// trelloBoard is the part of a Trello board export the importer reads
+type trelloBoard struct {
+	Lists []struct {
+		ID     string  `json:"id"`
+		Name   string  `json:"name"`
+		Closed bool    `json:"closed"`
+		Pos    float64 `json:"pos"`
+	} `json:"lists"`
+	Cards []struct {
+		ID          string  `json:"id"`
+		Name        string  `json:"name"`
+		Desc        string  `json:"desc"`
+		IDList      string  `json:"idList"`
+		Due         *string `json:"due"`
+		DueComplete bool    `json:"dueComplete"`
+		Closed      bool    `json:"closed"`
+		Pos         float64 `json:"pos"`
+		Labels      []struct {
+			Name  string `json:"name"`
+			Color string `json:"color"`
+		} `json:"labels"`
+	} `json:"cards"`
+	Checklists []struct {
+		IDCard     string  `json:"idCard"`
+		Pos        float64 `json:"pos"`
+		CheckItems []struct {
+			ID    string  `json:"id"`
+			Name  string  `json:"name"`
+			State string  `json:"state"`
+			Pos   float64 `json:"pos"`
+		} `json:"checkItems"`
+	} `json:"checklists"`
+}
+
+// parseTrello reads a Trello board export. Cards become todos in the
+// category named after their list, and the items of their checklists become
+// subtasks. Labels named low, medium or high set the priority; the others
+// become tags. Archived cards and lists are left out.
+func parseTrello(data []byte) ([]Todo, error) {
+	var board trelloBoard
+	if err := json.Unmarshal(data, &board); err != nil {
+		return nil, fmt.Errorf("invalid Trello file: %v", err)
+	}
+
+	sort.SliceStable(board.Lists, func(i, j int) bool { return board.Lists[i].Pos < board.Lists[j].Pos })
+	listOrder := make(map[string]int)
+	listNames := make(map[string]string)
+	for i, list := range board.Lists {
+		if !list.Closed {
+			listOrder[list.ID] = i
+			listNames[list.ID] = strings.TrimSpace(list.Name)
+		}
+	}
+	sort.SliceStable(board.Cards, func(i, j int) bool {
+		a, b := board.Cards[i], board.Cards[j]
+		if listOrder[a.IDList] != listOrder[b.IDList] {
+			return listOrder[a.IDList] < listOrder[b.IDList]
+		}
+		return a.Pos < b.Pos
+	})
+	sort.SliceStable(board.Checklists, func(i, j int) bool { return board.Checklists[i].Pos < board.Checklists[j].Pos })
+
+	var todos []Todo
+	for _, card := range board.Cards {
+		if _, ok := listOrder[card.IDList]; card.Closed || !ok || strings.TrimSpace(card.Name) == "" {
+			continue
+		}
+		todo := newTodo(card.Name)
+		todo.key = card.ID
+		todo.CreatedAt = trelloCreated(card.ID)
+		todo.Description = strings.TrimSpace(card.Desc)
+		todo.Category = listNames[card.IDList]
+		todo.Completed = card.DueComplete
+		for _, label := range card.Labels {
+			name := strings.TrimSpace(label.Name)
+			if priority, ok := priorityNames[strings.ToLower(name)]; ok {
+				todo.Priority = priority
+				continue
+			}
+			if name == "" {
+				name = label.Color
+			}
+			if name != "" {
+				todo.Tags = append(todo.Tags, name)
+			}
+		}
+		if card.Due != nil && *card.Due != "" {
+			if due, ok := parseDate(*card.Due); ok {
+				todo.DueDate = due
+			} else {
+				todo.warn("due date %q not understood", *card.Due)
+			}
+		}
+		todos = append(todos, todo)
+
+		for _, checklist := range board.Checklists {
+			if checklist.IDCard != card.ID {
+				continue
+			}
+			items := checklist.CheckItems
+			sort.SliceStable(items, func(i, j int) bool { return items[i].Pos < items[j].Pos })
+			for _, item := range items {
+				if strings.TrimSpace(item.Name) == "" {
+					continue
+				}
+				subtask := newTodo(item.Name)
+				subtask.parentKey = card.ID
+				subtask.Category = todo.Category
+				subtask.Completed = item.State == "complete"
+				subtask.CreatedAt = trelloCreated(item.ID)
+				todos = append(todos, subtask)
+			}
+		}
+	}
+	return todos, nil
+}
+
+// trelloCreated reads the creation time of a card or checklist item from
+// its id, whose first eight hex digits are a Unix time; Trello exports have
+// no other. Trello keeps no completion times.
+func trelloCreated(id string) *time.Time {
+	if len(id) != 24 {
+		return nil
+	}
+	seconds, err := strconv.ParseInt(id[:8], 16, 64)
+	if err != nil {
+		return nil
+	}
+	created := time.Unix(seconds, 0).UTC()
+	return &created
+}
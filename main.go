@@ -1,39 +1,197 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"gotodo/database"
+	"gotodo/events"
 	"gotodo/handlers"
 	"gotodo/models"
+	"gotodo/reminders"
+	"gotodo/webhooks"
 )
 
 func main() {
-	// Initialize database
 	dbPath := getEnv("DB_PATH", "./data/todos.db")
-	db, err := database.Initialize(dbPath)
-	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+	databaseURL := os.Getenv("DATABASE_URL")
+
+	// Schema management: gotodo migrate status|up|down [N]
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(dbPath, databaseURL, os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
 	}
-	defer db.Close()
 
 	// Initialize stores
-	todoStore := models.NewTodoStore(db)
-	categoryStore := models.NewCategoryStore(db)
+	var todoStore models.TodoRepository
+	var categoryStore models.CategoryRepository
+	var tagStore models.TagRepository
+	var reminderStore models.ReminderRepository
+	var webhookStore models.WebhookRepository
+	var userStore models.UserRepository
+	var workspaceStore models.WorkspaceRepository
+	var auditStore models.AuditRepository
+
+	defaultStorage := "sqlite"
+	if databaseURL != "" {
+		defaultStorage = "postgres"
+	}
+	storage := getEnv("STORAGE", defaultStorage)
+	switch storage {
+	case "sqlite":
+		db, err := database.Initialize(dbPath)
+		if err != nil {
+			log.Fatalf("Failed to initialize database: %v", err)
+		}
+		defer db.Close()
+
+		todoStore = models.NewTodoStore(db)
+		categoryStore = models.NewCategoryStore(db)
+		tagStore = models.NewTagStore(db)
+		reminderStore = models.NewReminderStore(db)
+		webhookStore = models.NewWebhookStore(db)
+		userStore = models.NewUserStore(db)
+		workspaceStore = models.NewWorkspaceStore(db)
+		auditStore = models.NewAuditStore(db)
+	case "postgres":
+		if databaseURL == "" {
+			log.Fatalf("STORAGE=postgres requires DATABASE_URL")
+		}
+		db, err := database.InitializePostgres(databaseURL)
+		if err != nil {
+			log.Fatalf("Failed to initialize database: %v", err)
+		}
+		defer db.Close()
+
+		todoStore = models.NewTodoStore(db)
+		categoryStore = models.NewCategoryStore(db)
+		tagStore = models.NewTagStore(db)
+		reminderStore = models.NewReminderStore(db)
+		webhookStore = models.NewWebhookStore(db)
+		userStore = models.NewUserStore(db)
+		workspaceStore = models.NewWorkspaceStore(db)
+		auditStore = models.NewAuditStore(db)
+	case "memory":
+		// Data is lost when the server stops; useful for demos and tests
+		memoryDB := models.NewMemoryDB()
+		todoStore = models.NewMemoryTodoStore(memoryDB)
+		categoryStore = models.NewMemoryCategoryStore(memoryDB)
+		tagStore = models.NewMemoryTagStore(memoryDB)
+		reminderStore = models.NewMemoryReminderStore(memoryDB)
+		webhookStore = models.NewMemoryWebhookStore(memoryDB)
+		userStore = models.NewMemoryUserStore(memoryDB)
+		workspaceStore = models.NewMemoryWorkspaceStore(memoryDB)
+		auditStore = models.NewMemoryAuditStore(memoryDB)
+	default:
+		log.Fatalf("Unknown STORAGE %q (use sqlite, postgres or memory)", storage)
+	}
+
+	// Send reminders in the background
+	notifier, err := newNotifier(getEnv("NOTIFIERS", "log"), userStore, todoStore)
+	if err != nil {
+		log.Fatalf("Failed to configure notifiers: %v", err)
+	}
+	interval, err := time.ParseDuration(getEnv("REMINDER_INTERVAL", "30s"))
+	if err != nil || interval <= 0 {
+		log.Fatalf("Invalid REMINDER_INTERVAL %q", os.Getenv("REMINDER_INTERVAL"))
+	}
+	scheduler := reminders.NewScheduler(reminderStore, todoStore, notifier, interval)
+	go scheduler.Run(context.Background())
+
+	// Empty the trash of todos deleted longer ago than the retention period
+	retention, err := time.ParseDuration(getEnv("TRASH_RETENTION", "720h"))
+	if err != nil || retention <= 0 {
+		log.Fatalf("Invalid TRASH_RETENTION %q", os.Getenv("TRASH_RETENTION"))
+	}
+	go purgeTrash(context.Background(), todoStore, retention)
+
+	// Handlers publish their changes; webhooks and /api/events receive them
+	bus := events.NewBus()
+	dispatcher := webhooks.NewDispatcher(webhookStore, workspaceStore)
+	dispatcher.AllowPrivateNetworks = os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true"
+	dispatcher.Subscribe(bus)
+
+	// Archive completed todos that have not changed for ARCHIVE_AFTER, if set
+	if v := os.Getenv("ARCHIVE_AFTER"); v != "" {
+		archiveAfter, err := time.ParseDuration(v)
+		if err != nil || archiveAfter <= 0 {
+			log.Fatalf("Invalid ARCHIVE_AFTER %q", v)
+		}
+		go archiveCompleted(context.Background(), todoStore, auditStore, bus, archiveAfter)
+	}
 	
 	// Initialize handlers
-	todoHandler := handlers.NewTodoHandler(todoStore)
-	categoryHandler := handlers.NewCategoryHandler(categoryStore)
+	authHandler := handlers.NewAuthHandler(userStore, workspaceStore)
+	tokenHandler := handlers.NewTokenHandler(userStore)
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		config := handlers.OIDCConfig{
+			Issuer:       issuer,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		}
+		if config.ClientID == "" || config.RedirectURL == "" {
+			log.Fatalf("OIDC_ISSUER requires OIDC_CLIENT_ID and OIDC_REDIRECT_URL")
+		}
+		if err := authHandler.EnableOIDC(context.Background(), config); err != nil {
+			log.Fatalf("Failed to configure single sign-on: %v", err)
+		}
+	}
+	todoHandler := handlers.NewTodoHandler(todoStore, auditStore, bus)
+	categoryHandler := handlers.NewCategoryHandler(categoryStore, bus)
+	tagHandler := handlers.NewTagHandler(tagStore)
+	reminderHandler := handlers.NewReminderHandler(reminderStore)
+	webhookHandler := handlers.NewWebhookHandler(webhookStore)
+	eventHandler := handlers.NewEventHandler(bus)
+	workspaceHandler := handlers.NewWorkspaceHandler(workspaceStore)
+	auditHandler := handlers.NewAuditHandler(auditStore, todoStore, bus)
+	trashHandler := handlers.NewTrashHandler(todoStore, auditStore, bus)
+	archiveHandler := handlers.NewArchiveHandler(todoStore, auditStore, bus)
+	bulkHandler := handlers.NewBulkHandler(todoStore, auditStore, bus)
+	exportHandler := handlers.NewExportHandler(todoStore)
+	importHandler := handlers.NewImportHandler(todoStore, categoryStore, tagStore, auditStore, bus)
+	calendarHandler := handlers.NewCalendarHandler(todoStore)
 
-	// API routes
-	http.Handle("/api/todos", todoHandler)
-	http.Handle("/api/todos/", todoHandler)
-	http.Handle("/api/categories", categoryHandler)
-	http.Handle("/api/categories/", categoryHandler)
+	// API routes; everything but /api/auth/ requires a signed-in user, and
+	// API tokens need the scopes of the resources a route changes or reads
+	http.Handle("/api/auth/", authHandler)
+	http.Handle("/api/tokens", authHandler.RequireSession(tokenHandler))
+	http.Handle("/api/tokens/", authHandler.RequireSession(tokenHandler))
+	http.Handle("/api/todos", authHandler.Require(todoHandler, "todos"))
+	http.Handle("/api/todos/", authHandler.Require(todoHandler, "todos"))
+	http.Handle("/api/todos/archive", authHandler.Require(archiveHandler, "todos"))
+	http.Handle("/api/todos/{id}/unarchive", authHandler.Require(archiveHandler, "todos"))
+	http.Handle("/api/todos/bulk", authHandler.Require(bulkHandler, "todos"))
+	http.Handle("/api/export", authHandler.Require(exportHandler, "todos"))
+	http.Handle("/api/import", authHandler.Require(importHandler, "todos", "categories", "tags"))
+	http.Handle("/api/todos/{id}/reminders", authHandler.Require(reminderHandler, "todos"))
+	http.Handle("/api/todos/{id}/reminders/{reminderID}", authHandler.Require(reminderHandler, "todos"))
+	http.Handle("/api/todos/{id}/history", authHandler.Require(auditHandler, "todos"))
+	http.Handle("/api/todos/{id}/history/{entryID}/restore", authHandler.Require(auditHandler, "todos"))
+	http.Handle("/api/audit", authHandler.Require(auditHandler, "todos"))
+	http.Handle("/api/trash", authHandler.Require(trashHandler, "todos"))
+	http.Handle("/api/trash/{id}", authHandler.Require(trashHandler, "todos"))
+	http.Handle("/api/trash/{id}/restore", authHandler.Require(trashHandler, "todos"))
+	http.Handle("/api/categories", authHandler.Require(categoryHandler, "categories"))
+	http.Handle("/api/categories/", authHandler.Require(categoryHandler, "categories"))
+	http.Handle("/api/tags", authHandler.Require(tagHandler, "tags"))
+	http.Handle("/api/tags/", authHandler.Require(tagHandler, "tags"))
+	http.Handle("/api/webhooks", authHandler.Require(webhookHandler, "webhooks"))
+	http.Handle("/api/webhooks/", authHandler.Require(webhookHandler, "webhooks"))
+	http.Handle("/api/workspaces", authHandler.Require(workspaceHandler, "workspaces"))
+	http.Handle("/api/workspaces/", authHandler.Require(workspaceHandler, "workspaces"))
+	http.Handle("/api/events", authHandler.Require(eventHandler, "todos", "categories"))
+
+	// Calendar feed; calendar apps pass the API token in the URL or by basic auth
+	http.Handle("/calendar.ics", authHandler.RequireFeed(calendarHandler, "todos"))
 
 	// Static files
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
@@ -57,10 +215,106 @@ func main() {
 
 	port := getEnv("PORT", "8080")
 	fmt.Printf("Server starting on http://localhost:%s\n", port)
-	fmt.Printf("Database: %s\n", dbPath)
+	if storage == "sqlite" {
+		fmt.Printf("Database: %s\n", dbPath)
+	} else {
+		fmt.Printf("Storage: %s\n", storage)
+	}
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
 
+// purgeTrash permanently removes the todos that have been in the trash for
+// longer than retention
+func purgeTrash(ctx context.Context, todos models.TodoRepository, retention time.Duration) {
+	every(ctx, min(retention, time.Hour), func() {
+		purged, err := todos.PurgeDeletedBefore(time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Error purging trash: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d todos from the trash", purged)
+		}
+	})
+}
+
+// archiveCompleted archives the completed todos of every user and workspace
+// that have not changed for after, recording and publishing each of them
+func archiveCompleted(ctx context.Context, todos models.TodoRepository, audit models.AuditRepository, bus *events.Bus, after time.Duration) {
+	every(ctx, min(after, time.Hour), func() {
+		before := time.Now().Add(-after)
+		archived, err := todos.Archive(models.ArchiveFilter{UpdatedBefore: &before})
+		if err != nil {
+			log.Printf("Error archiving todos: %v", err)
+			return
+		}
+		handlers.PublishArchived(audit, bus, archived)
+		if len(archived) > 0 {
+			log.Printf("Archived %d completed todos", len(archived))
+		}
+	})
+}
+
+// every runs task right away and then every interval until ctx is done
+func every(ctx context.Context, interval time.Duration, task func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		task()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newNotifier builds the reminder notifier from a comma-separated list of
+// log, webhook and smtp. The webhook and smtp notifiers send to a single
+// destination, so they only get the reminders of REMINDER_USER.
+func newNotifier(names string, users models.UserRepository, todos models.TodoRepository) (reminders.Notifier, error) {
+	var notifiers reminders.Notifiers
+	forUser := func(notifier reminders.Notifier) reminders.Notifier {
+		return reminders.UserNotifier{Notifier: notifier, Username: os.Getenv("REMINDER_USER"), Users: users, Todos: todos}
+	}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if (name == "webhook" || name == "smtp") && os.Getenv("REMINDER_USER") == "" {
+			return nil, fmt.Errorf("the %s notifier requires REMINDER_USER, the user whose reminders it sends", name)
+		}
+		switch name {
+		case "log":
+			notifiers = append(notifiers, reminders.LogNotifier{})
+		case "webhook":
+			url := os.Getenv("REMINDER_WEBHOOK_URL")
+			if url == "" {
+				return nil, fmt.Errorf("the webhook notifier requires REMINDER_WEBHOOK_URL")
+			}
+			notifiers = append(notifiers, forUser(reminders.NewWebhookNotifier(url)))
+		case "smtp":
+			addr, from, to := os.Getenv("SMTP_ADDR"), os.Getenv("SMTP_FROM"), os.Getenv("SMTP_TO")
+			if addr == "" || from == "" || to == "" {
+				return nil, fmt.Errorf("the smtp notifier requires SMTP_ADDR, SMTP_FROM and SMTP_TO")
+			}
+			var recipients []string
+			for _, address := range strings.Split(to, ",") {
+				recipients = append(recipients, strings.TrimSpace(address))
+			}
+			notifiers = append(notifiers, forUser(&reminders.SMTPNotifier{
+				Addr:     addr,
+				Username: os.Getenv("SMTP_USERNAME"),
+				Password: os.Getenv("SMTP_PASSWORD"),
+				From:     from,
+				To:       recipients,
+			}))
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown notifier %q (use log, webhook or smtp)", name)
+		}
+	}
+	return notifiers, nil
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
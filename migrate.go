@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"gotodo/database"
+)
+
+const migrateUsage = `usage: gotodo migrate <command>
+
+Commands:
+  status       Show applied and pending migrations
+  up           Apply all pending migrations
+  down [N]     Roll back the last N migrations (default 1)`
+
+// runMigrate implements the "migrate" command. It works on the PostgreSQL
+// database at databaseURL when set, and on the SQLite file at dbPath otherwise.
+func runMigrate(dbPath, databaseURL string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command\n%s", migrateUsage)
+	}
+
+	var db *database.DB
+	var err error
+	if databaseURL != "" {
+		db, err = database.OpenPostgres(databaseURL)
+	} else {
+		db, err = database.Open(dbPath)
+	}
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "status":
+		statuses, err := db.MigrationStatus()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+		for _, s := range statuses {
+			status := "pending"
+			if s.Applied {
+				status = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Modified {
+				status += " (modified since applied)"
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, status)
+		}
+		return w.Flush()
+
+	case "up":
+		count, err := db.MigrateUp()
+		fmt.Printf("Applied %d migration(s)\n", count)
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+		}
+		count, err := db.MigrateDown(steps)
+		fmt.Printf("Rolled back %d migration(s)\n", count)
+		return err
+
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], migrateUsage)
+	}
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// APIToken is a personal access token that lets scripts use the API as its
+// user, limited to its scopes
+type APIToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"` // such as todos:read or categories:write
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// Token is only set in the response that creates the token; only its
+	// hash is stored
+	Token string `json:"token,omitempty"`
+
+	UserID int `json:"-"`
+
+	tokenHash string // kept by the memory store
+}
+
+// apiTokenUseInterval is how often the last use of a token is recorded, so
+// that scripts do not write to the database on every request
+const apiTokenUseInterval = time.Minute
+
+// joinScopes and splitScopes convert token scopes to and from their column
+func joinScopes(scopes []string) string {
+	return strings.Join(scopes, ",")
+}
+
+func splitScopes(column string) []string {
+	if column == "" {
+		return []string{}
+	}
+	return strings.Split(column, ",")
+}
+
+// scanAPIToken reads a row of id, user_id, name, scopes, last_used_at, created_at
+func scanAPIToken(row rowScanner) (APIToken, error) {
+	var token APIToken
+	var scopes string
+	var lastUsedAt sql.NullTime
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &scopes, &lastUsedAt, &token.CreatedAt)
+	token.Scopes = splitScopes(scopes)
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	return token, err
+}
+
+const apiTokenSelect = `SELECT id, user_id, name, scopes, last_used_at, created_at FROM api_tokens`
+
+// CreateAPIToken stores a new API token of a user
+func (us *UserStore) CreateAPIToken(userID int, name, tokenHash string, scopes []string) (*APIToken, error) {
+	var id int
+	err := us.db.QueryRow(`
+		INSERT INTO api_tokens (user_id, name, token_hash, scopes, created_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		RETURNING id
+	`, userID, name, tokenHash, joinScopes(scopes)).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API token: %w", err)
+	}
+
+	token, err := scanAPIToken(us.db.QueryRow(apiTokenSelect+` WHERE id = ?`, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API token: %w", err)
+	}
+	return &token, nil
+}
+
+// APITokens returns the API tokens of a user
+func (us *UserStore) APITokens(userID int) ([]APIToken, error) {
+	rows, err := us.db.Query(apiTokenSelect+` WHERE user_id = ? ORDER BY id ASC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// DeleteAPIToken revokes an API token of a user
+func (us *UserStore) DeleteAPIToken(userID, id int) error {
+	result, err := us.db.Exec(`DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete API token: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("API token not found")
+	}
+
+	return nil
+}
+
+// APITokenUser returns the user and the token of a token hash
+func (us *UserStore) APITokenUser(tokenHash string, now time.Time) (*User, *APIToken, error) {
+	token, err := scanAPIToken(us.db.QueryRow(apiTokenSelect+` WHERE token_hash = ?`, tokenHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, fmt.Errorf("API token not found")
+		}
+		return nil, nil, fmt.Errorf("failed to get API token: %w", err)
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= apiTokenUseInterval {
+		now = now.UTC().Truncate(time.Second)
+		if _, err := us.db.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, now, token.ID); err != nil {
+			return nil, nil, fmt.Errorf("failed to record API token use: %w", err)
+		}
+		token.LastUsedAt = &now
+	}
+
+	user, err := us.GetByID(token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, &token, nil
+}
@@ -0,0 +1,322 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"gotodo/database"
+)
+
+// Audit log actions
+const (
+	AuditCreated    = "created"
+	AuditUpdated    = "updated"
+	AuditToggled    = "toggled"
+	AuditDeleted    = "deleted"
+	AuditRestored   = "restored"
+	AuditUndeleted  = "undeleted"
+	AuditArchived   = "archived"
+	AuditUnarchived = "unarchived"
+)
+
+// AuditActions lists every audit log action
+var AuditActions = []string{AuditCreated, AuditUpdated, AuditToggled, AuditDeleted, AuditRestored, AuditUndeleted, AuditArchived, AuditUnarchived}
+
+// Pagination limits for the audit log
+const (
+	DefaultAuditLimit = 50
+	MaxAuditLimit     = 500
+)
+
+// TodoRevision is the state of a todo as the audit log records it
+type TodoRevision struct {
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	CategoryID  *int       `json:"category_id"`
+	TagIDs      []int      `json:"tag_ids"`
+	ParentID    *int       `json:"parent_id"`
+	Priority    int        `json:"priority"`
+	DueDate     *time.Time `json:"due_date"`
+	Completed   bool       `json:"completed"`
+	Recurrence  *string    `json:"recurrence"`
+	Archived    bool       `json:"archived"`
+}
+
+// RevisionOf returns the revision of a todo
+func RevisionOf(todo *Todo) *TodoRevision {
+	tagIDs := make([]int, 0, len(todo.Tags))
+	for _, tag := range todo.Tags {
+		tagIDs = append(tagIDs, tag.ID)
+	}
+	slices.Sort(tagIDs)
+
+	return &TodoRevision{
+		Title:       todo.Title,
+		Description: todo.Description,
+		CategoryID:  copyInt(todo.CategoryID),
+		TagIDs:      tagIDs,
+		ParentID:    copyInt(todo.ParentID),
+		Priority:    todo.Priority,
+		DueDate:     copyTime(todo.DueDate),
+		Completed:   todo.Completed,
+		Recurrence:  copyString(todo.Recurrence),
+		Archived:    todo.ArchivedAt != nil,
+	}
+}
+
+// FieldChange is the old and new value of a field of a todo
+type FieldChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// DiffRevisions returns the fields that differ between two revisions, by
+// their JSON names. from is nil for a creation and to for a deletion.
+func DiffRevisions(from, to *TodoRevision) map[string]FieldChange {
+	oldFields, newFields := revisionFields(from), revisionFields(to)
+
+	changes := make(map[string]FieldChange)
+	for name := range revisionFields(&TodoRevision{}) {
+		if !reflect.DeepEqual(oldFields[name], newFields[name]) {
+			changes[name] = FieldChange{Old: oldFields[name], New: newFields[name]}
+		}
+	}
+	return changes
+}
+
+// revisionFields returns the fields of a revision as JSON values, none for nil
+func revisionFields(revision *TodoRevision) map[string]any {
+	fields := make(map[string]any)
+	if revision == nil {
+		return fields
+	}
+	data, _ := json.Marshal(revision)
+	json.Unmarshal(data, &fields)
+	return fields
+}
+
+// AuditEntry is a change to a todo: who made it, when, which fields it
+// changed and the todo afterwards
+type AuditEntry struct {
+	ID       int    `json:"id"`
+	TodoID   int    `json:"todo_id"`
+	Action   string `json:"action"`
+	UserID   *int   `json:"user_id"` // nil for changes the server made on its own, or once that user is deleted
+	Username string `json:"username,omitempty"`
+	// Changes maps the changed fields to their old and new values
+	Changes map[string]FieldChange `json:"changes"`
+	// Revision is the todo after the change, or before it for deletions
+	Revision  *TodoRevision `json:"revision"`
+	CreatedAt time.Time     `json:"created_at"`
+
+	owner ownership // kept by the memory store
+}
+
+// AuditFilter selects entries of the audit log; zero fields select all
+type AuditFilter struct {
+	TodoID int
+	Action string
+	UserID int
+	Since  *time.Time
+	Until  *time.Time
+	Limit  int // 0 means DefaultAuditLimit
+	Offset int
+}
+
+// AuditRepository stores the audit log of changes to todos. Entries outlive
+// their todo, so that the history of a deleted todo stays available.
+//
+// Implementations report a missing entry with an error containing
+// "audit entry not found". ForUser and ForWorkspace return a repository
+// limited to the log of the todos of a user or a workspace.
+type AuditRepository interface {
+	ForUser(userID int) AuditRepository
+	ForWorkspace(workspaceID int) AuditRepository
+
+	// Record adds an entry, setting its ID and CreatedAt
+	Record(entry *AuditEntry) error
+	// History returns the entries of a todo, oldest first
+	History(todoID int) ([]AuditEntry, error)
+	Get(id int) (*AuditEntry, error)
+	// List returns the entries matching the filter, newest first, and the
+	// number of matches before Limit and Offset are applied
+	List(filter AuditFilter) ([]AuditEntry, int, error)
+}
+
+// AuditStore keeps the audit log in an SQL database (SQLite or PostgreSQL)
+type AuditStore struct {
+	db    *database.DB
+	owner ownership
+}
+
+// NewAuditStore creates a new AuditStore backed by db
+func NewAuditStore(db *database.DB) *AuditStore {
+	return &AuditStore{db: db}
+}
+
+var _ AuditRepository = (*AuditStore)(nil)
+
+// ForUser returns an AuditStore limited to the log of a user's todos
+func (as *AuditStore) ForUser(userID int) AuditRepository {
+	return &AuditStore{db: as.db, owner: ownership{userID: userID}}
+}
+
+// ForWorkspace returns an AuditStore limited to the log of a workspace's todos
+func (as *AuditStore) ForWorkspace(workspaceID int) AuditRepository {
+	return &AuditStore{db: as.db, owner: ownership{workspaceID: workspaceID}}
+}
+
+const auditSelect = `
+	SELECT a.id, a.todo_id, a.action, a.user_id, COALESCE(u.username, ''), a.changes, a.revision, a.created_at
+	FROM todo_audit a
+	LEFT JOIN users u ON u.id = a.user_id`
+
+// scanAuditEntry reads a row of auditSelect
+func scanAuditEntry(row rowScanner) (AuditEntry, error) {
+	var entry AuditEntry
+	var userID sql.NullInt64
+	var changes, revision string
+	err := row.Scan(&entry.ID, &entry.TodoID, &entry.Action, &userID, &entry.Username, &changes, &revision, &entry.CreatedAt)
+	if err != nil {
+		return entry, err
+	}
+	if userID.Valid {
+		id := int(userID.Int64)
+		entry.UserID = &id
+	}
+	if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+		return entry, fmt.Errorf("invalid changes: %w", err)
+	}
+	if err := json.Unmarshal([]byte(revision), &entry.Revision); err != nil {
+		return entry, fmt.Errorf("invalid revision: %w", err)
+	}
+	return entry, nil
+}
+
+// Record adds an entry to the log
+func (as *AuditStore) Record(entry *AuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return fmt.Errorf("failed to encode changes: %w", err)
+	}
+	revision, err := json.Marshal(entry.Revision)
+	if err != nil {
+		return fmt.Errorf("failed to encode revision: %w", err)
+	}
+
+	// Written like the filters of List, so that they compare on SQLite
+	createdAt := time.Now().UTC().Truncate(time.Second)
+
+	var userID any
+	if entry.UserID != nil {
+		userID = *entry.UserID
+	}
+	err = as.db.QueryRow(`
+		INSERT INTO todo_audit (todo_id, action, user_id, owner_id, workspace_id, changes, revision, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, entry.TodoID, entry.Action, userID, as.owner.userValue(), as.owner.workspaceValue(), string(changes), string(revision), createdAt).
+		Scan(&entry.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	entry.CreatedAt = createdAt
+	return nil
+}
+
+// History returns the entries of a todo, oldest first
+func (as *AuditStore) History(todoID int) ([]AuditEntry, error) {
+	ownerCond, ownerArgs := as.owner.filter("a")
+	entries, err := as.query(auditSelect+` WHERE a.todo_id = ? AND `+ownerCond+` ORDER BY a.id ASC`,
+		append([]any{todoID}, ownerArgs...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query todo history: %w", err)
+	}
+	return entries, nil
+}
+
+// Get returns a specific entry
+func (as *AuditStore) Get(id int) (*AuditEntry, error) {
+	ownerCond, ownerArgs := as.owner.filter("a")
+	entry, err := scanAuditEntry(as.db.QueryRow(auditSelect+` WHERE a.id = ? AND `+ownerCond,
+		append([]any{id}, ownerArgs...)...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("audit entry not found")
+		}
+		return nil, fmt.Errorf("failed to get audit entry: %w", err)
+	}
+	return &entry, nil
+}
+
+// List returns the entries matching filter, newest first
+func (as *AuditStore) List(filter AuditFilter) ([]AuditEntry, int, error) {
+	ownerCond, args := as.owner.filter("a")
+	conditions := []string{ownerCond}
+	if filter.TodoID != 0 {
+		conditions = append(conditions, "a.todo_id = ?")
+		args = append(args, filter.TodoID)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "a.action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.UserID != 0 {
+		conditions = append(conditions, "a.user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.Since != nil {
+		conditions = append(conditions, "a.created_at >= ?")
+		args = append(args, filter.Since.UTC().Truncate(time.Second))
+	}
+	if filter.Until != nil {
+		conditions = append(conditions, "a.created_at < ?")
+		args = append(args, filter.Until.UTC().Truncate(time.Second))
+	}
+	where := " WHERE " + strings.Join(conditions, " AND ")
+
+	var total int
+	if err := as.db.QueryRow(`SELECT COUNT(*) FROM todo_audit a`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+
+	limit := filter.Limit
+	if limit == 0 {
+		limit = DefaultAuditLimit
+	}
+	entries, err := as.query(auditSelect+where+` ORDER BY a.id DESC LIMIT ? OFFSET ?`,
+		append(args, limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	return entries, total, nil
+}
+
+// query returns the entries selected by an auditSelect query
+func (as *AuditStore) query(query string, args ...any) ([]AuditEntry, error) {
+	rows, err := as.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return entries, nil
+}
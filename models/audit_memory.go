@@ -0,0 +1,116 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// MemoryAuditStore keeps the audit log in memory
+type MemoryAuditStore struct {
+	db    *MemoryDB
+	owner ownership
+}
+
+// NewMemoryAuditStore creates a new AuditRepository backed by db
+func NewMemoryAuditStore(db *MemoryDB) *MemoryAuditStore {
+	return &MemoryAuditStore{db: db}
+}
+
+var _ AuditRepository = (*MemoryAuditStore)(nil)
+
+// ForUser returns a MemoryAuditStore limited to the log of a user's todos
+func (as *MemoryAuditStore) ForUser(userID int) AuditRepository {
+	return &MemoryAuditStore{db: as.db, owner: ownership{userID: userID}}
+}
+
+// ForWorkspace returns a MemoryAuditStore limited to the log of a workspace's todos
+func (as *MemoryAuditStore) ForWorkspace(workspaceID int) AuditRepository {
+	return &MemoryAuditStore{db: as.db, owner: ownership{workspaceID: workspaceID}}
+}
+
+// Record adds an entry to the log
+func (as *MemoryAuditStore) Record(entry *AuditEntry) error {
+	as.db.mu.Lock()
+	defer as.db.mu.Unlock()
+
+	entry.ID = as.db.nextAuditID
+	entry.CreatedAt = memoryNow()
+	as.db.nextAuditID++
+
+	stored := *entry
+	stored.UserID = copyInt(entry.UserID)
+	stored.Username = ""
+	stored.owner = as.owner
+	as.db.audit = append(as.db.audit, stored)
+
+	return nil
+}
+
+// History returns the entries of a todo, oldest first
+func (as *MemoryAuditStore) History(todoID int) ([]AuditEntry, error) {
+	as.db.mu.RLock()
+	defer as.db.mu.RUnlock()
+
+	entries := []AuditEntry{}
+	for _, entry := range as.db.audit {
+		if entry.TodoID == todoID && as.owner.owns(entry.owner) {
+			entries = append(entries, as.db.withUsername(entry))
+		}
+	}
+	return entries, nil
+}
+
+// Get returns a specific entry
+func (as *MemoryAuditStore) Get(id int) (*AuditEntry, error) {
+	as.db.mu.RLock()
+	defer as.db.mu.RUnlock()
+
+	for _, entry := range as.db.audit {
+		if entry.ID == id && as.owner.owns(entry.owner) {
+			entry = as.db.withUsername(entry)
+			return &entry, nil
+		}
+	}
+	return nil, fmt.Errorf("audit entry not found")
+}
+
+// List returns the entries matching filter, newest first
+func (as *MemoryAuditStore) List(filter AuditFilter) ([]AuditEntry, int, error) {
+	as.db.mu.RLock()
+	defer as.db.mu.RUnlock()
+
+	var matches []AuditEntry
+	for i := len(as.db.audit) - 1; i >= 0; i-- {
+		entry := as.db.audit[i]
+		switch {
+		case !as.owner.owns(entry.owner),
+			filter.TodoID != 0 && entry.TodoID != filter.TodoID,
+			filter.Action != "" && entry.Action != filter.Action,
+			filter.UserID != 0 && (entry.UserID == nil || *entry.UserID != filter.UserID),
+			filter.Since != nil && entry.CreatedAt.Before(filter.Since.Truncate(time.Second)),
+			filter.Until != nil && !entry.CreatedAt.Before(filter.Until.Truncate(time.Second)):
+			continue
+		}
+		matches = append(matches, entry)
+	}
+
+	limit := filter.Limit
+	if limit == 0 {
+		limit = DefaultAuditLimit
+	}
+	entries := []AuditEntry{}
+	for i := filter.Offset; i < len(matches) && i < filter.Offset+limit; i++ {
+		entries = append(entries, as.db.withUsername(matches[i]))
+	}
+	return entries, len(matches), nil
+}
+
+// withUsername sets the username of an entry's user, as the SQL store joins
+// it. The caller must hold db.mu.
+func (db *MemoryDB) withUsername(entry AuditEntry) AuditEntry {
+	entry.UserID = copyInt(entry.UserID)
+	if entry.UserID != nil {
+		entry.Username = db.users[*entry.UserID].Username
+	}
+	return entry
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
@@ -15,29 +16,119 @@ type Category struct {
 	Color     string    `json:"color"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	Version   int       `json:"version"` // counts the changes, see Todo.Version
+
+	owner ownership // kept by the memory store; the SQL stores filter on owner_id and workspace_id
+}
+
+// defaultCategories are created for every new user
+var defaultCategories = []struct{ name, color string }{
+	{"仕事", "#ff6b6b"},
+	{"プライベート", "#4dabf7"},
+	{"勉強", "#51cf66"},
+	{"その他", "#868e96"},
 }
 
-// CategoryStore manages category items using SQLite database
+// CategoryRepository is the storage used by the category handlers.
+//
+// Implementations report missing categories with an error containing
+// "not found", duplicate names with one containing "UNIQUE constraint failed"
+// and deleting a category that todos outside the trash still use with one
+// containing "category is in use".
+//
+// Categories belong to a user or to a workspace; ForUser and ForWorkspace
+// return a repository limited to the categories of one, in which the others
+// do not exist.
+//
+// IfVersion returns a repository whose Update and Delete only change a
+// category that is still at the given version and fail with
+// ErrVersionConflict otherwise, like TodoRepository.IfVersion.
+type CategoryRepository interface {
+	ForUser(userID int) CategoryRepository
+	ForWorkspace(workspaceID int) CategoryRepository
+	IfVersion(version int) CategoryRepository
+	GetAll() ([]Category, error)
+	GetByID(id int) (*Category, error)
+	Create(name, color string) (*Category, error)
+	Update(id int, name, color string) (*Category, error)
+	Delete(id int) error
+}
+
+// CategoryStore manages category items in an SQL database (SQLite or PostgreSQL)
 type CategoryStore struct {
-	db *database.DB
+	db      *database.DB
+	owner   ownership
+	version int // the version writes expect, see IfVersion
 }
 
-// NewCategoryStore creates a new CategoryStore with SQLite backend
+// NewCategoryStore creates a new CategoryStore backed by db
 func NewCategoryStore(db *database.DB) *CategoryStore {
 	return &CategoryStore{
 		db: db,
 	}
 }
 
+var _ CategoryRepository = (*CategoryStore)(nil)
+
+// ForUser returns a CategoryStore limited to the categories of a user
+func (cs *CategoryStore) ForUser(userID int) CategoryRepository {
+	return &CategoryStore{db: cs.db, owner: ownership{userID: userID}}
+}
+
+// ForWorkspace returns a CategoryStore limited to the categories of a workspace
+func (cs *CategoryStore) ForWorkspace(workspaceID int) CategoryRepository {
+	return &CategoryStore{db: cs.db, owner: ownership{workspaceID: workspaceID}}
+}
+
+// IfVersion returns a CategoryStore whose writes only change a category at
+// the given version
+func (cs *CategoryStore) IfVersion(version int) CategoryRepository {
+	return &CategoryStore{db: cs.db, owner: cs.owner, version: version}
+}
+
+// versionFilter returns the condition a write puts on the version of the
+// category it changes, which only a store made by IfVersion has
+func (cs *CategoryStore) versionFilter() (string, []any) {
+	if cs.version == 0 {
+		return "1 = 1", nil
+	}
+	return "version = ?", []any{cs.version}
+}
+
+// notWritten tells why a write changed no category: it does not exist, or
+// it is no longer at the version the store expects
+func (cs *CategoryStore) notWritten(queryRow func(query string, args ...any) *sql.Row, id int) error {
+	if cs.version == 0 {
+		return fmt.Errorf("category not found")
+	}
+
+	owner, args := cs.owner.filter("")
+	var count int
+	err := queryRow(`SELECT COUNT(*) FROM categories WHERE id = ? AND `+owner, append([]any{id}, args...)...).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check category: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("category not found")
+	}
+	return ErrVersionConflict
+}
+
+// errDuplicateCategoryName reports a taken category name in the same words on
+// every backend, since handlers match on "UNIQUE constraint failed"
+var errDuplicateCategoryName = errors.New("UNIQUE constraint failed: categories.name")
+
 // GetAll retrieves all categories from the database
 func (cs *CategoryStore) GetAll() ([]Category, error) {
+	owner, args := cs.owner.filter("")
 	query := `
-		SELECT id, name, color, created_at, updated_at 
+		SELECT id, name, color, created_at, updated_at, version
 		FROM categories 
+		WHERE ` + owner + `
 		ORDER BY name ASC
 	`
 	
-	rows, err := cs.db.Query(query)
+	rows, err := cs.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query categories: %w", err)
 	}
@@ -52,6 +143,7 @@ func (cs *CategoryStore) GetAll() ([]Category, error) {
 			&category.Color,
 			&category.CreatedAt,
 			&category.UpdatedAt,
+			&category.Version,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan category: %w", err)
@@ -68,19 +160,20 @@ func (cs *CategoryStore) GetAll() ([]Category, error) {
 
 // GetByID retrieves a specific category by ID
 func (cs *CategoryStore) GetByID(id int) (*Category, error) {
+	owner, args := cs.owner.filter("")
 	query := `
-		SELECT id, name, color, created_at, updated_at 
+		SELECT id, name, color, created_at, updated_at, version
 		FROM categories 
-		WHERE id = ?
-	`
+		WHERE id = ? AND ` + owner
 	
 	var category Category
-	err := cs.db.QueryRow(query, id).Scan(
+	err := cs.db.QueryRow(query, append([]any{id}, args...)...).Scan(
 		&category.ID,
 		&category.Name,
 		&category.Color,
 		&category.CreatedAt,
 		&category.UpdatedAt,
+		&category.Version,
 	)
 	
 	if err != nil {
@@ -96,34 +189,38 @@ func (cs *CategoryStore) GetByID(id int) (*Category, error) {
 // Create adds a new category to the database
 func (cs *CategoryStore) Create(name, color string) (*Category, error) {
 	query := `
-		INSERT INTO categories (name, color, created_at, updated_at)
-		VALUES (?, ?, datetime('now'), datetime('now'))
+		INSERT INTO categories (name, color, owner_id, workspace_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING id
 	`
 	
-	result, err := cs.db.Exec(query, name, color)
+	var id int
+	err := cs.db.QueryRow(query, name, color, cs.owner.userValue(), cs.owner.workspaceValue()).Scan(&id)
 	if err != nil {
+		if database.IsUniqueViolation(err) {
+			return nil, fmt.Errorf("failed to create category: %w", errDuplicateCategoryName)
+		}
 		return nil, fmt.Errorf("failed to create category: %w", err)
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get last insert id: %w", err)
-	}
-
 	// Retrieve the created category
-	return cs.GetByID(int(id))
+	return cs.GetByID(id)
 }
 
 // Update modifies a category's name and color
 func (cs *CategoryStore) Update(id int, name, color string) (*Category, error) {
+	owner, args := cs.owner.filter("")
+	version, versionArgs := cs.versionFilter()
 	query := `
 		UPDATE categories 
-		SET name = ?, color = ?, updated_at = datetime('now')
-		WHERE id = ?
-	`
+		SET name = ?, color = ?, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = ? AND ` + owner + ` AND ` + version
 	
-	result, err := cs.db.Exec(query, name, color, id)
+	result, err := cs.db.Exec(query, append(append([]any{name, color, id}, args...), versionArgs...)...)
 	if err != nil {
+		if database.IsUniqueViolation(err) {
+			return nil, fmt.Errorf("failed to update category: %w", errDuplicateCategoryName)
+		}
 		return nil, fmt.Errorf("failed to update category: %w", err)
 	}
 
@@ -133,18 +230,27 @@ func (cs *CategoryStore) Update(id int, name, color string) (*Category, error) {
 	}
 
 	if rowsAffected == 0 {
-		return nil, fmt.Errorf("category not found")
+		return nil, cs.notWritten(cs.db.QueryRow, id)
 	}
 
 	// Return the updated category
 	return cs.GetByID(id)
 }
 
-// Delete removes a category from the database
+// Delete removes a category from the database. Todos in the trash do not
+// keep it in use; they lose the category instead.
 func (cs *CategoryStore) Delete(id int) error {
+	owner, args := cs.owner.filter("")
+
+	tx, err := cs.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	// Check if category is in use
 	var count int
-	err := cs.db.QueryRow(`SELECT COUNT(*) FROM todos WHERE category_id = ?`, id).Scan(&count)
+	err = tx.QueryRow(`SELECT COUNT(*) FROM todos WHERE category_id = ? AND deleted_at IS NULL AND `+owner, append([]any{id}, args...)...).Scan(&count)
 	if err != nil {
 		return fmt.Errorf("failed to check category usage: %w", err)
 	}
@@ -153,9 +259,15 @@ func (cs *CategoryStore) Delete(id int) error {
 		return fmt.Errorf("category is in use by %d todos", count)
 	}
 
-	query := `DELETE FROM categories WHERE id = ?`
+	_, err = tx.Exec(`UPDATE todos SET category_id = NULL, version = version + 1 WHERE category_id = ? AND `+owner, append([]any{id}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to clear category of deleted todos: %w", err)
+	}
+
+	version, versionArgs := cs.versionFilter()
+	query := `DELETE FROM categories WHERE id = ? AND ` + owner + ` AND ` + version
 	
-	result, err := cs.db.Exec(query, id)
+	result, err := tx.Exec(query, append(append([]any{id}, args...), versionArgs...)...)
 	if err != nil {
 		return fmt.Errorf("failed to delete category: %w", err)
 	}
@@ -166,8 +278,28 @@ func (cs *CategoryStore) Delete(id int) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("category not found")
+		return cs.notWritten(tx.QueryRow, id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to delete category: %w", err)
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// seedDefaultCategories gives a user or a new workspace the default
+// categories, skipping the names it already has
+func seedDefaultCategories(tx *database.Tx, o ownership) error {
+	for _, c := range defaultCategories {
+		_, err := tx.Exec(`
+			INSERT INTO categories (name, color, owner_id, workspace_id, created_at, updated_at)
+			VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+			ON CONFLICT DO NOTHING
+		`, c.name, c.color, o.userValue(), o.workspaceValue())
+		if err != nil {
+			return fmt.Errorf("failed to create default categories: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MemoryCategoryStore manages categories in memory
+type MemoryCategoryStore struct {
+	db      *MemoryDB
+	owner   ownership
+	version int // the version writes expect, see IfVersion
+}
+
+// NewMemoryCategoryStore creates a new CategoryRepository backed by db
+func NewMemoryCategoryStore(db *MemoryDB) *MemoryCategoryStore {
+	return &MemoryCategoryStore{db: db}
+}
+
+var _ CategoryRepository = (*MemoryCategoryStore)(nil)
+
+// ForUser returns a MemoryCategoryStore limited to the categories of a user
+func (cs *MemoryCategoryStore) ForUser(userID int) CategoryRepository {
+	return &MemoryCategoryStore{db: cs.db, owner: ownership{userID: userID}}
+}
+
+// ForWorkspace returns a MemoryCategoryStore limited to the categories of a workspace
+func (cs *MemoryCategoryStore) ForWorkspace(workspaceID int) CategoryRepository {
+	return &MemoryCategoryStore{db: cs.db, owner: ownership{workspaceID: workspaceID}}
+}
+
+// IfVersion returns a MemoryCategoryStore whose writes only change a
+// category at the given version
+func (cs *MemoryCategoryStore) IfVersion(version int) CategoryRepository {
+	return &MemoryCategoryStore{db: cs.db, owner: cs.owner, version: version}
+}
+
+// written returns the category a write changes, checking its version for a
+// store made by IfVersion. The caller must hold db.mu.
+func (cs *MemoryCategoryStore) written(id int) (Category, error) {
+	category, ok := cs.db.categories[id]
+	if !ok || !cs.owner.owns(category.owner) {
+		return Category{}, fmt.Errorf("category not found")
+	}
+	if cs.version != 0 && category.Version != cs.version {
+		return Category{}, ErrVersionConflict
+	}
+	return category, nil
+}
+
+// GetAll returns all categories ordered by name
+func (cs *MemoryCategoryStore) GetAll() ([]Category, error) {
+	cs.db.mu.RLock()
+	defer cs.db.mu.RUnlock()
+
+	categories := make([]Category, 0, len(cs.db.categories))
+	for _, category := range cs.db.categories {
+		if cs.owner.owns(category.owner) {
+			categories = append(categories, category)
+		}
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		return categories[i].Name < categories[j].Name
+	})
+
+	return categories, nil
+}
+
+// GetByID returns a specific category
+func (cs *MemoryCategoryStore) GetByID(id int) (*Category, error) {
+	cs.db.mu.RLock()
+	defer cs.db.mu.RUnlock()
+
+	category, ok := cs.db.categories[id]
+	if !ok || !cs.owner.owns(category.owner) {
+		return nil, fmt.Errorf("category not found")
+	}
+	return &category, nil
+}
+
+// Create adds a new category
+func (cs *MemoryCategoryStore) Create(name, color string) (*Category, error) {
+	cs.db.mu.Lock()
+	defer cs.db.mu.Unlock()
+
+	if cs.db.categoryNameTaken(cs.owner, name, 0) {
+		return nil, fmt.Errorf("failed to create category: %w", errDuplicateCategoryName)
+	}
+
+	category := cs.db.addCategory(cs.owner, name, color)
+	return &category, nil
+}
+
+// Update modifies a category's name and color
+func (cs *MemoryCategoryStore) Update(id int, name, color string) (*Category, error) {
+	cs.db.mu.Lock()
+	defer cs.db.mu.Unlock()
+
+	category, err := cs.written(id)
+	if err != nil {
+		return nil, err
+	}
+	if cs.db.categoryNameTaken(category.owner, name, id) {
+		return nil, fmt.Errorf("failed to update category: %w", errDuplicateCategoryName)
+	}
+
+	category.Name = name
+	category.Color = color
+	category.UpdatedAt = memoryNow()
+	category.Version++
+	cs.db.categories[id] = category
+
+	return &category, nil
+}
+
+// Delete removes a category that no todo uses; todos in the trash lose it
+func (cs *MemoryCategoryStore) Delete(id int) error {
+	cs.db.mu.Lock()
+	defer cs.db.mu.Unlock()
+
+	if _, err := cs.written(id); err != nil {
+		return err
+	}
+
+	count := 0
+	for _, todo := range cs.db.todos {
+		if todo.CategoryID != nil && *todo.CategoryID == id && todo.DeletedAt == nil {
+			count++
+		}
+	}
+	if count > 0 {
+		return fmt.Errorf("category is in use by %d todos", count)
+	}
+
+	for todoID, todo := range cs.db.todos {
+		if todo.CategoryID != nil && *todo.CategoryID == id {
+			todo.CategoryID = nil
+			todo.Version++
+			cs.db.todos[todoID] = todo
+		}
+	}
+
+	delete(cs.db.categories, id)
+
+	return nil
+}
+
+// addCategory stores a new category of owner. The caller must hold db.mu.
+func (db *MemoryDB) addCategory(owner ownership, name, color string) Category {
+	now := memoryNow()
+	category := Category{
+		ID:        db.nextCategoryID,
+		Name:      name,
+		Color:     color,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Version:   1,
+		owner:     owner,
+	}
+	db.categories[category.ID] = category
+	db.nextCategoryID++
+
+	return category
+}
+
+// seedDefaultCategories gives a user or a new workspace the default
+// categories, skipping the names it already has. The caller must hold db.mu.
+func (db *MemoryDB) seedDefaultCategories(owner ownership) {
+	for _, c := range defaultCategories {
+		if !db.categoryNameTaken(owner, c.name, 0) {
+			db.addCategory(owner, c.name, c.color)
+		}
+	}
+}
+
+// categoryNameTaken reports whether another category of owner already
+// uses name. The caller must hold db.mu.
+func (db *MemoryDB) categoryNameTaken(owner ownership, name string, exceptID int) bool {
+	for _, category := range db.categories {
+		if category.owner == owner && category.ID != exceptID && category.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryDB holds the data of the in-memory stores. It is safe for
+// concurrent use; all stores created from the same MemoryDB share its data.
+type MemoryDB struct {
+	mu               sync.RWMutex
+	todos            map[int]Todo
+	categories       map[int]Category
+	tags             map[int]Tag
+	todoTags         map[int]map[int]bool // todo ID -> tag IDs
+	reminders        map[int]Reminder
+	webhooks         map[int]Webhook
+	deliveries       []WebhookDelivery // in the order they were added
+	users            map[int]User
+	sessions         map[string]memorySession // by token hash
+	identities       map[userIdentity]int     // user IDs
+	apiTokens        map[int]APIToken
+	workspaces       map[int]Workspace
+	workspaceMembers map[int]map[int]WorkspaceMember // workspace ID -> user ID -> member
+	invitations      map[int]WorkspaceInvitation
+	audit            []AuditEntry // oldest first
+	nextTodoID       int
+	nextCategoryID   int
+	nextTagID        int
+	nextReminderID   int
+	nextWebhookID    int
+	nextDeliveryID   int
+	nextUserID       int
+	nextAPITokenID   int
+	nextWorkspaceID  int
+	nextInvitationID int
+	nextAuditID      int
+}
+
+// NewMemoryDB creates an empty in-memory database
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		todos:            make(map[int]Todo),
+		categories:       make(map[int]Category),
+		tags:             make(map[int]Tag),
+		todoTags:         make(map[int]map[int]bool),
+		reminders:        make(map[int]Reminder),
+		webhooks:         make(map[int]Webhook),
+		users:            make(map[int]User),
+		sessions:         make(map[string]memorySession),
+		identities:       make(map[userIdentity]int),
+		apiTokens:        make(map[int]APIToken),
+		workspaces:       make(map[int]Workspace),
+		workspaceMembers: make(map[int]map[int]WorkspaceMember),
+		invitations:      make(map[int]WorkspaceInvitation),
+		nextTodoID:       1,
+		nextCategoryID:   1,
+		nextTagID:        1,
+		nextReminderID:   1,
+		nextWebhookID:    1,
+		nextDeliveryID:   1,
+		nextUserID:       1,
+		nextAPITokenID:   1,
+		nextWorkspaceID:  1,
+		nextInvitationID: 1,
+		nextAuditID:      1,
+	}
+}
+
+// memoryNow returns the current time with the precision SQLite stores
+func memoryNow() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
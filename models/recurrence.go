@@ -0,0 +1,46 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gotodo/recurrence"
+)
+
+// MaxOccurrencePreview limits how many upcoming occurrences can be previewed at once
+const MaxOccurrencePreview = 100
+
+// NextOccurrences returns the due dates of up to n occurrences following a
+// recurring todo. The series continues from the todo's due date, or from now
+// when it has none.
+func NextOccurrences(todo *Todo, n int, now time.Time) ([]time.Time, error) {
+	if todo.Recurrence == nil {
+		return nil, fmt.Errorf("todo does not recur")
+	}
+	rule, err := recurrence.Parse(*todo.Recurrence)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stored recurrence: %w", err)
+	}
+
+	return rule.Occurrences(occurrenceBase(todo.DueDate, now), max(todo.Occurrence, 1), n), nil
+}
+
+// nextDueDate computes the due date of the occurrence following one with the
+// given rule, due date and position in its series
+func nextDueDate(rule string, dueDate *time.Time, occurrence int, now time.Time) (time.Time, bool, error) {
+	parsed, err := recurrence.Parse(rule)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid stored recurrence: %w", err)
+	}
+
+	next, ok := parsed.Next(occurrenceBase(dueDate, now), max(occurrence, 1))
+	return next, ok, nil
+}
+
+// occurrenceBase is the time a series continues from
+func occurrenceBase(dueDate *time.Time, now time.Time) time.Time {
+	if dueDate != nil {
+		return dueDate.UTC()
+	}
+	return now.UTC().Truncate(time.Second)
+}
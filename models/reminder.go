@@ -0,0 +1,288 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gotodo/database"
+)
+
+// MaxReminderAttempts is how many times a reminder is sent before a failed
+// delivery is given up
+const MaxReminderAttempts = 5
+
+// Reminder notifies about a todo at a fixed time (RemindAt) or a number of
+// minutes before its due date (MinutesBefore); exactly one of them is set
+type Reminder struct {
+	ID            int        `json:"id"`
+	TodoID        int        `json:"todo_id"`
+	RemindAt      *time.Time `json:"remind_at"`
+	MinutesBefore *int       `json:"minutes_before"`
+	// At is when the reminder fires; it is nil for a reminder relative to
+	// the due date of a todo that has none
+	At        *time.Time `json:"at"`
+	SentAt    *time.Time `json:"sent_at"`
+	Attempts  int        `json:"attempts"`
+	LastError *string    `json:"last_error,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// fireTime computes when a reminder fires for a todo due at dueDate
+func (r *Reminder) fireTime(dueDate *time.Time) {
+	switch {
+	case r.RemindAt != nil:
+		at := *r.RemindAt
+		r.At = &at
+	case r.MinutesBefore != nil && dueDate != nil:
+		at := dueDate.Add(-time.Duration(*r.MinutesBefore) * time.Minute)
+		r.At = &at
+	default:
+		r.At = nil
+	}
+}
+
+// ReminderRepository is the storage used by the reminder handlers and the
+// reminder scheduler.
+//
+// Implementations report a missing todo with an error containing
+// "todo not found" and a missing reminder with one containing
+// "reminder not found". Deleting a todo deletes its reminders, and the next
+// occurrence of a recurring todo gets a copy of its relative reminders.
+//
+// ForUser and ForWorkspace return a repository limited to the reminders of
+// the todos of a user or a workspace; the scheduler uses one that is not,
+// covering everyone.
+type ReminderRepository interface {
+	ForUser(userID int) ReminderRepository
+	ForWorkspace(workspaceID int) ReminderRepository
+
+	// List returns the reminders of a todo in the order they were created
+	List(todoID int) ([]Reminder, error)
+	Create(todoID int, remindAt *time.Time, minutesBefore *int) (*Reminder, error)
+	Delete(todoID, id int) error
+
+	// Due returns the unsent reminders of open todos whose time has come,
+	// earliest first
+	Due(now time.Time) ([]Reminder, error)
+	// Claim marks a reminder as sent before it is delivered and reports
+	// whether this call did so; false means it was already claimed, possibly
+	// by another server sharing the database
+	Claim(id int) (bool, error)
+	// Release records a failed delivery; with retry the reminder becomes
+	// due again, otherwise it stays sent
+	Release(id int, message string, retry bool) error
+}
+
+// ReminderStore manages reminders in an SQL database (SQLite or PostgreSQL)
+type ReminderStore struct {
+	db    *database.DB
+	owner ownership
+}
+
+// NewReminderStore creates a new ReminderStore backed by db
+func NewReminderStore(db *database.DB) *ReminderStore {
+	return &ReminderStore{db: db}
+}
+
+var _ ReminderRepository = (*ReminderStore)(nil)
+
+// ForUser returns a ReminderStore limited to the reminders of a user's todos
+func (rs *ReminderStore) ForUser(userID int) ReminderRepository {
+	return &ReminderStore{db: rs.db, owner: ownership{userID: userID}}
+}
+
+// ForWorkspace returns a ReminderStore limited to the reminders of a workspace's todos
+func (rs *ReminderStore) ForWorkspace(workspaceID int) ReminderRepository {
+	return &ReminderStore{db: rs.db, owner: ownership{workspaceID: workspaceID}}
+}
+
+// reminderSelect selects the columns read by scanReminder
+const reminderSelect = `
+	SELECT r.id, r.todo_id, r.remind_at, r.minutes_before, r.sent_at,
+		r.attempts, r.last_error, r.created_at, t.due_date
+	FROM reminders r
+	JOIN todos t ON t.id = r.todo_id
+`
+
+// scanReminder reads a row produced by reminderSelect
+func scanReminder(row rowScanner) (Reminder, error) {
+	var reminder Reminder
+	var remindAt, sentAt, dueDate sql.NullTime
+	var minutesBefore sql.NullInt64
+	var lastError sql.NullString
+
+	err := row.Scan(
+		&reminder.ID,
+		&reminder.TodoID,
+		&remindAt,
+		&minutesBefore,
+		&sentAt,
+		&reminder.Attempts,
+		&lastError,
+		&reminder.CreatedAt,
+		&dueDate,
+	)
+	if err != nil {
+		return reminder, err
+	}
+
+	if remindAt.Valid {
+		reminder.RemindAt = &remindAt.Time
+	}
+	if minutesBefore.Valid {
+		minutes := int(minutesBefore.Int64)
+		reminder.MinutesBefore = &minutes
+	}
+	if sentAt.Valid {
+		reminder.SentAt = &sentAt.Time
+	}
+	if lastError.Valid {
+		reminder.LastError = &lastError.String
+	}
+
+	var due *time.Time
+	if dueDate.Valid {
+		due = &dueDate.Time
+	}
+	reminder.fireTime(due)
+
+	return reminder, nil
+}
+
+// queryReminders runs a query built on reminderSelect
+func (rs *ReminderStore) queryReminders(query string, args ...any) ([]Reminder, error) {
+	rows, err := rs.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reminders: %w", err)
+	}
+	defer rows.Close()
+
+	reminders := []Reminder{}
+	for rows.Next() {
+		reminder, err := scanReminder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan reminder: %w", err)
+		}
+		reminders = append(reminders, reminder)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return reminders, nil
+}
+
+// checkTodo reports a missing todo, or one in the trash
+func (rs *ReminderStore) checkTodo(todoID int) error {
+	owner, args := rs.owner.filter("")
+	var count int
+	if err := rs.db.QueryRow(`SELECT COUNT(*) FROM todos WHERE id = ? AND deleted_at IS NULL AND `+owner, append([]any{todoID}, args...)...).Scan(&count); err != nil {
+		return fmt.Errorf("failed to check todo: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("todo not found")
+	}
+	return nil
+}
+
+// List returns the reminders of a todo
+func (rs *ReminderStore) List(todoID int) ([]Reminder, error) {
+	if err := rs.checkTodo(todoID); err != nil {
+		return nil, err
+	}
+	return rs.queryReminders(reminderSelect+` WHERE r.todo_id = ? ORDER BY r.id`, todoID)
+}
+
+// Create adds a reminder to a todo
+func (rs *ReminderStore) Create(todoID int, remindAt *time.Time, minutesBefore *int) (*Reminder, error) {
+	if err := rs.checkTodo(todoID); err != nil {
+		return nil, err
+	}
+
+	var id int
+	err := rs.db.QueryRow(`
+		INSERT INTO reminders (todo_id, remind_at, minutes_before, created_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		RETURNING id
+	`, todoID, remindAt, minutesBefore).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reminder: %w", err)
+	}
+
+	reminder, err := scanReminder(rs.db.QueryRow(reminderSelect+` WHERE r.id = ?`, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reminder: %w", err)
+	}
+	return &reminder, nil
+}
+
+// Delete removes a reminder of a todo
+func (rs *ReminderStore) Delete(todoID, id int) error {
+	owner, args := rs.owner.filter("")
+	result, err := rs.db.Exec(`
+		DELETE FROM reminders
+		WHERE id = ? AND todo_id = ? AND todo_id IN (SELECT id FROM todos WHERE deleted_at IS NULL AND `+owner+`)
+	`, append([]any{id, todoID}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to delete reminder: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("reminder not found")
+	}
+
+	return nil
+}
+
+// Due returns the reminders to send at now, skipping those of todos in the
+// trash. The fire time of relative reminders is computed from the due date
+// in the query.
+func (rs *ReminderStore) Due(now time.Time) ([]Reminder, error) {
+	dialect := rs.db.Dialect
+	fireTime := "COALESCE(" + dialect.Timestamp("r.remind_at") + ", " + dialect.MinutesBefore("t.due_date", "r.minutes_before") + ")"
+	owner, args := rs.owner.filter("t")
+	return rs.queryReminders(reminderSelect+`
+		WHERE r.sent_at IS NULL AND t.completed = FALSE AND t.deleted_at IS NULL
+			AND `+fireTime+` <= `+dialect.Timestamp("?")+` AND `+owner+`
+		ORDER BY `+fireTime+`, r.id
+	`, append([]any{now.UTC()}, args...)...)
+}
+
+// Claim marks a reminder as sent unless it already is
+func (rs *ReminderStore) Claim(id int) (bool, error) {
+	result, err := rs.db.Exec(`
+		UPDATE reminders
+		SET sent_at = CURRENT_TIMESTAMP, attempts = attempts + 1
+		WHERE id = ? AND sent_at IS NULL
+	`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim reminder: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// Release records a failed delivery
+func (rs *ReminderStore) Release(id int, message string, retry bool) error {
+	query := `UPDATE reminders SET last_error = ? WHERE id = ?`
+	if retry {
+		query = `UPDATE reminders SET last_error = ?, sent_at = NULL WHERE id = ?`
+	}
+
+	if _, err := rs.db.Exec(query, message, id); err != nil {
+		return fmt.Errorf("failed to release reminder: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MemoryReminderStore manages reminders in memory
+type MemoryReminderStore struct {
+	db    *MemoryDB
+	owner ownership
+}
+
+// NewMemoryReminderStore creates a new ReminderRepository backed by db
+func NewMemoryReminderStore(db *MemoryDB) *MemoryReminderStore {
+	return &MemoryReminderStore{db: db}
+}
+
+var _ ReminderRepository = (*MemoryReminderStore)(nil)
+
+// ForUser returns a MemoryReminderStore limited to the reminders of a user's todos
+func (rs *MemoryReminderStore) ForUser(userID int) ReminderRepository {
+	return &MemoryReminderStore{db: rs.db, owner: ownership{userID: userID}}
+}
+
+// ForWorkspace returns a MemoryReminderStore limited to the reminders of a workspace's todos
+func (rs *MemoryReminderStore) ForWorkspace(workspaceID int) ReminderRepository {
+	return &MemoryReminderStore{db: rs.db, owner: ownership{workspaceID: workspaceID}}
+}
+
+// ownsTodo reports whether a todo exists, belongs to the store's owner and
+// is not in the trash. The caller must hold db.mu.
+func (rs *MemoryReminderStore) ownsTodo(todoID int) bool {
+	todo, ok := rs.db.todos[todoID]
+	return ok && rs.owner.owns(todo.owner) && todo.DeletedAt == nil
+}
+
+// List returns the reminders of a todo
+func (rs *MemoryReminderStore) List(todoID int) ([]Reminder, error) {
+	rs.db.mu.RLock()
+	defer rs.db.mu.RUnlock()
+
+	if !rs.ownsTodo(todoID) {
+		return nil, fmt.Errorf("todo not found")
+	}
+	return rs.db.todoReminders(todoID), nil
+}
+
+// Create adds a reminder to a todo
+func (rs *MemoryReminderStore) Create(todoID int, remindAt *time.Time, minutesBefore *int) (*Reminder, error) {
+	rs.db.mu.Lock()
+	defer rs.db.mu.Unlock()
+
+	if !rs.ownsTodo(todoID) {
+		return nil, fmt.Errorf("todo not found")
+	}
+
+	reminder := rs.db.withFireTime(rs.db.addReminder(todoID, remindAt, minutesBefore))
+	return &reminder, nil
+}
+
+// Delete removes a reminder of a todo
+func (rs *MemoryReminderStore) Delete(todoID, id int) error {
+	rs.db.mu.Lock()
+	defer rs.db.mu.Unlock()
+
+	reminder, ok := rs.db.reminders[id]
+	if !ok || reminder.TodoID != todoID || !rs.ownsTodo(todoID) {
+		return fmt.Errorf("reminder not found")
+	}
+	delete(rs.db.reminders, id)
+
+	return nil
+}
+
+// Due returns the reminders to send at now
+func (rs *MemoryReminderStore) Due(now time.Time) ([]Reminder, error) {
+	rs.db.mu.RLock()
+	defer rs.db.mu.RUnlock()
+
+	var pending []Reminder
+	for _, reminder := range rs.db.reminders {
+		if reminder.SentAt != nil || rs.db.todos[reminder.TodoID].Completed || !rs.ownsTodo(reminder.TodoID) {
+			continue
+		}
+		pending = append(pending, rs.db.withFireTime(reminder))
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].ID < pending[j].ID
+	})
+
+	return dueReminders(pending, now), nil
+}
+
+// Claim marks a reminder as sent unless it already is
+func (rs *MemoryReminderStore) Claim(id int) (bool, error) {
+	rs.db.mu.Lock()
+	defer rs.db.mu.Unlock()
+
+	reminder, ok := rs.db.reminders[id]
+	if !ok || reminder.SentAt != nil {
+		return false, nil
+	}
+	now := memoryNow()
+	reminder.SentAt = &now
+	reminder.Attempts++
+	rs.db.reminders[id] = reminder
+
+	return true, nil
+}
+
+// Release records a failed delivery
+func (rs *MemoryReminderStore) Release(id int, message string, retry bool) error {
+	rs.db.mu.Lock()
+	defer rs.db.mu.Unlock()
+
+	reminder, ok := rs.db.reminders[id]
+	if !ok {
+		return nil
+	}
+	reminder.LastError = &message
+	if retry {
+		reminder.SentAt = nil
+	}
+	rs.db.reminders[id] = reminder
+
+	return nil
+}
+
+// addReminder stores a new reminder. The caller must hold db.mu.
+func (db *MemoryDB) addReminder(todoID int, remindAt *time.Time, minutesBefore *int) Reminder {
+	reminder := Reminder{
+		ID:            db.nextReminderID,
+		TodoID:        todoID,
+		RemindAt:      copyTime(remindAt),
+		MinutesBefore: copyInt(minutesBefore),
+		CreatedAt:     memoryNow(),
+	}
+	db.reminders[reminder.ID] = reminder
+	db.nextReminderID++
+
+	return reminder
+}
+
+// todoReminders returns the reminders of a todo in the order they were
+// created. The caller must hold db.mu.
+func (db *MemoryDB) todoReminders(todoID int) []Reminder {
+	reminders := []Reminder{}
+	for _, reminder := range db.reminders {
+		if reminder.TodoID == todoID {
+			reminders = append(reminders, db.withFireTime(reminder))
+		}
+	}
+	sort.Slice(reminders, func(i, j int) bool {
+		return reminders[i].ID < reminders[j].ID
+	})
+	return reminders
+}
+
+// withFireTime copies a reminder's pointer fields and sets its fire time from
+// the todo's due date. The caller must hold db.mu.
+func (db *MemoryDB) withFireTime(reminder Reminder) Reminder {
+	reminder.RemindAt = copyTime(reminder.RemindAt)
+	reminder.MinutesBefore = copyInt(reminder.MinutesBefore)
+	reminder.SentAt = copyTime(reminder.SentAt)
+	reminder.LastError = copyString(reminder.LastError)
+	reminder.fireTime(db.todos[reminder.TodoID].DueDate)
+	return reminder
+}
+
+// dueReminders keeps the reminders whose time is at or before now, earliest first
+func dueReminders(reminders []Reminder, now time.Time) []Reminder {
+	var due []Reminder
+	for _, reminder := range reminders {
+		if reminder.At != nil && !reminder.At.After(now) {
+			due = append(due, reminder)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].At.Before(*due[j].At)
+	})
+	return due
+}
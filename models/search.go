@@ -0,0 +1,167 @@
+package models
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Markers wrapped around the matched parts of highlighted text
+const (
+	HighlightStart = "<mark>"
+	HighlightEnd   = "</mark>"
+)
+
+// ftsMinTermLength is the shortest term the trigram tokenizer can match
+const ftsMinTermLength = 3
+
+// snippetContext is the number of characters kept around a match in a description snippet
+const snippetContext = 24
+
+// SearchMatch explains why a todo matched a search.
+// Title and Description contain the matched text wrapped in HighlightStart
+// and HighlightEnd; everything else is returned as stored, so clients must
+// escape it before rendering.
+type SearchMatch struct {
+	Title       string  `json:"title"`
+	Description string  `json:"description,omitempty"`
+	Score       float64 `json:"score"`
+}
+
+// searchTerms splits a search query into the terms that must all match
+func searchTerms(query string) []string {
+	return strings.Fields(query)
+}
+
+// canUseFTS reports whether every term is long enough for the trigram index
+func canUseFTS(terms []string) bool {
+	if len(terms) == 0 {
+		return false
+	}
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) < ftsMinTermLength {
+			return false
+		}
+	}
+	return true
+}
+
+// ftsMatchQuery quotes each term so user input is never parsed as FTS5 syntax
+func ftsMatchQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// likePattern builds a LIKE pattern matching term anywhere, with % and _
+// escaped so they are matched literally (use with ESCAPE '\')
+func likePattern(term string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + replacer.Replace(term) + "%"
+}
+
+// matchTodo builds a SearchMatch for a todo without help from the database.
+// It is used when the full-text index cannot serve a query.
+func matchTodo(todo Todo, terms []string) *SearchMatch {
+	match := &SearchMatch{Title: highlightText(todo.Title, terms)}
+	if todo.Description != "" {
+		match.Description = snippetText(todo.Description, terms)
+	}
+
+	for _, term := range terms {
+		lowerTerm := strings.ToLower(term)
+		if strings.Contains(strings.ToLower(todo.Title), lowerTerm) {
+			match.Score += 2
+		}
+		if strings.Contains(strings.ToLower(todo.Description), lowerTerm) {
+			match.Score++
+		}
+	}
+
+	return match
+}
+
+// highlightText wraps every case-insensitive occurrence of the terms in markers
+func highlightText(text string, terms []string) string {
+	marked := matchedRunes(text, terms)
+	if marked == nil {
+		return text
+	}
+
+	var b strings.Builder
+	inMatch := false
+	for i, r := range []rune(text) {
+		if marked[i] != inMatch {
+			if marked[i] {
+				b.WriteString(HighlightStart)
+			} else {
+				b.WriteString(HighlightEnd)
+			}
+			inMatch = marked[i]
+		}
+		b.WriteRune(r)
+	}
+	if inMatch {
+		b.WriteString(HighlightEnd)
+	}
+
+	return b.String()
+}
+
+// snippetText returns the highlighted part of text around the first match,
+// or the empty string if nothing matched
+func snippetText(text string, terms []string) string {
+	marked := matchedRunes(text, terms)
+	if marked == nil {
+		return ""
+	}
+
+	runes := []rune(text)
+	first := 0
+	for first < len(marked) && !marked[first] {
+		first++
+	}
+
+	start := max(first-snippetContext, 0)
+	end := min(first+snippetContext*2, len(runes))
+
+	snippet := highlightText(string(runes[start:end]), terms)
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// matchedRunes marks the runes of text covered by any term, or returns nil if none are
+func matchedRunes(text string, terms []string) []bool {
+	runes := []rune(strings.ToLower(text))
+	if len(runes) != utf8.RuneCountInString(text) {
+		// Lowercasing changed the length; fall back to exact matching
+		runes = []rune(text)
+	}
+
+	var marked []bool
+	for _, term := range terms {
+		termRunes := []rune(strings.ToLower(term))
+		if len(termRunes) == 0 {
+			continue
+		}
+		for i := 0; i+len(termRunes) <= len(runes); i++ {
+			if string(runes[i:i+len(termRunes)]) != string(termRunes) {
+				continue
+			}
+			if marked == nil {
+				marked = make([]bool, len(runes))
+			}
+			for j := i; j < i+len(termRunes); j++ {
+				marked[j] = true
+			}
+		}
+	}
+
+	return marked
+}
@@ -0,0 +1,650 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotodo/database"
+	"gotodo/recurrence"
+)
+
+// forEachDatabase runs fn against a freshly opened SQLite database and,
+// when GOTODO_TEST_POSTGRES_DSN is set, a PostgreSQL database in a schema
+// of its own that is dropped afterwards. Migrations are not applied.
+func forEachDatabase(t *testing.T, fn func(t *testing.T, db *database.DB)) {
+	t.Run("sqlite", func(t *testing.T) {
+		db, err := database.Open(filepath.Join(t.TempDir(), "todos.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		fn(t, db)
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv("GOTODO_TEST_POSTGRES_DSN")
+		if dsn == "" {
+			t.Skip("GOTODO_TEST_POSTGRES_DSN is not set")
+		}
+
+		admin, err := database.OpenPostgres(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { admin.Close() })
+		schema := fmt.Sprintf("gotodo_test_%d", time.Now().UnixNano())
+		if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+				t.Errorf("failed to drop schema %s: %v", schema, err)
+			}
+		})
+
+		db, err := database.OpenPostgres(withSearchPath(t, dsn, schema))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		fn(t, db)
+	})
+}
+
+// withSearchPath adds a search_path run-time parameter to a connection URL
+// or a key=value connection string
+func withSearchPath(t *testing.T, dsn, schema string) string {
+	if !strings.Contains(dsn, "://") {
+		return dsn + " search_path=" + schema
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("invalid GOTODO_TEST_POSTGRES_DSN: %v", err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// migrate applies every migration to db
+func migrate(t *testing.T, db *database.DB) {
+	t.Helper()
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *database.DB) {
+		applied, err := db.MigrateUp()
+		if err != nil {
+			t.Fatalf("MigrateUp: %v", err)
+		}
+		statuses, err := db.MigrationStatus()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if applied != len(statuses) {
+			t.Errorf("MigrateUp applied %d of %d migrations", applied, len(statuses))
+		}
+		for _, s := range statuses {
+			if !s.Applied || s.Modified {
+				t.Errorf("migration %04d_%s: applied %v, modified %v", s.Version, s.Name, s.Applied, s.Modified)
+			}
+		}
+		if again, err := db.MigrateUp(); err != nil || again != 0 {
+			t.Errorf("second MigrateUp applied %d migrations, err %v", again, err)
+		}
+
+		// Every migration can be rolled back and applied again
+		reverted, err := db.MigrateDown(len(statuses))
+		if err != nil {
+			t.Fatalf("MigrateDown: %v", err)
+		}
+		if reverted != len(statuses) {
+			t.Errorf("MigrateDown reverted %d of %d migrations", reverted, len(statuses))
+		}
+		if applied, err := db.MigrateUp(); err != nil || applied != len(statuses) {
+			t.Errorf("MigrateUp after MigrateDown applied %d migrations, err %v", applied, err)
+		}
+	})
+}
+
+func TestStoreCRUD(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *database.DB) {
+		migrate(t, db)
+		user, err := NewUserStore(db).Create("alice", "hash")
+		if err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+		todos := NewTodoStore(db).ForUser(user.ID)
+		categories := NewCategoryStore(db).ForUser(user.ID)
+		tags := NewTagStore(db).ForUser(user.ID)
+
+		category, err := categories.Create("Errands", "#123456")
+		if err != nil {
+			t.Fatalf("creating category: %v", err)
+		}
+		if category.Version != 1 {
+			t.Errorf("new category has version %d", category.Version)
+		}
+		category, err = categories.Update(category.ID, "Chores", "#654321")
+		if err != nil {
+			t.Fatalf("updating category: %v", err)
+		}
+		if category.Name != "Chores" || category.Version != 2 {
+			t.Errorf("updated category = %+v", category)
+		}
+		tag, err := tags.Create("home", "#000000")
+		if err != nil {
+			t.Fatalf("creating tag: %v", err)
+		}
+
+		due := time.Date(2030, 1, 2, 10, 0, 0, 0, time.UTC)
+		todo, err := todos.CreateFull("Buy milk", "2 litres", &category.ID, 2, &due, []int{tag.ID}, nil)
+		if err != nil {
+			t.Fatalf("creating todo: %v", err)
+		}
+		got, err := todos.GetByID(todo.ID)
+		if err != nil {
+			t.Fatalf("getting todo: %v", err)
+		}
+		if got.Title != "Buy milk" || got.Description != "2 litres" || got.Priority != 2 ||
+			got.DueDate == nil || !got.DueDate.Equal(due) || got.Category == nil || got.Category.Name != "Chores" ||
+			len(got.Tags) != 1 || got.Tags[0].Name != "home" || got.Version != 1 {
+			t.Errorf("created todo = %+v", got)
+		}
+
+		priority := 3
+		updated, err := todos.Update(todo.ID, "Buy oat milk", "", nil, &priority, nil, []int{})
+		if err != nil {
+			t.Fatalf("updating todo: %v", err)
+		}
+		if updated.Title != "Buy oat milk" || updated.CategoryID != nil || updated.Priority != 3 ||
+			updated.DueDate != nil || len(updated.Tags) != 0 || updated.Version != 2 {
+			t.Errorf("updated todo = %+v", updated)
+		}
+		toggled, _, err := todos.Toggle(todo.ID)
+		if err != nil {
+			t.Fatalf("toggling todo: %v", err)
+		}
+		if !toggled.Completed || toggled.Version != 3 {
+			t.Errorf("toggled todo = %+v", toggled)
+		}
+
+		// A write expecting an older version changes nothing
+		if _, err := todos.IfVersion(2).Update(todo.ID, "stale", "", nil, nil, nil, nil); !errors.Is(err, ErrVersionConflict) {
+			t.Errorf("stale update: err = %v, want ErrVersionConflict", err)
+		}
+		if _, err := categories.IfVersion(1).Update(category.ID, "stale", "#000000"); !errors.Is(err, ErrVersionConflict) {
+			t.Errorf("stale category update: err = %v, want ErrVersionConflict", err)
+		}
+
+		if err := todos.Delete(todo.ID); err != nil {
+			t.Fatalf("deleting todo: %v", err)
+		}
+		if _, err := todos.GetByID(todo.ID); err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("getting deleted todo: err = %v", err)
+		}
+		if _, err := todos.Restore(todo.ID); err != nil {
+			t.Fatalf("restoring todo: %v", err)
+		}
+		if err := todos.DeleteTree(todo.ID); err != nil {
+			t.Fatalf("deleting todo again: %v", err)
+		}
+		if err := todos.Purge(todo.ID); err != nil {
+			t.Fatalf("purging todo: %v", err)
+		}
+
+		if err := tags.Delete(tag.ID); err != nil {
+			t.Fatalf("deleting tag: %v", err)
+		}
+		if err := categories.Delete(category.ID); err != nil {
+			t.Fatalf("deleting category: %v", err)
+		}
+		if _, err := categories.GetByID(category.ID); err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("getting deleted category: err = %v", err)
+		}
+
+		// Other users do not see the todos of alice
+		bob, err := NewUserStore(db).Create("bob", "hash")
+		if err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+		own, err := todos.CreateFull("Private", "", nil, 1, nil, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewTodoStore(db).ForUser(bob.ID).GetByID(own.ID); err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("getting another user's todo: err = %v", err)
+		}
+	})
+}
+
+func TestToggleReportsCompletion(t *testing.T) {
+	check := func(t *testing.T, todos TodoRepository) {
+		rule, err := recurrence.Parse("FREQ=DAILY")
+		if err != nil {
+			t.Fatal(err)
+		}
+		due := time.Date(2030, 1, 2, 10, 0, 0, 0, time.UTC)
+		parent, err := todos.CreateFull("Water plants", "", nil, 1, &due, nil, rule)
+		if err != nil {
+			t.Fatalf("creating todo: %v", err)
+		}
+		if parent.Recurrence == nil || *parent.Recurrence != "FREQ=DAILY" || parent.SeriesID == nil ||
+			*parent.SeriesID != parent.ID || parent.Occurrence != 1 || parent.Version != 1 {
+			t.Errorf("created recurring todo = %+v", parent)
+		}
+		open, err := todos.CreateSubtask(parent.ID, "Fill the can", "", nil, 1, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("creating subtask: %v", err)
+		}
+		done, err := todos.CreateSubtask(parent.ID, "Find the can", "", nil, 1, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("creating subtask: %v", err)
+		}
+		if _, _, err := todos.Toggle(done.ID); err != nil {
+			t.Fatalf("completing subtask: %v", err)
+		}
+
+		todo, completion, err := todos.Toggle(parent.ID)
+		if err != nil {
+			t.Fatalf("completing todo: %v", err)
+		}
+		if !todo.Completed {
+			t.Errorf("toggled todo = %+v", todo)
+		}
+		if len(completion.Subtasks) != 1 {
+			t.Fatalf("completed subtasks = %+v, want only %d", completion.Subtasks, open.ID)
+		}
+		subtask := completion.Subtasks[0]
+		if subtask.Before.ID != open.ID || subtask.Before.Completed || subtask.Before.Version != 1 ||
+			subtask.After.ID != open.ID || !subtask.After.Completed || subtask.After.Version != 2 {
+			t.Errorf("completed subtask = %+v -> %+v", subtask.Before, subtask.After)
+		}
+		next := completion.Next
+		if next == nil || next.Occurrence != 2 || next.SeriesID == nil || *next.SeriesID != parent.ID ||
+			next.DueDate == nil || !next.DueDate.Equal(due.AddDate(0, 0, 1)) || next.Completed {
+			t.Errorf("next occurrence = %+v", next)
+		}
+
+		// Reopening changes nothing else
+		if _, completion, err = todos.Toggle(parent.ID); err != nil {
+			t.Fatalf("reopening todo: %v", err)
+		}
+		if len(completion.Subtasks) != 0 || completion.Next != nil {
+			t.Errorf("reopening reported %+v", completion)
+		}
+	}
+
+	forEachDatabase(t, func(t *testing.T, db *database.DB) {
+		migrate(t, db)
+		user, err := NewUserStore(db).Create("alice", "hash")
+		if err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+		check(t, NewTodoStore(db).ForUser(user.ID))
+	})
+	t.Run("memory", func(t *testing.T) {
+		check(t, NewMemoryTodoStore(NewMemoryDB()))
+	})
+}
+
+func TestArchiveReportsOwner(t *testing.T) {
+	check := func(t *testing.T, todos TodoRepository, userID, workspaceID int) {
+		mine, err := todos.ForUser(userID).CreateFull("Pay rent", "", nil, 1, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("creating todo: %v", err)
+		}
+		shared, err := todos.ForWorkspace(workspaceID).CreateFull("Book venue", "", nil, 1, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("creating workspace todo: %v", err)
+		}
+		for _, id := range []int{mine.ID, shared.ID} {
+			if _, _, err := todos.Toggle(id); err != nil {
+				t.Fatalf("completing todo: %v", err)
+			}
+		}
+
+		// The automatic archive runs on every user and workspace at once
+		archived, err := todos.Archive(ArchiveFilter{})
+		if err != nil {
+			t.Fatalf("archiving: %v", err)
+		}
+		if len(archived) != 2 {
+			t.Fatalf("archived %d todos, want 2", len(archived))
+		}
+		for _, todo := range archived {
+			gotUser, gotWorkspace := todo.Owner()
+			want := [2]int{userID, 0}
+			if todo.ID == shared.ID {
+				want = [2]int{0, workspaceID}
+			}
+			if [2]int{gotUser, gotWorkspace} != want || todo.ArchivedAt == nil {
+				t.Errorf("todo %d: owner = %d, %d, want %d, %d", todo.ID, gotUser, gotWorkspace, want[0], want[1])
+			}
+		}
+	}
+
+	forEachDatabase(t, func(t *testing.T, db *database.DB) {
+		migrate(t, db)
+		user, err := NewUserStore(db).Create("alice", "hash")
+		if err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+		workspace, err := NewWorkspaceStore(db).Create(user.ID, "Team")
+		if err != nil {
+			t.Fatalf("creating workspace: %v", err)
+		}
+		check(t, NewTodoStore(db), user.ID, workspace.ID)
+	})
+	t.Run("memory", func(t *testing.T) {
+		memoryDB := NewMemoryDB()
+		user, err := NewMemoryUserStore(memoryDB).Create("alice", "hash")
+		if err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+		workspace, err := NewMemoryWorkspaceStore(memoryDB).Create(user.ID, "Team")
+		if err != nil {
+			t.Fatalf("creating workspace: %v", err)
+		}
+		check(t, NewMemoryTodoStore(memoryDB), user.ID, workspace.ID)
+	})
+}
+
+func TestImport(t *testing.T) {
+	check := func(t *testing.T, todos TodoRepository) {
+		rule, err := recurrence.Parse("FREQ=WEEKLY")
+		if err != nil {
+			t.Fatal(err)
+		}
+		created := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+		completed := time.Date(2025, 3, 4, 18, 30, 0, 0, time.UTC)
+		todo, err := todos.Import(TodoImport{Title: "Gym", Priority: 2, Completed: true, Rule: rule, CreatedAt: &created, UpdatedAt: &completed})
+		if err != nil {
+			t.Fatalf("importing todo: %v", err)
+		}
+		if !todo.Completed || todo.Version != 1 || todo.Recurrence == nil || todo.SeriesID == nil ||
+			!todo.CreatedAt.Equal(created) || !todo.UpdatedAt.Equal(completed) {
+			t.Errorf("imported todo = %+v", todo)
+		}
+		// Importing it completed does not start the next occurrence
+		if list, _, err := todos.List(TodoFilter{}); err != nil || len(list) != 1 {
+			t.Errorf("todos after import = %d, %v; want only the imported one", len(list), err)
+		}
+
+		subtask, err := todos.Import(TodoImport{Title: "Stretch", ParentID: &todo.ID})
+		if err != nil {
+			t.Fatalf("importing subtask: %v", err)
+		}
+		if subtask.ParentID == nil || *subtask.ParentID != todo.ID || subtask.Completed || time.Since(subtask.CreatedAt) > time.Minute {
+			t.Errorf("imported subtask = %+v", subtask)
+		}
+
+		missing := 999
+		if _, err := todos.Import(TodoImport{Title: "Orphan", ParentID: &missing}); err == nil || !strings.Contains(err.Error(), "parent todo not found") {
+			t.Errorf("importing under a missing parent: %v", err)
+		}
+	}
+
+	forEachDatabase(t, func(t *testing.T, db *database.DB) {
+		migrate(t, db)
+		user, err := NewUserStore(db).Create("alice", "hash")
+		if err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+		check(t, NewTodoStore(db).ForUser(user.ID))
+	})
+	t.Run("memory", func(t *testing.T) {
+		check(t, NewMemoryTodoStore(NewMemoryDB()))
+	})
+}
+
+func TestEditIsOneWrite(t *testing.T) {
+	check := func(t *testing.T, todos TodoRepository) {
+		rule, err := recurrence.Parse("FREQ=WEEKLY")
+		if err != nil {
+			t.Fatal(err)
+		}
+		parent, err := todos.CreateFull("Trip", "", nil, 1, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("creating todo: %v", err)
+		}
+		todo, err := todos.CreateFull("Pack", "", nil, 1, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("creating todo: %v", err)
+		}
+
+		priority := 2
+		edited, err := todos.IfVersion(1).Edit(todo.ID, TodoEdit{
+			Title: "Pack bags", Priority: &priority,
+			Move: true, ParentID: &parent.ID,
+			SetRecurrence: true, Rule: rule,
+		})
+		if err != nil {
+			t.Fatalf("editing todo: %v", err)
+		}
+		if edited.Title != "Pack bags" || edited.Priority != 2 || edited.ParentID == nil || *edited.ParentID != parent.ID ||
+			edited.Recurrence == nil || *edited.Recurrence != "FREQ=WEEKLY" || edited.SeriesID == nil || edited.Version != 2 {
+			t.Errorf("edited todo = %+v", edited)
+		}
+
+		// A failing part of an edit leaves the todo as it was
+		failing := []TodoEdit{
+			{Title: "under its subtask", Move: true, ParentID: &todo.ID},
+			{Title: "no parent", Move: true, ParentID: new(int)},
+			{Title: "no tag", Move: true, TagIDs: []int{9999}, SetRecurrence: true},
+			{Title: "no category", CategoryID: new(int), SetRecurrence: true},
+		}
+		for _, edit := range failing {
+			if _, err := todos.Edit(parent.ID, edit); err == nil {
+				t.Errorf("edit %q succeeded", edit.Title)
+			}
+		}
+		got, err := todos.GetByID(parent.ID)
+		if err != nil {
+			t.Fatalf("getting todo: %v", err)
+		}
+		if got.Version != 1 || got.Title != "Trip" || got.ParentID != nil || got.Recurrence != nil {
+			t.Errorf("todo after failed edits = %+v", got)
+		}
+		if _, err := todos.Edit(todo.ID, TodoEdit{Title: "itself", Move: true, ParentID: &todo.ID}); err == nil ||
+			!strings.Contains(err.Error(), "cycle") {
+			t.Errorf("moving a todo under itself: err = %v", err)
+		}
+		if _, err := todos.IfVersion(1).Edit(todo.ID, TodoEdit{Title: "stale"}); !errors.Is(err, ErrVersionConflict) {
+			t.Errorf("stale edit: err = %v, want ErrVersionConflict", err)
+		}
+	}
+
+	forEachDatabase(t, func(t *testing.T, db *database.DB) {
+		migrate(t, db)
+		user, err := NewUserStore(db).Create("alice", "hash")
+		if err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+		check(t, NewTodoStore(db).ForUser(user.ID))
+	})
+	t.Run("memory", func(t *testing.T) {
+		check(t, NewMemoryTodoStore(NewMemoryDB()))
+	})
+}
+
+func TestReminderDue(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *database.DB) {
+		migrate(t, db)
+		user, err := NewUserStore(db).Create("alice", "hash")
+		if err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+		todos := NewTodoStore(db).ForUser(user.ID)
+		reminders := NewReminderStore(db)
+
+		// Times in another zone than UTC must compare by their value
+		tokyo := time.FixedZone("JST", 9*60*60)
+		now := time.Date(2030, 1, 2, 18, 0, 0, 0, tokyo) // 09:00 UTC
+		due := time.Date(2030, 1, 2, 10, 0, 0, 0, time.UTC)
+		todo, err := todos.CreateFull("Dentist", "", nil, 1, &due, nil, nil)
+		if err != nil {
+			t.Fatalf("creating todo: %v", err)
+		}
+		undated, err := todos.CreateFull("Someday", "", nil, 1, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("creating todo: %v", err)
+		}
+		done, err := todos.CreateFull("Done", "", nil, 1, &due, nil, nil)
+		if err != nil {
+			t.Fatalf("creating todo: %v", err)
+		}
+		if _, _, err := todos.Toggle(done.ID); err != nil {
+			t.Fatalf("completing todo: %v", err)
+		}
+
+		create := func(todoID int, remindAt *time.Time, minutesBefore int) int {
+			t.Helper()
+			var minutes *int
+			if remindAt == nil {
+				minutes = &minutesBefore
+			}
+			reminder, err := reminders.Create(todoID, remindAt, minutes)
+			if err != nil {
+				t.Fatalf("creating reminder: %v", err)
+			}
+			return reminder.ID
+		}
+		at := func(utc string) *time.Time {
+			clock, _ := time.Parse("15:04", utc)
+			at := time.Date(2030, 1, 2, clock.Hour(), clock.Minute(), 0, 0, time.UTC).In(tokyo)
+			return &at
+		}
+		hourBefore := create(todo.ID, nil, 60)     // 09:00
+		create(todo.ID, nil, 30)                   // 09:30
+		atNine := create(todo.ID, at("09:00"), 0)  // at now
+		early := create(todo.ID, at("08:15"), 0)   // earlier
+		create(todo.ID, at("09:01"), 0)            // later
+		create(undated.ID, nil, 0)                 // never
+		create(done.ID, at("08:00"), 0)            // completed todo
+		sent := create(todo.ID, at("08:30"), 0)    // already sent
+		dayBefore := create(todo.ID, nil, 24*60+1) // the day before
+		if _, err := reminders.Claim(sent); err != nil {
+			t.Fatalf("claiming reminder: %v", err)
+		}
+
+		got, err := reminders.Due(now)
+		if err != nil {
+			t.Fatalf("Due: %v", err)
+		}
+		var ids []int
+		for _, reminder := range got {
+			ids = append(ids, reminder.ID)
+		}
+		want := []int{dayBefore, early, hourBefore, atNine}
+		if fmt.Sprint(ids) != fmt.Sprint(want) {
+			t.Errorf("due reminders = %v, want %v", ids, want)
+		}
+	})
+}
+
+func TestStoreUniqueViolations(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *database.DB) {
+		migrate(t, db)
+		users := NewUserStore(db)
+		user, err := users.Create("alice", "hash")
+		if err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+
+		checks := map[string]func() error{
+			"users.username": func() error {
+				_, err := users.Create("alice", "hash")
+				return err
+			},
+			"categories.name": func() error {
+				// Every user starts with the default categories
+				_, err := NewCategoryStore(db).ForUser(user.ID).Create(defaultCategories[0].name, "#000000")
+				return err
+			},
+			"tags.name": func() error {
+				tags := NewTagStore(db).ForUser(user.ID)
+				if _, err := tags.Create("home", "#000000"); err != nil {
+					return fmt.Errorf("first tag: %w", err)
+				}
+				_, err := tags.Create("home", "#ffffff")
+				return err
+			},
+			"user_identities": func() error {
+				if _, err := users.CreateWithIdentity("carol", "https://issuer.example", "subject"); err != nil {
+					return fmt.Errorf("first identity: %w", err)
+				}
+				_, err := users.CreateWithIdentity("dave", "https://issuer.example", "subject")
+				return err
+			},
+		}
+		for constraint, check := range checks {
+			err := check()
+			if err == nil || !strings.Contains(err.Error(), "UNIQUE constraint failed: "+constraint) {
+				t.Errorf("%s: err = %v, want a UNIQUE constraint error", constraint, err)
+			}
+		}
+
+		// Renaming a category to a taken name is reported the same way
+		categories, err := NewCategoryStore(db).ForUser(user.ID).GetAll()
+		if err != nil || len(categories) < 2 {
+			t.Fatalf("default categories %v, err %v", categories, err)
+		}
+		_, err = NewCategoryStore(db).ForUser(user.ID).Update(categories[0].ID, categories[1].Name, "#000000")
+		if err == nil || !strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			t.Errorf("renaming category: err = %v, want a UNIQUE constraint error", err)
+		}
+	})
+}
+
+func TestSearchMatchDescription(t *testing.T) {
+	db, err := database.Initialize(filepath.Join(t.TempDir(), "todos.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	user, err := NewUserStore(db).Create("alice", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	todos := NewTodoStore(db).ForUser(user.ID)
+	if _, err := todos.CreateFull("コードレビュー", "金曜日までに終わらせる", nil, 1, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := todos.CreateFull("Release", "after the レビュー is done", nil, 1, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The description is only shown when it matched, with the full-text
+	// index (built with sqlite_fts5) and without it
+	found, _, err := todos.List(TodoFilter{Search: "レビュー"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("found %d todos, want 2", len(found))
+	}
+	for _, todo := range found {
+		match := todo.Match
+		switch todo.Title {
+		case "コードレビュー":
+			if match.Description != "" {
+				t.Errorf("title match has description %q", match.Description)
+			}
+		case "Release":
+			if !strings.Contains(match.Description, HighlightStart+"レビュー"+HighlightEnd) {
+				t.Errorf("description match has description %q", match.Description)
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"gotodo/database"
+)
+
+// Tag is a label that can be attached to any number of todos
+type Tag struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	owner ownership // kept by the memory store; the SQL stores filter on owner_id and workspace_id
+}
+
+// TagRepository is the storage used by the tag handlers.
+//
+// Implementations report missing tags with an error containing "not found"
+// and duplicate names with one containing "UNIQUE constraint failed".
+// Deleting a tag removes it from every todo.
+//
+// Tags belong to a user or to a workspace; ForUser and ForWorkspace return a
+// repository limited to the tags of one, in which the others do not exist.
+type TagRepository interface {
+	ForUser(userID int) TagRepository
+	ForWorkspace(workspaceID int) TagRepository
+	GetAll() ([]Tag, error)
+	GetByID(id int) (*Tag, error)
+	Create(name, color string) (*Tag, error)
+	Update(id int, name, color string) (*Tag, error)
+	Delete(id int) error
+}
+
+// TagStore manages tags in an SQL database (SQLite or PostgreSQL)
+type TagStore struct {
+	db    *database.DB
+	owner ownership
+}
+
+// NewTagStore creates a new TagStore backed by db
+func NewTagStore(db *database.DB) *TagStore {
+	return &TagStore{db: db}
+}
+
+var _ TagRepository = (*TagStore)(nil)
+
+// ForUser returns a TagStore limited to the tags of a user
+func (ts *TagStore) ForUser(userID int) TagRepository {
+	return &TagStore{db: ts.db, owner: ownership{userID: userID}}
+}
+
+// ForWorkspace returns a TagStore limited to the tags of a workspace
+func (ts *TagStore) ForWorkspace(workspaceID int) TagRepository {
+	return &TagStore{db: ts.db, owner: ownership{workspaceID: workspaceID}}
+}
+
+// errDuplicateTagName reports a taken tag name in the same words on every backend
+var errDuplicateTagName = errors.New("UNIQUE constraint failed: tags.name")
+
+// GetAll retrieves all tags ordered by name
+func (ts *TagStore) GetAll() ([]Tag, error) {
+	owner, args := ts.owner.filter("")
+	rows, err := ts.db.Query(`
+		SELECT id, name, color, created_at, updated_at
+		FROM tags
+		WHERE `+owner+`
+		ORDER BY name ASC
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []Tag
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt, &tag.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return tags, nil
+}
+
+// GetByID retrieves a specific tag
+func (ts *TagStore) GetByID(id int) (*Tag, error) {
+	owner, args := ts.owner.filter("")
+	var tag Tag
+	err := ts.db.QueryRow(`
+		SELECT id, name, color, created_at, updated_at
+		FROM tags
+		WHERE id = ? AND `+owner, append([]any{id}, args...)...).Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt, &tag.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("tag not found")
+		}
+		return nil, fmt.Errorf("failed to get tag: %w", err)
+	}
+
+	return &tag, nil
+}
+
+// Create adds a new tag
+func (ts *TagStore) Create(name, color string) (*Tag, error) {
+	var id int
+	err := ts.db.QueryRow(`
+		INSERT INTO tags (name, color, owner_id, workspace_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING id
+	`, name, color, ts.owner.userValue(), ts.owner.workspaceValue()).Scan(&id)
+	if err != nil {
+		if database.IsUniqueViolation(err) {
+			return nil, fmt.Errorf("failed to create tag: %w", errDuplicateTagName)
+		}
+		return nil, fmt.Errorf("failed to create tag: %w", err)
+	}
+
+	return ts.GetByID(id)
+}
+
+// Update modifies a tag's name and color
+func (ts *TagStore) Update(id int, name, color string) (*Tag, error) {
+	owner, args := ts.owner.filter("")
+	result, err := ts.db.Exec(`
+		UPDATE tags
+		SET name = ?, color = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND `+owner, append([]any{name, color, id}, args...)...)
+	if err != nil {
+		if database.IsUniqueViolation(err) {
+			return nil, fmt.Errorf("failed to update tag: %w", errDuplicateTagName)
+		}
+		return nil, fmt.Errorf("failed to update tag: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("tag not found")
+	}
+
+	return ts.GetByID(id)
+}
+
+// Delete removes a tag; todo_tags cascades, detaching it from its todos
+func (ts *TagStore) Delete(id int) error {
+	owner, args := ts.owner.filter("")
+	result, err := ts.db.Exec(`DELETE FROM tags WHERE id = ? AND `+owner, append([]any{id}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to delete tag: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("tag not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MemoryTagStore manages tags in memory
+type MemoryTagStore struct {
+	db    *MemoryDB
+	owner ownership
+}
+
+// NewMemoryTagStore creates a new TagRepository backed by db
+func NewMemoryTagStore(db *MemoryDB) *MemoryTagStore {
+	return &MemoryTagStore{db: db}
+}
+
+var _ TagRepository = (*MemoryTagStore)(nil)
+
+// ForUser returns a MemoryTagStore limited to the tags of a user
+func (ts *MemoryTagStore) ForUser(userID int) TagRepository {
+	return &MemoryTagStore{db: ts.db, owner: ownership{userID: userID}}
+}
+
+// ForWorkspace returns a MemoryTagStore limited to the tags of a workspace
+func (ts *MemoryTagStore) ForWorkspace(workspaceID int) TagRepository {
+	return &MemoryTagStore{db: ts.db, owner: ownership{workspaceID: workspaceID}}
+}
+
+// GetAll returns all tags ordered by name
+func (ts *MemoryTagStore) GetAll() ([]Tag, error) {
+	ts.db.mu.RLock()
+	defer ts.db.mu.RUnlock()
+
+	tags := make([]Tag, 0, len(ts.db.tags))
+	for _, tag := range ts.db.tags {
+		if ts.owner.owns(tag.owner) {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+
+	return tags, nil
+}
+
+// GetByID returns a specific tag
+func (ts *MemoryTagStore) GetByID(id int) (*Tag, error) {
+	ts.db.mu.RLock()
+	defer ts.db.mu.RUnlock()
+
+	tag, ok := ts.db.tags[id]
+	if !ok || !ts.owner.owns(tag.owner) {
+		return nil, fmt.Errorf("tag not found")
+	}
+	return &tag, nil
+}
+
+// Create adds a new tag
+func (ts *MemoryTagStore) Create(name, color string) (*Tag, error) {
+	ts.db.mu.Lock()
+	defer ts.db.mu.Unlock()
+
+	if ts.db.tagNameTaken(ts.owner, name, 0) {
+		return nil, fmt.Errorf("failed to create tag: %w", errDuplicateTagName)
+	}
+
+	now := memoryNow()
+	tag := Tag{
+		ID:        ts.db.nextTagID,
+		Name:      name,
+		Color:     color,
+		CreatedAt: now,
+		UpdatedAt: now,
+		owner:     ts.owner,
+	}
+	ts.db.tags[tag.ID] = tag
+	ts.db.nextTagID++
+
+	return &tag, nil
+}
+
+// Update modifies a tag's name and color
+func (ts *MemoryTagStore) Update(id int, name, color string) (*Tag, error) {
+	ts.db.mu.Lock()
+	defer ts.db.mu.Unlock()
+
+	tag, ok := ts.db.tags[id]
+	if !ok || !ts.owner.owns(tag.owner) {
+		return nil, fmt.Errorf("tag not found")
+	}
+	if ts.db.tagNameTaken(tag.owner, name, id) {
+		return nil, fmt.Errorf("failed to update tag: %w", errDuplicateTagName)
+	}
+
+	tag.Name = name
+	tag.Color = color
+	tag.UpdatedAt = memoryNow()
+	ts.db.tags[id] = tag
+
+	return &tag, nil
+}
+
+// Delete removes a tag and detaches it from its todos
+func (ts *MemoryTagStore) Delete(id int) error {
+	ts.db.mu.Lock()
+	defer ts.db.mu.Unlock()
+
+	if tag, ok := ts.db.tags[id]; !ok || !ts.owner.owns(tag.owner) {
+		return fmt.Errorf("tag not found")
+	}
+	delete(ts.db.tags, id)
+	for todoID, tagIDs := range ts.db.todoTags {
+		delete(tagIDs, id)
+		if len(tagIDs) == 0 {
+			delete(ts.db.todoTags, todoID)
+		}
+	}
+
+	return nil
+}
+
+// tagNameTaken reports whether another tag of owner already uses name.
+// The caller must hold db.mu.
+func (db *MemoryDB) tagNameTaken(owner ownership, name string, exceptID int) bool {
+	for _, tag := range db.tags {
+		if tag.owner == owner && tag.ID != exceptID && tag.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -1,85 +1,234 @@
-// This file contains the old in-memory implementation
-// It's kept for reference and can be removed once SQLite migration is complete
 package models
 
 import (
-	"sync"
+	"errors"
 	"time"
+
+	"gotodo/recurrence"
 )
 
-// OldTodo represents the original in-memory TODO structure
-type OldTodo struct {
-	ID        int       `json:"id"`
-	Title     string    `json:"title"`
-	Completed bool      `json:"completed"`
-	CreatedAt time.Time `json:"created_at"`
+// Todo represents a TODO item
+type Todo struct {
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	CategoryID  *int       `json:"category_id"`
+	Category    *Category  `json:"category,omitempty"`
+	Tags        []Tag      `json:"tags"`
+	ParentID    *int       `json:"parent_id"`
+	Priority    int        `json:"priority"` // 1:低, 2:中, 3:高
+	DueDate     *time.Time `json:"due_date"`
+	Completed   bool       `json:"completed"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`  // only set on todos in the trash
+	ArchivedAt  *time.Time `json:"archived_at,omitempty"` // only set on archived todos
+	// Version counts the changes to the todo, starting at 1; it is the ETag
+	// of the todo in the API
+	Version int `json:"version"`
+
+	// Recurrence is the RRULE of a recurring todo, see package recurrence.
+	// Occurrences of the same series share SeriesID, the ID of the first one.
+	Recurrence *string `json:"recurrence"`
+	SeriesID   *int    `json:"series_id"`
+	Occurrence int     `json:"occurrence,omitempty"` // position in the series, from 1
+
+	// Progress counts the direct subtasks; it is only set when there are any
+	Progress *Progress `json:"progress,omitempty"`
+	// Subtasks is only set when a listing asks for nested todos
+	Subtasks []Todo `json:"subtasks,omitempty"`
+
+	// Match is only set on search results
+	Match *SearchMatch `json:"match,omitempty"`
+
+	owner ownership // the SQL stores read it from owner_id and workspace_id
 }
 
-// OldTodoStore manages TODO items in memory (deprecated)
-type OldTodoStore struct {
-	mu     sync.RWMutex
-	todos  []OldTodo
-	nextID int
+// Owner returns the user of a personal todo, or the workspace of a todo
+// that belongs to one; the other is 0
+func (t *Todo) Owner() (userID, workspaceID int) {
+	return t.owner.userID, t.owner.workspaceID
 }
 
-// NewOldTodoStore creates a new in-memory TodoStore (deprecated)
-func NewOldTodoStore() *OldTodoStore {
-	return &OldTodoStore{
-		todos:  make([]OldTodo, 0),
-		nextID: 1,
-	}
+// Progress reports how many of a todo's subtasks are completed
+type Progress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
 }
 
-func (ts *OldTodoStore) GetAll() []OldTodo {
-	ts.mu.RLock()
-	defer ts.mu.RUnlock()
-	
-	result := make([]OldTodo, len(ts.todos))
-	copy(result, ts.todos)
-	return result
+// Completion lists what completing a todo changed besides the todo itself
+type Completion struct {
+	// Subtasks are the open subtasks completed along with it
+	Subtasks []TodoChange
+	// Next is the next occurrence of a recurring todo, if one was created
+	Next *Todo
 }
 
-func (ts *OldTodoStore) Create(title string) OldTodo {
-	ts.mu.Lock()
-	defer ts.mu.Unlock()
-	
-	todo := OldTodo{
-		ID:        ts.nextID,
-		Title:     title,
-		Completed: false,
-		CreatedAt: time.Now(),
-	}
-	
-	ts.todos = append(ts.todos, todo)
-	ts.nextID++
-	
-	return todo
+// TodoEdit is a change to a todo made by Edit
+type TodoEdit struct {
+	Title       string
+	Description string
+	CategoryID  *int
+	Priority    *int // nil keeps the priority
+	DueDate     *time.Time
+	TagIDs      []int // nil keeps the tags
+
+	// Move re-parents the todo under ParentID, or makes it a top-level todo
+	// when ParentID is nil
+	Move     bool
+	ParentID *int
+	// SetRecurrence replaces the rule of the todo with Rule, starting a
+	// series unless it already belongs to one; a nil Rule stops it
+	SetRecurrence bool
+	Rule          *recurrence.Rule
 }
 
-func (ts *OldTodoStore) Toggle(id int) (*OldTodo, bool) {
-	ts.mu.Lock()
-	defer ts.mu.Unlock()
-	
-	for i := range ts.todos {
-		if ts.todos[i].ID == id {
-			ts.todos[i].Completed = !ts.todos[i].Completed
-			return &ts.todos[i], true
-		}
-	}
-	
-	return nil, false
+// TodoImport is a todo created by Import, as the file it comes from has it
+type TodoImport struct {
+	Title       string
+	Description string
+	CategoryID  *int
+	Priority    int
+	DueDate     *time.Time
+	TagIDs      []int
+	ParentID    *int // nil for a top-level todo
+	Completed   bool
+	// Rule makes the todo the first occurrence of a recurring series; an
+	// imported completed todo does not create the next occurrence
+	Rule *recurrence.Rule
+	// CreatedAt and UpdatedAt keep the times of the file; nil means now
+	CreatedAt *time.Time
+	UpdatedAt *time.Time
+}
+
+// TodoChange is a todo before and after a change
+type TodoChange struct {
+	Before *Todo
+	After  *Todo
 }
 
-func (ts *OldTodoStore) Delete(id int) bool {
-	ts.mu.Lock()
-	defer ts.mu.Unlock()
-	
-	for i, todo := range ts.todos {
-		if todo.ID == id {
-			ts.todos = append(ts.todos[:i], ts.todos[i+1:]...)
-			return true
+// ErrVersionConflict is returned by the writes of a store made by IfVersion
+// when the todo or category is no longer at the expected version
+var ErrVersionConflict = errors.New("version conflict")
+
+// TodoRepository is the storage used by the todo handlers.
+//
+// Implementations report missing todos with an error containing "not found"
+// and unknown category and tag IDs with one containing "category not found"
+// and "tag not found". Priorities outside 1-3 are stored as 1.
+//
+// Todos belong to a user or to a workspace; ForUser and ForWorkspace return
+// a repository limited to the todos, categories and tags of one, in which
+// the others do not exist.
+//
+// IfVersion returns a repository whose Toggle, Update, Edit, Delete,
+// DeleteTree and SetRecurrence only change a todo that is still at the given
+// version, checked in the same statement or under the same lock as the
+// change, and fail with ErrVersionConflict otherwise. Version 0 drops the
+// check.
+//
+// Todos form a hierarchy through ParentID. Completing a todo also completes
+// all of its open subtasks, while reopening one leaves them as they are.
+// Delete refuses to remove a todo that has subtasks with an error containing
+// "has subtasks"; DeleteTree removes the todo together with all of them.
+// Both move todos to the trash, where every method but Trash, Restore and
+// the Purge methods treats them as missing.
+// Edit reports an attempt to put a todo under itself or one of its own
+// subtasks with an error containing "cycle".
+//
+// Completing a recurring todo creates its next occurrence, with the due date
+// advanced by the rule, unless the series has ended or that occurrence
+// already exists.
+//
+// Completed todos can be archived, which leaves them out of List unless the
+// filter asks for archived todos. Todos are archived together with their
+// subtasks, so only top-level todos whose subtasks are all completed are.
+type TodoRepository interface {
+	ForUser(userID int) TodoRepository
+	ForWorkspace(workspaceID int) TodoRepository
+	IfVersion(version int) TodoRepository
+
+	// List returns the todos matching the filter and the number of matches
+	// before Limit and Offset are applied
+	List(filter TodoFilter) ([]Todo, int, error)
+	GetByID(id int) (*Todo, error)
+	// CreateFull adds a todo; a rule other than nil makes it the first
+	// occurrence of a recurring series
+	CreateFull(title, description string, categoryID *int, priority int, dueDate *time.Time, tagIDs []int, rule *recurrence.Rule) (*Todo, error)
+	// Toggle returns the todo and, when it was completed, what its
+	// completion changed; reopening a todo returns an empty Completion
+	Toggle(id int) (*Todo, *Completion, error)
+	// Update replaces every field except the priority and the tags, which
+	// are kept when nil
+	Update(id int, title, description string, categoryID *int, priority *int, dueDate *time.Time, tagIDs []int) (*Todo, error)
+	Delete(id int) error
+
+	// CreateSubtask adds a todo under parentID, reporting a missing parent
+	// with an error containing "parent todo not found"
+	CreateSubtask(parentID int, title, description string, categoryID *int, priority int, dueDate *time.Time, tagIDs []int, rule *recurrence.Rule) (*Todo, error)
+	// Import adds a todo with its completion, parent, rule and times in a
+	// single write; it fails like CreateSubtask
+	Import(todo TodoImport) (*Todo, error)
+	// Edit changes the fields of a todo, and its parent and recurrence rule
+	// when the edit asks to, in a single write. It fails like Update and
+	// CreateSubtask, and changes nothing when it does.
+	Edit(id int, edit TodoEdit) (*Todo, error)
+	// Descendants returns every todo below the given ones, at any depth,
+	// in the default order
+	Descendants(ids ...int) ([]Todo, error)
+	DeleteTree(id int) error
+
+	// SetRecurrence makes a todo recurring, starting a series with it unless
+	// it already belongs to one; a nil rule stops the recurrence
+	SetRecurrence(id int, rule *recurrence.Rule) (*Todo, error)
+
+	// Trash returns the todos in the trash that were not deleted along with
+	// their parent, most recently deleted first
+	Trash() ([]Todo, error)
+	// Restore takes a todo out of the trash together with the subtasks
+	// deleted along with it, returning them with the todo first. A todo
+	// whose parent is in the trash is reported with an error containing
+	// "parent todo is in the trash".
+	Restore(id int) ([]Todo, error)
+	// Purge permanently removes a todo in the trash and its subtasks
+	Purge(id int) error
+	// PurgeDeletedBefore permanently removes the todos deleted before t,
+	// returning how many were removed
+	PurgeDeletedBefore(t time.Time) (int, error)
+
+	// Archive archives the completed top-level todos matching the filter
+	// with their subtasks, returning the archived top-level todos
+	Archive(filter ArchiveFilter) ([]Todo, error)
+	// Unarchive brings an archived todo and its subtasks back to the active
+	// list. A subtask of an archived todo is reported with an error
+	// containing "archived with its parent".
+	Unarchive(id int) (*Todo, error)
+
+	// Bulk applies a change to the given todos in a single transaction,
+	// returning a result for each distinct id in order. Deleting a todo
+	// moves its subtasks to the trash as well, like DeleteTree. An unknown
+	// category is reported with an error containing "category not found"
+	// and nothing is changed. Completed todos report what their completion
+	// changed in the Completion of their result.
+	Bulk(ids []int, change BulkChange) ([]BulkResult, error)
+}
+
+// NestSubtasks attaches descendants, as returned by Descendants, to their
+// parents among todos and among each other, keeping their order
+func NestSubtasks(todos []Todo, descendants []Todo) []Todo {
+	children := make(map[int][]Todo)
+	for _, todo := range descendants {
+		children[*todo.ParentID] = append(children[*todo.ParentID], todo)
+	}
+
+	var nest func(todos []Todo) []Todo
+	nest = func(todos []Todo) []Todo {
+		for i := range todos {
+			if subtasks, ok := children[todos[i].ID]; ok {
+				todos[i].Subtasks = nest(subtasks)
+			}
 		}
+		return todos
 	}
-	
-	return false
-}
\ No newline at end of file
+	return nest(todos)
+}
@@ -0,0 +1,52 @@
+package models
+
+// MaxBulkTodos is the most todos a single bulk change may touch
+const MaxBulkTodos = 1000
+
+// Actions of a bulk change
+const (
+	BulkComplete    = "complete"
+	BulkReopen      = "reopen"
+	BulkDelete      = "delete"
+	BulkSetCategory = "set_category"
+	BulkSetPriority = "set_priority"
+	BulkShiftDue    = "shift_due"
+)
+
+// BulkActions lists every action of a bulk change
+var BulkActions = []string{BulkComplete, BulkReopen, BulkDelete, BulkSetCategory, BulkSetPriority, BulkShiftDue}
+
+// BulkChange is an action applied to many todos at once
+type BulkChange struct {
+	Action     string
+	CategoryID *int // set_category; nil removes the category
+	Priority   int  // set_priority
+	Days       int  // shift_due; negative values move due dates earlier
+}
+
+// Outcomes of a bulk change for a single todo
+const (
+	BulkOK        = "ok"
+	BulkUnchanged = "unchanged" // the todo already was as requested, or has no due date to shift
+	BulkNotFound  = "not_found"
+)
+
+// BulkResult reports what a bulk change did to one todo
+type BulkResult struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+	// Todo is the todo after the change; it is not set for deleted todos
+	Todo *Todo `json:"todo,omitempty"`
+	// Before is the todo as it was, for the audit log
+	Before *Todo `json:"-"`
+	// Completion is what completing the todo changed besides it
+	Completion *Completion `json:"-"`
+}
+
+// sameInt reports whether two optional ids are equal
+func sameInt(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
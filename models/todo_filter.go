@@ -0,0 +1,87 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gotodo/query"
+)
+
+// Pagination limits for todo listings
+const (
+	DefaultTodoLimit = 100
+	MaxTodoLimit     = 1000
+)
+
+// TodoFilter describes which todos a listing should return and in what order
+type TodoFilter struct {
+	Search     string       // plain text; every word must match
+	Query      *query.Query // structured search, combined with the other fields
+	CategoryID *int
+	NoCategory bool  // only todos without a category
+	ParentID   *int  // only direct subtasks of this todo
+	NoParent   bool  // only top-level todos
+	TagIDs     []int // todos having every one of these tags
+	NoTags     bool  // only todos without tags
+	SeriesID   *int  // only occurrences of this recurring series
+	Priority   *int
+	Completed  *bool
+	DueBefore  *time.Time
+	DueAfter   *time.Time
+	HasDueDate *bool  // only todos with (true) or without (false) a due date
+	Overdue    bool   // incomplete todos whose due date has passed
+	Archived   bool   // archived todos instead of the active ones
+	Sort       string // "smart" (default) or a comma separated list like "due_date,-priority"
+	AfterID    int    // only todos with a greater ID, to page through them sorted by "id"
+	Limit      int    // 0 means no limit
+	Offset     int
+}
+
+// ArchiveFilter selects the completed todos to archive; zero fields select all
+type ArchiveFilter struct {
+	CategoryID    *int
+	UpdatedBefore *time.Time // only todos that have not changed since
+}
+
+// SortField is a single column of a todo sort order
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// sortableTodoFields maps API sort keys to their todo columns
+var sortableTodoFields = map[string]string{
+	"id":         "t.id",
+	"title":      "t.title",
+	"priority":   "t.priority",
+	"due_date":   "t.due_date",
+	"created_at": "t.created_at",
+	"updated_at": "t.updated_at",
+	"completed":  "t.completed",
+}
+
+// ParseTodoSort validates a sort expression and returns its fields.
+// An empty expression or "smart" returns nil, meaning the default order.
+func ParseTodoSort(sort string) ([]SortField, error) {
+	sort = strings.TrimSpace(sort)
+	if sort == "" || sort == "smart" {
+		return nil, nil
+	}
+
+	var fields []SortField
+	for _, part := range strings.Split(sort, ",") {
+		part = strings.TrimSpace(part)
+		desc := false
+		if strings.HasPrefix(part, "-") {
+			desc = true
+			part = part[1:]
+		}
+		if _, ok := sortableTodoFields[part]; !ok {
+			return nil, fmt.Errorf("invalid sort field: %q", part)
+		}
+		fields = append(fields, SortField{Field: part, Desc: desc})
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,1109 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gotodo/recurrence"
+)
+
+// MemoryTodoStore manages TODO items in memory
+type MemoryTodoStore struct {
+	db      *MemoryDB
+	owner   ownership
+	version int // the version writes expect, see IfVersion
+}
+
+// NewMemoryTodoStore creates a new TodoRepository backed by db
+func NewMemoryTodoStore(db *MemoryDB) *MemoryTodoStore {
+	return &MemoryTodoStore{db: db}
+}
+
+var _ TodoRepository = (*MemoryTodoStore)(nil)
+
+// ForUser returns a MemoryTodoStore limited to the todos of a user
+func (ts *MemoryTodoStore) ForUser(userID int) TodoRepository {
+	return &MemoryTodoStore{db: ts.db, owner: ownership{userID: userID}}
+}
+
+// ForWorkspace returns a MemoryTodoStore limited to the todos of a workspace
+func (ts *MemoryTodoStore) ForWorkspace(workspaceID int) TodoRepository {
+	return &MemoryTodoStore{db: ts.db, owner: ownership{workspaceID: workspaceID}}
+}
+
+// IfVersion returns a MemoryTodoStore whose writes only change a todo at
+// the given version
+func (ts *MemoryTodoStore) IfVersion(version int) TodoRepository {
+	return &MemoryTodoStore{db: ts.db, owner: ts.owner, version: version}
+}
+
+// todo returns a todo of the store's owner that is not in the trash.
+// The caller must hold db.mu.
+func (ts *MemoryTodoStore) todo(id int) (Todo, bool) {
+	todo, ok := ts.db.todos[id]
+	if !ok || !ts.owner.owns(todo.owner) || todo.DeletedAt != nil {
+		return Todo{}, false
+	}
+	return todo, true
+}
+
+// written returns the todo a write changes, checking its version for a
+// store made by IfVersion. The caller must hold db.mu.
+func (ts *MemoryTodoStore) written(id int) (Todo, error) {
+	todo, ok := ts.todo(id)
+	if !ok {
+		return Todo{}, fmt.Errorf("todo not found")
+	}
+	if ts.version != 0 && todo.Version != ts.version {
+		return Todo{}, ErrVersionConflict
+	}
+	return todo, nil
+}
+
+// trashed returns a todo of the store's owner that is in the trash.
+// The caller must hold db.mu.
+func (ts *MemoryTodoStore) trashed(id int) (Todo, bool) {
+	todo, ok := ts.db.todos[id]
+	if !ok || !ts.owner.owns(todo.owner) || todo.DeletedAt == nil {
+		return Todo{}, false
+	}
+	return todo, true
+}
+
+// List returns the todos matching the filter, ordered like the SQLite store
+func (ts *MemoryTodoStore) List(filter TodoFilter) ([]Todo, int, error) {
+	sortFields, err := ParseTodoSort(filter.Sort)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ts.db.mu.RLock()
+	defer ts.db.mu.RUnlock()
+
+	now := time.Now()
+	terms := searchTerms(filter.Search)
+	if filter.Query != nil {
+		terms = append(terms, filter.Query.TextTerms()...)
+	}
+
+	var todos []Todo
+	for _, todo := range ts.db.todos {
+		if !ts.owner.owns(todo.owner) || todo.DeletedAt != nil {
+			continue
+		}
+		todo = ts.db.withRelations(todo)
+		if !matchesFilter(todo, filter, terms, now) {
+			continue
+		}
+		if len(terms) > 0 {
+			todo.Match = matchTodo(todo, terms)
+		}
+		todos = append(todos, todo)
+	}
+
+	byRelevance := len(terms) > 0 && sortFields == nil
+	sort.Slice(todos, func(i, j int) bool {
+		a, b := todos[i], todos[j]
+		if byRelevance && a.Match.Score != b.Match.Score {
+			return a.Match.Score > b.Match.Score
+		}
+		if sortFields == nil {
+			if c := compareSmart(a, b, now); c != 0 {
+				return c < 0
+			}
+		} else {
+			for _, field := range sortFields {
+				if c := compareTodoField(a, b, field); c != 0 {
+					return c < 0
+				}
+			}
+		}
+		return a.ID > b.ID
+	})
+
+	total := len(todos)
+	if filter.Offset > 0 || filter.Limit > 0 {
+		start := min(filter.Offset, total)
+		end := total
+		if filter.Limit > 0 {
+			end = min(start+filter.Limit, total)
+		}
+		todos = todos[start:end]
+	}
+
+	return todos, total, nil
+}
+
+// matchesFilter reports whether a todo satisfies every part of a filter
+func matchesFilter(todo Todo, filter TodoFilter, terms []string, now time.Time) bool {
+	for _, term := range terms {
+		if !containsFold(todo.Title, term) && !containsFold(todo.Description, term) {
+			return false
+		}
+	}
+	if filter.Query != nil && !matchesQuery(todo, filter.Query, now) {
+		return false
+	}
+	if filter.NoCategory && todo.CategoryID != nil {
+		return false
+	}
+	if !filter.NoCategory && filter.CategoryID != nil && (todo.CategoryID == nil || *todo.CategoryID != *filter.CategoryID) {
+		return false
+	}
+	if filter.NoParent && todo.ParentID != nil {
+		return false
+	}
+	if !filter.NoParent && filter.ParentID != nil && (todo.ParentID == nil || *todo.ParentID != *filter.ParentID) {
+		return false
+	}
+	if filter.NoTags && len(todo.Tags) > 0 {
+		return false
+	}
+	if !filter.NoTags {
+		for _, tagID := range filter.TagIDs {
+			if !hasTag(todo, tagID) {
+				return false
+			}
+		}
+	}
+	if filter.SeriesID != nil && (todo.SeriesID == nil || *todo.SeriesID != *filter.SeriesID) {
+		return false
+	}
+	if filter.Priority != nil && todo.Priority != *filter.Priority {
+		return false
+	}
+	if filter.Completed != nil && todo.Completed != *filter.Completed {
+		return false
+	}
+	if filter.DueBefore != nil && (todo.DueDate == nil || !todo.DueDate.Before(*filter.DueBefore)) {
+		return false
+	}
+	if filter.DueAfter != nil && (todo.DueDate == nil || todo.DueDate.Before(*filter.DueAfter)) {
+		return false
+	}
+	if filter.HasDueDate != nil && *filter.HasDueDate != (todo.DueDate != nil) {
+		return false
+	}
+	if filter.Overdue && !isOverdue(todo, now) {
+		return false
+	}
+	if filter.Archived != (todo.ArchivedAt != nil) {
+		return false
+	}
+	if filter.AfterID > 0 && todo.ID <= filter.AfterID {
+		return false
+	}
+	return true
+}
+
+// hasTag reports whether a todo carries the given tag
+func hasTag(todo Todo, tagID int) bool {
+	for _, tag := range todo.Tags {
+		if tag.ID == tagID {
+			return true
+		}
+	}
+	return false
+}
+
+// compareSmart orders todos like todoSmartOrder
+func compareSmart(a, b Todo, now time.Time) int {
+	if a.Completed != b.Completed {
+		return compareBool(a.Completed, b.Completed)
+	}
+
+	bucket := func(t Todo) int {
+		switch {
+		case t.DueDate == nil:
+			return 2
+		case t.DueDate.Before(now):
+			return 0
+		default:
+			return 1
+		}
+	}
+	if c := bucket(a) - bucket(b); c != 0 {
+		return c
+	}
+	if a.DueDate != nil && b.DueDate != nil {
+		if c := a.DueDate.Compare(*b.DueDate); c != 0 {
+			return c
+		}
+	}
+	if a.Priority != b.Priority {
+		return b.Priority - a.Priority
+	}
+	return b.CreatedAt.Compare(a.CreatedAt)
+}
+
+// compareTodoField orders todos by a single sort field; todos without a due
+// date always sort after those with one
+func compareTodoField(a, b Todo, field SortField) int {
+	var c int
+	switch field.Field {
+	case "id":
+		c = a.ID - b.ID
+	case "title":
+		c = strings.Compare(a.Title, b.Title)
+	case "priority":
+		c = a.Priority - b.Priority
+	case "due_date":
+		switch {
+		case a.DueDate == nil && b.DueDate == nil:
+			return 0
+		case a.DueDate == nil:
+			return 1
+		case b.DueDate == nil:
+			return -1
+		}
+		c = a.DueDate.Compare(*b.DueDate)
+	case "created_at":
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	case "updated_at":
+		c = a.UpdatedAt.Compare(b.UpdatedAt)
+	case "completed":
+		c = compareBool(a.Completed, b.Completed)
+	}
+	if field.Desc {
+		return -c
+	}
+	return c
+}
+
+// compareBool orders false before true
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// GetByID returns a specific todo
+func (ts *MemoryTodoStore) GetByID(id int) (*Todo, error) {
+	ts.db.mu.RLock()
+	defer ts.db.mu.RUnlock()
+
+	todo, ok := ts.todo(id)
+	if !ok {
+		return nil, fmt.Errorf("todo not found")
+	}
+	todo = ts.db.withRelations(todo)
+	return &todo, nil
+}
+
+// CreateFull adds a new todo with all fields
+func (ts *MemoryTodoStore) CreateFull(title, description string, categoryID *int, priority int, dueDate *time.Time, tagIDs []int, rule *recurrence.Rule) (*Todo, error) {
+	return ts.Import(TodoImport{
+		Title:       title,
+		Description: description,
+		CategoryID:  categoryID,
+		Priority:    priority,
+		DueDate:     dueDate,
+		TagIDs:      tagIDs,
+		Rule:        rule,
+	})
+}
+
+// Import adds a todo with its completion and times, its tags and its rule
+func (ts *MemoryTodoStore) Import(todo TodoImport) (*Todo, error) {
+	// Validate priority range
+	priority := todo.Priority
+	if priority < 1 || priority > 3 {
+		priority = 1 // Default to low priority if invalid
+	}
+
+	ts.db.mu.Lock()
+	defer ts.db.mu.Unlock()
+
+	if err := ts.checkParent(0, todo.ParentID); err != nil {
+		return nil, err
+	}
+	if err := ts.db.checkCategory(ts.owner, todo.CategoryID); err != nil {
+		return nil, err
+	}
+	if err := ts.db.checkTags(ts.owner, todo.TagIDs); err != nil {
+		return nil, err
+	}
+
+	now := memoryNow()
+	created := Todo{
+		ID:          ts.db.nextTodoID,
+		Title:       todo.Title,
+		Description: todo.Description,
+		CategoryID:  copyInt(todo.CategoryID),
+		ParentID:    copyInt(todo.ParentID),
+		Priority:    priority,
+		DueDate:     copyTime(todo.DueDate),
+		Completed:   todo.Completed,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Version:     1,
+		owner:       ts.owner,
+	}
+	if todo.CreatedAt != nil {
+		created.CreatedAt = todo.CreatedAt.UTC()
+	}
+	if todo.UpdatedAt != nil {
+		created.UpdatedAt = todo.UpdatedAt.UTC()
+	}
+	setRule(&created, todo.Rule)
+	ts.db.todos[created.ID] = created
+	ts.db.nextTodoID++
+	ts.db.setTags(created.ID, todo.TagIDs)
+
+	created = ts.db.withRelations(created)
+	return &created, nil
+}
+
+// Toggle switches the completion status of a todo. Completing it also
+// completes its open subtasks at every depth and, for a recurring todo,
+// creates the next occurrence.
+func (ts *MemoryTodoStore) Toggle(id int) (*Todo, *Completion, error) {
+	ts.db.mu.Lock()
+	defer ts.db.mu.Unlock()
+
+	todo, err := ts.written(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := memoryNow()
+	todo.Completed = !todo.Completed
+	todo.UpdatedAt = now
+	todo.Version++
+	ts.db.todos[id] = todo
+
+	changes := &Completion{}
+	if todo.Completed {
+		if changes, err = ts.db.finishCompletion(todo, now); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	todo = ts.db.withRelations(todo)
+	return &todo, changes, nil
+}
+
+// finishCompletion completes the open subtasks of a just completed todo at
+// every depth and creates the next occurrence of a recurring one.
+// The caller must hold db.mu.
+func (db *MemoryDB) finishCompletion(todo Todo, now time.Time) (*Completion, error) {
+	var open []Todo
+	for subtaskID := range db.subtree(todo.ID) {
+		subtask := db.todos[subtaskID]
+		if !subtask.Completed && subtask.DeletedAt == nil {
+			open = append(open, db.withRelations(subtask))
+		}
+	}
+	sortTodos(open)
+
+	changes := &Completion{}
+	for i := range open {
+		subtask := db.todos[open[i].ID]
+		subtask.Completed = true
+		subtask.UpdatedAt = now
+		subtask.Version++
+		db.todos[subtask.ID] = subtask
+		after := db.withRelations(subtask)
+		changes.Subtasks = append(changes.Subtasks, TodoChange{Before: &open[i], After: &after})
+	}
+
+	next, err := db.createNextOccurrence(todo)
+	if err != nil {
+		return nil, err
+	}
+	changes.Next = next
+	return changes, nil
+}
+
+// Update modifies a todo's fields; a nil priority keeps the current one
+func (ts *MemoryTodoStore) Update(id int, title, description string, categoryID *int, priority *int, dueDate *time.Time, tagIDs []int) (*Todo, error) {
+	return ts.Edit(id, TodoEdit{
+		Title:       title,
+		Description: description,
+		CategoryID:  categoryID,
+		Priority:    priority,
+		DueDate:     dueDate,
+		TagIDs:      tagIDs,
+	})
+}
+
+// Edit modifies a todo's fields, parent and recurrence under one lock
+func (ts *MemoryTodoStore) Edit(id int, edit TodoEdit) (*Todo, error) {
+	ts.db.mu.Lock()
+	defer ts.db.mu.Unlock()
+
+	if edit.Move {
+		if err := ts.checkParent(id, edit.ParentID); err != nil {
+			return nil, err
+		}
+	}
+	todo, err := ts.written(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := ts.db.checkCategory(ts.owner, edit.CategoryID); err != nil {
+		return nil, err
+	}
+	if err := ts.db.checkTags(ts.owner, edit.TagIDs); err != nil {
+		return nil, err
+	}
+
+	todo.Title = edit.Title
+	todo.Description = edit.Description
+	todo.CategoryID = copyInt(edit.CategoryID)
+	if edit.Priority != nil {
+		todo.Priority = *edit.Priority
+		if todo.Priority < 1 || todo.Priority > 3 {
+			todo.Priority = 1
+		}
+	}
+	todo.DueDate = copyTime(edit.DueDate)
+	if edit.Move {
+		todo.ParentID = copyInt(edit.ParentID)
+	}
+	if edit.SetRecurrence {
+		setRule(&todo, edit.Rule)
+	}
+	todo.UpdatedAt = memoryNow()
+	todo.Version++
+	ts.db.todos[id] = todo
+	if edit.TagIDs != nil {
+		ts.db.setTags(id, edit.TagIDs)
+	}
+
+	todo = ts.db.withRelations(todo)
+	return &todo, nil
+}
+
+// Delete moves a todo that has no subtasks to the trash
+func (ts *MemoryTodoStore) Delete(id int) error {
+	ts.db.mu.Lock()
+	defer ts.db.mu.Unlock()
+
+	if _, err := ts.written(id); err != nil {
+		return err
+	}
+	if progress := ts.db.progress(id); progress != nil {
+		return fmt.Errorf("todo has subtasks (%d)", progress.Total)
+	}
+	ts.db.trashTodo(id)
+
+	return nil
+}
+
+// DeleteTree moves a todo and all of its subtasks to the trash
+func (ts *MemoryTodoStore) DeleteTree(id int) error {
+	ts.db.mu.Lock()
+	defer ts.db.mu.Unlock()
+
+	if _, err := ts.written(id); err != nil {
+		return err
+	}
+	ts.db.trashTodo(id)
+
+	return nil
+}
+
+// trashTodo moves a todo and the subtasks that are not in the trash yet to
+// it. The caller must hold db.mu.
+func (db *MemoryDB) trashTodo(id int) {
+	now := memoryNow()
+	for todoID := range db.subtree(id) {
+		if todo := db.todos[todoID]; todo.DeletedAt == nil {
+			todo.DeletedAt = &now
+			todo.Version++
+			db.todos[todoID] = todo
+		}
+	}
+	todo := db.todos[id]
+	todo.DeletedAt = &now
+	todo.Version++
+	db.todos[id] = todo
+}
+
+// Trash returns the todos in the trash that were not deleted along with
+// their parent, most recently deleted first
+func (ts *MemoryTodoStore) Trash() ([]Todo, error) {
+	ts.db.mu.RLock()
+	defer ts.db.mu.RUnlock()
+
+	todos := []Todo{}
+	for _, todo := range ts.db.todos {
+		if !ts.owner.owns(todo.owner) || todo.DeletedAt == nil {
+			continue
+		}
+		if todo.ParentID != nil && ts.db.todos[*todo.ParentID].DeletedAt != nil {
+			continue
+		}
+		todos = append(todos, ts.db.withRelations(todo))
+	}
+	sort.Slice(todos, func(i, j int) bool {
+		if c := todos[i].DeletedAt.Compare(*todos[j].DeletedAt); c != 0 {
+			return c > 0
+		}
+		return todos[i].ID > todos[j].ID
+	})
+
+	return todos, nil
+}
+
+// Restore takes a todo out of the trash with the subtasks deleted along with it
+func (ts *MemoryTodoStore) Restore(id int) ([]Todo, error) {
+	ts.db.mu.Lock()
+	defer ts.db.mu.Unlock()
+
+	todo, ok := ts.trashed(id)
+	if !ok {
+		return nil, fmt.Errorf("todo not found")
+	}
+	if todo.ParentID != nil && ts.db.todos[*todo.ParentID].DeletedAt != nil {
+		return nil, fmt.Errorf("parent todo is in the trash")
+	}
+
+	// Subtasks deleted before the todo were deleted on their own and stay
+	deletedAt := *todo.DeletedAt
+	for subtaskID := range ts.db.subtree(id) {
+		subtask := ts.db.todos[subtaskID]
+		if subtask.DeletedAt != nil && !subtask.DeletedAt.Before(deletedAt) {
+			subtask.DeletedAt = nil
+			subtask.Version++
+			ts.db.todos[subtaskID] = subtask
+		}
+	}
+	todo.DeletedAt = nil
+	todo.Version++
+	ts.db.todos[id] = todo
+
+	return append([]Todo{ts.db.withRelations(todo)}, ts.descendants(id)...), nil
+}
+
+// Purge permanently removes a todo in the trash and its subtasks
+func (ts *MemoryTodoStore) Purge(id int) error {
+	ts.db.mu.Lock()
+	defer ts.db.mu.Unlock()
+
+	if _, ok := ts.trashed(id); !ok {
+		return fmt.Errorf("todo not found")
+	}
+	for subtaskID := range ts.db.subtree(id) {
+		ts.db.deleteTodo(subtaskID)
+	}
+	ts.db.deleteTodo(id)
+
+	return nil
+}
+
+// PurgeDeletedBefore permanently removes the todos deleted before t
+func (ts *MemoryTodoStore) PurgeDeletedBefore(t time.Time) (int, error) {
+	ts.db.mu.Lock()
+	defer ts.db.mu.Unlock()
+
+	before := t.Truncate(time.Second)
+	purged := 0
+	for id, todo := range ts.db.todos {
+		if !ts.owner.owns(todo.owner) || todo.DeletedAt == nil || !todo.DeletedAt.Before(before) {
+			continue
+		}
+		// Like the foreign keys of the SQL store, take the subtasks along
+		for subtaskID := range ts.db.subtree(id) {
+			ts.db.deleteTodo(subtaskID)
+		}
+		ts.db.deleteTodo(id)
+		purged++
+	}
+
+	return purged, nil
+}
+
+// CreateSubtask adds a new todo under an existing one
+func (ts *MemoryTodoStore) CreateSubtask(parentID int, title, description string, categoryID *int, priority int, dueDate *time.Time, tagIDs []int, rule *recurrence.Rule) (*Todo, error) {
+	return ts.Import(TodoImport{
+		Title:       title,
+		Description: description,
+		CategoryID:  categoryID,
+		Priority:    priority,
+		DueDate:     dueDate,
+		TagIDs:      tagIDs,
+		ParentID:    &parentID,
+		Rule:        rule,
+	})
+}
+
+// checkParent reports a parent that does not exist, or that would put a
+// todo under itself or one of its subtasks. A nil parent is fine.
+// The caller must hold db.mu.
+func (ts *MemoryTodoStore) checkParent(id int, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	if _, ok := ts.todo(*parentID); !ok {
+		return fmt.Errorf("parent todo not found")
+	}
+	// The new parent must not be the todo itself or one of its subtasks
+	if *parentID == id || ts.db.subtree(id)[*parentID] {
+		return fmt.Errorf("todo cycle: a todo cannot be moved under itself or its subtasks")
+	}
+	return nil
+}
+
+// Descendants returns every todo below the given ones in the default order
+func (ts *MemoryTodoStore) Descendants(ids ...int) ([]Todo, error) {
+	ts.db.mu.RLock()
+	defer ts.db.mu.RUnlock()
+
+	return ts.descendants(ids...), nil
+}
+
+// descendants returns every todo below the given ones that is not in the
+// trash, in the default order. The caller must hold db.mu.
+func (ts *MemoryTodoStore) descendants(ids ...int) []Todo {
+	var todos []Todo
+	for id := range ts.db.subtree(ids...) {
+		if todo, ok := ts.todo(id); ok {
+			todos = append(todos, ts.db.withRelations(todo))
+		}
+	}
+	sortTodos(todos)
+
+	return todos
+}
+
+// sortTodos puts todos in the default order
+func sortTodos(todos []Todo) {
+	now := time.Now()
+	sort.Slice(todos, func(i, j int) bool {
+		if c := compareSmart(todos[i], todos[j], now); c != 0 {
+			return c < 0
+		}
+		return todos[i].ID > todos[j].ID
+	})
+}
+
+// Archive archives the completed top-level todos matching the filter whose
+// subtasks are all completed, together with those subtasks
+func (ts *MemoryTodoStore) Archive(filter ArchiveFilter) ([]Todo, error) {
+	ts.db.mu.Lock()
+	defer ts.db.mu.Unlock()
+
+	// busy holds every todo with an open subtask at any depth
+	busy := make(map[int]bool)
+	for _, todo := range ts.db.todos {
+		if todo.Completed || todo.DeletedAt != nil {
+			continue
+		}
+		for parentID := todo.ParentID; parentID != nil; parentID = ts.db.todos[*parentID].ParentID {
+			busy[*parentID] = true
+		}
+	}
+
+	now := memoryNow()
+	var todos []Todo
+	for id, todo := range ts.db.todos {
+		switch {
+		case !ts.owner.owns(todo.owner), todo.ParentID != nil, !todo.Completed,
+			todo.ArchivedAt != nil, todo.DeletedAt != nil, busy[id],
+			filter.CategoryID != nil && (todo.CategoryID == nil || *todo.CategoryID != *filter.CategoryID),
+			filter.UpdatedBefore != nil && !todo.UpdatedAt.Before(*filter.UpdatedBefore):
+			continue
+		}
+		for subtaskID := range ts.db.subtree(id) {
+			if subtask := ts.db.todos[subtaskID]; subtask.DeletedAt == nil {
+				subtask.ArchivedAt = &now
+				subtask.Version++
+				ts.db.todos[subtaskID] = subtask
+			}
+		}
+		todo.ArchivedAt = &now
+		todo.Version++
+		ts.db.todos[id] = todo
+		todos = append(todos, ts.db.withRelations(todo))
+	}
+
+	sortTodos(todos)
+	if todos == nil {
+		todos = []Todo{}
+	}
+	return todos, nil
+}
+
+// Unarchive brings an archived todo and its subtasks back to the active list
+func (ts *MemoryTodoStore) Unarchive(id int) (*Todo, error) {
+	ts.db.mu.Lock()
+	defer ts.db.mu.Unlock()
+
+	todo, ok := ts.todo(id)
+	if !ok {
+		return nil, fmt.Errorf("todo not found")
+	}
+	if todo.ParentID != nil && ts.db.todos[*todo.ParentID].ArchivedAt != nil {
+		return nil, fmt.Errorf("todo is archived with its parent")
+	}
+
+	if todo.ArchivedAt != nil {
+		for subtaskID := range ts.db.subtree(id) {
+			subtask := ts.db.todos[subtaskID]
+			subtask.ArchivedAt = nil
+			subtask.Version++
+			ts.db.todos[subtaskID] = subtask
+		}
+		todo.ArchivedAt = nil
+		todo.Version++
+		ts.db.todos[id] = todo
+	}
+
+	todo = ts.db.withRelations(todo)
+	return &todo, nil
+}
+
+// Bulk applies a change to the given todos, all of them under one lock
+func (ts *MemoryTodoStore) Bulk(ids []int, change BulkChange) ([]BulkResult, error) {
+	ts.db.mu.Lock()
+	defer ts.db.mu.Unlock()
+
+	if !slices.Contains(BulkActions, change.Action) {
+		return nil, fmt.Errorf("unknown bulk action %q", change.Action)
+	}
+	if change.Action == BulkSetCategory {
+		if err := ts.db.checkCategory(ts.owner, change.CategoryID); err != nil {
+			return nil, err
+		}
+	}
+
+	// The todos as they were decide what to change and go to the audit log
+	ids = uniqueIDs(ids)
+	results := make([]BulkResult, len(ids))
+	for i, id := range ids {
+		results[i] = BulkResult{ID: id, Status: BulkNotFound}
+		if todo, ok := ts.todo(id); ok {
+			before := ts.db.withRelations(todo)
+			results[i].Before = &before
+		}
+	}
+
+	now := memoryNow()
+	for i := range results {
+		if results[i].Before == nil {
+			continue
+		}
+		applied, err := ts.applyBulkChange(&results[i], change, now)
+		if err != nil {
+			return nil, err
+		}
+		if !applied {
+			results[i].Status = BulkUnchanged
+			continue
+		}
+		results[i].Status = BulkOK
+	}
+
+	for i := range results {
+		if todo, ok := ts.todo(results[i].ID); ok && results[i].Status == BulkOK {
+			after := ts.db.withRelations(todo)
+			results[i].Todo = &after
+		}
+	}
+	return results, nil
+}
+
+// applyBulkChange makes the bulk change of a result to its todo, reporting
+// whether there was anything to change. Completing a todo sets the
+// Completion of the result. The caller must hold db.mu.
+func (ts *MemoryTodoStore) applyBulkChange(result *BulkResult, change BulkChange, now time.Time) (bool, error) {
+	before := result.Before
+	todo := ts.db.todos[before.ID]
+	switch change.Action {
+	case BulkComplete, BulkReopen:
+		completed := change.Action == BulkComplete
+		if before.Completed == completed {
+			return false, nil
+		}
+		todo.Completed = completed
+	case BulkDelete:
+		// A subtask listed after its parent is already in the trash with it
+		if todo.DeletedAt == nil {
+			ts.db.trashTodo(todo.ID)
+		}
+		return true, nil
+	case BulkSetCategory:
+		if sameInt(before.CategoryID, change.CategoryID) {
+			return false, nil
+		}
+		todo.CategoryID = copyInt(change.CategoryID)
+	case BulkSetPriority:
+		priority := change.Priority
+		if priority < 1 || priority > 3 {
+			priority = 1
+		}
+		if before.Priority == priority {
+			return false, nil
+		}
+		todo.Priority = priority
+	case BulkShiftDue:
+		if before.DueDate == nil || change.Days == 0 {
+			return false, nil
+		}
+		due := before.DueDate.AddDate(0, 0, change.Days)
+		todo.DueDate = &due
+	}
+	todo.UpdatedAt = now
+	todo.Version++
+	ts.db.todos[todo.ID] = todo
+
+	if change.Action == BulkComplete {
+		var err error
+		if result.Completion, err = ts.db.finishCompletion(todo, now); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// setRule sets or clears the recurrence rule of a todo. The first recurring
+// todo starts the series.
+func setRule(todo *Todo, rule *recurrence.Rule) {
+	if rule == nil {
+		todo.Recurrence = nil
+		return
+	}
+	value := rule.String()
+	todo.Recurrence = &value
+	if todo.SeriesID == nil {
+		seriesID := todo.ID
+		todo.SeriesID = &seriesID
+	}
+	if todo.Occurrence == 0 {
+		todo.Occurrence = 1
+	}
+}
+
+// SetRecurrence sets or clears the recurrence rule of a todo
+func (ts *MemoryTodoStore) SetRecurrence(id int, rule *recurrence.Rule) (*Todo, error) {
+	ts.db.mu.Lock()
+	defer ts.db.mu.Unlock()
+
+	todo, err := ts.written(id)
+	if err != nil {
+		return nil, err
+	}
+	setRule(&todo, rule)
+	todo.UpdatedAt = memoryNow()
+	todo.Version++
+	ts.db.todos[id] = todo
+
+	todo = ts.db.withRelations(todo)
+	return &todo, nil
+}
+
+// createNextOccurrence adds the occurrence following a just completed
+// recurring todo, copying its fields, tags and relative reminders, and
+// returns it, or nil when there is none. The caller must hold db.mu.
+func (db *MemoryDB) createNextOccurrence(todo Todo) (*Todo, error) {
+	if todo.Recurrence == nil {
+		return nil, nil
+	}
+
+	// Completing the same occurrence again must not start a second branch
+	for _, other := range db.todos {
+		if other.SeriesID != nil && *other.SeriesID == *todo.SeriesID && other.Occurrence > todo.Occurrence {
+			return nil, nil
+		}
+	}
+
+	next, ok, err := nextDueDate(*todo.Recurrence, todo.DueDate, todo.Occurrence, time.Now())
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	now := memoryNow()
+	occurrence := Todo{
+		ID:          db.nextTodoID,
+		Title:       todo.Title,
+		Description: todo.Description,
+		CategoryID:  copyInt(todo.CategoryID),
+		ParentID:    copyInt(todo.ParentID),
+		Priority:    todo.Priority,
+		DueDate:     &next,
+		Recurrence:  copyString(todo.Recurrence),
+		SeriesID:    copyInt(todo.SeriesID),
+		Occurrence:  todo.Occurrence + 1,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Version:     1,
+		owner:       todo.owner,
+	}
+	db.todos[occurrence.ID] = occurrence
+	db.nextTodoID++
+
+	for tagID := range db.todoTags[todo.ID] {
+		if db.todoTags[occurrence.ID] == nil {
+			db.todoTags[occurrence.ID] = make(map[int]bool)
+		}
+		db.todoTags[occurrence.ID][tagID] = true
+	}
+
+	// Reminders at a fixed time belong to this occurrence only
+	for _, reminder := range db.todoReminders(todo.ID) {
+		if reminder.MinutesBefore != nil {
+			db.addReminder(occurrence.ID, nil, reminder.MinutesBefore)
+		}
+	}
+
+	occurrence = db.withRelations(occurrence)
+	return &occurrence, nil
+}
+
+// deleteTodo removes a todo with its tags and reminders, like the foreign
+// keys of the SQL store do. The caller must hold db.mu.
+func (db *MemoryDB) deleteTodo(id int) {
+	delete(db.todos, id)
+	delete(db.todoTags, id)
+	for reminderID, reminder := range db.reminders {
+		if reminder.TodoID == id {
+			delete(db.reminders, reminderID)
+		}
+	}
+}
+
+// withRelations attaches the todo's category and subtask progress the way the
+// SQL store does and copies its pointer fields, so callers never share memory
+// with the store. The caller must hold db.mu.
+func (db *MemoryDB) withRelations(todo Todo) Todo {
+	todo.CategoryID = copyInt(todo.CategoryID)
+	todo.ParentID = copyInt(todo.ParentID)
+	todo.SeriesID = copyInt(todo.SeriesID)
+	todo.Recurrence = copyString(todo.Recurrence)
+	todo.DueDate = copyTime(todo.DueDate)
+	todo.DeletedAt = copyTime(todo.DeletedAt)
+	todo.ArchivedAt = copyTime(todo.ArchivedAt)
+	todo.Progress = db.progress(todo.ID)
+	todo.Tags = []Tag{}
+	for tagID := range db.todoTags[todo.ID] {
+		tag := db.tags[tagID]
+		todo.Tags = append(todo.Tags, Tag{ID: tag.ID, Name: tag.Name, Color: tag.Color})
+	}
+	sort.Slice(todo.Tags, func(i, j int) bool {
+		return todo.Tags[i].Name < todo.Tags[j].Name
+	})
+	todo.Category = nil
+	if todo.CategoryID != nil {
+		if category, ok := db.categories[*todo.CategoryID]; ok {
+			todo.Category = &Category{
+				ID:    category.ID,
+				Name:  category.Name,
+				Color: category.Color,
+			}
+		}
+	}
+	return todo
+}
+
+// progress counts the direct subtasks of a todo, returning nil when it has none.
+// The caller must hold db.mu.
+func (db *MemoryDB) progress(id int) *Progress {
+	var progress Progress
+	for _, todo := range db.todos {
+		if todo.ParentID != nil && *todo.ParentID == id && todo.DeletedAt == nil {
+			progress.Total++
+			if todo.Completed {
+				progress.Done++
+			}
+		}
+	}
+	if progress.Total == 0 {
+		return nil
+	}
+	return &progress
+}
+
+// subtree returns the ids of every todo below the given ones.
+// The caller must hold db.mu.
+func (db *MemoryDB) subtree(ids ...int) map[int]bool {
+	below := make(map[int]bool)
+	parents := ids
+	for len(parents) > 0 {
+		var next []int
+		for _, todo := range db.todos {
+			if todo.ParentID == nil || below[todo.ID] {
+				continue
+			}
+			for _, parent := range parents {
+				if *todo.ParentID == parent {
+					below[todo.ID] = true
+					next = append(next, todo.ID)
+					break
+				}
+			}
+		}
+		parents = next
+	}
+	return below
+}
+
+// checkCategory reports a category that does not exist or is not one of
+// owner's. The caller must hold db.mu.
+func (db *MemoryDB) checkCategory(owner ownership, categoryID *int) error {
+	if categoryID == nil {
+		return nil
+	}
+	if category, ok := db.categories[*categoryID]; !ok || !owner.owns(category.owner) {
+		return fmt.Errorf("category not found")
+	}
+	return nil
+}
+
+// checkTags reports tag IDs that do not exist or are not owner's. The
+// caller must hold db.mu.
+func (db *MemoryDB) checkTags(owner ownership, tagIDs []int) error {
+	for _, tagID := range tagIDs {
+		if tag, ok := db.tags[tagID]; !ok || !owner.owns(tag.owner) {
+			return fmt.Errorf("tag not found")
+		}
+	}
+	return nil
+}
+
+// setTags replaces the tags of a todo.
+// The caller must hold db.mu.
+func (db *MemoryDB) setTags(todoID int, tagIDs []int) {
+	delete(db.todoTags, todoID)
+	for _, tagID := range tagIDs {
+		if db.todoTags[todoID] == nil {
+			db.todoTags[todoID] = make(map[int]bool)
+		}
+		db.todoTags[todoID][tagID] = true
+	}
+}
+
+// copyInt returns a pointer to a copy of *p, so stored todos never alias caller memory
+func copyInt(p *int) *int {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// copyString returns a pointer to a copy of *p
+func copyString(p *string) *string {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// copyTime returns a pointer to a copy of *p in UTC
+func copyTime(p *time.Time) *time.Time {
+	if p == nil {
+		return nil
+	}
+	v := p.UTC()
+	return &v
+}
@@ -0,0 +1,241 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gotodo/query"
+)
+
+// dateColumns maps query date fields to their todo columns
+var dateColumns = map[string]string{
+	query.FieldDue:     "t.due_date",
+	query.FieldCreated: "t.created_at",
+	query.FieldUpdated: "t.updated_at",
+}
+
+// queryConditions translates a parsed search query into SQL conditions over
+// the todos/categories join. Values are always passed as arguments; only
+// column names and operators chosen by the parser end up in the SQL.
+// Positive free-text terms are left to the search index, see TextTerms.
+// like is the case-insensitive LIKE operator of the database.
+func queryConditions(q *query.Query, like string) ([]string, []any) {
+	var conditions []string
+	var args []any
+
+	for _, cond := range q.Conditions {
+		if cond.Field == query.FieldText && !cond.Negate {
+			continue
+		}
+
+		sql, condArgs := conditionSQL(cond, like)
+		if cond.Negate {
+			// COALESCE keeps NULL columns (no category, no due date) on the negated side
+			sql = "NOT COALESCE((" + sql + "), FALSE)"
+		}
+		conditions = append(conditions, sql)
+		args = append(args, condArgs...)
+	}
+
+	return conditions, args
+}
+
+// conditionSQL returns the SQL for a single, non-negated condition
+func conditionSQL(cond query.Condition, like string) (string, []any) {
+	switch cond.Field {
+	case query.FieldText:
+		pattern := likePattern(cond.Text)
+		return "t.title " + like + ` ? ESCAPE '\' OR t.description ` + like + ` ? ESCAPE '\'`, []any{pattern, pattern}
+
+	case query.FieldTitle:
+		return "t.title " + like + ` ? ESCAPE '\'`, []any{likePattern(cond.Text)}
+
+	case query.FieldDescription:
+		return "t.description " + like + ` ? ESCAPE '\'`, []any{likePattern(cond.Text)}
+
+	case query.FieldCategory:
+		if cond.Text == query.None {
+			return "t.category_id IS NULL", nil
+		}
+		return "LOWER(c.name) = LOWER(?)", []any{cond.Text}
+
+	case query.FieldTag:
+		if cond.Text == query.None {
+			return "NOT EXISTS (SELECT 1 FROM todo_tags tt WHERE tt.todo_id = t.id)", nil
+		}
+		return `EXISTS (
+			SELECT 1 FROM todo_tags tt JOIN tags g ON g.id = tt.tag_id
+			WHERE tt.todo_id = t.id AND LOWER(g.name) = LOWER(?))`, []any{cond.Text}
+
+	case query.FieldPriority:
+		return fmt.Sprintf("t.priority %s ?", cond.Op), []any{cond.Int}
+
+	case query.FieldDue, query.FieldCreated, query.FieldUpdated:
+		column := dateColumns[cond.Field]
+		if cond.None {
+			return column + " IS NULL", nil
+		}
+		switch cond.Op {
+		case query.OpLt:
+			return column + " < ?", []any{cond.From}
+		case query.OpLe:
+			return column + " < ?", []any{cond.To}
+		case query.OpGt:
+			return column + " >= ?", []any{cond.To}
+		case query.OpGe:
+			return column + " >= ?", []any{cond.From}
+		default:
+			return column + " >= ? AND " + column + " < ?", []any{cond.From, cond.To}
+		}
+
+	case query.FieldIs:
+		switch cond.Text {
+		case query.IsOpen:
+			return "t.completed = FALSE", nil
+		case query.IsDone:
+			return "t.completed = TRUE", nil
+		default:
+			return "t.completed = FALSE AND t.due_date < CURRENT_TIMESTAMP", nil
+		}
+
+	case query.FieldHas:
+		switch cond.Text {
+		case query.HasDue:
+			return "t.due_date IS NOT NULL", nil
+		case query.HasCategory:
+			return "t.category_id IS NOT NULL", nil
+		case query.HasTag:
+			return "EXISTS (SELECT 1 FROM todo_tags tt WHERE tt.todo_id = t.id)", nil
+		default:
+			return "t.description <> ''", nil
+		}
+	}
+
+	// The parser never produces other fields
+	return "FALSE", nil
+}
+
+// matchesQuery evaluates a parsed search query against a todo in Go, with
+// the same semantics as queryConditions. Positive free-text terms are
+// ignored here as well.
+func matchesQuery(todo Todo, q *query.Query, now time.Time) bool {
+	for _, cond := range q.Conditions {
+		if cond.Field == query.FieldText && !cond.Negate {
+			continue
+		}
+		if matchesCondition(todo, cond, now) == cond.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesCondition evaluates a single condition, ignoring its negation.
+// Conditions on unset fields are false, like SQL comparisons with NULL.
+func matchesCondition(todo Todo, cond query.Condition, now time.Time) bool {
+	switch cond.Field {
+	case query.FieldText:
+		return containsFold(todo.Title, cond.Text) || containsFold(todo.Description, cond.Text)
+
+	case query.FieldTitle:
+		return containsFold(todo.Title, cond.Text)
+
+	case query.FieldDescription:
+		return containsFold(todo.Description, cond.Text)
+
+	case query.FieldCategory:
+		if cond.Text == query.None {
+			return todo.CategoryID == nil
+		}
+		return todo.Category != nil && strings.EqualFold(todo.Category.Name, cond.Text)
+
+	case query.FieldTag:
+		if cond.Text == query.None {
+			return len(todo.Tags) == 0
+		}
+		for _, tag := range todo.Tags {
+			if strings.EqualFold(tag.Name, cond.Text) {
+				return true
+			}
+		}
+		return false
+
+	case query.FieldPriority:
+		switch cond.Op {
+		case query.OpLt:
+			return todo.Priority < cond.Int
+		case query.OpLe:
+			return todo.Priority <= cond.Int
+		case query.OpGt:
+			return todo.Priority > cond.Int
+		case query.OpGe:
+			return todo.Priority >= cond.Int
+		default:
+			return todo.Priority == cond.Int
+		}
+
+	case query.FieldDue, query.FieldCreated, query.FieldUpdated:
+		var value *time.Time
+		switch cond.Field {
+		case query.FieldDue:
+			value = todo.DueDate
+		case query.FieldCreated:
+			value = &todo.CreatedAt
+		default:
+			value = &todo.UpdatedAt
+		}
+		if cond.None {
+			return value == nil
+		}
+		if value == nil {
+			return false
+		}
+		switch cond.Op {
+		case query.OpLt:
+			return value.Before(cond.From)
+		case query.OpLe:
+			return value.Before(cond.To)
+		case query.OpGt:
+			return !value.Before(cond.To)
+		case query.OpGe:
+			return !value.Before(cond.From)
+		default:
+			return !value.Before(cond.From) && value.Before(cond.To)
+		}
+
+	case query.FieldIs:
+		switch cond.Text {
+		case query.IsOpen:
+			return !todo.Completed
+		case query.IsDone:
+			return todo.Completed
+		default:
+			return isOverdue(todo, now)
+		}
+
+	case query.FieldHas:
+		switch cond.Text {
+		case query.HasDue:
+			return todo.DueDate != nil
+		case query.HasCategory:
+			return todo.CategoryID != nil
+		case query.HasTag:
+			return len(todo.Tags) > 0
+		default:
+			return todo.Description != ""
+		}
+	}
+
+	return false
+}
+
+// isOverdue reports whether an incomplete todo's due date has passed
+func isOverdue(todo Todo, now time.Time) bool {
+	return !todo.Completed && todo.DueDate != nil && todo.DueDate.Before(now)
+}
+
+// containsFold reports whether substr is within s, ignoring case
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
@@ -0,0 +1,1585 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"gotodo/database"
+	"gotodo/recurrence"
+)
+
+// TodoStore manages TODO items in an SQL database (SQLite or PostgreSQL)
+type TodoStore struct {
+	db      *database.DB
+	owner   ownership
+	version int // the version writes expect, see IfVersion
+}
+
+// NewTodoStore creates a new TodoStore backed by db
+func NewTodoStore(db *database.DB) *TodoStore {
+	return &TodoStore{
+		db: db,
+	}
+}
+
+var _ TodoRepository = (*TodoStore)(nil)
+
+// ForUser returns a TodoStore limited to the todos of a user
+func (ts *TodoStore) ForUser(userID int) TodoRepository {
+	return &TodoStore{db: ts.db, owner: ownership{userID: userID}}
+}
+
+// ForWorkspace returns a TodoStore limited to the todos of a workspace
+func (ts *TodoStore) ForWorkspace(workspaceID int) TodoRepository {
+	return &TodoStore{db: ts.db, owner: ownership{workspaceID: workspaceID}}
+}
+
+// IfVersion returns a TodoStore whose writes only change a todo at the
+// given version
+func (ts *TodoStore) IfVersion(version int) TodoRepository {
+	return &TodoStore{db: ts.db, owner: ts.owner, version: version}
+}
+
+// versionFilter returns the condition a write puts on the version of the
+// todo it changes, which only a store made by IfVersion has
+func (ts *TodoStore) versionFilter() (string, []any) {
+	if ts.version == 0 {
+		return "1 = 1", nil
+	}
+	return "version = ?", []any{ts.version}
+}
+
+// notWritten tells why a write changed no todo: it does not exist, or it is
+// no longer at the version the store expects
+func (ts *TodoStore) notWritten(queryRow func(query string, args ...any) *sql.Row, id int) error {
+	if ts.version == 0 {
+		return fmt.Errorf("todo not found")
+	}
+
+	owner, args := ts.owner.filter("")
+	var count int
+	err := queryRow(`SELECT COUNT(*) FROM todos WHERE id = ? AND deleted_at IS NULL AND `+owner, append([]any{id}, args...)...).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check todo: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("todo not found")
+	}
+	return ErrVersionConflict
+}
+
+// todoColumns are the columns of a todo joined with its category, in the order expected by scanTodo
+const todoColumns = `
+			t.id, t.title, t.description, t.category_id, t.priority, t.due_date,
+			t.completed, t.created_at, t.updated_at,
+			c.id, c.name, c.color, t.parent_id,
+			t.recurrence, t.series_id, t.occurrence, t.deleted_at, t.archived_at, t.version,
+			t.owner_id, t.workspace_id,
+			(SELECT COUNT(*) FROM todos s WHERE s.parent_id = t.id AND s.deleted_at IS NULL),
+			(SELECT COUNT(*) FROM todos s WHERE s.parent_id = t.id AND s.deleted_at IS NULL AND s.completed = TRUE)`
+
+// todoFrom joins todos with their categories
+const todoFrom = `
+		FROM todos t
+		LEFT JOIN categories c ON t.category_id = c.id`
+
+// todoSelect selects a todo joined with its category
+const todoSelect = `
+		SELECT ` + todoColumns + todoFrom
+
+// todoSmartOrder puts open todos first, then overdue ones, then by due date, priority and age
+const todoSmartOrder = `
+			t.completed ASC,
+			CASE 
+				WHEN t.due_date IS NULL THEN 2
+				WHEN t.due_date < CURRENT_TIMESTAMP THEN 0
+				ELSE 1
+			END ASC,
+			t.due_date ASC,
+			t.priority DESC,
+			t.created_at DESC
+`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanTodo reads a row produced by todoSelect; extra receives any columns selected after todoColumns
+func scanTodo(row rowScanner, extra ...any) (Todo, error) {
+	var todo Todo
+	var categoryID, categoryIDJoin sql.NullInt64
+	var categoryName, categoryColor sql.NullString
+	var dueDate sql.NullTime
+	var parentID sql.NullInt64
+	var progress Progress
+	var rule sql.NullString
+	var seriesID, occurrence sql.NullInt64
+	var deletedAt, archivedAt sql.NullTime
+	var ownerID, workspaceID sql.NullInt64
+
+	dest := []any{
+		&todo.ID,
+		&todo.Title,
+		&todo.Description,
+		&categoryID,
+		&todo.Priority,
+		&dueDate,
+		&todo.Completed,
+		&todo.CreatedAt,
+		&todo.UpdatedAt,
+		&categoryIDJoin,
+		&categoryName,
+		&categoryColor,
+		&parentID,
+		&rule,
+		&seriesID,
+		&occurrence,
+		&deletedAt,
+		&archivedAt,
+		&todo.Version,
+		&ownerID,
+		&workspaceID,
+		&progress.Total,
+		&progress.Done,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return todo, err
+	}
+
+	// Handle due date
+	if dueDate.Valid {
+		todo.DueDate = &dueDate.Time
+	}
+
+	// Handle category
+	if categoryID.Valid {
+		id := int(categoryID.Int64)
+		todo.CategoryID = &id
+
+		if categoryIDJoin.Valid && categoryName.Valid && categoryColor.Valid {
+			todo.Category = &Category{
+				ID:    int(categoryIDJoin.Int64),
+				Name:  categoryName.String,
+				Color: categoryColor.String,
+			}
+		}
+	}
+
+	// Handle subtasks
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		todo.ParentID = &id
+	}
+	if progress.Total > 0 {
+		todo.Progress = &progress
+	}
+
+	// Handle recurrence
+	if rule.Valid {
+		todo.Recurrence = &rule.String
+	}
+	if seriesID.Valid {
+		id := int(seriesID.Int64)
+		todo.SeriesID = &id
+	}
+	todo.Occurrence = int(occurrence.Int64)
+
+	// Handle the trash and the archive
+	if deletedAt.Valid {
+		todo.DeletedAt = &deletedAt.Time
+	}
+	if archivedAt.Valid {
+		todo.ArchivedAt = &archivedAt.Time
+	}
+
+	// Workspace todos have no owner_id
+	if workspaceID.Valid {
+		todo.owner = ownership{workspaceID: int(workspaceID.Int64)}
+	} else {
+		todo.owner = ownership{userID: int(ownerID.Int64)}
+	}
+
+	return todo, nil
+}
+
+// GetAll retrieves all TODO items from the database
+func (ts *TodoStore) GetAll() ([]Todo, error) {
+	todos, _, err := ts.List(TodoFilter{})
+	return todos, err
+}
+
+// Search retrieves TODO items that match the search query
+func (ts *TodoStore) Search(query string) ([]Todo, error) {
+	todos, _, err := ts.List(TodoFilter{Search: query})
+	return todos, err
+}
+
+// List retrieves the TODO items matching the filter, along with the
+// number of matches before Limit and Offset are applied
+func (ts *TodoStore) List(filter TodoFilter) ([]Todo, int, error) {
+	q := buildTodoQuery(filter, ts.db)
+	owner, ownerArgs := ts.owner.filter("t")
+	q.conditions = append(q.conditions, owner, "t.deleted_at IS NULL")
+	q.args = append(q.args, ownerArgs...)
+
+	orderBy, err := todoOrderBy(filter.Sort)
+	if err != nil {
+		return nil, 0, err
+	}
+	args := q.args
+	if q.rank != "" && (filter.Sort == "" || filter.Sort == "smart") {
+		// Without an explicit sort, search results are ordered by relevance
+		orderBy = q.rank + ", " + orderBy
+		args = append(args, q.rankArgs...)
+	}
+
+	query := "SELECT " + todoColumns + q.columns + todoFrom + q.joins + q.where() + " ORDER BY " + orderBy
+
+	paginated := filter.Limit > 0 || filter.Offset > 0
+	if paginated {
+		limit := filter.Limit
+		if limit <= 0 {
+			limit = math.MaxInt32 // OFFSET requires a LIMIT in SQLite
+		}
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, filter.Offset)
+	}
+
+	rows, err := ts.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query todos: %w", err)
+	}
+	defer rows.Close()
+
+	var todos []Todo
+	for rows.Next() {
+		var todo Todo
+		if q.fts {
+			var match SearchMatch
+			todo, err = scanTodo(rows, &match.Title, &match.Description, &match.Score)
+			// bm25 scores are negative, with better matches further from zero
+			match.Score = -match.Score
+			// snippet() returns the start of the description even when only
+			// the title matched
+			if !strings.Contains(match.Description, HighlightStart) {
+				match.Description = ""
+			}
+			todo.Match = &match
+		} else {
+			todo, err = scanTodo(rows)
+			if len(q.terms) > 0 {
+				todo.Match = matchTodo(todo, q.terms)
+			}
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan todo: %w", err)
+		}
+		todos = append(todos, todo)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	if err := ts.attachTags(todos); err != nil {
+		return nil, 0, err
+	}
+
+	total := len(todos)
+	if paginated {
+		countQuery := "SELECT COUNT(*)" + todoFrom + q.joins + q.where()
+		if err := ts.db.QueryRow(countQuery, q.args...).Scan(&total); err != nil {
+			return nil, 0, fmt.Errorf("failed to count todos: %w", err)
+		}
+	}
+
+	return todos, total, nil
+}
+
+// todoQuery holds the parts of a todo listing query built from a filter
+type todoQuery struct {
+	columns    string // selected after todoColumns
+	joins      string
+	conditions []string
+	args       []any
+	rank       string // relevance ordering for searches
+	rankArgs   []any
+	terms      []string
+	fts        bool
+}
+
+// where returns the WHERE clause for the query's conditions
+func (q *todoQuery) where() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+// buildTodoQuery translates a filter into joins, conditions and arguments
+func buildTodoQuery(filter TodoFilter, db *database.DB) *todoQuery {
+	q := &todoQuery{}
+	like := db.Dialect.Like()
+
+	q.terms = searchTerms(filter.Search)
+	if filter.Query != nil {
+		q.terms = append(q.terms, filter.Query.TextTerms()...)
+		conditions, args := queryConditions(filter.Query, like)
+		q.conditions = append(q.conditions, conditions...)
+		q.args = append(q.args, args...)
+	}
+
+	if len(q.terms) > 0 {
+		if db.FullTextSearch && canUseFTS(q.terms) {
+			q.fts = true
+			q.columns = `,
+			highlight(todos_fts, 0, '` + HighlightStart + `', '` + HighlightEnd + `'),
+			snippet(todos_fts, 1, '` + HighlightStart + `', '` + HighlightEnd + `', '…', 16),
+			bm25(todos_fts, 2.0, 1.0)`
+			q.joins = " JOIN todos_fts ON todos_fts.rowid = t.id"
+			q.conditions = append(q.conditions, "todos_fts MATCH ?")
+			q.args = append(q.args, ftsMatchQuery(q.terms))
+			q.rank = "bm25(todos_fts, 2.0, 1.0) ASC"
+		} else {
+			// Without the index (PostgreSQL, SQLite without FTS5, or terms
+			// too short for trigrams) terms are matched with LIKE, ranking
+			// todos whose title contains the terms first
+			var titleMatches []string
+			for _, term := range q.terms {
+				pattern := likePattern(term)
+				q.conditions = append(q.conditions, "(t.title "+like+` ? ESCAPE '\' OR t.description `+like+` ? ESCAPE '\')`)
+				q.args = append(q.args, pattern, pattern)
+				titleMatches = append(titleMatches, "CASE WHEN t.title "+like+` ? ESCAPE '\' THEN 1 ELSE 0 END`)
+				q.rankArgs = append(q.rankArgs, pattern)
+			}
+			q.rank = "(" + strings.Join(titleMatches, " + ") + ") DESC"
+		}
+	}
+	if filter.NoCategory {
+		q.conditions = append(q.conditions, "t.category_id IS NULL")
+	} else if filter.CategoryID != nil {
+		q.conditions = append(q.conditions, "t.category_id = ?")
+		q.args = append(q.args, *filter.CategoryID)
+	}
+	if filter.NoParent {
+		q.conditions = append(q.conditions, "t.parent_id IS NULL")
+	} else if filter.ParentID != nil {
+		q.conditions = append(q.conditions, "t.parent_id = ?")
+		q.args = append(q.args, *filter.ParentID)
+	}
+	if filter.NoTags {
+		q.conditions = append(q.conditions, "NOT EXISTS (SELECT 1 FROM todo_tags tt WHERE tt.todo_id = t.id)")
+	} else {
+		for _, tagID := range filter.TagIDs {
+			q.conditions = append(q.conditions, "EXISTS (SELECT 1 FROM todo_tags tt WHERE tt.todo_id = t.id AND tt.tag_id = ?)")
+			q.args = append(q.args, tagID)
+		}
+	}
+	if filter.SeriesID != nil {
+		q.conditions = append(q.conditions, "t.series_id = ?")
+		q.args = append(q.args, *filter.SeriesID)
+	}
+	if filter.Priority != nil {
+		q.conditions = append(q.conditions, "t.priority = ?")
+		q.args = append(q.args, *filter.Priority)
+	}
+	if filter.Completed != nil {
+		q.conditions = append(q.conditions, "t.completed = ?")
+		q.args = append(q.args, *filter.Completed)
+	}
+	if filter.DueBefore != nil {
+		q.conditions = append(q.conditions, "t.due_date < ?")
+		q.args = append(q.args, filter.DueBefore.UTC())
+	}
+	if filter.DueAfter != nil {
+		q.conditions = append(q.conditions, "t.due_date >= ?")
+		q.args = append(q.args, filter.DueAfter.UTC())
+	}
+	if filter.HasDueDate != nil {
+		if *filter.HasDueDate {
+			q.conditions = append(q.conditions, "t.due_date IS NOT NULL")
+		} else {
+			q.conditions = append(q.conditions, "t.due_date IS NULL")
+		}
+	}
+	if filter.Overdue {
+		q.conditions = append(q.conditions, "t.completed = FALSE AND t.due_date < CURRENT_TIMESTAMP")
+	}
+	if filter.Archived {
+		q.conditions = append(q.conditions, "t.archived_at IS NOT NULL")
+	} else {
+		q.conditions = append(q.conditions, "t.archived_at IS NULL")
+	}
+	if filter.AfterID > 0 {
+		q.conditions = append(q.conditions, "t.id > ?")
+		q.args = append(q.args, filter.AfterID)
+	}
+
+	return q
+}
+
+// todoOrderBy turns a sort expression into an ORDER BY list
+func todoOrderBy(sort string) (string, error) {
+	fields, err := ParseTodoSort(sort)
+	if err != nil {
+		return "", err
+	}
+	if fields == nil {
+		return todoSmartOrder, nil
+	}
+
+	var parts []string
+	for _, field := range fields {
+		column := sortableTodoFields[field.Field]
+		direction := "ASC"
+		if field.Desc {
+			direction = "DESC"
+		}
+		if field.Field == "due_date" {
+			// Todos without a due date always go last
+			parts = append(parts, "t.due_date IS NULL ASC")
+		}
+		parts = append(parts, column+" "+direction)
+	}
+	// Keep pagination stable when sort keys tie
+	parts = append(parts, "t.id DESC")
+
+	return strings.Join(parts, ", "), nil
+}
+
+// Create adds a new TODO item to the database
+func (ts *TodoStore) Create(title string) (*Todo, error) {
+	query := `
+		INSERT INTO todos (title, description, category_id, priority, completed, owner_id, workspace_id, created_at, updated_at)
+		VALUES (?, '', NULL, 1, FALSE, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING id
+	`
+	
+	var id int
+	err := ts.db.QueryRow(query, title, ts.owner.userValue(), ts.owner.workspaceValue()).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create todo: %w", err)
+	}
+
+	// Retrieve the created todo
+	return ts.GetByID(id)
+}
+
+// CreateWithCategory adds a new TODO item with a category
+func (ts *TodoStore) CreateWithCategory(title string, categoryID *int) (*Todo, error) {
+	query := `
+		INSERT INTO todos (title, description, category_id, priority, completed, owner_id, workspace_id, created_at, updated_at)
+		VALUES (?, '', ?, 1, FALSE, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING id
+	`
+	
+	var id int
+	err := ts.db.QueryRow(query, title, categoryID, ts.owner.userValue(), ts.owner.workspaceValue()).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create todo: %w", err)
+	}
+
+	// Retrieve the created todo
+	return ts.GetByID(id)
+}
+
+// CreateWithCategoryAndPriority adds a new TODO item with category and priority
+func (ts *TodoStore) CreateWithCategoryAndPriority(title string, categoryID *int, priority int) (*Todo, error) {
+	// Validate priority range
+	if priority < 1 || priority > 3 {
+		priority = 1 // Default to low priority if invalid
+	}
+	
+	query := `
+		INSERT INTO todos (title, description, category_id, priority, due_date, completed, owner_id, workspace_id, created_at, updated_at)
+		VALUES (?, '', ?, ?, NULL, FALSE, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING id
+	`
+	
+	var id int
+	err := ts.db.QueryRow(query, title, categoryID, priority, ts.owner.userValue(), ts.owner.workspaceValue()).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create todo: %w", err)
+	}
+
+	// Retrieve the created todo
+	return ts.GetByID(id)
+}
+
+// CreateFull adds a new TODO item with all fields
+func (ts *TodoStore) CreateFull(title, description string, categoryID *int, priority int, dueDate *time.Time, tagIDs []int, rule *recurrence.Rule) (*Todo, error) {
+	return ts.Import(TodoImport{
+		Title:       title,
+		Description: description,
+		CategoryID:  categoryID,
+		Priority:    priority,
+		DueDate:     dueDate,
+		TagIDs:      tagIDs,
+		Rule:        rule,
+	})
+}
+
+// Import adds a TODO item with its completion and times, its tags and its
+// recurrence in one transaction
+func (ts *TodoStore) Import(todo TodoImport) (*Todo, error) {
+	id, err := ts.insertTodo(todo)
+	if err != nil {
+		return nil, err
+	}
+
+	// Retrieve the created todo
+	return ts.GetByID(id)
+}
+
+// insertTodo adds a TODO item, its tags and its recurrence in one transaction
+func (ts *TodoStore) insertTodo(todo TodoImport) (int, error) {
+	// Validate priority range
+	priority := todo.Priority
+	if priority < 1 || priority > 3 {
+		priority = 1 // Default to low priority if invalid
+	}
+	
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := ts.checkParent(tx, 0, todo.ParentID); err != nil {
+		return 0, err
+	}
+	if err := ts.checkCategory(tx, todo.CategoryID); err != nil {
+		return 0, err
+	}
+
+	query := `
+		INSERT INTO todos (title, description, category_id, priority, due_date, parent_id, completed, owner_id, workspace_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP), COALESCE(?, CURRENT_TIMESTAMP))
+		RETURNING id
+	`
+	
+	var id int
+	err = tx.QueryRow(query, todo.Title, todo.Description, todo.CategoryID, priority, todo.DueDate, todo.ParentID, todo.Completed,
+		ts.owner.userValue(), ts.owner.workspaceValue(), copyTime(todo.CreatedAt), copyTime(todo.UpdatedAt)).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create todo: %w", err)
+	}
+
+	// The todo starts its series, whose id is only known now
+	if todo.Rule != nil {
+		_, err = tx.Exec(`UPDATE todos SET recurrence = ?, series_id = id, occurrence = 1 WHERE id = ?`, todo.Rule.String(), id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to set recurrence: %w", err)
+		}
+	}
+
+	if len(todo.TagIDs) > 0 {
+		if err := setTodoTags(tx, ts.owner, id, todo.TagIDs); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to create todo: %w", err)
+	}
+
+	return id, nil
+}
+
+// GetByID retrieves a specific TODO item by ID
+func (ts *TodoStore) GetByID(id int) (*Todo, error) {
+	owner, args := ts.owner.filter("t")
+	todo, err := scanTodo(ts.db.QueryRow(todoSelect+" WHERE t.id = ? AND t.deleted_at IS NULL AND "+owner, append([]any{id}, args...)...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("todo not found")
+		}
+		return nil, fmt.Errorf("failed to get todo: %w", err)
+	}
+
+	todos := []Todo{todo}
+	if err := ts.attachTags(todos); err != nil {
+		return nil, err
+	}
+
+	return &todos[0], nil
+}
+
+// Toggle switches the completion status of a TODO item. Completing it also
+// completes its open subtasks at every depth and, for a recurring todo,
+// creates the next occurrence.
+func (ts *TodoStore) Toggle(id int) (*Todo, *Completion, error) {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	owner, args := ts.owner.filter("")
+	version, versionArgs := ts.versionFilter()
+	query := `
+		UPDATE todos 
+		SET completed = NOT completed, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = ? AND deleted_at IS NULL AND ` + owner + ` AND ` + version + `
+		RETURNING completed
+	`
+	
+	var completed bool
+	err = tx.QueryRow(query, append(append([]any{id}, args...), versionArgs...)...).Scan(&completed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, ts.notWritten(tx.QueryRow, id)
+		}
+		return nil, nil, fmt.Errorf("failed to toggle todo: %w", err)
+	}
+
+	var done completion
+	if completed {
+		if done, err = finishCompletion(tx, id); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to toggle todo: %w", err)
+	}
+
+	// Return the updated todo
+	todo, err := ts.GetByID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	changes, err := ts.loadCompletion(done)
+	if err != nil {
+		return nil, nil, err
+	}
+	return todo, changes, nil
+}
+
+// completion is what finishCompletion changed, read into a Completion by
+// loadCompletion once the transaction is committed
+type completion struct {
+	subtasks []Todo // the subtasks it completed, as they were
+	nextID   int    // the next occurrence it created, or 0
+}
+
+// finishCompletion completes the open subtasks of a just completed todo at
+// every depth and creates the next occurrence of a recurring one
+func finishCompletion(tx *database.Tx, id int) (completion, error) {
+	var done completion
+	subtasks, err := selectTodos(tx.Query, todoSubtree+todoSelect+`
+		WHERE t.id IN (SELECT id FROM subtree) AND t.completed = FALSE AND t.deleted_at IS NULL
+		ORDER BY `+todoSmartOrder, id)
+	if err != nil {
+		return done, fmt.Errorf("failed to query subtasks: %w", err)
+	}
+	done.subtasks = subtasks
+
+	if len(subtasks) > 0 {
+		ids := make([]int, len(subtasks))
+		for i, subtask := range subtasks {
+			ids[i] = subtask.ID
+		}
+		in, args := inClause(ids)
+		_, err = tx.Exec(`
+			UPDATE todos
+			SET completed = TRUE, updated_at = CURRENT_TIMESTAMP, version = version + 1
+			WHERE id IN (`+in+`)
+		`, args...)
+		if err != nil {
+			return done, fmt.Errorf("failed to complete subtasks: %w", err)
+		}
+	}
+
+	done.nextID, err = createNextOccurrence(tx, id)
+	return done, err
+}
+
+// loadCompletion reads the todos a completion changed as they are now
+func (ts *TodoStore) loadCompletion(done completion) (*Completion, error) {
+	changes := &Completion{}
+	ids := make([]int, 0, len(done.subtasks)+1)
+	for _, subtask := range done.subtasks {
+		ids = append(ids, subtask.ID)
+	}
+	if done.nextID != 0 {
+		ids = append(ids, done.nextID)
+	}
+	if len(ids) == 0 {
+		return changes, nil
+	}
+
+	in, args := inClause(ids)
+	todos, err := ts.queryTodos(todoSelect+` WHERE t.id IN (`+in+`) AND t.deleted_at IS NULL`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query completed todos: %w", err)
+	}
+	after := make(map[int]*Todo, len(todos))
+	for i := range todos {
+		after[todos[i].ID] = &todos[i]
+	}
+
+	for i := range done.subtasks {
+		if todo, ok := after[done.subtasks[i].ID]; ok {
+			changes.Subtasks = append(changes.Subtasks, TodoChange{Before: &done.subtasks[i], After: todo})
+		}
+	}
+	changes.Next = after[done.nextID]
+	return changes, nil
+}
+
+// Update modifies a TODO item's title, description, category, priority, due date and tags
+func (ts *TodoStore) Update(id int, title, description string, categoryID *int, priority *int, dueDate *time.Time, tagIDs []int) (*Todo, error) {
+	return ts.Edit(id, TodoEdit{
+		Title:       title,
+		Description: description,
+		CategoryID:  categoryID,
+		Priority:    priority,
+		DueDate:     dueDate,
+		TagIDs:      tagIDs,
+	})
+}
+
+// Edit modifies a TODO item's fields, parent and recurrence in one transaction
+func (ts *TodoStore) Edit(id int, edit TodoEdit) (*Todo, error) {
+	// Validate priority if provided
+	priority := edit.Priority
+	if priority != nil && (*priority < 1 || *priority > 3) {
+		defaultPriority := 1
+		priority = &defaultPriority
+	}
+	
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := ts.checkCategory(tx, edit.CategoryID); err != nil {
+		return nil, err
+	}
+
+	set := `title = ?, description = ?, category_id = ?, priority = COALESCE(?, priority), due_date = ?`
+	values := []any{edit.Title, edit.Description, edit.CategoryID, priority, edit.DueDate}
+	if edit.Move {
+		if err := ts.checkParent(tx, id, edit.ParentID); err != nil {
+			return nil, err
+		}
+		set += `, parent_id = ?`
+		values = append(values, edit.ParentID)
+	}
+	if edit.SetRecurrence {
+		if edit.Rule != nil {
+			// The first recurring todo starts the series
+			set += `, recurrence = ?, series_id = COALESCE(series_id, id), occurrence = COALESCE(occurrence, 1)`
+			values = append(values, edit.Rule.String())
+		} else {
+			set += `, recurrence = NULL`
+		}
+	}
+
+	owner, args := ts.owner.filter("")
+	version, versionArgs := ts.versionFilter()
+	query := `
+		UPDATE todos 
+		SET ` + set + `, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = ? AND deleted_at IS NULL AND ` + owner + ` AND ` + version
+	
+	result, err := tx.Exec(query, append(append(append(values, id), args...), versionArgs...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update todo: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return nil, ts.notWritten(tx.QueryRow, id)
+	}
+
+	if edit.TagIDs != nil {
+		if err := setTodoTags(tx, ts.owner, id, edit.TagIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to update todo: %w", err)
+	}
+
+	// Return the updated todo
+	return ts.GetByID(id)
+}
+
+// checkCategory reports a category that does not exist or belongs to
+// another user
+func (ts *TodoStore) checkCategory(tx *database.Tx, categoryID *int) error {
+	if categoryID == nil {
+		return nil
+	}
+
+	owner, args := ts.owner.filter("")
+	var count int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM categories WHERE id = ? AND `+owner, append([]any{*categoryID}, args...)...).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check category: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("category not found")
+	}
+	return nil
+}
+
+// setTodoTags replaces the tags of a todo with tags of o
+func setTodoTags(tx *database.Tx, o ownership, todoID int, tagIDs []int) error {
+	tagIDs = uniqueIDs(tagIDs)
+	if len(tagIDs) > 0 {
+		in, args := inClause(tagIDs)
+		owner, ownerArgs := o.filter("")
+		var count int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM tags WHERE id IN (`+in+`) AND `+owner, append(args, ownerArgs...)...).Scan(&count); err != nil {
+			return fmt.Errorf("failed to check tags: %w", err)
+		}
+		if count != len(tagIDs) {
+			return fmt.Errorf("tag not found")
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM todo_tags WHERE todo_id = ?`, todoID); err != nil {
+		return fmt.Errorf("failed to update tags: %w", err)
+	}
+	for _, tagID := range tagIDs {
+		if _, err := tx.Exec(`INSERT INTO todo_tags (todo_id, tag_id) VALUES (?, ?)`, todoID, tagID); err != nil {
+			return fmt.Errorf("failed to update tags: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// attachTags loads the tags of the given todos, ordered by name
+func (ts *TodoStore) attachTags(todos []Todo) error {
+	return loadTags(ts.db.Query, todos)
+}
+
+// loadTags is attachTags through run
+func loadTags(run queryFunc, todos []Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+
+	index := make(map[int]int, len(todos))
+	ids := make([]int, len(todos))
+	for i := range todos {
+		todos[i].Tags = []Tag{}
+		index[todos[i].ID] = i
+		ids[i] = todos[i].ID
+	}
+
+	in, args := inClause(ids)
+	rows, err := run(`
+		SELECT tt.todo_id, g.id, g.name, g.color
+		FROM todo_tags tt
+		JOIN tags g ON g.id = tt.tag_id
+		WHERE tt.todo_id IN (`+in+`)
+		ORDER BY g.name ASC
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query tags: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var todoID int
+		var tag Tag
+		if err := rows.Scan(&todoID, &tag.ID, &tag.Name, &tag.Color); err != nil {
+			return fmt.Errorf("failed to scan tag: %w", err)
+		}
+		i := index[todoID]
+		todos[i].Tags = append(todos[i].Tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return nil
+}
+
+// inClause returns the placeholders and arguments for an IN (...) list of ids
+func inClause(ids []int) (string, []any) {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", "), args
+}
+
+// uniqueIDs drops repeated ids, keeping the first occurrence of each
+func uniqueIDs(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	var unique []int
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// Delete moves a TODO item that has no subtasks to the trash
+func (ts *TodoStore) Delete(id int) error {
+	// Check if the todo has subtasks
+	owner, args := ts.owner.filter("")
+	var count int
+	err := ts.db.QueryRow(`SELECT COUNT(*) FROM todos WHERE parent_id = ? AND deleted_at IS NULL AND `+owner, append([]any{id}, args...)...).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check subtasks: %w", err)
+	}
+	
+	if count > 0 {
+		return fmt.Errorf("todo has subtasks (%d)", count)
+	}
+
+	return ts.DeleteTree(id)
+}
+
+// DeleteTree moves a TODO item and all of its subtasks to the trash
+func (ts *TodoStore) DeleteTree(id int) error {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Written like the argument of PurgeDeletedBefore, so that they compare on SQLite
+	if err := ts.trashTree(tx, id, time.Now().UTC().Truncate(time.Second)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to delete todo: %w", err)
+	}
+
+	return nil
+}
+
+// trashTree moves a todo and the subtasks that are not in the trash yet to it
+func (ts *TodoStore) trashTree(tx *database.Tx, id int, deletedAt time.Time) error {
+	owner, args := ts.owner.filter("")
+	version, versionArgs := ts.versionFilter()
+	query := `UPDATE todos SET deleted_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NULL AND ` + owner + ` AND ` + version
+
+	result, err := tx.Exec(query, append(append([]any{deletedAt, id}, args...), versionArgs...)...)
+	if err != nil {
+		return fmt.Errorf("failed to delete todo: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ts.notWritten(tx.QueryRow, id)
+	}
+
+	// Subtasks already in the trash keep their own deletion time
+	_, err = tx.Exec(todoSubtree+`
+		UPDATE todos SET deleted_at = ?, version = version + 1
+		WHERE deleted_at IS NULL AND id IN (SELECT id FROM subtree)
+	`, id, deletedAt)
+	if err != nil {
+		return fmt.Errorf("failed to delete subtasks: %w", err)
+	}
+
+	return nil
+}
+
+// Trash retrieves the TODO items in the trash that were not deleted along
+// with their parent, most recently deleted first
+func (ts *TodoStore) Trash() ([]Todo, error) {
+	owner, args := ts.owner.filter("t")
+	todos, err := ts.queryTodos(todoSelect+`
+		WHERE t.deleted_at IS NOT NULL AND `+owner+`
+			AND NOT EXISTS (SELECT 1 FROM todos p WHERE p.id = t.parent_id AND p.deleted_at IS NOT NULL)
+		ORDER BY t.deleted_at DESC, t.id DESC
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trash: %w", err)
+	}
+	return todos, nil
+}
+
+// queryFunc runs a query on a database or in a transaction
+type queryFunc func(query string, args ...any) (*sql.Rows, error)
+
+// queryTodos runs a todoSelect query and attaches the tags of the todos
+func (ts *TodoStore) queryTodos(query string, args ...any) ([]Todo, error) {
+	return selectTodos(ts.db.Query, query, args...)
+}
+
+// selectTodos is queryTodos through run, such as the Query method of a
+// transaction
+func selectTodos(run queryFunc, query string, args ...any) ([]Todo, error) {
+	rows, err := run(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	todos := []Todo{}
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan todo: %w", err)
+		}
+		todos = append(todos, todo)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	if err := loadTags(run, todos); err != nil {
+		return nil, err
+	}
+
+	return todos, nil
+}
+
+// Restore takes a TODO item out of the trash with the subtasks deleted along with it
+func (ts *TodoStore) Restore(id int) ([]Todo, error) {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	owner, args := ts.owner.filter("t")
+	var deletedAt time.Time
+	var parentDeleted bool
+	err = tx.QueryRow(`
+		SELECT t.deleted_at, p.deleted_at IS NOT NULL
+		FROM todos t
+		LEFT JOIN todos p ON p.id = t.parent_id
+		WHERE t.id = ? AND t.deleted_at IS NOT NULL AND `+owner, append([]any{id}, args...)...).Scan(&deletedAt, &parentDeleted)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("todo not found")
+		}
+		return nil, fmt.Errorf("failed to get todo: %w", err)
+	}
+	if parentDeleted {
+		return nil, fmt.Errorf("parent todo is in the trash")
+	}
+
+	// Subtasks deleted before the todo were deleted on their own and stay
+	_, err = tx.Exec(todoSubtree+`
+		UPDATE todos SET deleted_at = NULL, version = version + 1
+		WHERE id = ? OR (deleted_at >= ? AND id IN (SELECT id FROM subtree))
+	`, id, id, deletedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore todo: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to restore todo: %w", err)
+	}
+
+	todo, err := ts.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	subtasks, err := ts.Descendants(id)
+	if err != nil {
+		return nil, err
+	}
+	return append([]Todo{*todo}, subtasks...), nil
+}
+
+// Purge permanently removes a TODO item in the trash and its subtasks
+func (ts *TodoStore) Purge(id int) error {
+	// parent_id cascades, taking the subtasks with it
+	owner, args := ts.owner.filter("")
+	query := `DELETE FROM todos WHERE id = ? AND deleted_at IS NOT NULL AND ` + owner
+	
+	result, err := ts.db.Exec(query, append([]any{id}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to purge todo: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("todo not found")
+	}
+
+	return nil
+}
+
+// PurgeDeletedBefore permanently removes the TODO items deleted before t
+func (ts *TodoStore) PurgeDeletedBefore(t time.Time) (int, error) {
+	owner, args := ts.owner.filter("")
+	result, err := ts.db.Exec(`DELETE FROM todos WHERE deleted_at < ? AND `+owner,
+		append([]any{t.UTC().Truncate(time.Second)}, args...)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge trash: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return int(rowsAffected), nil
+}
+
+// Archive archives the completed top-level TODO items matching the filter
+// whose subtasks are all completed, together with those subtasks
+func (ts *TodoStore) Archive(filter ArchiveFilter) ([]Todo, error) {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	owner, args := ts.owner.filter("t")
+	conditions := []string{owner}
+	if filter.CategoryID != nil {
+		conditions = append(conditions, "t.category_id = ?")
+		args = append(args, *filter.CategoryID)
+	}
+	if filter.UpdatedBefore != nil {
+		conditions = append(conditions, "t.updated_at < ?")
+		args = append(args, filter.UpdatedBefore.UTC())
+	}
+
+	// busy holds every todo with an open subtask at any depth
+	rows, err := tx.Query(`
+		WITH RECURSIVE busy(id) AS (
+			SELECT parent_id FROM todos WHERE parent_id IS NOT NULL AND completed = FALSE AND deleted_at IS NULL
+			UNION
+			SELECT t.parent_id FROM todos t JOIN busy ON t.id = busy.id WHERE t.parent_id IS NOT NULL
+		)
+		SELECT t.id FROM todos t
+		WHERE t.parent_id IS NULL AND t.completed = TRUE AND t.archived_at IS NULL AND t.deleted_at IS NULL
+			AND t.id NOT IN (SELECT id FROM busy) AND `+strings.Join(conditions, " AND "), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query completed todos: %w", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan todo: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	if len(ids) == 0 {
+		return []Todo{}, nil
+	}
+
+	in, inArgs := inClause(ids)
+	_, err = tx.Exec(`
+		WITH RECURSIVE tree(id) AS (
+			SELECT id FROM todos WHERE id IN (`+in+`)
+			UNION
+			SELECT t.id FROM todos t JOIN tree ON t.parent_id = tree.id
+		)
+		UPDATE todos SET archived_at = ?, version = version + 1
+		WHERE deleted_at IS NULL AND id IN (SELECT id FROM tree)
+	`, append(inArgs, time.Now().UTC().Truncate(time.Second))...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to archive todos: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to archive todos: %w", err)
+	}
+
+	todos, err := ts.queryTodos(todoSelect+` WHERE t.id IN (`+in+`) ORDER BY `+todoSmartOrder, inArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query archived todos: %w", err)
+	}
+	return todos, nil
+}
+
+// Unarchive brings an archived TODO item and its subtasks back to the active list
+func (ts *TodoStore) Unarchive(id int) (*Todo, error) {
+	owner, args := ts.owner.filter("t")
+	var archived, parentArchived bool
+	err := ts.db.QueryRow(`
+		SELECT t.archived_at IS NOT NULL, p.archived_at IS NOT NULL
+		FROM todos t
+		LEFT JOIN todos p ON p.id = t.parent_id
+		WHERE t.id = ? AND t.deleted_at IS NULL AND `+owner, append([]any{id}, args...)...).Scan(&archived, &parentArchived)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("todo not found")
+		}
+		return nil, fmt.Errorf("failed to get todo: %w", err)
+	}
+	if parentArchived {
+		return nil, fmt.Errorf("todo is archived with its parent")
+	}
+
+	if archived {
+		_, err = ts.db.Exec(todoSubtree+`
+			UPDATE todos SET archived_at = NULL, version = version + 1
+			WHERE id = ? OR id IN (SELECT id FROM subtree)
+		`, id, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unarchive todo: %w", err)
+		}
+	}
+
+	return ts.GetByID(id)
+}
+
+// Bulk applies a change to the given TODO items in a single transaction
+func (ts *TodoStore) Bulk(ids []int, change BulkChange) ([]BulkResult, error) {
+	ids = uniqueIDs(ids)
+	results := make([]BulkResult, len(ids))
+	if len(ids) == 0 {
+		return results, nil
+	}
+
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The todos as they were decide what to change and go to the audit log.
+	// They are read in the transaction, so that they are the todos it changes.
+	in, args := inClause(ids)
+	owner, ownerArgs := ts.owner.filter("t")
+	current, err := selectTodos(tx.Query, todoSelect+` WHERE t.id IN (`+in+`) AND t.deleted_at IS NULL AND `+owner, append(args, ownerArgs...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query todos: %w", err)
+	}
+	before := make(map[int]*Todo, len(current))
+	for i := range current {
+		before[current[i].ID] = &current[i]
+	}
+
+	if change.Action == BulkSetCategory {
+		if err := ts.checkCategory(tx, change.CategoryID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Written like the argument of PurgeDeletedBefore, so that they compare on SQLite
+	now := time.Now().UTC().Truncate(time.Second)
+	var changed []int
+	completions := make([]completion, len(ids))
+	for i, id := range ids {
+		results[i] = BulkResult{ID: id, Status: BulkNotFound}
+		todo, ok := before[id]
+		if !ok {
+			continue
+		}
+		results[i].Before = todo
+
+		applied, err := ts.applyBulkChange(tx, todo, change, now, &completions[i])
+		if err != nil {
+			return nil, err
+		}
+		if !applied {
+			results[i].Status = BulkUnchanged
+			continue
+		}
+		results[i].Status = BulkOK
+		changed = append(changed, id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to apply bulk change: %w", err)
+	}
+
+	if len(changed) > 0 {
+		in, args := inClause(changed)
+		todos, err := ts.queryTodos(todoSelect+` WHERE t.id IN (`+in+`) AND t.deleted_at IS NULL`, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query changed todos: %w", err)
+		}
+		after := make(map[int]*Todo, len(todos))
+		for i := range todos {
+			after[todos[i].ID] = &todos[i]
+		}
+		for i := range results {
+			results[i].Todo = after[results[i].ID]
+		}
+	}
+
+	if change.Action == BulkComplete {
+		for i := range results {
+			if results[i].Status != BulkOK {
+				continue
+			}
+			if results[i].Completion, err = ts.loadCompletion(completions[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// applyBulkChange makes a bulk change to one todo, reporting whether there
+// was anything to change. Completing a todo fills in done.
+func (ts *TodoStore) applyBulkChange(tx *database.Tx, todo *Todo, change BulkChange, now time.Time, done *completion) (bool, error) {
+	var column string
+	var value any
+	switch change.Action {
+	case BulkComplete, BulkReopen:
+		completed := change.Action == BulkComplete
+		if todo.Completed == completed {
+			return false, nil
+		}
+		column, value = "completed", completed
+	case BulkDelete:
+		// A subtask listed after its parent is already in the trash with it
+		if err := ts.trashTree(tx, todo.ID, now); err != nil && !strings.Contains(err.Error(), "not found") {
+			return false, err
+		}
+		return true, nil
+	case BulkSetCategory:
+		if sameInt(todo.CategoryID, change.CategoryID) {
+			return false, nil
+		}
+		column, value = "category_id", change.CategoryID
+	case BulkSetPriority:
+		priority := change.Priority
+		if priority < 1 || priority > 3 {
+			priority = 1
+		}
+		if todo.Priority == priority {
+			return false, nil
+		}
+		column, value = "priority", priority
+	case BulkShiftDue:
+		if todo.DueDate == nil || change.Days == 0 {
+			return false, nil
+		}
+		column, value = "due_date", todo.DueDate.AddDate(0, 0, change.Days)
+	default:
+		return false, fmt.Errorf("unknown bulk action %q", change.Action)
+	}
+
+	_, err := tx.Exec(`UPDATE todos SET `+column+` = ?, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = ?`, value, todo.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update todo: %w", err)
+	}
+
+	if change.Action == BulkComplete {
+		if *done, err = finishCompletion(tx, todo.ID); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// todoSubtree is a WITH clause selecting the ids of every todo below the
+// todo given as its argument
+const todoSubtree = `
+		WITH RECURSIVE subtree(id) AS (
+			SELECT id FROM todos WHERE parent_id = ?
+			UNION
+			SELECT t.id FROM todos t JOIN subtree ON t.parent_id = subtree.id
+		)`
+
+// CreateSubtask adds a new TODO item under an existing one
+func (ts *TodoStore) CreateSubtask(parentID int, title, description string, categoryID *int, priority int, dueDate *time.Time, tagIDs []int, rule *recurrence.Rule) (*Todo, error) {
+	return ts.Import(TodoImport{
+		Title:       title,
+		Description: description,
+		CategoryID:  categoryID,
+		Priority:    priority,
+		DueDate:     dueDate,
+		TagIDs:      tagIDs,
+		ParentID:    &parentID,
+		Rule:        rule,
+	})
+}
+
+// checkParent reports a parent that does not exist, or that would put a
+// TODO item under itself or one of its subtasks. A nil parent is fine.
+func (ts *TodoStore) checkParent(tx *database.Tx, id int, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+
+	owner, ownerArgs := ts.owner.filter("")
+	var exists int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM todos WHERE id = ? AND deleted_at IS NULL AND `+owner, append([]any{*parentID}, ownerArgs...)...).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check parent todo: %w", err)
+	}
+	if exists == 0 {
+		return fmt.Errorf("parent todo not found")
+	}
+
+	// The new parent must not be the todo itself or one of its subtasks
+	var cycles int
+	err := tx.QueryRow(todoSubtree+`
+		SELECT COUNT(*) FROM subtree WHERE id = ?
+	`, id, *parentID).Scan(&cycles)
+	if err != nil {
+		return fmt.Errorf("failed to check subtasks: %w", err)
+	}
+	if cycles > 0 || *parentID == id {
+		return fmt.Errorf("todo cycle: a todo cannot be moved under itself or its subtasks")
+	}
+	return nil
+}
+
+// Descendants retrieves every TODO item below the given ones
+func (ts *TodoStore) Descendants(ids ...int) ([]Todo, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	in, args := inClause(ids)
+	owner, ownerArgs := ts.owner.filter("t")
+	query := `
+		WITH RECURSIVE subtree(id) AS (
+			SELECT id FROM todos WHERE parent_id IN (` + in + `)
+			UNION
+			SELECT t.id FROM todos t JOIN subtree ON t.parent_id = subtree.id
+		)` + todoSelect + `
+		WHERE t.id IN (SELECT id FROM subtree) AND t.deleted_at IS NULL AND ` + owner + `
+		ORDER BY ` + todoSmartOrder
+
+	todos, err := ts.queryTodos(query, append(args, ownerArgs...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subtasks: %w", err)
+	}
+	return todos, nil
+}
+
+// SetRecurrence sets or clears the recurrence rule of a TODO item
+func (ts *TodoStore) SetRecurrence(id int, rule *recurrence.Rule) (*Todo, error) {
+	owner, args := ts.owner.filter("")
+	version, versionArgs := ts.versionFilter()
+	owner += " AND " + version
+	args = append(args, versionArgs...)
+	var result sql.Result
+	var err error
+	if rule != nil {
+		// The first recurring todo starts the series
+		result, err = ts.db.Exec(`
+			UPDATE todos
+			SET recurrence = ?, series_id = COALESCE(series_id, id), occurrence = COALESCE(occurrence, 1),
+				updated_at = CURRENT_TIMESTAMP, version = version + 1
+			WHERE id = ? AND deleted_at IS NULL AND `+owner, append([]any{rule.String(), id}, args...)...)
+	} else {
+		result, err = ts.db.Exec(`
+			UPDATE todos
+			SET recurrence = NULL, updated_at = CURRENT_TIMESTAMP, version = version + 1
+			WHERE id = ? AND deleted_at IS NULL AND `+owner, append([]any{id}, args...)...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to set recurrence: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return nil, ts.notWritten(ts.db.QueryRow, id)
+	}
+
+	return ts.GetByID(id)
+}
+
+// createNextOccurrence adds the occurrence following a just completed
+// recurring todo, copying its fields, tags and relative reminders, and
+// returns its id, or 0 when there is none
+func createNextOccurrence(tx *database.Tx, id int) (int, error) {
+	var title, description string
+	var categoryID, parentID, seriesID, occurrence, ownerID, workspaceID sql.NullInt64
+	var priority int
+	var rule sql.NullString
+	var dueDate sql.NullTime
+	err := tx.QueryRow(`
+		SELECT title, description, category_id, priority, parent_id, recurrence, series_id, occurrence, due_date, owner_id, workspace_id
+		FROM todos WHERE id = ?
+	`, id).Scan(&title, &description, &categoryID, &priority, &parentID, &rule, &seriesID, &occurrence, &dueDate, &ownerID, &workspaceID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get recurrence: %w", err)
+	}
+	if !rule.Valid {
+		return 0, nil
+	}
+
+	// Completing the same occurrence again must not start a second branch
+	var later int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM todos WHERE series_id = ? AND occurrence > ?
+	`, seriesID, occurrence).Scan(&later)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check occurrences: %w", err)
+	}
+	if later > 0 {
+		return 0, nil
+	}
+
+	var due *time.Time
+	if dueDate.Valid {
+		due = &dueDate.Time
+	}
+	next, ok, err := nextDueDate(rule.String, due, int(occurrence.Int64), time.Now())
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	var nextID int
+	err = tx.QueryRow(`
+		INSERT INTO todos (title, description, category_id, priority, due_date, parent_id,
+			recurrence, series_id, occurrence, owner_id, workspace_id, completed, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, FALSE, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING id
+	`, title, description, categoryID, priority, next, parentID,
+		rule.String, seriesID, occurrence.Int64+1, ownerID, workspaceID).Scan(&nextID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create next occurrence: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO todo_tags (todo_id, tag_id)
+		SELECT ?, tag_id FROM todo_tags WHERE todo_id = ?
+	`, nextID, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to copy tags: %w", err)
+	}
+
+	// Reminders at a fixed time belong to this occurrence only
+	_, err = tx.Exec(`
+		INSERT INTO reminders (todo_id, minutes_before, created_at)
+		SELECT ?, minutes_before, CURRENT_TIMESTAMP FROM reminders
+		WHERE todo_id = ? AND minutes_before IS NOT NULL
+	`, nextID, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to copy reminders: %w", err)
+	}
+
+	return nextID, nil
+}
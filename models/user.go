@@ -0,0 +1,278 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"gotodo/database"
+)
+
+// User is an account; todos, categories, tags and webhooks belong to a user
+type User struct {
+	ID           int       `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// UserRepository stores accounts, their login sessions and their API
+// tokens. Sessions and tokens are identified by a hash of their token.
+//
+// Implementations report missing users, unknown or expired sessions and
+// unknown API tokens with an error containing "not found", a taken
+// username with one containing "UNIQUE constraint failed: users.username"
+// and a taken identity with one containing "UNIQUE constraint failed:
+// user_identities". A new user gets the default categories.
+type UserRepository interface {
+	Create(username, passwordHash string) (*User, error)
+	// CreateWithIdentity adds a user without a password who signs in
+	// through an OpenID Connect provider as subject of issuer
+	CreateWithIdentity(username, issuer, subject string) (*User, error)
+	GetByID(id int) (*User, error)
+	GetByUsername(username string) (*User, error)
+	// GetByIdentity returns the user who signs in as subject of issuer
+	GetByIdentity(issuer, subject string) (*User, error)
+
+	CreateSession(userID int, tokenHash string, expiresAt time.Time) error
+	// SessionUser returns the user of a session that has not expired at now
+	SessionUser(tokenHash string, now time.Time) (*User, error)
+	DeleteSession(tokenHash string) error
+	// DeleteExpiredSessions removes the sessions that expired before now
+	DeleteExpiredSessions(now time.Time) error
+
+	CreateAPIToken(userID int, name, tokenHash string, scopes []string) (*APIToken, error)
+	// APITokens returns the API tokens of a user, oldest first
+	APITokens(userID int) ([]APIToken, error)
+	DeleteAPIToken(userID, id int) error
+	// APITokenUser returns the user and the token of a token hash, and
+	// records that the token was used at now
+	APITokenUser(tokenHash string, now time.Time) (*User, *APIToken, error)
+}
+
+// UserStore manages users and sessions in an SQL database (SQLite or PostgreSQL)
+type UserStore struct {
+	db *database.DB
+}
+
+// NewUserStore creates a new UserStore backed by db
+func NewUserStore(db *database.DB) *UserStore {
+	return &UserStore{db: db}
+}
+
+var _ UserRepository = (*UserStore)(nil)
+
+// errDuplicateUsername and errDuplicateIdentity report a taken username or
+// identity in the same words on every backend
+var (
+	errDuplicateUsername = errors.New("UNIQUE constraint failed: users.username")
+	errDuplicateIdentity = errors.New("UNIQUE constraint failed: user_identities.issuer, user_identities.subject")
+)
+
+// ownedTables are the tables with an owner_id column
+var ownedTables = []string{"todos", "categories", "tags", "webhooks"}
+
+// ownership is whose rows a store works on: the personal rows of a user
+// (owner_id) or the shared rows of a workspace (workspace_id), which have no
+// owner_id. Stores for the zero ownership are not limited to either; the
+// background jobs use them.
+type ownership struct {
+	userID      int
+	workspaceID int
+}
+
+// filter returns an SQL condition limiting the rows of table (an alias, or
+// "" for none) to those of o, and its arguments
+func (o ownership) filter(table string) (string, []any) {
+	if table != "" {
+		table += "."
+	}
+	switch {
+	case o.workspaceID != 0:
+		return table + "workspace_id = ?", []any{o.workspaceID}
+	case o.userID != 0:
+		return table + "owner_id = ?", []any{o.userID}
+	}
+	return "1 = 1", nil
+}
+
+// userValue and workspaceValue return what a store for o writes to the
+// owner_id and workspace_id columns
+func (o ownership) userValue() any {
+	if o.userID == 0 || o.workspaceID != 0 {
+		return nil
+	}
+	return o.userID
+}
+
+func (o ownership) workspaceValue() any {
+	if o.workspaceID == 0 {
+		return nil
+	}
+	return o.workspaceID
+}
+
+// owns reports whether a row of the memory store owned by row is visible
+// to a store for o
+func (o ownership) owns(row ownership) bool {
+	return o == ownership{} || o == row
+}
+
+// userIdentity is the OpenID Connect identity of a user
+type userIdentity struct {
+	issuer  string
+	subject string
+}
+
+// Create adds a user with the default categories. The first user also
+// takes over everything created before there were accounts.
+func (us *UserStore) Create(username, passwordHash string) (*User, error) {
+	return us.create(username, passwordHash, nil)
+}
+
+// CreateWithIdentity is Create for a user of an OpenID Connect provider,
+// who has no password
+func (us *UserStore) CreateWithIdentity(username, issuer, subject string) (*User, error) {
+	return us.create(username, "", &userIdentity{issuer: issuer, subject: subject})
+}
+
+func (us *UserStore) create(username, passwordHash string, identity *userIdentity) (*User, error) {
+	tx, err := us.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO users (username, password_hash, created_at, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING id
+	`, username, passwordHash).Scan(&id)
+	if err != nil {
+		if database.IsUniqueViolation(err) {
+			return nil, fmt.Errorf("failed to create user: %w", errDuplicateUsername)
+		}
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	var others int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM users WHERE id <> ?`, id).Scan(&others); err != nil {
+		return nil, fmt.Errorf("failed to count users: %w", err)
+	}
+	if others == 0 {
+		for _, table := range ownedTables {
+			if _, err := tx.Exec(`UPDATE `+table+` SET owner_id = ? WHERE owner_id IS NULL`, id); err != nil {
+				return nil, fmt.Errorf("failed to assign %s: %w", table, err)
+			}
+		}
+	}
+
+	if identity != nil {
+		_, err := tx.Exec(`
+			INSERT INTO user_identities (user_id, issuer, subject, created_at)
+			VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		`, id, identity.issuer, identity.subject)
+		if err != nil {
+			if database.IsUniqueViolation(err) {
+				return nil, fmt.Errorf("failed to create user identity: %w", errDuplicateIdentity)
+			}
+			return nil, fmt.Errorf("failed to create user identity: %w", err)
+		}
+	}
+
+	if err := seedDefaultCategories(tx, ownership{userID: id}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return us.GetByID(id)
+}
+
+// getUser retrieves the user matching a condition
+func (us *UserStore) getUser(where string, args ...any) (*User, error) {
+	var user User
+	err := us.db.QueryRow(`
+		SELECT id, username, password_hash, created_at, updated_at
+		FROM users
+		WHERE `+where, args...).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// GetByID retrieves a specific user
+func (us *UserStore) GetByID(id int) (*User, error) {
+	return us.getUser("id = ?", id)
+}
+
+// GetByUsername retrieves the user with a username
+func (us *UserStore) GetByUsername(username string) (*User, error) {
+	return us.getUser("username = ?", username)
+}
+
+// GetByIdentity retrieves the user who signs in as subject of issuer
+func (us *UserStore) GetByIdentity(issuer, subject string) (*User, error) {
+	return us.getUser("id = (SELECT user_id FROM user_identities WHERE issuer = ? AND subject = ?)", issuer, subject)
+}
+
+// CreateSession stores a new session
+func (us *UserStore) CreateSession(userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := us.db.Exec(`
+		INSERT INTO sessions (id, user_id, created_at, expires_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP, ?)
+	`, tokenHash, userID, expiresAt.UTC().Truncate(time.Second))
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+// SessionUser returns the user of an unexpired session
+func (us *UserStore) SessionUser(tokenHash string, now time.Time) (*User, error) {
+	var user User
+	var expiresAt time.Time
+	err := us.db.QueryRow(`
+		SELECT u.id, u.username, u.password_hash, u.created_at, u.updated_at, s.expires_at
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.id = ?
+	`, tokenHash).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt, &expiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("session not found")
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	if !expiresAt.After(now) {
+		return nil, fmt.Errorf("session not found")
+	}
+
+	return &user, nil
+}
+
+// DeleteSession removes a session; removing an unknown one is not an error
+func (us *UserStore) DeleteSession(tokenHash string) error {
+	if _, err := us.db.Exec(`DELETE FROM sessions WHERE id = ?`, tokenHash); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredSessions removes the sessions that expired before now
+func (us *UserStore) DeleteExpiredSessions(now time.Time) error {
+	if _, err := us.db.Exec(`DELETE FROM sessions WHERE expires_at < ?`, now.UTC().Truncate(time.Second)); err != nil {
+		return fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+	return nil
+}
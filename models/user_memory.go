@@ -0,0 +1,233 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// memorySession is a login session of the memory store
+type memorySession struct {
+	userID    int
+	expiresAt time.Time
+}
+
+// MemoryUserStore manages users and sessions in memory
+type MemoryUserStore struct {
+	db *MemoryDB
+}
+
+// NewMemoryUserStore creates a new UserRepository backed by db
+func NewMemoryUserStore(db *MemoryDB) *MemoryUserStore {
+	return &MemoryUserStore{db: db}
+}
+
+var _ UserRepository = (*MemoryUserStore)(nil)
+
+// Create adds a user with the default categories
+func (us *MemoryUserStore) Create(username, passwordHash string) (*User, error) {
+	return us.create(username, passwordHash, nil)
+}
+
+// CreateWithIdentity is Create for a user of an OpenID Connect provider,
+// who has no password
+func (us *MemoryUserStore) CreateWithIdentity(username, issuer, subject string) (*User, error) {
+	return us.create(username, "", &userIdentity{issuer: issuer, subject: subject})
+}
+
+func (us *MemoryUserStore) create(username, passwordHash string, identity *userIdentity) (*User, error) {
+	us.db.mu.Lock()
+	defer us.db.mu.Unlock()
+
+	for _, user := range us.db.users {
+		if user.Username == username {
+			return nil, fmt.Errorf("failed to create user: %w", errDuplicateUsername)
+		}
+	}
+	if identity != nil {
+		if _, ok := us.db.identities[*identity]; ok {
+			return nil, fmt.Errorf("failed to create user identity: %w", errDuplicateIdentity)
+		}
+	}
+
+	now := memoryNow()
+	user := User{
+		ID:           us.db.nextUserID,
+		Username:     username,
+		PasswordHash: passwordHash,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	us.db.users[user.ID] = user
+	us.db.nextUserID++
+	if identity != nil {
+		us.db.identities[*identity] = user.ID
+	}
+	us.db.seedDefaultCategories(ownership{userID: user.ID})
+
+	return &user, nil
+}
+
+// GetByID returns a specific user
+func (us *MemoryUserStore) GetByID(id int) (*User, error) {
+	us.db.mu.RLock()
+	defer us.db.mu.RUnlock()
+
+	user, ok := us.db.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+	return &user, nil
+}
+
+// GetByUsername returns the user with a username
+func (us *MemoryUserStore) GetByUsername(username string) (*User, error) {
+	us.db.mu.RLock()
+	defer us.db.mu.RUnlock()
+
+	for _, user := range us.db.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+// GetByIdentity returns the user who signs in as subject of issuer
+func (us *MemoryUserStore) GetByIdentity(issuer, subject string) (*User, error) {
+	us.db.mu.RLock()
+	defer us.db.mu.RUnlock()
+
+	userID, ok := us.db.identities[userIdentity{issuer: issuer, subject: subject}]
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+	user := us.db.users[userID]
+	return &user, nil
+}
+
+// CreateSession stores a new session
+func (us *MemoryUserStore) CreateSession(userID int, tokenHash string, expiresAt time.Time) error {
+	us.db.mu.Lock()
+	defer us.db.mu.Unlock()
+
+	if _, ok := us.db.users[userID]; !ok {
+		return fmt.Errorf("failed to create session: FOREIGN KEY constraint failed")
+	}
+	us.db.sessions[tokenHash] = memorySession{userID: userID, expiresAt: expiresAt}
+
+	return nil
+}
+
+// SessionUser returns the user of an unexpired session
+func (us *MemoryUserStore) SessionUser(tokenHash string, now time.Time) (*User, error) {
+	us.db.mu.RLock()
+	defer us.db.mu.RUnlock()
+
+	session, ok := us.db.sessions[tokenHash]
+	if !ok || !session.expiresAt.After(now) {
+		return nil, fmt.Errorf("session not found")
+	}
+	user := us.db.users[session.userID]
+	return &user, nil
+}
+
+// DeleteSession removes a session
+func (us *MemoryUserStore) DeleteSession(tokenHash string) error {
+	us.db.mu.Lock()
+	defer us.db.mu.Unlock()
+
+	delete(us.db.sessions, tokenHash)
+	return nil
+}
+
+// DeleteExpiredSessions removes the sessions that expired before now
+func (us *MemoryUserStore) DeleteExpiredSessions(now time.Time) error {
+	us.db.mu.Lock()
+	defer us.db.mu.Unlock()
+
+	for tokenHash, session := range us.db.sessions {
+		if session.expiresAt.Before(now) {
+			delete(us.db.sessions, tokenHash)
+		}
+	}
+	return nil
+}
+
+// CreateAPIToken stores a new API token of a user
+func (us *MemoryUserStore) CreateAPIToken(userID int, name, tokenHash string, scopes []string) (*APIToken, error) {
+	us.db.mu.Lock()
+	defer us.db.mu.Unlock()
+
+	if _, ok := us.db.users[userID]; !ok {
+		return nil, fmt.Errorf("failed to create API token: FOREIGN KEY constraint failed")
+	}
+	for _, token := range us.db.apiTokens {
+		if token.tokenHash == tokenHash {
+			return nil, fmt.Errorf("failed to create API token: UNIQUE constraint failed: api_tokens.token_hash")
+		}
+	}
+
+	token := APIToken{
+		ID:        us.db.nextAPITokenID,
+		Name:      name,
+		Scopes:    append([]string{}, scopes...),
+		CreatedAt: memoryNow(),
+		UserID:    userID,
+		tokenHash: tokenHash,
+	}
+	us.db.apiTokens[token.ID] = token
+	us.db.nextAPITokenID++
+
+	return &token, nil
+}
+
+// APITokens returns the API tokens of a user, oldest first
+func (us *MemoryUserStore) APITokens(userID int) ([]APIToken, error) {
+	us.db.mu.RLock()
+	defer us.db.mu.RUnlock()
+
+	tokens := []APIToken{}
+	for _, token := range us.db.apiTokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID < tokens[j].ID })
+
+	return tokens, nil
+}
+
+// DeleteAPIToken revokes an API token of a user
+func (us *MemoryUserStore) DeleteAPIToken(userID, id int) error {
+	us.db.mu.Lock()
+	defer us.db.mu.Unlock()
+
+	token, ok := us.db.apiTokens[id]
+	if !ok || token.UserID != userID {
+		return fmt.Errorf("API token not found")
+	}
+	delete(us.db.apiTokens, id)
+
+	return nil
+}
+
+// APITokenUser returns the user and the token of a token hash
+func (us *MemoryUserStore) APITokenUser(tokenHash string, now time.Time) (*User, *APIToken, error) {
+	us.db.mu.Lock()
+	defer us.db.mu.Unlock()
+
+	for id, token := range us.db.apiTokens {
+		if token.tokenHash != tokenHash {
+			continue
+		}
+		if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= apiTokenUseInterval {
+			lastUsedAt := now.UTC().Truncate(time.Second)
+			token.LastUsedAt = &lastUsedAt
+			us.db.apiTokens[id] = token
+		}
+		user := us.db.users[token.UserID]
+		return &user, &token, nil
+	}
+	return nil, nil, fmt.Errorf("API token not found")
+}
@@ -0,0 +1,303 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"gotodo/database"
+	"gotodo/events"
+)
+
+// Webhook is a URL that receives the events selected by Events, signed
+// with Secret
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"` // event types or patterns such as todo.*; empty for all
+	Secret    string    `json:"secret,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	owner ownership // kept by the memory store; the SQL stores filter on owner_id and workspace_id
+}
+
+// WebhookDelivery is one attempt at delivering an event to a webhook
+type WebhookDelivery struct {
+	ID         int             `json:"id"`
+	WebhookID  int             `json:"webhook_id"`
+	EventID    int64           `json:"event_id"`
+	EventType  string          `json:"event_type"`
+	Attempt    int             `json:"attempt"`
+	Success    bool            `json:"success"`
+	StatusCode *int            `json:"status_code"`
+	Error      *string         `json:"error"`
+	Payload    json.RawMessage `json:"payload"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// WebhookRepository is the storage used by the webhook handlers and the
+// webhook dispatcher.
+//
+// Implementations report missing webhooks with an error containing
+// "not found". Deleting a webhook deletes its delivery log.
+//
+// Webhooks belong to a user and only receive the events of that user's
+// changes; ForUser returns a repository limited to the webhooks of one.
+type WebhookRepository interface {
+	ForUser(userID int) WebhookRepository
+	GetAll() ([]Webhook, error)
+	GetByID(id int) (*Webhook, error)
+	Create(url string, events []string, secret string) (*Webhook, error)
+	// Update replaces every field except the secret, which is kept when nil
+	Update(id int, url string, events []string, secret *string, active bool) (*Webhook, error)
+	Delete(id int) error
+
+	// Subscribers returns the active webhooks that receive eventType
+	Subscribers(eventType string) ([]Webhook, error)
+	// AddDelivery records a delivery attempt
+	AddDelivery(delivery WebhookDelivery) error
+	// Deliveries returns the latest delivery attempts of a webhook, newest first
+	Deliveries(webhookID int, limit int) ([]WebhookDelivery, error)
+}
+
+// WebhookStore manages webhooks in an SQL database (SQLite or PostgreSQL)
+type WebhookStore struct {
+	db    *database.DB
+	owner ownership
+}
+
+// NewWebhookStore creates a new WebhookStore backed by db
+func NewWebhookStore(db *database.DB) *WebhookStore {
+	return &WebhookStore{db: db}
+}
+
+var _ WebhookRepository = (*WebhookStore)(nil)
+
+// ForUser returns a WebhookStore limited to the webhooks of a user
+func (ws *WebhookStore) ForUser(userID int) WebhookRepository {
+	return &WebhookStore{db: ws.db, owner: ownership{userID: userID}}
+}
+
+// joinEvents and splitEvents convert event patterns to and from their column
+func joinEvents(patterns []string) string {
+	return strings.Join(patterns, ",")
+}
+
+func splitEvents(column string) []string {
+	if column == "" {
+		return []string{}
+	}
+	return strings.Split(column, ",")
+}
+
+// scanWebhook reads a row of id, url, events, secret, active, created_at, updated_at
+func scanWebhook(row rowScanner) (Webhook, error) {
+	var webhook Webhook
+	var patterns string
+	err := row.Scan(
+		&webhook.ID,
+		&webhook.URL,
+		&patterns,
+		&webhook.Secret,
+		&webhook.Active,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+	webhook.Events = splitEvents(patterns)
+	return webhook, err
+}
+
+// queryWebhooks returns the webhooks of the store's owner matching a condition
+func (ws *WebhookStore) queryWebhooks(condition string, args ...any) ([]Webhook, error) {
+	owner, ownerArgs := ws.owner.filter("")
+	rows, err := ws.db.Query(`
+		SELECT id, url, events, secret, active, created_at, updated_at
+		FROM webhooks
+		WHERE `+condition+` AND `+owner+`
+		ORDER BY id ASC
+	`, append(args, ownerArgs...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+// GetAll retrieves all webhooks
+func (ws *WebhookStore) GetAll() ([]Webhook, error) {
+	return ws.queryWebhooks("1 = 1")
+}
+
+// GetByID retrieves a specific webhook
+func (ws *WebhookStore) GetByID(id int) (*Webhook, error) {
+	owner, args := ws.owner.filter("")
+	webhook, err := scanWebhook(ws.db.QueryRow(`
+		SELECT id, url, events, secret, active, created_at, updated_at
+		FROM webhooks
+		WHERE id = ? AND `+owner, append([]any{id}, args...)...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("webhook not found")
+		}
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+
+	return &webhook, nil
+}
+
+// Create adds a new, active webhook
+func (ws *WebhookStore) Create(url string, events []string, secret string) (*Webhook, error) {
+	var id int
+	err := ws.db.QueryRow(`
+		INSERT INTO webhooks (url, events, secret, active, owner_id, created_at, updated_at)
+		VALUES (?, ?, ?, TRUE, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING id
+	`, url, joinEvents(events), secret, ws.owner.userValue()).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return ws.GetByID(id)
+}
+
+// Update modifies a webhook
+func (ws *WebhookStore) Update(id int, url string, events []string, secret *string, active bool) (*Webhook, error) {
+	owner, args := ws.owner.filter("")
+	result, err := ws.db.Exec(`
+		UPDATE webhooks
+		SET url = ?, events = ?, secret = COALESCE(?, secret), active = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND `+owner, append([]any{url, joinEvents(events), secret, active, id}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update webhook: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("webhook not found")
+	}
+
+	return ws.GetByID(id)
+}
+
+// Delete removes a webhook; webhook_deliveries cascades
+func (ws *WebhookStore) Delete(id int) error {
+	owner, args := ws.owner.filter("")
+	result, err := ws.db.Exec(`DELETE FROM webhooks WHERE id = ? AND `+owner, append([]any{id}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("webhook not found")
+	}
+
+	return nil
+}
+
+// Subscribers returns the active webhooks that receive eventType. Patterns
+// are matched here rather than in SQL; there are only ever a few webhooks.
+func (ws *WebhookStore) Subscribers(eventType string) ([]Webhook, error) {
+	active, err := ws.queryWebhooks("active = TRUE")
+	if err != nil {
+		return nil, err
+	}
+	return subscribers(active, eventType), nil
+}
+
+// AddDelivery records a delivery attempt
+func (ws *WebhookStore) AddDelivery(d WebhookDelivery) error {
+	_, err := ws.db.Exec(`
+		INSERT INTO webhook_deliveries
+			(webhook_id, event_id, event_type, attempt, success, status_code, error, payload, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`, d.WebhookID, d.EventID, d.EventType, d.Attempt, d.Success, d.StatusCode, d.Error, string(d.Payload))
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// Deliveries returns the latest delivery attempts of a webhook
+func (ws *WebhookStore) Deliveries(webhookID int, limit int) ([]WebhookDelivery, error) {
+	if _, err := ws.GetByID(webhookID); err != nil {
+		return nil, err
+	}
+
+	rows, err := ws.db.Query(`
+		SELECT id, webhook_id, event_id, event_type, attempt, success, status_code, error, payload, created_at
+		FROM webhook_deliveries
+		WHERE webhook_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		var statusCode sql.NullInt64
+		var deliveryError sql.NullString
+		var payload string
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Attempt,
+			&d.Success, &statusCode, &deliveryError, &payload, &d.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		if statusCode.Valid {
+			code := int(statusCode.Int64)
+			d.StatusCode = &code
+		}
+		if deliveryError.Valid {
+			d.Error = &deliveryError.String
+		}
+		d.Payload = json.RawMessage(payload)
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// subscribers keeps the webhooks whose events select eventType
+func subscribers(webhooks []Webhook, eventType string) []Webhook {
+	var matching []Webhook
+	for _, webhook := range webhooks {
+		if events.Matches(webhook.Events, eventType) {
+			matching = append(matching, webhook)
+		}
+	}
+	return matching
+}
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MemoryWebhookStore manages webhooks in memory
+type MemoryWebhookStore struct {
+	db    *MemoryDB
+	owner ownership
+}
+
+// NewMemoryWebhookStore creates a new WebhookRepository backed by db
+func NewMemoryWebhookStore(db *MemoryDB) *MemoryWebhookStore {
+	return &MemoryWebhookStore{db: db}
+}
+
+var _ WebhookRepository = (*MemoryWebhookStore)(nil)
+
+// ForUser returns a MemoryWebhookStore limited to the webhooks of a user
+func (ws *MemoryWebhookStore) ForUser(userID int) WebhookRepository {
+	return &MemoryWebhookStore{db: ws.db, owner: ownership{userID: userID}}
+}
+
+// webhook returns a webhook of the store's owner. The caller must hold db.mu.
+func (ws *MemoryWebhookStore) webhook(id int) (Webhook, bool) {
+	webhook, ok := ws.db.webhooks[id]
+	if !ok || !ws.owner.owns(webhook.owner) {
+		return Webhook{}, false
+	}
+	return webhook, true
+}
+
+// GetAll returns all webhooks ordered by ID
+func (ws *MemoryWebhookStore) GetAll() ([]Webhook, error) {
+	ws.db.mu.RLock()
+	defer ws.db.mu.RUnlock()
+
+	return ws.db.allWebhooks(ws.owner), nil
+}
+
+// GetByID returns a specific webhook
+func (ws *MemoryWebhookStore) GetByID(id int) (*Webhook, error) {
+	ws.db.mu.RLock()
+	defer ws.db.mu.RUnlock()
+
+	webhook, ok := ws.webhook(id)
+	if !ok {
+		return nil, fmt.Errorf("webhook not found")
+	}
+	webhook.Events = append([]string{}, webhook.Events...)
+	return &webhook, nil
+}
+
+// Create adds a new, active webhook
+func (ws *MemoryWebhookStore) Create(url string, events []string, secret string) (*Webhook, error) {
+	ws.db.mu.Lock()
+	defer ws.db.mu.Unlock()
+
+	now := memoryNow()
+	webhook := Webhook{
+		ID:        ws.db.nextWebhookID,
+		URL:       url,
+		Events:    append([]string{}, events...),
+		Secret:    secret,
+		Active:    true,
+		CreatedAt: now,
+		UpdatedAt: now,
+		owner:     ws.owner,
+	}
+	ws.db.webhooks[webhook.ID] = webhook
+	ws.db.nextWebhookID++
+
+	webhook.Events = append([]string{}, webhook.Events...)
+	return &webhook, nil
+}
+
+// Update modifies a webhook
+func (ws *MemoryWebhookStore) Update(id int, url string, events []string, secret *string, active bool) (*Webhook, error) {
+	ws.db.mu.Lock()
+	defer ws.db.mu.Unlock()
+
+	webhook, ok := ws.webhook(id)
+	if !ok {
+		return nil, fmt.Errorf("webhook not found")
+	}
+	webhook.URL = url
+	webhook.Events = append([]string{}, events...)
+	if secret != nil {
+		webhook.Secret = *secret
+	}
+	webhook.Active = active
+	webhook.UpdatedAt = memoryNow()
+	ws.db.webhooks[id] = webhook
+
+	webhook.Events = append([]string{}, webhook.Events...)
+	return &webhook, nil
+}
+
+// Delete removes a webhook and its delivery log
+func (ws *MemoryWebhookStore) Delete(id int) error {
+	ws.db.mu.Lock()
+	defer ws.db.mu.Unlock()
+
+	if _, ok := ws.webhook(id); !ok {
+		return fmt.Errorf("webhook not found")
+	}
+	delete(ws.db.webhooks, id)
+
+	kept := ws.db.deliveries[:0]
+	for _, d := range ws.db.deliveries {
+		if d.WebhookID != id {
+			kept = append(kept, d)
+		}
+	}
+	ws.db.deliveries = kept
+
+	return nil
+}
+
+// Subscribers returns the active webhooks that receive eventType
+func (ws *MemoryWebhookStore) Subscribers(eventType string) ([]Webhook, error) {
+	ws.db.mu.RLock()
+	defer ws.db.mu.RUnlock()
+
+	var active []Webhook
+	for _, webhook := range ws.db.allWebhooks(ws.owner) {
+		if webhook.Active {
+			active = append(active, webhook)
+		}
+	}
+	return subscribers(active, eventType), nil
+}
+
+// AddDelivery records a delivery attempt
+func (ws *MemoryWebhookStore) AddDelivery(d WebhookDelivery) error {
+	ws.db.mu.Lock()
+	defer ws.db.mu.Unlock()
+
+	d.ID = ws.db.nextDeliveryID
+	d.StatusCode = copyInt(d.StatusCode)
+	d.Error = copyString(d.Error)
+	d.Payload = append([]byte{}, d.Payload...)
+	d.CreatedAt = memoryNow()
+	ws.db.deliveries = append(ws.db.deliveries, d)
+	ws.db.nextDeliveryID++
+
+	return nil
+}
+
+// Deliveries returns the latest delivery attempts of a webhook
+func (ws *MemoryWebhookStore) Deliveries(webhookID int, limit int) ([]WebhookDelivery, error) {
+	ws.db.mu.RLock()
+	defer ws.db.mu.RUnlock()
+
+	if _, ok := ws.webhook(webhookID); !ok {
+		return nil, fmt.Errorf("webhook not found")
+	}
+
+	deliveries := []WebhookDelivery{}
+	for i := len(ws.db.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if d := ws.db.deliveries[i]; d.WebhookID == webhookID {
+			d.StatusCode = copyInt(d.StatusCode)
+			d.Error = copyString(d.Error)
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+// allWebhooks returns copies of the webhooks of owner ordered by ID.
+// The caller must hold db.mu.
+func (db *MemoryDB) allWebhooks(owner ownership) []Webhook {
+	webhooks := make([]Webhook, 0, len(db.webhooks))
+	for _, webhook := range db.webhooks {
+		if !owner.owns(webhook.owner) {
+			continue
+		}
+		webhook.Events = append([]string{}, webhook.Events...)
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].ID < webhooks[j].ID
+	})
+	return webhooks
+}
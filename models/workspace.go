@@ -0,0 +1,408 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gotodo/database"
+)
+
+// Workspace roles. Owners manage the workspace and its members, editors
+// change its todos, categories and tags, and viewers only see them.
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// Workspace is a shared list: its todos, categories and tags belong to the
+// workspace instead of a user, and every member sees them
+type Workspace struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"` // of the user who asked for the workspace
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WorkspaceMember is a user with a role in a workspace
+type WorkspaceMember struct {
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"` // when they joined
+}
+
+// WorkspaceInvitation is a link that lets anyone who has it join a workspace
+// with its role until it expires or is revoked
+type WorkspaceInvitation struct {
+	ID        int       `json:"id"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Token and URL are only set in the response that creates the
+	// invitation; only the hash of the token is stored
+	Token string `json:"token,omitempty"`
+	URL   string `json:"url,omitempty"`
+
+	workspaceID int    // kept by the memory store
+	tokenHash   string // kept by the memory store
+}
+
+// WorkspaceRepository stores workspaces, their members and their invitations.
+//
+// Implementations report a missing workspace, or one the user is not a
+// member of, with an error containing "workspace not found", a missing
+// member with one containing "member not found", and an unknown or expired
+// invitation with one containing "invitation not found". Removing or
+// demoting the only owner fails with an error containing "last owner".
+type WorkspaceRepository interface {
+	// List returns the workspaces of a user by name, with their role
+	List(userID int) ([]Workspace, error)
+	// Create adds a workspace with the default categories, owned by userID
+	Create(userID int, name string) (*Workspace, error)
+	// Get returns a workspace with the role of userID, who must be a member
+	Get(id, userID int) (*Workspace, error)
+	Rename(id int, name string) error
+	// Delete removes a workspace with its todos, categories and tags
+	Delete(id int) error
+
+	// Members returns the members of a workspace by username
+	Members(workspaceID int) ([]WorkspaceMember, error)
+	SetRole(workspaceID, userID int, role string) error
+	RemoveMember(workspaceID, userID int) error
+
+	CreateInvitation(workspaceID int, tokenHash, role string, expiresAt time.Time) (*WorkspaceInvitation, error)
+	// Invitations returns the invitations of a workspace that have not
+	// expired at now, oldest first
+	Invitations(workspaceID int, now time.Time) ([]WorkspaceInvitation, error)
+	DeleteInvitation(workspaceID, id int) error
+	// Join adds userID to the workspace of an invitation that has not
+	// expired at now. Members who join again keep their role.
+	Join(tokenHash string, userID int, now time.Time) (*Workspace, error)
+}
+
+// WorkspaceStore manages workspaces in an SQL database (SQLite or PostgreSQL)
+type WorkspaceStore struct {
+	db *database.DB
+}
+
+// NewWorkspaceStore creates a new WorkspaceStore backed by db
+func NewWorkspaceStore(db *database.DB) *WorkspaceStore {
+	return &WorkspaceStore{db: db}
+}
+
+var _ WorkspaceRepository = (*WorkspaceStore)(nil)
+
+// scanWorkspace reads a row of workspaceSelect
+func scanWorkspace(row rowScanner) (Workspace, error) {
+	var workspace Workspace
+	err := row.Scan(&workspace.ID, &workspace.Name, &workspace.Role, &workspace.CreatedAt, &workspace.UpdatedAt)
+	return workspace, err
+}
+
+const workspaceSelect = `
+	SELECT w.id, w.name, m.role, w.created_at, w.updated_at
+	FROM workspaces w
+	JOIN workspace_members m ON m.workspace_id = w.id`
+
+// List returns the workspaces of a user
+func (ws *WorkspaceStore) List(userID int) ([]Workspace, error) {
+	rows, err := ws.db.Query(workspaceSelect+` WHERE m.user_id = ? ORDER BY w.name ASC, w.id ASC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workspaces: %w", err)
+	}
+	defer rows.Close()
+
+	workspaces := []Workspace{}
+	for rows.Next() {
+		workspace, err := scanWorkspace(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan workspace: %w", err)
+		}
+		workspaces = append(workspaces, workspace)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return workspaces, nil
+}
+
+// Create adds a workspace owned by userID
+func (ws *WorkspaceStore) Create(userID int, name string) (*Workspace, error) {
+	tx, err := ws.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO workspaces (name, created_at, updated_at)
+		VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING id
+	`, name).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	`, id, userID, RoleOwner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add workspace owner: %w", err)
+	}
+
+	if err := seedDefaultCategories(tx, ownership{workspaceID: id}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	return ws.Get(id, userID)
+}
+
+// Get retrieves a workspace of userID
+func (ws *WorkspaceStore) Get(id, userID int) (*Workspace, error) {
+	workspace, err := scanWorkspace(ws.db.QueryRow(workspaceSelect+` WHERE w.id = ? AND m.user_id = ?`, id, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("workspace not found")
+		}
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	return &workspace, nil
+}
+
+// Rename changes the name of a workspace
+func (ws *WorkspaceStore) Rename(id int, name string) error {
+	result, err := ws.db.Exec(`UPDATE workspaces SET name = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, name, id)
+	if err != nil {
+		return fmt.Errorf("failed to rename workspace: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("workspace not found")
+	}
+
+	return nil
+}
+
+// Delete removes a workspace; its todos, categories, tags, members and
+// invitations cascade
+func (ws *WorkspaceStore) Delete(id int) error {
+	result, err := ws.db.Exec(`DELETE FROM workspaces WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete workspace: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("workspace not found")
+	}
+
+	return nil
+}
+
+// Members returns the members of a workspace
+func (ws *WorkspaceStore) Members(workspaceID int) ([]WorkspaceMember, error) {
+	rows, err := ws.db.Query(`
+		SELECT m.user_id, u.username, m.role, m.created_at
+		FROM workspace_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.workspace_id = ?
+		ORDER BY u.username ASC
+	`, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workspace members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []WorkspaceMember{}
+	for rows.Next() {
+		var member WorkspaceMember
+		if err := rows.Scan(&member.UserID, &member.Username, &member.Role, &member.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan workspace member: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return members, nil
+}
+
+// SetRole changes the role of a member
+func (ws *WorkspaceStore) SetRole(workspaceID, userID int, role string) error {
+	return ws.changeMember(workspaceID, userID, role != RoleOwner, func(tx *database.Tx) (sql.Result, error) {
+		return tx.Exec(`UPDATE workspace_members SET role = ? WHERE workspace_id = ? AND user_id = ?`, role, workspaceID, userID)
+	})
+}
+
+// RemoveMember takes a user out of a workspace
+func (ws *WorkspaceStore) RemoveMember(workspaceID, userID int) error {
+	return ws.changeMember(workspaceID, userID, true, func(tx *database.Tx) (sql.Result, error) {
+		return tx.Exec(`DELETE FROM workspace_members WHERE workspace_id = ? AND user_id = ?`, workspaceID, userID)
+	})
+}
+
+// changeMember runs change on a member in a transaction that fails when
+// losesOwner and the member is the only owner
+func (ws *WorkspaceStore) changeMember(workspaceID, userID int, losesOwner bool, change func(tx *database.Tx) (sql.Result, error)) error {
+	tx, err := ws.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if losesOwner {
+		var otherOwners int
+		err := tx.QueryRow(`
+			SELECT COUNT(*) FROM workspace_members
+			WHERE workspace_id = ? AND role = ? AND user_id <> ?
+		`, workspaceID, RoleOwner, userID).Scan(&otherOwners)
+		if err != nil {
+			return fmt.Errorf("failed to count workspace owners: %w", err)
+		}
+
+		var role string
+		err = tx.QueryRow(`SELECT role FROM workspace_members WHERE workspace_id = ? AND user_id = ?`, workspaceID, userID).Scan(&role)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("member not found")
+			}
+			return fmt.Errorf("failed to get workspace member: %w", err)
+		}
+		if role == RoleOwner && otherOwners == 0 {
+			return fmt.Errorf("cannot remove the last owner of a workspace")
+		}
+	}
+
+	result, err := change(tx)
+	if err != nil {
+		return fmt.Errorf("failed to change workspace member: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("member not found")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to change workspace member: %w", err)
+	}
+	return nil
+}
+
+const invitationSelect = `SELECT id, role, created_at, expires_at FROM workspace_invitations`
+
+// CreateInvitation stores a new invitation link of a workspace
+func (ws *WorkspaceStore) CreateInvitation(workspaceID int, tokenHash, role string, expiresAt time.Time) (*WorkspaceInvitation, error) {
+	var id int
+	err := ws.db.QueryRow(`
+		INSERT INTO workspace_invitations (workspace_id, token_hash, role, created_at, expires_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP, ?)
+		RETURNING id
+	`, workspaceID, tokenHash, role, expiresAt.UTC().Truncate(time.Second)).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	var invitation WorkspaceInvitation
+	err = ws.db.QueryRow(invitationSelect+` WHERE id = ?`, id).
+		Scan(&invitation.ID, &invitation.Role, &invitation.CreatedAt, &invitation.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+	return &invitation, nil
+}
+
+// Invitations returns the unexpired invitations of a workspace
+func (ws *WorkspaceStore) Invitations(workspaceID int, now time.Time) ([]WorkspaceInvitation, error) {
+	rows, err := ws.db.Query(invitationSelect+` WHERE workspace_id = ? AND expires_at > ? ORDER BY id ASC`,
+		workspaceID, now.UTC().Truncate(time.Second))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invitations: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := []WorkspaceInvitation{}
+	for rows.Next() {
+		var invitation WorkspaceInvitation
+		if err := rows.Scan(&invitation.ID, &invitation.Role, &invitation.CreatedAt, &invitation.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan invitation: %w", err)
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return invitations, nil
+}
+
+// DeleteInvitation revokes an invitation of a workspace
+func (ws *WorkspaceStore) DeleteInvitation(workspaceID, id int) error {
+	result, err := ws.db.Exec(`DELETE FROM workspace_invitations WHERE id = ? AND workspace_id = ?`, id, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to delete invitation: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("invitation not found")
+	}
+
+	return nil
+}
+
+// Join adds a user to the workspace of an invitation
+func (ws *WorkspaceStore) Join(tokenHash string, userID int, now time.Time) (*Workspace, error) {
+	var workspaceID int
+	var role string
+	var expiresAt time.Time
+	err := ws.db.QueryRow(`SELECT workspace_id, role, expires_at FROM workspace_invitations WHERE token_hash = ?`, tokenHash).
+		Scan(&workspaceID, &role, &expiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("invitation not found")
+		}
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+	if !expiresAt.After(now) {
+		return nil, fmt.Errorf("invitation not found")
+	}
+
+	_, err = ws.db.Exec(`
+		INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (workspace_id, user_id) DO NOTHING
+	`, workspaceID, userID, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to join workspace: %w", err)
+	}
+
+	return ws.Get(workspaceID, userID)
+}
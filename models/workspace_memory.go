@@ -0,0 +1,288 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MemoryWorkspaceStore manages workspaces in memory
+type MemoryWorkspaceStore struct {
+	db *MemoryDB
+}
+
+// NewMemoryWorkspaceStore creates a new WorkspaceRepository backed by db
+func NewMemoryWorkspaceStore(db *MemoryDB) *MemoryWorkspaceStore {
+	return &MemoryWorkspaceStore{db: db}
+}
+
+var _ WorkspaceRepository = (*MemoryWorkspaceStore)(nil)
+
+// List returns the workspaces of a user by name
+func (ws *MemoryWorkspaceStore) List(userID int) ([]Workspace, error) {
+	ws.db.mu.RLock()
+	defer ws.db.mu.RUnlock()
+
+	workspaces := []Workspace{}
+	for id, members := range ws.db.workspaceMembers {
+		if member, ok := members[userID]; ok {
+			workspace := ws.db.workspaces[id]
+			workspace.Role = member.Role
+			workspaces = append(workspaces, workspace)
+		}
+	}
+	sort.Slice(workspaces, func(i, j int) bool {
+		if workspaces[i].Name != workspaces[j].Name {
+			return workspaces[i].Name < workspaces[j].Name
+		}
+		return workspaces[i].ID < workspaces[j].ID
+	})
+
+	return workspaces, nil
+}
+
+// Create adds a workspace owned by userID
+func (ws *MemoryWorkspaceStore) Create(userID int, name string) (*Workspace, error) {
+	ws.db.mu.Lock()
+	defer ws.db.mu.Unlock()
+
+	if _, ok := ws.db.users[userID]; !ok {
+		return nil, fmt.Errorf("failed to add workspace owner: FOREIGN KEY constraint failed")
+	}
+
+	now := memoryNow()
+	workspace := Workspace{
+		ID:        ws.db.nextWorkspaceID,
+		Name:      name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	ws.db.workspaces[workspace.ID] = workspace
+	ws.db.nextWorkspaceID++
+	ws.db.workspaceMembers[workspace.ID] = map[int]WorkspaceMember{
+		userID: {UserID: userID, Role: RoleOwner, CreatedAt: now},
+	}
+	ws.db.seedDefaultCategories(ownership{workspaceID: workspace.ID})
+
+	workspace.Role = RoleOwner
+	return &workspace, nil
+}
+
+// Get returns a workspace of userID
+func (ws *MemoryWorkspaceStore) Get(id, userID int) (*Workspace, error) {
+	ws.db.mu.RLock()
+	defer ws.db.mu.RUnlock()
+
+	member, ok := ws.db.workspaceMembers[id][userID]
+	if !ok {
+		return nil, fmt.Errorf("workspace not found")
+	}
+	workspace := ws.db.workspaces[id]
+	workspace.Role = member.Role
+	return &workspace, nil
+}
+
+// Rename changes the name of a workspace
+func (ws *MemoryWorkspaceStore) Rename(id int, name string) error {
+	ws.db.mu.Lock()
+	defer ws.db.mu.Unlock()
+
+	workspace, ok := ws.db.workspaces[id]
+	if !ok {
+		return fmt.Errorf("workspace not found")
+	}
+	workspace.Name = name
+	workspace.UpdatedAt = memoryNow()
+	ws.db.workspaces[id] = workspace
+
+	return nil
+}
+
+// Delete removes a workspace with everything in it, including the audit log
+// of its todos, like the foreign keys of the SQL store do
+func (ws *MemoryWorkspaceStore) Delete(id int) error {
+	ws.db.mu.Lock()
+	defer ws.db.mu.Unlock()
+
+	if _, ok := ws.db.workspaces[id]; !ok {
+		return fmt.Errorf("workspace not found")
+	}
+
+	owner := ownership{workspaceID: id}
+	for todoID, todo := range ws.db.todos {
+		if todo.owner == owner {
+			ws.db.deleteTodo(todoID)
+		}
+	}
+	for categoryID, category := range ws.db.categories {
+		if category.owner == owner {
+			delete(ws.db.categories, categoryID)
+		}
+	}
+	for tagID, tag := range ws.db.tags {
+		if tag.owner == owner {
+			delete(ws.db.tags, tagID)
+		}
+	}
+	for invitationID, invitation := range ws.db.invitations {
+		if invitation.workspaceID == id {
+			delete(ws.db.invitations, invitationID)
+		}
+	}
+	audit := ws.db.audit[:0]
+	for _, entry := range ws.db.audit {
+		if entry.owner != owner {
+			audit = append(audit, entry)
+		}
+	}
+	ws.db.audit = audit
+	delete(ws.db.workspaceMembers, id)
+	delete(ws.db.workspaces, id)
+
+	return nil
+}
+
+// Members returns the members of a workspace by username
+func (ws *MemoryWorkspaceStore) Members(workspaceID int) ([]WorkspaceMember, error) {
+	ws.db.mu.RLock()
+	defer ws.db.mu.RUnlock()
+
+	members := []WorkspaceMember{}
+	for userID, member := range ws.db.workspaceMembers[workspaceID] {
+		member.Username = ws.db.users[userID].Username
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Username < members[j].Username
+	})
+
+	return members, nil
+}
+
+// SetRole changes the role of a member
+func (ws *MemoryWorkspaceStore) SetRole(workspaceID, userID int, role string) error {
+	ws.db.mu.Lock()
+	defer ws.db.mu.Unlock()
+
+	if err := ws.db.checkMemberChange(workspaceID, userID, role != RoleOwner); err != nil {
+		return err
+	}
+	member := ws.db.workspaceMembers[workspaceID][userID]
+	member.Role = role
+	ws.db.workspaceMembers[workspaceID][userID] = member
+
+	return nil
+}
+
+// RemoveMember takes a user out of a workspace
+func (ws *MemoryWorkspaceStore) RemoveMember(workspaceID, userID int) error {
+	ws.db.mu.Lock()
+	defer ws.db.mu.Unlock()
+
+	if err := ws.db.checkMemberChange(workspaceID, userID, true); err != nil {
+		return err
+	}
+	delete(ws.db.workspaceMembers[workspaceID], userID)
+
+	return nil
+}
+
+// checkMemberChange reports a missing member, or the only owner when
+// losesOwner. The caller must hold db.mu.
+func (db *MemoryDB) checkMemberChange(workspaceID, userID int, losesOwner bool) error {
+	member, ok := db.workspaceMembers[workspaceID][userID]
+	if !ok {
+		return fmt.Errorf("member not found")
+	}
+	if !losesOwner || member.Role != RoleOwner {
+		return nil
+	}
+	for otherID, other := range db.workspaceMembers[workspaceID] {
+		if otherID != userID && other.Role == RoleOwner {
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot remove the last owner of a workspace")
+}
+
+// CreateInvitation stores a new invitation link of a workspace
+func (ws *MemoryWorkspaceStore) CreateInvitation(workspaceID int, tokenHash, role string, expiresAt time.Time) (*WorkspaceInvitation, error) {
+	ws.db.mu.Lock()
+	defer ws.db.mu.Unlock()
+
+	if _, ok := ws.db.workspaces[workspaceID]; !ok {
+		return nil, fmt.Errorf("failed to create invitation: FOREIGN KEY constraint failed")
+	}
+	for _, invitation := range ws.db.invitations {
+		if invitation.tokenHash == tokenHash {
+			return nil, fmt.Errorf("failed to create invitation: UNIQUE constraint failed: workspace_invitations.token_hash")
+		}
+	}
+
+	invitation := WorkspaceInvitation{
+		ID:          ws.db.nextInvitationID,
+		Role:        role,
+		CreatedAt:   memoryNow(),
+		ExpiresAt:   expiresAt.UTC().Truncate(time.Second),
+		workspaceID: workspaceID,
+		tokenHash:   tokenHash,
+	}
+	ws.db.invitations[invitation.ID] = invitation
+	ws.db.nextInvitationID++
+
+	return &invitation, nil
+}
+
+// Invitations returns the unexpired invitations of a workspace, oldest first
+func (ws *MemoryWorkspaceStore) Invitations(workspaceID int, now time.Time) ([]WorkspaceInvitation, error) {
+	ws.db.mu.RLock()
+	defer ws.db.mu.RUnlock()
+
+	invitations := []WorkspaceInvitation{}
+	for _, invitation := range ws.db.invitations {
+		if invitation.workspaceID == workspaceID && invitation.ExpiresAt.After(now) {
+			invitations = append(invitations, invitation)
+		}
+	}
+	sort.Slice(invitations, func(i, j int) bool { return invitations[i].ID < invitations[j].ID })
+
+	return invitations, nil
+}
+
+// DeleteInvitation revokes an invitation of a workspace
+func (ws *MemoryWorkspaceStore) DeleteInvitation(workspaceID, id int) error {
+	ws.db.mu.Lock()
+	defer ws.db.mu.Unlock()
+
+	invitation, ok := ws.db.invitations[id]
+	if !ok || invitation.workspaceID != workspaceID {
+		return fmt.Errorf("invitation not found")
+	}
+	delete(ws.db.invitations, id)
+
+	return nil
+}
+
+// Join adds a user to the workspace of an invitation
+func (ws *MemoryWorkspaceStore) Join(tokenHash string, userID int, now time.Time) (*Workspace, error) {
+	ws.db.mu.Lock()
+	defer ws.db.mu.Unlock()
+
+	for _, invitation := range ws.db.invitations {
+		if invitation.tokenHash != tokenHash || !invitation.ExpiresAt.After(now) {
+			continue
+		}
+
+		members := ws.db.workspaceMembers[invitation.workspaceID]
+		member, ok := members[userID]
+		if !ok {
+			member = WorkspaceMember{UserID: userID, Role: invitation.Role, CreatedAt: memoryNow()}
+			members[userID] = member
+		}
+
+		workspace := ws.db.workspaces[invitation.workspaceID]
+		workspace.Role = member.Role
+		return &workspace, nil
+	}
+	return nil, fmt.Errorf("invitation not found")
+}
@@ -0,0 +1,283 @@
+package query
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// dateLayout is the format of absolute dates in queries
+const dateLayout = "2006-01-02"
+
+// None is the value used by category:none, tag:none and due:none
+const None = "none"
+
+// priorityNames maps priority words to their numeric values
+var priorityNames = map[string]int{
+	"low":    1,
+	"medium": 2,
+	"high":   3,
+}
+
+// token is a lexed term before its value is interpreted
+type token struct {
+	field    string
+	op       Op
+	value    string
+	negate   bool
+	pos      int // start of the whole term
+	len      int
+	valuePos int // start of the value
+	valueLen int
+}
+
+// Parse parses a query. now is used to resolve relative dates such as "today".
+func Parse(input string, now time.Time) (*Query, *Error) {
+	tokens, err := lex([]rune(input))
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Query{}
+	for _, tok := range tokens {
+		cond, err := interpret(tok, now)
+		if err != nil {
+			return nil, err
+		}
+		q.Conditions = append(q.Conditions, cond)
+	}
+	return q, nil
+}
+
+// lex splits the input into terms
+func lex(runes []rune) ([]token, *Error) {
+	var tokens []token
+	i := 0
+	for {
+		for i < len(runes) && unicode.IsSpace(runes[i]) {
+			i++
+		}
+		if i >= len(runes) {
+			return tokens, nil
+		}
+
+		tok := token{pos: i, field: FieldText, op: OpEq}
+		if runes[i] == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			tok.negate = true
+			i++
+		}
+
+		if runes[i] == '"' {
+			value, next, err := lexQuoted(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tok.value, tok.valuePos, tok.valueLen = value, i, next-i
+			i = next
+		} else {
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != ':' && runes[i] != '"' {
+				i++
+			}
+			word := string(runes[start:i])
+
+			if i < len(runes) && runes[i] == ':' && knownField(strings.ToLower(word)) {
+				field := strings.ToLower(word)
+				tok.field = field
+				i++ // skip ':'
+
+				tok.op, i = lexOp(runes, i)
+
+				if i < len(runes) && runes[i] == '"' {
+					value, next, err := lexQuoted(runes, i)
+					if err != nil {
+						return nil, err
+					}
+					tok.value, tok.valuePos, tok.valueLen = value, i, next-i
+					i = next
+				} else {
+					valueStart := i
+					for i < len(runes) && !unicode.IsSpace(runes[i]) {
+						i++
+					}
+					tok.value, tok.valuePos, tok.valueLen = string(runes[valueStart:i]), valueStart, i-valueStart
+				}
+
+				if tok.value == "" {
+					return nil, &Error{Msg: "missing value for " + field, Pos: tok.pos, Len: i - tok.pos}
+				}
+			} else {
+				// A plain word, possibly containing colons such as "10:30",
+				// "Re:" or "http://example.com"
+				for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '"' {
+					i++
+				}
+				tok.value, tok.valuePos, tok.valueLen = string(runes[start:i]), start, i-start
+			}
+		}
+
+		tok.len = i - tok.pos
+		tokens = append(tokens, tok)
+	}
+}
+
+// lexQuoted reads a double-quoted string starting at runes[start].
+// A doubled quote ("") inside the string stands for a literal quote.
+func lexQuoted(runes []rune, start int) (string, int, *Error) {
+	var b strings.Builder
+	i := start + 1
+	for i < len(runes) {
+		if runes[i] == '"' {
+			if i+1 < len(runes) && runes[i+1] == '"' {
+				b.WriteRune('"')
+				i += 2
+				continue
+			}
+			if b.Len() == 0 {
+				return "", 0, &Error{Msg: "empty phrase", Pos: start, Len: i + 1 - start}
+			}
+			return b.String(), i + 1, nil
+		}
+		b.WriteRune(runes[i])
+		i++
+	}
+	return "", 0, &Error{Msg: "unterminated quote", Pos: start, Len: len(runes) - start}
+}
+
+// lexOp reads an optional comparison operator after a field name
+func lexOp(runes []rune, i int) (Op, int) {
+	for _, op := range []Op{OpGe, OpLe, OpGt, OpLt, OpEq} {
+		n := len(op)
+		if i+n <= len(runes) && string(runes[i:i+n]) == string(op) {
+			return op, i + n
+		}
+	}
+	return OpEq, i
+}
+
+// knownField reports whether field can be used in field:value terms. Other
+// words followed by a colon are searched as text.
+func knownField(field string) bool {
+	switch field {
+	case FieldTitle, FieldDescription, FieldCategory, FieldTag, FieldPriority,
+		FieldDue, FieldCreated, FieldUpdated, FieldIs, FieldHas:
+		return true
+	}
+	return false
+}
+
+// interpret validates a token's value for its field
+func interpret(tok token, now time.Time) (Condition, *Error) {
+	cond := Condition{
+		Field:  tok.field,
+		Op:     tok.op,
+		Negate: tok.negate,
+		Pos:    tok.pos,
+		Len:    tok.len,
+	}
+	valueErr := func(msg string) *Error {
+		return &Error{Msg: msg, Pos: tok.valuePos, Len: tok.valueLen}
+	}
+
+	switch tok.field {
+	case FieldText, FieldTitle, FieldDescription:
+		if tok.op != OpEq {
+			return cond, valueErr(tok.field + " does not support comparisons")
+		}
+		cond.Text = tok.value
+
+	case FieldCategory, FieldTag:
+		if tok.op != OpEq {
+			return cond, valueErr(tok.field + " does not support comparisons")
+		}
+		cond.Text = tok.value
+		if strings.EqualFold(tok.value, None) {
+			cond.Text = None
+		}
+
+	case FieldPriority:
+		priority, ok := priorityNames[strings.ToLower(tok.value)]
+		if !ok {
+			n, err := strconv.Atoi(tok.value)
+			if err != nil || n < 1 || n > 3 {
+				return cond, valueErr("priority must be 1-3 or low, medium, high")
+			}
+			priority = n
+		}
+		cond.Int = priority
+
+	case FieldDue, FieldCreated, FieldUpdated:
+		if tok.field == FieldDue && strings.EqualFold(tok.value, None) {
+			if tok.op != OpEq {
+				return cond, valueErr("due:none does not support comparisons")
+			}
+			cond.None = true
+			break
+		}
+		day, ok := parseDay(tok.value, now)
+		if !ok {
+			return cond, valueErr("invalid date " + strconv.Quote(tok.value) + "; use YYYY-MM-DD, today, tomorrow, yesterday or +Nd/-Nd")
+		}
+		cond.From = day
+		cond.To = day.AddDate(0, 0, 1)
+
+	case FieldIs:
+		value := strings.ToLower(tok.value)
+		switch value {
+		case IsOpen, "incomplete", "todo":
+			value = IsOpen
+		case IsDone, "completed", "closed":
+			value = IsDone
+		case IsOverdue:
+		default:
+			return cond, valueErr("is: must be open, done or overdue")
+		}
+		if tok.op != OpEq {
+			return cond, valueErr("is: does not support comparisons")
+		}
+		cond.Text = value
+
+	case FieldHas:
+		value := strings.ToLower(tok.value)
+		switch value {
+		case HasDue, HasCategory, HasTag, HasDescription:
+		default:
+			return cond, valueErr("has: must be due, category, tag or description")
+		}
+		if tok.op != OpEq {
+			return cond, valueErr("has: does not support comparisons")
+		}
+		cond.Text = value
+	}
+
+	return cond, nil
+}
+
+// parseDay resolves an absolute or relative date to midnight UTC
+func parseDay(value string, now time.Time) (time.Time, bool) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch strings.ToLower(value) {
+	case "today":
+		return today, true
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true
+	}
+
+	if (strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-")) && strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(value[:len(value)-1])
+		if err != nil {
+			return time.Time{}, false
+		}
+		return today.AddDate(0, 0, days), true
+	}
+
+	day, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return day, true
+}
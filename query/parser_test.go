@@ -0,0 +1,161 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []token
+	}{
+		{"milk", []token{
+			{field: FieldText, op: OpEq, value: "milk", pos: 0, len: 4, valuePos: 0, valueLen: 4},
+		}},
+		{"  milk  eggs ", []token{
+			{field: FieldText, op: OpEq, value: "milk", pos: 2, len: 4, valuePos: 2, valueLen: 4},
+			{field: FieldText, op: OpEq, value: "eggs", pos: 8, len: 4, valuePos: 8, valueLen: 4},
+		}},
+		{"-milk", []token{
+			{field: FieldText, op: OpEq, value: "milk", negate: true, pos: 0, len: 5, valuePos: 1, valueLen: 4},
+		}},
+		{"- milk", []token{
+			{field: FieldText, op: OpEq, value: "-", pos: 0, len: 1, valuePos: 0, valueLen: 1},
+			{field: FieldText, op: OpEq, value: "milk", pos: 2, len: 4, valuePos: 2, valueLen: 4},
+		}},
+		{`"buy milk"`, []token{
+			{field: FieldText, op: OpEq, value: "buy milk", pos: 0, len: 10, valuePos: 0, valueLen: 10},
+		}},
+		{`-"say ""hi"""`, []token{
+			{field: FieldText, op: OpEq, value: `say "hi"`, negate: true, pos: 0, len: 13, valuePos: 1, valueLen: 12},
+		}},
+		{`Title:"buy milk"`, []token{
+			{field: FieldTitle, op: OpEq, value: "buy milk", pos: 0, len: 16, valuePos: 6, valueLen: 10},
+		}},
+		{"-tag:home", []token{
+			{field: FieldTag, op: OpEq, value: "home", negate: true, pos: 0, len: 9, valuePos: 5, valueLen: 4},
+		}},
+		{"priority:>=2 due:<today", []token{
+			{field: FieldPriority, op: OpGe, value: "2", pos: 0, len: 12, valuePos: 11, valueLen: 1},
+			{field: FieldDue, op: OpLt, value: "today", pos: 13, len: 10, valuePos: 18, valueLen: 5},
+		}},
+		{"has:due", []token{
+			{field: FieldHas, op: OpEq, value: "due", pos: 0, len: 7, valuePos: 4, valueLen: 3},
+		}},
+		// Unknown prefixes are plain words
+		{"http://example.com", []token{
+			{field: FieldText, op: OpEq, value: "http://example.com", pos: 0, len: 18, valuePos: 0, valueLen: 18},
+		}},
+		{"Re: invoice", []token{
+			{field: FieldText, op: OpEq, value: "Re:", pos: 0, len: 3, valuePos: 0, valueLen: 3},
+			{field: FieldText, op: OpEq, value: "invoice", pos: 4, len: 7, valuePos: 4, valueLen: 7},
+		}},
+		{"10:30 -foo:bar", []token{
+			{field: FieldText, op: OpEq, value: "10:30", pos: 0, len: 5, valuePos: 0, valueLen: 5},
+			{field: FieldText, op: OpEq, value: "foo:bar", negate: true, pos: 6, len: 8, valuePos: 7, valueLen: 7},
+		}},
+		{"日本:語", []token{
+			{field: FieldText, op: OpEq, value: "日本:語", pos: 0, len: 4, valuePos: 0, valueLen: 4},
+		}},
+	}
+
+	for _, tt := range tests {
+		got, err := lex([]rune(tt.input))
+		if err != nil {
+			t.Errorf("lex(%q): %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lex(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Error
+	}{
+		{`milk "buy`, Error{Msg: "unterminated quote", Pos: 5, Len: 4}},
+		{`title:"buy`, Error{Msg: "unterminated quote", Pos: 6, Len: 4}},
+		{`a ""`, Error{Msg: "empty phrase", Pos: 2, Len: 2}},
+		{"tag:", Error{Msg: "missing value for tag", Pos: 0, Len: 4}},
+		{"milk -due:<= eggs", Error{Msg: "missing value for due", Pos: 5, Len: 7}},
+	}
+
+	for _, tt := range tests {
+		_, err := lex([]rune(tt.input))
+		if err == nil || *err != tt.want {
+			t.Errorf("lex(%q) error = %v, want %+v", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	now := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+	today := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+	day := func(offset int) time.Time { return today.AddDate(0, 0, offset) }
+
+	tests := []struct {
+		input string
+		want  Condition
+	}{
+		{"Re:", Condition{Field: FieldText, Op: OpEq, Text: "Re:", Len: 3}},
+		{"title:milk", Condition{Field: FieldTitle, Op: OpEq, Text: "milk", Len: 10}},
+		{"-category:None", Condition{Field: FieldCategory, Op: OpEq, Negate: true, Text: None, Len: 14}},
+		{"tag:Home", Condition{Field: FieldTag, Op: OpEq, Text: "Home", Len: 8}},
+		{"priority:high", Condition{Field: FieldPriority, Op: OpEq, Int: 3, Len: 13}},
+		{"priority:<2", Condition{Field: FieldPriority, Op: OpLt, Int: 2, Len: 11}},
+		{"due:today", Condition{Field: FieldDue, Op: OpEq, From: day(0), To: day(1), Len: 9}},
+		{"due:<=tomorrow", Condition{Field: FieldDue, Op: OpLe, From: day(1), To: day(2), Len: 14}},
+		{"created:-7d", Condition{Field: FieldCreated, Op: OpEq, From: day(-7), To: day(-6), Len: 11}},
+		{"updated:>2029-12-31", Condition{Field: FieldUpdated, Op: OpGt, From: day(-2), To: day(-1), Len: 19}},
+		{"due:none", Condition{Field: FieldDue, Op: OpEq, None: true, Len: 8}},
+		{"is:completed", Condition{Field: FieldIs, Op: OpEq, Text: IsDone, Len: 12}},
+		{"-is:todo", Condition{Field: FieldIs, Op: OpEq, Negate: true, Text: IsOpen, Len: 8}},
+		{"is:overdue", Condition{Field: FieldIs, Op: OpEq, Text: IsOverdue, Len: 10}},
+		{"has:Description", Condition{Field: FieldHas, Op: OpEq, Text: HasDescription, Len: 15}},
+		{"-has:tag", Condition{Field: FieldHas, Op: OpEq, Negate: true, Text: HasTag, Len: 8}},
+	}
+
+	for _, tt := range tests {
+		q, err := Parse(tt.input, now)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		if len(q.Conditions) != 1 || !reflect.DeepEqual(q.Conditions[0], tt.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.input, q.Conditions, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	now := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		input string
+		want  Error
+	}{
+		{"milk priority:urgent", Error{Msg: "priority must be 1-3 or low, medium, high", Pos: 14, Len: 6}},
+		{"priority:4", Error{Msg: "priority must be 1-3 or low, medium, high", Pos: 9, Len: 1}},
+		{"title:>milk", Error{Msg: "title does not support comparisons", Pos: 7, Len: 4}},
+		{"tag:<=home", Error{Msg: "tag does not support comparisons", Pos: 6, Len: 4}},
+		{"due:someday", Error{Msg: `invalid date "someday"; use YYYY-MM-DD, today, tomorrow, yesterday or +Nd/-Nd`, Pos: 4, Len: 7}},
+		{"created:+xd", Error{Msg: `invalid date "+xd"; use YYYY-MM-DD, today, tomorrow, yesterday or +Nd/-Nd`, Pos: 8, Len: 3}},
+		{"due:<none", Error{Msg: "due:none does not support comparisons", Pos: 5, Len: 4}},
+		{"is:maybe", Error{Msg: "is: must be open, done or overdue", Pos: 3, Len: 5}},
+		{"is:>open", Error{Msg: "is: does not support comparisons", Pos: 4, Len: 4}},
+		{`has:"due date"`, Error{Msg: "has: must be due, category, tag or description", Pos: 4, Len: 10}},
+		{"has:<tag", Error{Msg: "has: does not support comparisons", Pos: 5, Len: 3}},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.input, now)
+		if err == nil || *err != tt.want {
+			t.Errorf("Parse(%q) error = %v, want %+v", tt.input, err, tt.want)
+		}
+	}
+}
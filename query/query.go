@@ -0,0 +1,103 @@
+// Package query parses the structured search language used by the todo list,
+// for example:
+//
+//	category:仕事 priority:>=2 due:<2026-11-01 is:open "design review"
+//
+// A query is a list of whitespace separated terms that must all match.
+// Bare words and "quoted phrases" match the title or description, and a
+// leading "-" negates any term. A word with a colon that does not start with
+// a known field, such as "Re:" or "http://example.com", is a bare word too.
+package query
+
+import (
+	"fmt"
+	"time"
+)
+
+// Op is the comparison used by a condition
+type Op string
+
+const (
+	OpEq Op = "="
+	OpLt Op = "<"
+	OpLe Op = "<="
+	OpGt Op = ">"
+	OpGe Op = ">="
+)
+
+// Fields that can be used in field:value terms
+const (
+	FieldText        = "text" // bare words and phrases
+	FieldTitle       = "title"
+	FieldDescription = "description"
+	FieldCategory    = "category"
+	FieldTag         = "tag"
+	FieldPriority    = "priority"
+	FieldDue         = "due"
+	FieldCreated     = "created"
+	FieldUpdated     = "updated"
+	FieldIs          = "is"
+	FieldHas         = "has"
+)
+
+// Values accepted by the is: and has: fields
+const (
+	IsOpen    = "open"
+	IsDone    = "done"
+	IsOverdue = "overdue"
+
+	HasDue         = "due"
+	HasCategory    = "category"
+	HasTag         = "tag"
+	HasDescription = "description"
+)
+
+// Query is a parsed search query
+type Query struct {
+	Conditions []Condition
+}
+
+// Condition is a single term of a query
+type Condition struct {
+	Field  string
+	Op     Op
+	Negate bool
+
+	// Text holds the value of text, title, description, category, tag, is
+	// and has conditions. Category and tag names compare case-insensitively;
+	// "none" is represented by None.
+	Text string
+	// Int holds the priority (1-3) of priority conditions
+	Int int
+	// From and To bound date conditions as the half-open range [From, To)
+	// covered by the given day; None is set for "due:none"
+	From time.Time
+	To   time.Time
+	None bool
+
+	// Pos and Len locate the term in the original query, in characters
+	Pos int
+	Len int
+}
+
+// TextTerms returns the values of the positive free-text conditions
+func (q *Query) TextTerms() []string {
+	var terms []string
+	for _, cond := range q.Conditions {
+		if cond.Field == FieldText && !cond.Negate {
+			terms = append(terms, cond.Text)
+		}
+	}
+	return terms
+}
+
+// Error is a syntax error in a query
+type Error struct {
+	Msg string `json:"error"`
+	Pos int    `json:"position"` // character offset of the offending token
+	Len int    `json:"length"`   // length of the offending token in characters
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
@@ -0,0 +1,297 @@
+// Package recurrence implements the subset of iCalendar RRULEs (RFC 5545)
+// used by recurring todos, for example:
+//
+//	FREQ=WEEKLY;BYDAY=MO,FR
+//	FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=12
+//	FREQ=DAILY;INTERVAL=2;UNTIL=20261231
+//
+// Supported parts are FREQ (DAILY, WEEKLY, MONTHLY or YEARLY), INTERVAL,
+// BYDAY (weekly rules only), BYMONTHDAY (monthly rules only; negative days
+// count from the end of the month), UNTIL and COUNT. Occurrences keep the
+// time of day of the first one, and dates that do not exist in a month or
+// year (such as February 30th) are skipped.
+package recurrence
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is the base unit a rule repeats in
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// weekdayNames are the BYDAY codes, indexed by time.Weekday
+var weekdayNames = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Rule describes when a todo repeats
+type Rule struct {
+	Freq     Frequency
+	Interval int            // repeat every Interval days, weeks, months or years; at least 1
+	Weekdays []time.Weekday // weekly rules: the days of the week; empty means the first occurrence's day
+	MonthDay int            // monthly rules: 1-31, or -1 to -31 from the end of the month; 0 means the first occurrence's day
+	Until    *time.Time     // no occurrences after this time
+	Count    int            // total number of occurrences in the series; 0 means unlimited
+}
+
+// Parse reads a rule such as "FREQ=WEEKLY;BYDAY=MO,WE". An "RRULE:" prefix is accepted.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 6 && strings.EqualFold(s[:6], "RRULE:") {
+		s = s[6:]
+	}
+	if s == "" {
+		return nil, fmt.Errorf("empty recurrence rule")
+	}
+
+	rule := &Rule{Interval: 1}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		key = strings.ToUpper(strings.TrimSpace(key))
+		value = strings.ToUpper(strings.TrimSpace(value))
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("%s is given more than once", key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "FREQ":
+			switch Frequency(value) {
+			case Daily, Weekly, Monthly, Yearly:
+				rule.Freq = Frequency(value)
+			default:
+				return nil, fmt.Errorf("FREQ must be DAILY, WEEKLY, MONTHLY or YEARLY")
+			}
+
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 1000 {
+				return nil, fmt.Errorf("INTERVAL must be between 1 and 1000")
+			}
+			rule.Interval = n
+
+		case "BYDAY":
+			for _, name := range strings.Split(value, ",") {
+				day, ok := parseWeekday(name)
+				if !ok {
+					return nil, fmt.Errorf("invalid BYDAY value %q; use MO, TU, WE, TH, FR, SA or SU", name)
+				}
+				rule.Weekdays = append(rule.Weekdays, day)
+			}
+
+		case "BYMONTHDAY":
+			n, err := strconv.Atoi(value)
+			if err != nil || n == 0 || n < -31 || n > 31 {
+				return nil, fmt.Errorf("BYMONTHDAY must be 1 to 31 or -1 to -31")
+			}
+			rule.MonthDay = n
+
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			rule.Until = &until
+
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("COUNT must be a positive integer")
+			}
+			rule.Count = n
+
+		default:
+			return nil, fmt.Errorf("unsupported rule part %s", key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, fmt.Errorf("FREQ is required")
+	}
+	if len(rule.Weekdays) > 0 && rule.Freq != Weekly {
+		return nil, fmt.Errorf("BYDAY is only supported with FREQ=WEEKLY")
+	}
+	if rule.MonthDay != 0 && rule.Freq != Monthly {
+		return nil, fmt.Errorf("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	}
+	if rule.Until != nil && rule.Count > 0 {
+		return nil, fmt.Errorf("UNTIL and COUNT cannot be combined")
+	}
+
+	rule.Weekdays = normalizeWeekdays(rule.Weekdays)
+	return rule, nil
+}
+
+// parseWeekday reads a BYDAY code such as "MO"
+func parseWeekday(name string) (time.Weekday, bool) {
+	for day, code := range weekdayNames {
+		if code == strings.TrimSpace(name) {
+			return time.Weekday(day), true
+		}
+	}
+	return 0, false
+}
+
+// parseUntil reads an UNTIL value. A date without a time includes the whole day.
+func parseUntil(value string) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("20060102", value); err == nil {
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("UNTIL must be YYYYMMDD or YYYYMMDDTHHMMSSZ")
+}
+
+// normalizeWeekdays sorts weekdays from Monday to Sunday and drops duplicates
+func normalizeWeekdays(days []time.Weekday) []time.Weekday {
+	seen := make(map[time.Weekday]bool)
+	var unique []time.Weekday
+	for _, day := range days {
+		if !seen[day] {
+			seen[day] = true
+			unique = append(unique, day)
+		}
+	}
+	sort.Slice(unique, func(i, j int) bool {
+		return mondayIndex(unique[i]) < mondayIndex(unique[j])
+	})
+	return unique
+}
+
+// mondayIndex numbers weekdays from Monday (0) to Sunday (6), as weeks start on Monday
+func mondayIndex(day time.Weekday) int {
+	return (int(day) + 6) % 7
+}
+
+// String formats the rule in its canonical form
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.Weekdays) > 0 {
+		names := make([]string, len(r.Weekdays))
+		for i, day := range r.Weekdays {
+			names[i] = weekdayNames[day]
+		}
+		parts = append(parts, "BYDAY="+strings.Join(names, ","))
+	}
+	if r.MonthDay != 0 {
+		parts = append(parts, "BYMONTHDAY="+strconv.Itoa(r.MonthDay))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the occurrence following prev, which is the given occurrence
+// (counting from 1) of the series. It reports false when the series ends
+// before another occurrence.
+func (r *Rule) Next(prev time.Time, occurrence int) (time.Time, bool) {
+	if r.Count > 0 && occurrence >= r.Count {
+		return time.Time{}, false
+	}
+
+	next, ok := r.next(prev)
+	if !ok || (r.Until != nil && next.After(*r.Until)) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// Occurrences returns up to n occurrences following prev, see Next
+func (r *Rule) Occurrences(prev time.Time, occurrence, n int) []time.Time {
+	var times []time.Time
+	for len(times) < n {
+		next, ok := r.Next(prev, occurrence)
+		if !ok {
+			break
+		}
+		times = append(times, next)
+		prev = next
+		occurrence++
+	}
+	return times
+}
+
+// next computes the occurrence after prev without the UNTIL and COUNT limits
+func (r *Rule) next(prev time.Time) (time.Time, bool) {
+	interval := max(r.Interval, 1)
+
+	switch r.Freq {
+	case Daily:
+		return prev.AddDate(0, 0, interval), true
+
+	case Weekly:
+		days := r.Weekdays
+		if len(days) == 0 {
+			days = []time.Weekday{prev.Weekday()}
+		}
+		// A later day in the same week, otherwise the first day Interval weeks on
+		current := mondayIndex(prev.Weekday())
+		for _, day := range days {
+			if offset := mondayIndex(day) - current; offset > 0 {
+				return prev.AddDate(0, 0, offset), true
+			}
+		}
+		weekStart := prev.AddDate(0, 0, -current)
+		return weekStart.AddDate(0, 0, 7*interval+mondayIndex(days[0])), true
+
+	case Monthly:
+		day := r.MonthDay
+		if day == 0 {
+			day = prev.Day()
+		}
+		// The same month may still have the day if BYMONTHDAY is after prev
+		for k := 0; k <= 120*interval; k += interval {
+			year, month := prev.Year(), prev.Month()+time.Month(k)
+			if date, ok := monthDay(year, month, day, prev); ok && date.After(prev) {
+				return date, true
+			}
+		}
+
+	case Yearly:
+		for k := interval; k <= 8*interval; k += interval {
+			date := time.Date(prev.Year()+k, prev.Month(), prev.Day(),
+				prev.Hour(), prev.Minute(), prev.Second(), 0, prev.Location())
+			if date.Day() == prev.Day() {
+				return date, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// monthDay returns the given day of a month at the time of day of clock,
+// counting negative days from the end of the month. It reports false when
+// the month does not have that day.
+func monthDay(year int, month time.Month, day int, clock time.Time) (time.Time, bool) {
+	first := time.Date(year, month, 1, clock.Hour(), clock.Minute(), clock.Second(), 0, clock.Location())
+	daysInMonth := first.AddDate(0, 1, -1).Day()
+	if day < 0 {
+		day = daysInMonth + day + 1
+	}
+	if day < 1 || day > daysInMonth {
+		return time.Time{}, false
+	}
+	return first.AddDate(0, 0, day-1), true
+}
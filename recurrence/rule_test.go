@@ -0,0 +1,112 @@
+package recurrence
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string // canonical form, or "" when parsing fails
+	}{
+		{"FREQ=DAILY", "FREQ=DAILY"},
+		{"RRULE:freq=weekly;byday=fr,mo,fr", "FREQ=WEEKLY;BYDAY=MO,FR"},
+		{"FREQ=WEEKLY;INTERVAL=1", "FREQ=WEEKLY"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=12", "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=12"},
+		{"FREQ=DAILY;INTERVAL=2;UNTIL=20261231", "FREQ=DAILY;INTERVAL=2;UNTIL=20261231T235959Z"},
+		{"FREQ=DAILY;UNTIL=20261231T120000Z", "FREQ=DAILY;UNTIL=20261231T120000Z"},
+		{"", ""},
+		{"INTERVAL=2", ""},
+		{"FREQ=HOURLY", ""},
+		{"FREQ=DAILY;FREQ=WEEKLY", ""},
+		{"FREQ=DAILY;INTERVAL=0", ""},
+		{"FREQ=DAILY;BYDAY=MO", ""},
+		{"FREQ=WEEKLY;BYDAY=XX", ""},
+		{"FREQ=MONTHLY;BYMONTHDAY=32", ""},
+		{"FREQ=YEARLY;BYMONTHDAY=1", ""},
+		{"FREQ=DAILY;COUNT=0", ""},
+		{"FREQ=DAILY;UNTIL=2026-12-31", ""},
+		{"FREQ=DAILY;COUNT=3;UNTIL=20261231", ""},
+		{"FREQ=DAILY;BYHOUR=9", ""},
+	}
+
+	for _, tt := range tests {
+		rule, err := Parse(tt.input)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("Parse(%q) = %s, want an error", tt.input, rule)
+		case tt.want != "" && err != nil:
+			t.Errorf("Parse(%q): %v", tt.input, err)
+		case tt.want != "" && rule.String() != tt.want:
+			t.Errorf("Parse(%q) = %s, want %s", tt.input, rule, tt.want)
+		}
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 9, 30, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name       string
+		rule       string
+		first      time.Time
+		occurrence int
+		want       []time.Time
+	}{
+		{"daily with interval", "FREQ=DAILY;INTERVAL=3", day(2026, 12, 30), 1,
+			[]time.Time{day(2027, 1, 2), day(2027, 1, 5), day(2027, 1, 8)}},
+		{"weekly on the first day", "FREQ=WEEKLY", day(2026, 10, 14), 1,
+			[]time.Time{day(2026, 10, 21), day(2026, 10, 28), day(2026, 11, 4)}},
+		// 2026-10-14 is a Wednesday; Friday follows in the same week, then
+		// Monday and Friday every other week
+		{"weekly BYDAY with interval", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", day(2026, 10, 14), 1,
+			[]time.Time{day(2026, 10, 16), day(2026, 10, 26), day(2026, 10, 30), day(2026, 11, 9)}},
+		{"weekly BYDAY on Sunday with interval", "FREQ=WEEKLY;INTERVAL=3;BYDAY=SU,TU", day(2026, 10, 18), 1,
+			[]time.Time{day(2026, 11, 3), day(2026, 11, 8), day(2026, 11, 24)}},
+		{"last day of the month", "FREQ=MONTHLY;BYMONTHDAY=-1", day(2024, 1, 31), 1,
+			[]time.Time{day(2024, 2, 29), day(2024, 3, 31), day(2024, 4, 30)}},
+		{"last day of February", "FREQ=MONTHLY;BYMONTHDAY=-1", day(2025, 1, 31), 1,
+			[]time.Time{day(2025, 2, 28), day(2025, 3, 31)}},
+		{"BYMONTHDAY later in the month", "FREQ=MONTHLY;BYMONTHDAY=20", day(2026, 10, 14), 1,
+			[]time.Time{day(2026, 10, 20), day(2026, 11, 20)}},
+		{"the 31st skips short months", "FREQ=MONTHLY", day(2026, 1, 31), 1,
+			[]time.Time{day(2026, 3, 31), day(2026, 5, 31), day(2026, 7, 31), day(2026, 8, 31)}},
+		{"BYMONTHDAY=31 every other month", "FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=31", day(2026, 1, 31), 1,
+			[]time.Time{day(2026, 3, 31), day(2026, 5, 31), day(2026, 7, 31), day(2027, 1, 31)}},
+		{"February 29th", "FREQ=YEARLY", day(2024, 2, 29), 1,
+			[]time.Time{day(2028, 2, 29), day(2032, 2, 29)}},
+		{"yearly with interval", "FREQ=YEARLY;INTERVAL=2", day(2026, 10, 14), 1,
+			[]time.Time{day(2028, 10, 14), day(2030, 10, 14)}},
+		// COUNT includes the first occurrence
+		{"COUNT", "FREQ=DAILY;COUNT=3", day(2026, 10, 14), 1,
+			[]time.Time{day(2026, 10, 15), day(2026, 10, 16)}},
+		{"COUNT reached", "FREQ=DAILY;COUNT=3", day(2026, 10, 16), 3, nil},
+		// An UNTIL date includes the whole day
+		{"UNTIL date", "FREQ=DAILY;UNTIL=20261016", day(2026, 10, 14), 1,
+			[]time.Time{day(2026, 10, 15), day(2026, 10, 16)}},
+		{"UNTIL time before the last day's occurrence", "FREQ=DAILY;UNTIL=20261016T092959Z", day(2026, 10, 14), 1,
+			[]time.Time{day(2026, 10, 15)}},
+		{"UNTIL time at the occurrence", "FREQ=DAILY;UNTIL=20261016T093000Z", day(2026, 10, 14), 1,
+			[]time.Time{day(2026, 10, 15), day(2026, 10, 16)}},
+	}
+
+	for _, tt := range tests {
+		rule, err := Parse(tt.rule)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		// A series with an end must not run on past the wanted occurrences
+		n := len(tt.want)
+		if rule.Until != nil || rule.Count > 0 {
+			n++
+		}
+		got := rule.Occurrences(tt.first, tt.occurrence, n)
+		if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("%s: occurrences after %s = %v, want %v", tt.name, tt.first, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Package reminders sends todo reminders when they come due.
+//
+// A Scheduler polls the reminder store and hands each due reminder to a
+// Notifier. Notifiers are pluggable: reminders can be logged, posted to a
+// webhook or mailed over SMTP, or any combination of these with Notifiers.
+package reminders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gotodo/models"
+)
+
+// Notification is a reminder about to be sent together with its todo
+type Notification struct {
+	Reminder models.Reminder `json:"reminder"`
+	Todo     models.Todo     `json:"todo"`
+}
+
+// Subject is a one-line summary of the notification
+func (n Notification) Subject() string {
+	return "Reminder: " + n.Todo.Title
+}
+
+// Body is a plain-text description of the todo
+func (n Notification) Body() string {
+	var b strings.Builder
+	b.WriteString(n.Todo.Title + "\n")
+	if n.Todo.DueDate != nil {
+		fmt.Fprintf(&b, "Due: %s\n", n.Todo.DueDate.Format(time.RFC1123))
+	}
+	if n.Todo.Description != "" {
+		b.WriteString("\n" + n.Todo.Description + "\n")
+	}
+	return b.String()
+}
+
+// Notifier delivers notifications
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Notifiers sends every notification to all of its notifiers, reporting
+// the errors of those that failed
+type Notifiers []Notifier
+
+// Notify sends n to every notifier
+func (ns Notifiers) Notify(ctx context.Context, n Notification) error {
+	var errs []error
+	for _, notifier := range ns {
+		if err := notifier.Notify(ctx, n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// UserNotifier passes on only the notifications about the todos of one
+// user. It guards notifiers with a single destination, such as a fixed
+// webhook URL or mail address, which must not receive the todos of other
+// users. The user is looked up on every notification, so it may register
+// after the server started.
+type UserNotifier struct {
+	Notifier Notifier
+	Username string
+	Users    models.UserRepository
+	Todos    models.TodoRepository
+}
+
+// Notify sends n when its todo belongs to the user and drops it otherwise
+func (un UserNotifier) Notify(ctx context.Context, n Notification) error {
+	user, err := un.Users.GetByUsername(un.Username)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil
+		}
+		return fmt.Errorf("failed to get reminder user: %w", err)
+	}
+	if _, err := un.Todos.ForUser(user.ID).GetByID(n.Todo.ID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil
+		}
+		return fmt.Errorf("failed to check todo owner: %w", err)
+	}
+	return un.Notifier.Notify(ctx, n)
+}
+
+// LogNotifier writes notifications to the standard logger
+type LogNotifier struct{}
+
+// Notify logs n
+func (LogNotifier) Notify(ctx context.Context, n Notification) error {
+	log.Printf("%s (todo %d, reminder %d)", n.Subject(), n.Todo.ID, n.Reminder.ID)
+	return nil
+}
@@ -0,0 +1,57 @@
+package reminders
+
+import (
+	"context"
+	"testing"
+
+	"gotodo/models"
+)
+
+// recordingNotifier keeps the todos it was notified about
+type recordingNotifier struct {
+	todoIDs []int
+}
+
+func (rn *recordingNotifier) Notify(ctx context.Context, n Notification) error {
+	rn.todoIDs = append(rn.todoIDs, n.Todo.ID)
+	return nil
+}
+
+func TestUserNotifierOnlySendsTheTodosOfItsUser(t *testing.T) {
+	db := models.NewMemoryDB()
+	users := models.NewMemoryUserStore(db)
+	todos := models.NewMemoryTodoStore(db)
+	recorder := &recordingNotifier{}
+	notifier := UserNotifier{Notifier: recorder, Username: "alice", Users: users, Todos: todos}
+
+	// Nothing is sent before the user exists
+	if err := notifier.Notify(context.Background(), Notification{Todo: models.Todo{ID: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	alice, err := users.Create("alice", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := users.Create("bob", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	own, err := todos.ForUser(alice.ID).CreateFull("alice's todo", "", nil, 1, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := todos.ForUser(bob.ID).CreateFull("bob's todo", "", nil, 1, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, todo := range []*models.Todo{own, other} {
+		if err := notifier.Notify(context.Background(), Notification{Todo: *todo}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(recorder.todoIDs) != 1 || recorder.todoIDs[0] != own.ID {
+		t.Errorf("sent todos %v, want only %d", recorder.todoIDs, own.ID)
+	}
+}
@@ -0,0 +1,101 @@
+package reminders
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"gotodo/models"
+)
+
+// Scheduler sends due reminders. Each reminder is claimed in the store
+// before it is delivered, so it fires once even when the server restarts
+// or several servers share a database. A failed delivery is retried on
+// later checks up to models.MaxReminderAttempts times.
+type Scheduler struct {
+	reminders models.ReminderRepository
+	todos     models.TodoRepository
+	notifier  Notifier
+	interval  time.Duration
+}
+
+// NewScheduler creates a Scheduler that checks for due reminders every interval
+func NewScheduler(reminders models.ReminderRepository, todos models.TodoRepository, notifier Notifier, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		reminders: reminders,
+		todos:     todos,
+		notifier:  notifier,
+		interval:  interval,
+	}
+}
+
+// Run checks for due reminders until ctx is done. The first check happens
+// right away, catching up on reminders that came due while the server was down.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.SendDue(ctx, time.Now()); err != nil {
+			log.Printf("Error sending reminders: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SendDue sends the reminders due at now
+func (s *Scheduler) SendDue(ctx context.Context, now time.Time) error {
+	due, err := s.reminders.Due(now)
+	if err != nil {
+		return err
+	}
+
+	for _, reminder := range due {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.send(ctx, reminder)
+	}
+	return nil
+}
+
+// send claims and delivers a single reminder
+func (s *Scheduler) send(ctx context.Context, reminder models.Reminder) {
+	claimed, err := s.reminders.Claim(reminder.ID)
+	if err != nil {
+		log.Printf("Error claiming reminder %d: %v", reminder.ID, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	reminder.Attempts++
+
+	todo, err := s.todos.GetByID(reminder.TodoID)
+	if err != nil {
+		// The todo was deleted since, taking the reminder with it
+		if !strings.Contains(err.Error(), "not found") {
+			log.Printf("Error getting todo for reminder %d: %v", reminder.ID, err)
+			s.release(reminder.ID, err, reminder.Attempts)
+		}
+		return
+	}
+
+	if err := s.notifier.Notify(ctx, Notification{Reminder: reminder, Todo: *todo}); err != nil {
+		log.Printf("Error sending reminder %d (attempt %d): %v", reminder.ID, reminder.Attempts, err)
+		s.release(reminder.ID, err, reminder.Attempts)
+	}
+}
+
+// release records a failed delivery, retrying it unless attempts ran out
+func (s *Scheduler) release(id int, cause error, attempts int) {
+	if err := s.reminders.Release(id, cause.Error(), attempts < models.MaxReminderAttempts); err != nil {
+		log.Printf("Error releasing reminder %d: %v", id, err)
+	}
+}
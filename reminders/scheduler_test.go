@@ -0,0 +1,118 @@
+package reminders
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gotodo/models"
+)
+
+// fakeNotifier records the reminders it was asked to send and fails with err
+type fakeNotifier struct {
+	sent []int
+	err  error
+}
+
+func (fn *fakeNotifier) Notify(ctx context.Context, n Notification) error {
+	fn.sent = append(fn.sent, n.Reminder.ID)
+	return fn.err
+}
+
+func TestSchedulerSendsDueRemindersOnce(t *testing.T) {
+	db := models.NewMemoryDB()
+	todos := models.NewMemoryTodoStore(db)
+	reminders := models.NewMemoryReminderStore(db)
+	notifier := &fakeNotifier{}
+	scheduler := NewScheduler(reminders, todos, notifier, time.Minute)
+
+	now := time.Date(2030, 1, 2, 9, 0, 0, 0, time.UTC)
+	due := now.Add(time.Hour)
+	todo, err := todos.CreateFull("Dentist", "", nil, 1, &due, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+	sixty, thirty := 60, 30
+	absolute, _ := reminders.Create(todo.ID, &past, nil)
+	relative, _ := reminders.Create(todo.ID, nil, &sixty)
+	reminders.Create(todo.ID, &future, nil)
+	reminders.Create(todo.ID, nil, &thirty)
+
+	if err := scheduler.SendDue(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	if len(notifier.sent) != 2 || notifier.sent[0] != absolute.ID || notifier.sent[1] != relative.ID {
+		t.Errorf("sent reminders %v, want %d and %d", notifier.sent, absolute.ID, relative.ID)
+	}
+
+	// Sent reminders are not sent again
+	notifier.sent = nil
+	if err := scheduler.SendDue(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	if len(notifier.sent) != 0 {
+		t.Errorf("sent reminders %v again", notifier.sent)
+	}
+}
+
+func TestSchedulerRetriesFailedDeliveries(t *testing.T) {
+	db := models.NewMemoryDB()
+	todos := models.NewMemoryTodoStore(db)
+	reminders := models.NewMemoryReminderStore(db)
+	notifier := &fakeNotifier{err: errors.New("mail server down")}
+	scheduler := NewScheduler(reminders, todos, notifier, time.Minute)
+
+	now := time.Now()
+	todo, err := todos.CreateFull("Call back", "", nil, 1, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reminders.Create(todo.ID, &now, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < models.MaxReminderAttempts+2; i++ {
+		if err := scheduler.SendDue(context.Background(), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(notifier.sent) != models.MaxReminderAttempts {
+		t.Errorf("delivery attempted %d times, want %d", len(notifier.sent), models.MaxReminderAttempts)
+	}
+	list, err := reminders.List(todo.ID)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("reminders %v, err %v", list, err)
+	}
+	if list[0].LastError == nil || *list[0].LastError != "mail server down" {
+		t.Errorf("last error = %v", list[0].LastError)
+	}
+}
+
+func TestSchedulerSkipsCompletedTodos(t *testing.T) {
+	db := models.NewMemoryDB()
+	todos := models.NewMemoryTodoStore(db)
+	reminders := models.NewMemoryReminderStore(db)
+	notifier := &fakeNotifier{}
+	scheduler := NewScheduler(reminders, todos, notifier, time.Minute)
+
+	now := time.Now()
+	todo, err := todos.CreateFull("Done already", "", nil, 1, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reminders.Create(todo.ID, &now, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := todos.Toggle(todo.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := scheduler.SendDue(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	if len(notifier.sent) != 0 {
+		t.Errorf("sent reminders %v of a completed todo", notifier.sent)
+	}
+}
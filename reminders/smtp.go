@@ -0,0 +1,114 @@
+package reminders
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// smtpTimeout bounds a delivery whose context has no deadline
+const smtpTimeout = 30 * time.Second
+
+// SMTPNotifier mails notifications. Without a username it sends without
+// authentication, which is enough for a local relay or test server.
+type SMTPNotifier struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Notify mails n to every recipient. The exchange with the server ends
+// when ctx is done, and after smtpTimeout when ctx has no deadline.
+func (sn *SMTPNotifier) Notify(ctx context.Context, n Notification) error {
+	host, _, err := net.SplitHostPort(sn.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP address: %w", err)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, smtpTimeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", sn.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	// Cancelling ctx interrupts a reply that is still awaited
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	defer client.Close()
+
+	if err := sn.send(client, host, n); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+// send mails n over client the way smtp.SendMail does, using STARTTLS when
+// the server offers it
+func (sn *SMTPNotifier) send(client *smtp.Client, host string, n Notification) error {
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if sn.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", sn.Username, sn.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(sn.From); err != nil {
+		return err
+	}
+	for _, to := range sn.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(sn.message(n)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// message builds the mail; the subject is encoded since titles need not be ASCII
+func (sn *SMTPNotifier) message(n Notification) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", sn.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(sn.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", n.Subject()))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	body := strings.ReplaceAll(n.Body(), "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,181 @@
+package reminders
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"gotodo/models"
+)
+
+// mailbox is what a fakeSMTPServer received in one session
+type mailbox struct {
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTPServer accepts one SMTP session on a local port and reports what
+// it received on the returned channel. With greet false it accepts the
+// connection but never answers, like a server that hangs.
+func fakeSMTPServer(t *testing.T, greet bool) (string, <-chan mailbox) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan mailbox, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if !greet {
+			// Hold the connection until the client gives up
+			conn.Read(make([]byte, 1))
+			return
+		}
+
+		text := textproto.NewConn(conn)
+		var got mailbox
+		text.PrintfLine("220 localhost ESMTP fake")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch {
+			case command == "EHLO" || command == "HELO":
+				text.PrintfLine("250-localhost\r\n250 8BITMIME")
+			case strings.HasPrefix(strings.ToUpper(line), "MAIL FROM:"):
+				got.from = smtpPath(line)
+				text.PrintfLine("250 OK")
+			case strings.HasPrefix(strings.ToUpper(line), "RCPT TO:"):
+				got.to = append(got.to, smtpPath(line))
+				text.PrintfLine("250 OK")
+			case command == "DATA":
+				text.PrintfLine("354 Go ahead")
+				// ReadDotBytes turns the CRLF line endings into LF
+				data, err := text.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				got.data = string(data)
+				text.PrintfLine("250 OK")
+			case command == "QUIT":
+				text.PrintfLine("221 Bye")
+				received <- got
+				return
+			default:
+				text.PrintfLine("502 Not implemented")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+// smtpPath returns the address between < and > in a MAIL or RCPT command
+func smtpPath(line string) string {
+	_, path, _ := strings.Cut(line, "<")
+	path, _, _ = strings.Cut(path, ">")
+	return path
+}
+
+func TestSMTPNotifierSendsMail(t *testing.T) {
+	addr, received := fakeSMTPServer(t, true)
+	notifier := &SMTPNotifier{
+		Addr: addr,
+		From: "gotodo@example.com",
+		To:   []string{"alice@example.com", "bob@example.com"},
+	}
+	due := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	n := Notification{
+		Reminder: models.Reminder{ID: 7, TodoID: 3},
+		Todo:     models.Todo{ID: 3, Title: "レビュー", Description: "line one\nline two", DueDate: &due},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := notifier.Notify(ctx, n); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	var got mailbox
+	select {
+	case got = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server received no mail")
+	}
+	if got.from != "gotodo@example.com" {
+		t.Errorf("MAIL FROM = %q", got.from)
+	}
+	if strings.Join(got.to, ",") != "alice@example.com,bob@example.com" {
+		t.Errorf("RCPT TO = %q", got.to)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(got.data))
+	if err != nil {
+		t.Fatalf("invalid message %q: %v", got.data, err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("invalid subject: %v", err)
+	}
+	for header, want := range map[string]string{
+		"From":         "gotodo@example.com",
+		"To":           "alice@example.com, bob@example.com",
+		"Subject":      "Reminder: レビュー",
+		"Content-Type": "text/plain; charset=utf-8",
+	} {
+		value := msg.Header.Get(header)
+		if header == "Subject" {
+			value = subject
+		}
+		if value != want {
+			t.Errorf("%s = %q, want %q", header, value, want)
+		}
+	}
+	if _, err := msg.Header.Date(); err != nil {
+		t.Errorf("invalid Date header: %v", err)
+	}
+
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "レビュー\nDue: Sun, 01 Mar 2026 09:30:00 UTC\n\nline one\nline two\n"
+	if string(body) != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
+
+func TestSMTPNotifierStopsAtDeadline(t *testing.T) {
+	addr, _ := fakeSMTPServer(t, false)
+	notifier := &SMTPNotifier{Addr: addr, From: "gotodo@example.com", To: []string{"alice@example.com"}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := notifier.Notify(ctx, Notification{Todo: models.Todo{Title: "a"}})
+	if err == nil {
+		t.Fatal("Notify succeeded against a server that never answers")
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("err = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Notify took %v", elapsed)
+	}
+}
@@ -0,0 +1,45 @@
+package reminders
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gotodo/models"
+)
+
+func TestWebhookNotifierPostsNotification(t *testing.T) {
+	var got Notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request %s with Content-Type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("invalid body: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	n := Notification{Reminder: models.Reminder{ID: 7, TodoID: 3}, Todo: models.Todo{ID: 3, Title: "Dentist"}}
+	if err := NewWebhookNotifier(server.URL).Notify(context.Background(), n); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if got.Reminder.ID != 7 || got.Todo.ID != 3 || got.Todo.Title != "Dentist" {
+		t.Errorf("posted %+v", got)
+	}
+}
+
+func TestWebhookNotifierReportsFailedStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	err := NewWebhookNotifier(server.URL).Notify(context.Background(), Notification{})
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("err = %v, want the 503 status", err)
+	}
+}
@@ -1,3 +1,16 @@
+// Todos are loaded from the server a page at a time
+const TODO_PAGE_SIZE = 100;
+
+// The sort parameter of GET /api/todos for each option of the sort menu
+const TODO_SORT_PARAMS = {
+    smart: 'smart',
+    due_date: 'due_date,-created_at',
+    priority: '-priority,-created_at',
+    created_at: '-created_at',
+    updated_at: '-updated_at',
+    title: 'title',
+};
+
 class TodoApp {
     constructor() {
         this.todoForm = document.getElementById('todo-form');
@@ -11,17 +24,22 @@ class TodoApp {
         this.priorityFilter = document.getElementById('priority-filter');
         this.dueDateInput = document.getElementById('due-date-input');
         this.manageCategoriesBtn = document.getElementById('manage-categories');
+        this.archiveCompletedBtn = document.getElementById('archive-completed');
         this.overdueWarning = document.getElementById('overdue-warning');
         this.overdueCount = document.getElementById('overdue-count');
         this.searchInput = document.getElementById('search-input');
         this.clearSearchBtn = document.getElementById('clear-search');
+        this.searchError = document.getElementById('search-error');
         this.statusFilter = document.getElementById('status-filter');
         this.dueDateFilter = document.getElementById('due-date-filter');
         this.categoryProgress = document.getElementById('category-progress');
         this.categoryProgressList = document.getElementById('category-progress-list');
         this.sortOrder = document.getElementById('sort-order');
+        this.loadMoreBtn = document.getElementById('load-more');
         this.categories = [];
-        this.allTodos = []; // Store all todos for filtering
+        this.tags = [];
+        this.allTodos = []; // The todos loaded so far
+        this.totalTodos = 0; // How many todos match the filters on the server
         this.currentCategoryFilter = ''; // Current filter category ID
         this.currentPriorityFilter = ''; // Current filter priority
         this.currentSearchQuery = ''; // Current search query
@@ -35,25 +53,26 @@ class TodoApp {
     init() {
         this.todoForm.addEventListener('submit', (e) => this.handleSubmit(e));
         this.manageCategoriesBtn.addEventListener('click', () => this.showCategoryManager());
+        this.archiveCompletedBtn.addEventListener('click', () => this.archiveCompleted());
         this.priorityFilter.addEventListener('change', (e) => {
             this.currentPriorityFilter = e.target.value;
-            this.filterTodos();
+            this.loadTodos();
         });
         
         this.statusFilter.addEventListener('change', (e) => {
             this.currentStatusFilter = e.target.value;
-            this.filterTodos();
+            this.loadTodos();
         });
         
         this.dueDateFilter.addEventListener('change', (e) => {
             this.currentDueDateFilter = e.target.value;
-            this.filterTodos();
+            this.loadTodos();
         });
         
         this.sortOrder.addEventListener('change', (e) => {
             this.currentSortOrder = e.target.value;
             this.saveSortPreference();
-            this.filterTodos();
+            this.loadTodos();
         });
         
         // Load saved sort preference
@@ -73,8 +92,97 @@ class TodoApp {
             this.clearSearch();
         });
         
+        this.loadMoreBtn.addEventListener('click', () => this.loadTodos(true));
+        
         this.loadCategories();
+        this.loadTags();
         this.loadTodos();
+        this.connectEvents();
+    }
+    
+    // Live updates: reload when this or another client changes todos or categories
+    connectEvents() {
+        if (!window.EventSource) return;
+        
+        const source = new EventSource(withWorkspace('/api/events'));
+        let reloadTimeout;
+        let reloadCategories = false;
+        const reload = (categories) => {
+            reloadCategories = reloadCategories || categories;
+            clearTimeout(reloadTimeout);
+            reloadTimeout = setTimeout(async () => {
+                if (reloadCategories) {
+                    reloadCategories = false;
+                    // Keep the selections, which rebuilding the dropdowns resets
+                    const selectedCategory = this.categorySelect ? this.categorySelect.value : '';
+                    await this.loadCategories();
+                    if (this.categorySelect) this.categorySelect.value = selectedCategory;
+                    if (this.categoryFilter) this.categoryFilter.value = this.currentCategoryFilter;
+                }
+                this.loadTodos();
+            }, 200); // Batch bursts of events into one reload
+        };
+        
+        ['todo.created', 'todo.updated', 'todo.toggled', 'todo.deleted', 'todo.restored'].forEach(type => 
+            source.addEventListener(type, () => reload(false))
+        );
+        // "reset" means events were missed while disconnected
+        ['category.created', 'category.updated', 'category.deleted', 'reset'].forEach(type => 
+            source.addEventListener(type, () => reload(true))
+        );
+    }
+    
+    async loadTags() {
+        try {
+            const response = await fetch('/api/tags');
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+            
+            this.tags = await response.json();
+        } catch (error) {
+            console.error('Failed to load tags:', error);
+        }
+    }
+    
+    // Resolve comma separated tag names to IDs, creating tags that do not exist yet
+    async resolveTagIds(input) {
+        const names = [...new Set(input.split(',').map(name => name.trim()).filter(name => name))];
+        const ids = [];
+        for (const name of names) {
+            let tag = this.tags.find(t => t.name.toLowerCase() === name.toLowerCase());
+            if (!tag) {
+                const response = await fetch('/api/tags', {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json',
+                    },
+                    body: JSON.stringify({ name }),
+                });
+                if (!response.ok) {
+                    throw new Error(`HTTP error! status: ${response.status}`);
+                }
+                tag = await response.json();
+                this.tags.push(tag);
+            }
+            ids.push(tag.id);
+        }
+        return ids;
+    }
+    
+    // Search for todos with the given tag
+    async searchTag(id) {
+        if (!this.tags.some(tag => tag.id === id)) {
+            await this.loadTags();
+        }
+        const tag = this.tags.find(tag => tag.id === id);
+        if (!tag) return;
+        
+        const name = tag.name.replace(/"/g, '');
+        const term = /\s/.test(name) ? `tag:"${name}"` : `tag:${name}`;
+        this.searchInput.value = term;
+        this.currentSearchQuery = term;
+        this.handleSearch();
     }
     
     async loadCategories() {
@@ -127,7 +235,7 @@ class TodoApp {
         
         this.categoryFilter.addEventListener('change', (e) => {
             this.currentCategoryFilter = e.target.value;
-            this.filterTodos();
+            this.loadTodos();
         });
     }
     
@@ -185,27 +293,92 @@ class TodoApp {
         return response.json();
     }
     
-    async loadTodos() {
+    // Load the first page of todos matching the filters, or with more the
+    // next page after those already shown
+    async loadTodos(more = false) {
         try {
-            let url = '/api/todos';
-            if (this.currentSearchQuery) {
-                url += `?search=${encodeURIComponent(this.currentSearchQuery)}`;
+            const params = this.todoListParams();
+            if (more) {
+                params.set('offset', this.allTodos.length);
             }
             
-            const response = await fetch(url);
+            const response = await fetch(`/api/todos?${params}`);
+            if (response.status === 400 && this.currentSearchQuery) {
+                this.showSearchError(await response.json());
+                return;
+            }
             if (!response.ok) {
                 throw new Error(`HTTP error! status: ${response.status}`);
             }
+            this.hideSearchError();
             
             const todos = await response.json();
-            this.allTodos = todos; // Store all todos
-            this.filterTodos(); // Apply current filter
+            this.allTodos = more ? this.allTodos.concat(todos) : todos;
+            this.totalTodos = parseInt(response.headers.get('X-Total-Count') || this.allTodos.length);
+            this.renderTodos(this.allTodos);
+            this.updateStats(this.allTodos);
         } catch (error) {
             console.error('Failed to load todos:', error);
             this.showError('TODOの読み込みに失敗しました');
         }
     }
     
+    // The filters and sort order as query parameters of GET /api/todos, so
+    // that the server filters and sorts every todo rather than one page
+    todoListParams() {
+        const params = new URLSearchParams();
+        if (this.currentSearchQuery) {
+            params.set('search', this.currentSearchQuery);
+        }
+        if (this.currentCategoryFilter) {
+            params.set('category_id', this.currentCategoryFilter); // "null" for todos without a category
+        }
+        if (this.currentPriorityFilter) {
+            params.set('priority', this.currentPriorityFilter);
+        }
+        
+        switch (this.currentStatusFilter) {
+            case 'completed':
+                params.set('completed', 'true');
+                break;
+            case 'incomplete':
+                params.set('completed', 'false');
+                break;
+            case 'archived':
+                params.set('archived', 'true');
+                break;
+        }
+        
+        // Days are those of the browser's time zone
+        const now = new Date();
+        const day = (offset) => new Date(now.getFullYear(), now.getMonth(), now.getDate() + offset).toISOString();
+        switch (this.currentDueDateFilter) {
+            case 'overdue':
+                params.set('overdue', 'true');
+                break;
+            case 'today':
+                params.set('due_after', day(0));
+                params.set('due_before', day(1));
+                break;
+            case 'tomorrow':
+                params.set('due_after', day(1));
+                params.set('due_before', day(2));
+                break;
+            case 'this_week':
+                params.set('due_after', day(0));
+                params.set('due_before', day(8));
+                break;
+            case 'no_due_date':
+                params.set('has_due_date', 'false');
+                break;
+        }
+        
+        // Under smart sort, search results keep the server's relevance order
+        params.set('sort', TODO_SORT_PARAMS[this.currentSortOrder] || 'smart');
+        params.set('limit', TODO_PAGE_SIZE);
+        return params;
+    }
+    
     async handleSearch() {
         // Show/hide clear button
         if (this.currentSearchQuery) {
@@ -218,158 +391,35 @@ class TodoApp {
         await this.loadTodos();
     }
     
+    // Show a search syntax error with the offending part of the query underlined
+    showSearchError(error) {
+        const chars = Array.from(this.currentSearchQuery);
+        const start = error.position || 0;
+        const end = start + Math.max(error.length || 0, 1);
+        const before = this.escapeHtml(chars.slice(0, start).join(''));
+        const token = this.escapeHtml(chars.slice(start, end).join('') || ' ');
+        const after = this.escapeHtml(chars.slice(end).join(''));
+        
+        this.searchError.innerHTML = `
+            <span class="search-error-query">${before}<span class="search-error-token">${token}</span>${after}</span>
+            <span class="search-error-message">${this.escapeHtml(error.error)}</span>
+        `;
+        this.searchError.style.display = 'block';
+    }
+    
+    hideSearchError() {
+        this.searchError.style.display = 'none';
+        this.searchError.innerHTML = '';
+    }
+    
     clearSearch() {
+        this.hideSearchError();
         this.currentSearchQuery = '';
         this.searchInput.value = '';
         this.clearSearchBtn.style.display = 'none';
         this.loadTodos();
     }
     
-    filterTodos() {
-        let filteredTodos = this.allTodos;
-        
-        // Apply category filter
-        if (this.currentCategoryFilter === 'null') {
-            // Show only todos without category
-            filteredTodos = filteredTodos.filter(todo => !todo.category_id);
-        } else if (this.currentCategoryFilter && this.currentCategoryFilter !== '') {
-            // Show only todos with specific category
-            const categoryId = parseInt(this.currentCategoryFilter);
-            filteredTodos = filteredTodos.filter(todo => todo.category_id === categoryId);
-        }
-        
-        // Apply priority filter
-        if (this.currentPriorityFilter && this.currentPriorityFilter !== '') {
-            const priority = parseInt(this.currentPriorityFilter);
-            filteredTodos = filteredTodos.filter(todo => todo.priority === priority);
-        }
-        
-        // Apply status filter
-        if (this.currentStatusFilter && this.currentStatusFilter !== '') {
-            if (this.currentStatusFilter === 'completed') {
-                filteredTodos = filteredTodos.filter(todo => todo.completed);
-            } else if (this.currentStatusFilter === 'incomplete') {
-                filteredTodos = filteredTodos.filter(todo => !todo.completed);
-            }
-        }
-        
-        // Apply due date filter
-        if (this.currentDueDateFilter && this.currentDueDateFilter !== '') {
-            const now = new Date();
-            const today = new Date(now.getFullYear(), now.getMonth(), now.getDate());
-            const tomorrow = new Date(today);
-            tomorrow.setDate(tomorrow.getDate() + 1);
-            const weekEnd = new Date(today);
-            weekEnd.setDate(weekEnd.getDate() + 7);
-            
-            filteredTodos = filteredTodos.filter(todo => {
-                if (this.currentDueDateFilter === 'no_due_date') {
-                    return !todo.due_date;
-                }
-                
-                if (!todo.due_date) return false;
-                
-                const dueDate = new Date(todo.due_date);
-                const dueDateOnly = new Date(dueDate.getFullYear(), dueDate.getMonth(), dueDate.getDate());
-                
-                switch (this.currentDueDateFilter) {
-                    case 'overdue':
-                        return dueDate < now;
-                    case 'today':
-                        return dueDateOnly.getTime() === today.getTime();
-                    case 'tomorrow':
-                        return dueDateOnly.getTime() === tomorrow.getTime();
-                    case 'this_week':
-                        return dueDateOnly >= today && dueDateOnly <= weekEnd;
-                    default:
-                        return true;
-                }
-            });
-        }
-        
-        // Apply sorting
-        filteredTodos = this.sortTodos(filteredTodos);
-        
-        this.renderTodos(filteredTodos);
-        this.updateStats(filteredTodos);
-    }
-    
-    sortTodos(todos) {
-        if (!todos || todos.length === 0) return todos;
-        
-        const sortedTodos = [...todos]; // Create a copy to avoid mutating original array
-        
-        switch (this.currentSortOrder) {
-            case 'smart':
-                // Smart sort: completed status -> overdue priority -> due date -> priority -> created date
-                return sortedTodos.sort((a, b) => {
-                    // First by completion status
-                    if (a.completed !== b.completed) {
-                        return a.completed ? 1 : -1;
-                    }
-                    
-                    // Then by overdue status (for incomplete items)
-                    if (!a.completed && !b.completed) {
-                        const aOverdue = a.due_date && this.isOverdue(a.due_date);
-                        const bOverdue = b.due_date && this.isOverdue(b.due_date);
-                        
-                        if (aOverdue !== bOverdue) {
-                            return aOverdue ? -1 : 1;
-                        }
-                        
-                        // Then by due date
-                        if (a.due_date && b.due_date) {
-                            return new Date(a.due_date) - new Date(b.due_date);
-                        } else if (a.due_date) {
-                            return -1;
-                        } else if (b.due_date) {
-                            return 1;
-                        }
-                    }
-                    
-                    // Then by priority (high to low)
-                    if (a.priority !== b.priority) {
-                        return b.priority - a.priority;
-                    }
-                    
-                    // Finally by created date (newest first)
-                    return new Date(b.created_at) - new Date(a.created_at);
-                });
-                
-            case 'due_date':
-                return sortedTodos.sort((a, b) => {
-                    if (a.due_date && b.due_date) {
-                        return new Date(a.due_date) - new Date(b.due_date);
-                    } else if (a.due_date) {
-                        return -1;
-                    } else if (b.due_date) {
-                        return 1;
-                    }
-                    return new Date(b.created_at) - new Date(a.created_at);
-                });
-                
-            case 'priority':
-                return sortedTodos.sort((a, b) => {
-                    if (a.priority !== b.priority) {
-                        return b.priority - a.priority;
-                    }
-                    return new Date(b.created_at) - new Date(a.created_at);
-                });
-                
-            case 'created_at':
-                return sortedTodos.sort((a, b) => new Date(b.created_at) - new Date(a.created_at));
-                
-            case 'updated_at':
-                return sortedTodos.sort((a, b) => new Date(b.updated_at) - new Date(a.updated_at));
-                
-            case 'title':
-                return sortedTodos.sort((a, b) => a.title.localeCompare(b.title, 'ja'));
-                
-            default:
-                return sortedTodos;
-        }
-    }
-    
     saveSortPreference() {
         localStorage.setItem('gotodo_sort_order', this.currentSortOrder);
     }
@@ -383,6 +433,7 @@ class TodoApp {
     }
     
     renderTodos(todos) {
+        this.loadMoreBtn.style.display = todos && todos.length < this.totalTodos ? 'block' : 'none';
         if (!todos || todos.length === 0) {
             this.todoList.innerHTML = `
                 <div class="empty-state">
@@ -412,6 +463,20 @@ class TodoApp {
         const priorityInfo = this.getPriorityInfo(todo.priority);
         const priorityBadge = `<span class="priority-badge priority-${priorityInfo.level}" title="優先度: ${priorityInfo.name}">${priorityInfo.icon}</span>`;
         
+        const tagBadges = (todo.tags || []).map(tag => 
+            `<span class="tag-badge" style="border-color: ${tag.color}; color: ${tag.color}" onclick="todoApp.searchTag(${tag.id})">#${this.escapeHtml(tag.name)}</span>`
+        ).join('');
+        
+        // Subtask progress (done/total)
+        const progressBadge = todo.progress ? 
+            `<span class="subtask-progress" title="サブタスク">☑ ${todo.progress.done}/${todo.progress.total}</span>` : 
+            '';
+        
+        // Recurrence rule of a recurring todo
+        const recurrenceBadge = todo.recurrence ? 
+            `<span class="recurrence-badge" title="繰り返し: ${this.escapeHtml(todo.recurrence)}">🔁</span>` : 
+            '';
+        
         return `
             <div class="todo-item ${completedClass} ${overdueClass}" data-id="${todo.id}">
                 <input 
@@ -424,11 +489,14 @@ class TodoApp {
                     <div class="todo-header">
                         ${priorityBadge}
                         <div class="todo-title" onclick="todoApp.editTodo(${todo.id})">
-                            ${this.escapeHtml(todo.title)}
+                            ${todo.match ? this.highlightHtml(todo.match.title) : this.escapeHtml(todo.title)}
                         </div>
                         ${categoryBadge}
+                        ${tagBadges}
+                        ${progressBadge}
+                        ${recurrenceBadge}
                     </div>
-                    ${todo.description ? `<div class="todo-description">${this.escapeHtml(todo.description)}</div>` : ''}
+                    ${todo.description ? `<div class="todo-description">${todo.match && todo.match.description ? this.highlightHtml(todo.match.description) : this.escapeHtml(todo.description)}</div>` : ''}
                     <div class="todo-dates">
                         ${todo.due_date ? `<span class="todo-due-date ${this.getDueDateClass(todo.due_date, todo.completed)}">期限: ${this.formatDueDate(todo.due_date)}</span>` : ''}
                         <span class="todo-date">作成: ${createdAt}</span>
@@ -436,6 +504,13 @@ class TodoApp {
                     </div>
                 </div>
                 <div class="todo-actions">
+                    ${todo.archived_at ? `<button 
+                        class="todo-edit" 
+                        onclick="todoApp.unarchiveTodo(${todo.id})"
+                        title="アーカイブから戻す"
+                    >
+                        📤
+                    </button>` : ''}
                     <button 
                         class="todo-edit" 
                         onclick="todoApp.editTodo(${todo.id})"
@@ -472,29 +547,117 @@ class TodoApp {
         }
     }
     
+    // Deleted todos go to the trash, so there is no confirmation but an undo
     async deleteTodo(id) {
-        if (!confirm('このTODOを削除しますか？')) {
-            return;
-        }
-        
         try {
-            const response = await fetch(`/api/todos/${id}`, {
+            let response = await fetch(`/api/todos/${id}`, {
                 method: 'DELETE',
             });
             
+            // A todo with subtasks is only deleted together with them
+            if (response.status === 409) {
+                if (!confirm('このTODOにはサブタスクがあります。サブタスクもまとめて削除しますか？')) {
+                    return;
+                }
+                response = await fetch(`/api/todos/${id}?cascade=true`, {
+                    method: 'DELETE',
+                });
+            }
+            
             if (!response.ok) {
                 throw new Error(`HTTP error! status: ${response.status}`);
             }
             
             this.loadTodos();
+            this.showUndo('TODOをゴミ箱に移動しました', () => this.restoreTodo(id));
         } catch (error) {
             console.error('Failed to delete todo:', error);
             alert('TODOの削除に失敗しました');
         }
     }
     
+    // Archive the completed todos, only those of the selected category if any
+    async archiveCompleted() {
+        const categoryId = parseInt(this.currentCategoryFilter);
+        const body = isNaN(categoryId) ? {} : { category_id: categoryId };
+        if (!confirm(isNaN(categoryId) ? '完了済みのTODOをすべてアーカイブしますか？' : 'このカテゴリの完了済みのTODOをアーカイブしますか？')) {
+            return;
+        }
+        
+        try {
+            const response = await fetch('/api/todos/archive', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify(body),
+            });
+            
+            if (!response.ok) {
+                throw new Error(await response.text());
+            }
+            
+            const archived = await response.json();
+            alert(`${archived.length}件のTODOをアーカイブしました`);
+            this.loadTodos();
+        } catch (error) {
+            console.error('Failed to archive todos:', error);
+            alert('アーカイブに失敗しました: ' + error.message);
+        }
+    }
+    
+    async unarchiveTodo(id) {
+        try {
+            const response = await fetch(`/api/todos/${id}/unarchive`, {
+                method: 'POST',
+            });
+            
+            if (!response.ok) {
+                throw new Error(await response.text());
+            }
+            
+            this.loadTodos();
+        } catch (error) {
+            console.error('Failed to unarchive todo:', error);
+            alert('アーカイブから戻せませんでした: ' + error.message);
+        }
+    }
+    
+    async restoreTodo(id) {
+        try {
+            const response = await fetch(`/api/trash/${id}/restore`, {
+                method: 'POST',
+            });
+            
+            if (!response.ok) {
+                throw new Error(await response.text());
+            }
+            
+            this.loadTodos();
+        } catch (error) {
+            console.error('Failed to restore todo:', error);
+            alert('TODOを元に戻せませんでした: ' + error.message);
+        }
+    }
+    
+    // Show a message with an undo button for a few seconds
+    showUndo(message, undo) {
+        document.querySelector('.undo-toast')?.remove();
+        
+        const toast = document.createElement('div');
+        toast.className = 'undo-toast';
+        toast.innerHTML = `<span>${this.escapeHtml(message)}</span><button type="button">元に戻す</button>`;
+        const timeout = setTimeout(() => toast.remove(), 8000);
+        toast.querySelector('button').addEventListener('click', () => {
+            clearTimeout(timeout);
+            toast.remove();
+            undo();
+        });
+        document.body.appendChild(toast);
+    }
+    
     updateStats(todos) {
-        const total = todos ? todos.length : 0;
+        const total = this.totalTodos;
         const completed = todos ? todos.filter(todo => todo.completed).length : 0;
         
         // Count overdue items (only among incomplete todos)
@@ -609,7 +772,8 @@ class TodoApp {
     
     async getTodos() {
         try {
-            const response = await fetch('/api/todos');
+            const archived = this.currentStatusFilter === 'archived';
+            const response = await fetch(`/api/todos?archived=${archived}`);
             if (!response.ok) {
                 throw new Error(`HTTP error! status: ${response.status}`);
             }
@@ -649,6 +813,10 @@ class TodoApp {
                                 ${categoryOptions}
                             </select>
                         </div>
+                        <div class="form-group">
+                            <label for="edit-tags">タグ</label>
+                            <input type="text" id="edit-tags" value="${this.escapeHtml((todo.tags || []).map(tag => tag.name).join(', '))}" placeholder="カンマ区切り（例: blocked, customer-x）">
+                        </div>
                         <div class="form-group">
                             <label for="edit-priority">優先度</label>
                             <select id="edit-priority" class="priority-select">
@@ -661,6 +829,10 @@ class TodoApp {
                             <label for="edit-due-date">期限</label>
                             <input type="datetime-local" id="edit-due-date" value="${todo.due_date ? this.formatDateForInput(todo.due_date) : ''}" title="期限を設定（任意）">
                         </div>
+                        <div class="form-group">
+                            <label for="edit-recurrence">繰り返し</label>
+                            <input type="text" id="edit-recurrence" value="${this.escapeHtml(todo.recurrence || '')}" placeholder="例: FREQ=WEEKLY;BYDAY=MO,FR">
+                        </div>
                         <div class="form-actions">
                             <button type="button" onclick="todoApp.closeEditModal()">キャンセル</button>
                             <button type="submit">保存</button>
@@ -676,14 +848,14 @@ class TodoApp {
         // Add event listener for form submission
         document.getElementById('edit-form').addEventListener('submit', (e) => {
             e.preventDefault();
-            this.saveEdit(todo.id);
+            this.saveEdit(todo.id, todo.version);
         });
         
         // Focus on title input
         document.getElementById('edit-title').focus();
     }
     
-    async saveEdit(id) {
+    async saveEdit(id, version) {
         const title = document.getElementById('edit-title').value.trim();
         const description = document.getElementById('edit-description').value.trim();
         const categorySelect = document.getElementById('edit-category');
@@ -692,13 +864,15 @@ class TodoApp {
         const priority = prioritySelect.value ? parseInt(prioritySelect.value) : 1;
         const dueDateInput = document.getElementById('edit-due-date');
         const dueDate = dueDateInput.value || null;
+        const tagInput = document.getElementById('edit-tags').value;
+        const recurrence = document.getElementById('edit-recurrence').value.trim();
         
         if (!title) {
             alert('タイトルは必須です');
             return;
         }
         
-        const body = { title, description };
+        const body = { title, description, recurrence };
         if (categoryId !== null) {
             body.category_id = categoryId;
         }
@@ -710,14 +884,27 @@ class TodoApp {
         }
         
         try {
+            body.tag_ids = await this.resolveTagIds(tagInput);
+            
             const response = await fetch(`/api/todos/${id}`, {
                 method: 'PUT',
                 headers: {
                     'Content-Type': 'application/json',
+                    'If-Match': `"${version}"`,
                 },
                 body: JSON.stringify(body),
             });
             
+            // Someone else saved the todo since the form was opened
+            if (response.status === 412) {
+                const current = await response.json();
+                alert('このTODOは他の場所で更新されました。最新の内容を表示します');
+                this.closeEditModal();
+                this.loadTodos();
+                this.showEditModal(current);
+                return;
+            }
+            
             if (!response.ok) {
                 throw new Error(`HTTP error! status: ${response.status}`);
             }
@@ -988,9 +1175,268 @@ class TodoApp {
         div.textContent = text || '';
         return div.innerHTML;
     }
+    
+    // Escape search highlights from the API while keeping their <mark> tags
+    highlightHtml(text) {
+        return this.escapeHtml(text)
+            .replace(/&lt;mark&gt;/g, '<mark>')
+            .replace(/&lt;\/mark&gt;/g, '</mark>');
+    }
+}
+
+// Auth shows the login form until there is a signed-in user, then starts the app
+class Auth {
+    constructor() {
+        this.overlay = document.getElementById('auth-overlay');
+        this.form = document.getElementById('auth-form');
+        this.title = document.getElementById('auth-title');
+        this.username = document.getElementById('auth-username');
+        this.password = document.getElementById('auth-password');
+        this.error = document.getElementById('auth-error');
+        this.submit = document.getElementById('auth-submit');
+        this.switchButton = document.getElementById('auth-switch');
+        this.registering = false;
+
+        this.form.addEventListener('submit', (e) => this.handleSubmit(e));
+        this.switchButton.addEventListener('click', () => this.setMode(!this.registering));
+        document.getElementById('logout-btn').addEventListener('click', () => this.logout());
+    }
+
+    async start() {
+        try {
+            const response = await fetch('/api/auth/me');
+            if (response.ok) {
+                this.signedIn(await response.json());
+                return;
+            }
+        } catch (error) {
+            console.error('Error checking session:', error);
+        }
+        this.showForm();
+    }
+
+    setMode(registering) {
+        this.registering = registering;
+        this.title.textContent = registering ? 'アカウント作成' : 'ログイン';
+        this.submit.textContent = registering ? '作成' : 'ログイン';
+        this.switchButton.textContent = registering ? 'ログインに戻る' : 'アカウントを作成する';
+        this.password.autocomplete = registering ? 'new-password' : 'current-password';
+        this.error.style.display = 'none';
+    }
+
+    async showForm() {
+        this.overlay.style.display = 'flex';
+        this.username.focus();
+
+        try {
+            const response = await fetch('/api/auth/methods');
+            const methods = await response.json();
+            document.getElementById('auth-sso').style.display = methods.oidc ? 'block' : 'none';
+        } catch (error) {
+            console.error('Error loading sign-in methods:', error);
+        }
+    }
+
+    async handleSubmit(e) {
+        e.preventDefault();
+
+        const endpoint = this.registering ? '/api/auth/register' : '/api/auth/login';
+        try {
+            const response = await fetch(endpoint, {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({
+                    username: this.username.value.trim(),
+                    password: this.password.value
+                })
+            });
+            if (!response.ok) {
+                this.error.textContent = (await response.text()).trim();
+                this.error.style.display = 'block';
+                return;
+            }
+            this.password.value = '';
+            this.signedIn(await response.json());
+        } catch (error) {
+            console.error('Error signing in:', error);
+            this.error.textContent = 'サーバーに接続できませんでした';
+            this.error.style.display = 'block';
+        }
+    }
+
+    async signedIn(user) {
+        // After the session expired mid-way, start over with the new user's data
+        if (window.todoApp) {
+            location.reload();
+            return;
+        }
+
+        this.overlay.style.display = 'none';
+        document.getElementById('current-user').textContent = user.username;
+        document.getElementById('user-bar').style.display = 'flex';
+        await window.workspaces.start();
+        window.todoApp = new TodoApp();
+    }
+
+    async logout() {
+        try {
+            await fetch('/api/auth/logout', { method: 'POST' });
+        } catch (error) {
+            console.error('Error signing out:', error);
+        }
+        location.reload();
+    }
+}
+
+// The workspace whose todos the app shows; '' for the personal ones
+const WORKSPACE_KEY = 'gotodo_workspace';
+
+// withWorkspace adds the current workspace to the URL of an API route that
+// works on todos, categories or tags
+function withWorkspace(url) {
+    const workspace = localStorage.getItem(WORKSPACE_KEY);
+    if (!workspace || !url.startsWith('/api/') || /^\/api\/(auth|tokens|workspaces|webhooks)(\/|\?|$)/.test(url)) {
+        return url;
+    }
+    return url + (url.includes('?') ? '&' : '?') + 'workspace=' + encodeURIComponent(workspace);
+}
+
+// Workspaces runs the workspace switcher and joins workspaces from invitation links
+class Workspaces {
+    constructor() {
+        this.select = document.getElementById('workspace-select');
+        this.inviteButton = document.getElementById('invite-btn');
+        this.workspaces = [];
+
+        this.select.addEventListener('change', () => this.switchTo(this.select.value));
+        document.getElementById('new-workspace-btn').addEventListener('click', () => this.create());
+        this.inviteButton.addEventListener('click', () => this.invite());
+    }
+
+    async start() {
+        // Opening an invitation link joins its workspace and switches to it
+        const params = new URLSearchParams(location.search);
+        const invite = params.get('invite');
+        if (invite) {
+            history.replaceState(null, '', location.pathname);
+            try {
+                const response = await fetch('/api/workspaces/join', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ token: invite })
+                });
+                if (!response.ok) {
+                    throw new Error((await response.text()).trim());
+                }
+                const workspace = await response.json();
+                localStorage.setItem(WORKSPACE_KEY, workspace.id);
+            } catch (error) {
+                console.error('Error joining workspace:', error);
+                alert('ワークスペースに参加できませんでした: ' + error.message);
+            }
+        }
+
+        await this.load();
+    }
+
+    async load() {
+        try {
+            const response = await fetch('/api/workspaces');
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+            this.workspaces = await response.json();
+        } catch (error) {
+            console.error('Failed to load workspaces:', error);
+        }
+
+        // Fall back to the personal todos when the saved workspace is gone
+        const current = localStorage.getItem(WORKSPACE_KEY) || '';
+        const workspace = this.workspaces.find(w => String(w.id) === current);
+        if (current && !workspace) {
+            localStorage.removeItem(WORKSPACE_KEY);
+        }
+
+        this.select.innerHTML = '<option value="">個人</option>';
+        this.workspaces.forEach(w => {
+            const option = document.createElement('option');
+            option.value = w.id;
+            option.textContent = w.role === 'viewer' ? `${w.name}（閲覧のみ）` : w.name;
+            this.select.appendChild(option);
+        });
+        this.select.value = workspace ? current : '';
+        this.inviteButton.style.display = workspace && workspace.role === 'owner' ? 'inline-block' : 'none';
+    }
+
+    switchTo(id) {
+        if (id) {
+            localStorage.setItem(WORKSPACE_KEY, id);
+        } else {
+            localStorage.removeItem(WORKSPACE_KEY);
+        }
+        location.reload();
+    }
+
+    async create() {
+        const name = prompt('新しいワークスペースの名前');
+        if (!name || !name.trim()) return;
+
+        try {
+            const response = await fetch('/api/workspaces', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ name: name.trim() })
+            });
+            if (!response.ok) {
+                throw new Error((await response.text()).trim());
+            }
+            const workspace = await response.json();
+            this.switchTo(String(workspace.id));
+        } catch (error) {
+            console.error('Error creating workspace:', error);
+            alert('ワークスペースの作成に失敗しました: ' + error.message);
+        }
+    }
+
+    async invite() {
+        const role = confirm('編集できるメンバーとして招待しますか？\n（キャンセルで閲覧のみのメンバー）') ? 'editor' : 'viewer';
+
+        try {
+            const response = await fetch(`/api/workspaces/${this.select.value}/invitations`, {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ role })
+            });
+            if (!response.ok) {
+                throw new Error((await response.text()).trim());
+            }
+            const invitation = await response.json();
+            prompt('このリンクを共有してください（7日間有効）', invitation.url);
+        } catch (error) {
+            console.error('Error creating invitation:', error);
+            alert('招待リンクの作成に失敗しました: ' + error.message);
+        }
+    }
 }
 
 // Initialize the app when the DOM is loaded
 document.addEventListener('DOMContentLoaded', () => {
-    window.todoApp = new TodoApp();
+    const auth = new Auth();
+    window.workspaces = new Workspaces();
+
+    // Show the login form again when the session expires; requests for todos,
+    // categories and tags go to the current workspace
+    const apiFetch = window.fetch.bind(window);
+    window.fetch = async (resource, options) => {
+        if (typeof resource === 'string') {
+            resource = withWorkspace(resource);
+        }
+        const response = await apiFetch(resource, options);
+        if (response.status === 401 && !String(resource).startsWith('/api/auth/')) {
+            auth.showForm();
+        }
+        return response;
+    };
+
+    auth.start();
 });
\ No newline at end of file
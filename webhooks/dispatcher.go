@@ -0,0 +1,243 @@
+// Package webhooks delivers API events to the webhooks subscribed to them.
+//
+// Every payload is the JSON encoding of an events.Event, signed with the
+// webhook's secret: the X-Gotodo-Signature header holds "sha256=" followed by
+// the hex HMAC-SHA256 of the request body.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"gotodo/events"
+	"gotodo/models"
+)
+
+// Request headers sent with every delivery
+const (
+	SignatureHeader = "X-Gotodo-Signature"
+	EventHeader     = "X-Gotodo-Event"
+	DeliveryHeader  = "X-Gotodo-Delivery" // the event ID, the same for every attempt, for deduplication
+)
+
+// Dispatcher posts events to webhooks in the background. A delivery fails
+// on a network error or a status outside 2xx and is retried with exponential
+// backoff: BaseDelay, twice that, and so on, up to MaxAttempts attempts.
+// Pending retries are lost when the server stops.
+//
+// Webhook URLs are chosen by users, so unless AllowPrivateNetworks is set
+// the dispatcher refuses to connect to loopback, private, link-local and
+// other non-public addresses, whatever name resolves to them.
+type Dispatcher struct {
+	store       models.WebhookRepository
+	workspaces  models.WorkspaceRepository
+	client      *http.Client
+	MaxAttempts int
+	BaseDelay   time.Duration
+
+	AllowPrivateNetworks bool
+}
+
+// NewDispatcher creates a Dispatcher making up to 6 attempts over about 30
+// seconds. The events of a workspace go to the webhooks of its members.
+func NewDispatcher(store models.WebhookRepository, workspaces models.WorkspaceRepository) *Dispatcher {
+	d := &Dispatcher{
+		store:       store,
+		workspaces:  workspaces,
+		MaxAttempts: 6,
+		BaseDelay:   time.Second,
+	}
+	// The addresses are checked as they are dialed, after DNS resolution, so
+	// that a name cannot resolve to a public address when the webhook is
+	// saved and to an internal one when it is called. Without a proxy every
+	// connection, redirects included, goes through this check.
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: d.checkAddress}
+	d.client = &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+	return d
+}
+
+// nonPublicPrefixes are the ranges besides loopback, private, link-local,
+// multicast and unspecified addresses that webhooks may not connect to
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved, and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, which can reach any IPv4 address
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+	netip.MustParsePrefix("2002::/16"),      // 6to4, which embeds an IPv4 address
+}
+
+// checkAddress refuses connections to addresses that are not public, unless
+// AllowPrivateNetworks is set; it is the Control function of the dialer
+func (d *Dispatcher) checkAddress(network, address string, conn syscall.RawConn) error {
+	if d.AllowPrivateNetworks {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("invalid webhook address %q: %w", host, err)
+	}
+	if !publicAddr(ip) {
+		return fmt.Errorf("webhook address %s is not public", ip)
+	}
+	return nil
+}
+
+// publicAddr reports whether ip is an address on the public internet
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Subscribe dispatches every event published on bus until the returned
+// function is called
+func (d *Dispatcher) Subscribe(bus *events.Bus) (unsubscribe func()) {
+	return bus.Subscribe(func(event events.Event) {
+		go d.Dispatch(event)
+	})
+}
+
+// Dispatch starts delivering an event to every active webhook subscribed to
+// its type of its user or, for a change to a workspace, of every member of
+// the workspace
+func (d *Dispatcher) Dispatch(event events.Event) {
+	userIDs := []int{event.UserID}
+	if event.WorkspaceID != 0 {
+		members, err := d.workspaces.Members(event.WorkspaceID)
+		if err != nil {
+			log.Printf("Error getting members of workspace %d: %v", event.WorkspaceID, err)
+			return
+		}
+		userIDs = userIDs[:0]
+		for _, member := range members {
+			userIDs = append(userIDs, member.UserID)
+		}
+	}
+
+	var webhooks []models.Webhook
+	for _, userID := range userIDs {
+		subscribers, err := d.store.ForUser(userID).Subscribers(event.Type)
+		if err != nil {
+			log.Printf("Error getting webhooks for %s: %v", event.Type, err)
+			return
+		}
+		webhooks = append(webhooks, subscribers...)
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", event.Type, err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		go d.deliver(webhook, event, payload)
+	}
+}
+
+// deliver posts payload to a webhook until it succeeds or runs out of attempts
+func (d *Dispatcher) deliver(webhook models.Webhook, event events.Event, payload []byte) {
+	delay := d.BaseDelay
+	for attempt := 1; attempt <= d.MaxAttempts; attempt++ {
+		statusCode, err := d.post(webhook, event, payload)
+
+		delivery := models.WebhookDelivery{
+			WebhookID: webhook.ID,
+			EventID:   event.ID,
+			EventType: event.Type,
+			Attempt:   attempt,
+			Success:   err == nil,
+			Payload:   payload,
+		}
+		if statusCode != 0 {
+			delivery.StatusCode = &statusCode
+		}
+		if err != nil {
+			message := err.Error()
+			delivery.Error = &message
+		}
+		if err := d.store.AddDelivery(delivery); err != nil {
+			log.Printf("Error recording webhook delivery: %v", err)
+		}
+
+		if delivery.Success {
+			return
+		}
+		if attempt < d.MaxAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	log.Printf("Giving up delivering %s event %d to webhook %d", event.Type, event.ID, webhook.ID)
+}
+
+// post makes a single delivery attempt, returning the response status if any
+func (d *Dispatcher) post(webhook models.Webhook, event events.Event, payload []byte) (int, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gotodo-webhooks")
+	req.Header.Set(EventHeader, event.Type)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(event.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the X-Gotodo-Signature value of body for secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,227 @@
+package webhooks
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gotodo/events"
+	"gotodo/models"
+)
+
+// request is what a test webhook received in one delivery
+type request struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// webhookServer answers deliveries with the given statuses in turn, then
+// with 200, and reports each request on the returned channel. It listens on
+// 127.0.0.1, so dispatchers posting to it need AllowPrivateNetworks.
+func webhookServer(t *testing.T, statuses ...int) (*httptest.Server, <-chan request) {
+	t.Helper()
+	received := make(chan request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- request{path: r.URL.Path, header: r.Header, body: body}
+		if len(statuses) > 0 {
+			w.WriteHeader(statuses[0])
+			statuses = statuses[1:]
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+// nextRequest waits for the next delivery to a webhookServer
+func nextRequest(t *testing.T, received <-chan request) request {
+	t.Helper()
+	select {
+	case r := <-received:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("the webhook received no request")
+		return request{}
+	}
+}
+
+func TestDispatcherDeliversSignedEvents(t *testing.T) {
+	server, received := webhookServer(t)
+	store := models.NewMemoryWebhookStore(models.NewMemoryDB())
+	if _, err := store.ForUser(1).Create(server.URL, []string{"todo.*"}, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(store, nil)
+	d.AllowPrivateNetworks = true
+	bus := events.NewBus()
+	defer d.Subscribe(bus)()
+
+	// Only subscribed event types of the webhook's user are delivered
+	bus.Publish(1, 0, events.CategoryCreated, map[string]int{"id": 2})
+	bus.Publish(2, 0, events.TodoCreated, map[string]int{"id": 3})
+	event := bus.Publish(1, 0, events.TodoCreated, map[string]int{"id": 1})
+
+	r := nextRequest(t, received)
+	if got := r.header.Get(EventHeader); got != events.TodoCreated {
+		t.Errorf("%s = %q", EventHeader, got)
+	}
+	if got := r.header.Get(DeliveryHeader); got != strconv.FormatInt(event.ID, 10) {
+		t.Errorf("%s = %q, want %d", DeliveryHeader, got, event.ID)
+	}
+	if got := r.header.Get(SignatureHeader); got != Sign("secret", r.body) {
+		t.Errorf("%s = %q, want %q", SignatureHeader, got, Sign("secret", r.body))
+	}
+	select {
+	case r := <-received:
+		t.Errorf("unexpected delivery of %s", r.header.Get(EventHeader))
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDispatcherRetriesFailedDeliveries(t *testing.T) {
+	server, received := webhookServer(t, http.StatusInternalServerError, http.StatusBadGateway)
+	store := models.NewMemoryWebhookStore(models.NewMemoryDB()).ForUser(1)
+	webhook, err := store.Create(server.URL, nil, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(store, nil)
+	d.AllowPrivateNetworks = true
+	d.BaseDelay = time.Millisecond
+
+	d.Dispatch(events.Event{ID: 1, UserID: 1, Type: events.TodoCreated})
+	for i := 0; i < 3; i++ {
+		if r := nextRequest(t, received); r.header.Get(DeliveryHeader) != "1" {
+			t.Errorf("attempt %d has %s %q", i+1, DeliveryHeader, r.header.Get(DeliveryHeader))
+		}
+	}
+
+	// The delivery log ends with the successful third attempt
+	var deliveries []models.WebhookDelivery
+	for start := time.Now(); len(deliveries) < 3 && time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if deliveries, err = store.Deliveries(webhook.ID, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(deliveries) != 3 {
+		t.Fatalf("recorded %d deliveries, want 3", len(deliveries))
+	}
+	for _, delivery := range deliveries {
+		if delivery.Success != (delivery.Attempt == 3) {
+			t.Errorf("attempt %d: success %v, status %v", delivery.Attempt, delivery.Success, delivery.StatusCode)
+		}
+	}
+}
+
+func TestDispatcherDeliversWorkspaceEventsToMembers(t *testing.T) {
+	server, received := webhookServer(t)
+	db := models.NewMemoryDB()
+	store := models.NewMemoryWebhookStore(db)
+	workspaces := models.NewMemoryWorkspaceStore(db)
+
+	// Users 1 and 2 share a workspace; user 3 is not a member
+	users := models.NewMemoryUserStore(db)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if _, err := users.Create(name, "hash"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	workspace, err := workspaces.Create(1, "Family")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := workspaces.CreateInvitation(workspace.ID, "token", models.RoleEditor, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := workspaces.Join("token", 2, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	for userID := 1; userID <= 3; userID++ {
+		if _, err := store.ForUser(userID).Create(server.URL+"/user"+strconv.Itoa(userID), nil, "secret"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := NewDispatcher(store, workspaces)
+	d.AllowPrivateNetworks = true
+	d.Dispatch(events.Event{ID: 1, UserID: 2, WorkspaceID: workspace.ID, Type: events.TodoCreated})
+
+	paths := []string{nextRequest(t, received).path, nextRequest(t, received).path}
+	sort.Strings(paths)
+	if strings.Join(paths, ",") != "/user1,/user2" {
+		t.Errorf("delivered to %v, want the webhooks of users 1 and 2", paths)
+	}
+	select {
+	case r := <-received:
+		t.Errorf("unexpected delivery to %s", r.path)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPublicAddr(t *testing.T) {
+	for address, want := range map[string]bool{
+		"93.184.215.14":        true,
+		"2606:2800:21f:cb07::": true,
+		"127.0.0.1":            false,
+		"::1":                  false,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false, // cloud metadata
+		"fe80::1":              false,
+		"fd00::1":              false,
+		"0.0.0.0":              false,
+		"::":                   false,
+		"100.64.0.1":           false,
+		"::ffff:127.0.0.1":     false,
+		"::ffff:10.0.0.1":      false,
+		"64:ff9b::a9fe:a9fe":   false,
+		"224.0.0.1":            false,
+		"255.255.255.255":      false,
+	} {
+		if got := publicAddr(netip.MustParseAddr(address)); got != want {
+			t.Errorf("publicAddr(%s) = %v, want %v", address, got, want)
+		}
+	}
+}
+
+func TestDispatcherRefusesPrivateAddresses(t *testing.T) {
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(nil, nil)
+	webhook := models.Webhook{ID: 1, URL: server.URL, Secret: "secret"}
+	event := events.Event{ID: 1, Type: events.TodoCreated}
+
+	// The test server listens on 127.0.0.1; a name resolving to it is
+	// refused the same way
+	for _, url := range []string{server.URL, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)} {
+		webhook.URL = url
+		if _, err := d.post(webhook, event, []byte("{}")); err == nil || !strings.Contains(err.Error(), "is not public") {
+			t.Errorf("post to %s: err = %v, want a refused address", url, err)
+		}
+	}
+	if n := received.Load(); n != 0 {
+		t.Fatalf("the server received %d requests", n)
+	}
+
+	d.AllowPrivateNetworks = true
+	webhook.URL = server.URL
+	if status, err := d.post(webhook, event, []byte("{}")); err != nil || status != http.StatusOK {
+		t.Errorf("post with AllowPrivateNetworks: status %d, err %v", status, err)
+	}
+	if n := received.Load(); n != 1 {
+		t.Errorf("the server received %d requests, want 1", n)
+	}
+}